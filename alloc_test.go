@@ -0,0 +1,46 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+//go:build !race
+
+// The race detector drops items of sync.Pool randomly, thus allocations are not stable.
+
+package flv
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestDecoderDecodeAllocs(t *testing.T) {
+	dec := newBenchDecoder(t, 4096)
+
+	var flvTag tag.FlvTag
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := decodeAndReadPayload(dec, &flvTag); err != nil {
+			t.Fatal(err)
+		}
+	})
+	require.Equal(t, float64(0), allocs)
+}
+
+func TestEncoderEncodeAllocs(t *testing.T) {
+	enc, err := NewEncoder(io.Discard, FlagsVideo)
+	require.Nil(t, err)
+
+	flvTag := newBenchTag(make([]byte, 4096))
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := enc.Encode(flvTag); err != nil {
+			t.Fatal(err)
+		}
+	})
+	require.Equal(t, float64(0), allocs)
+}
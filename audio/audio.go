@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package audio converts legacy FLV audio (linear PCM, G.711 and MP3) from/to WAV and MP3 files.
+package audio
+
+import (
+	"bytes"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// G711SamplingRate is the only sampling rate of G.711 in FLV.
+const G711SamplingRate = 8000
+
+var soundRates = map[tag.SoundRate]uint32{
+	tag.SoundRate5_5kHz: 5512,
+	tag.SoundRate11kHz:  11025,
+	tag.SoundRate22kHz:  22050,
+	tag.SoundRate44kHz:  44100,
+}
+
+func soundRateOf(rate uint32) (tag.SoundRate, bool) {
+	for soundRate, r := range soundRates {
+		if r == rate {
+			return soundRate, true
+		}
+	}
+	return 0, false
+}
+
+func soundTypeOf(channels int) tag.SoundType {
+	if channels == 1 {
+		return tag.SoundTypeMono
+	}
+	return tag.SoundTypeStereo
+}
+
+func newAudioTag(timestamp uint32, audioData *tag.AudioData, data []byte) *tag.FlvTag {
+	audioData.Data = bytes.NewReader(data)
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeAudio,
+		Timestamp: timestamp,
+		Data:      audioData,
+	}
+}
@@ -0,0 +1,125 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package audio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/mp3"
+	"github.com/yutopp/go-flv/internal/packaging"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// ========================================
+// Import
+
+// MP3Importer reads an MP3 elementary stream and produces an audio tag per frame.
+type MP3Importer struct {
+	r       *mp3.Reader
+	elapsed uint64 // in microseconds
+}
+
+func NewMP3Importer(r io.Reader) *MP3Importer {
+	return &MP3Importer{
+		r: mp3.NewReader(r),
+	}
+}
+
+// Decode reads the next tag. It returns io.EOF at the end of the stream.
+func (im *MP3Importer) Decode(flvTag *tag.FlvTag) error {
+	header, frame, err := im.r.ReadFrame()
+	if err != nil {
+		return err
+	}
+
+	audioData := &tag.AudioData{
+		SoundFormat: tag.SoundFormatMP3,
+		SoundRate:   mp3SoundRateOf(header.SamplingRate),
+		SoundSize:   tag.SoundSize16Bit,
+		SoundType:   soundTypeOf(header.Channels()),
+	}
+	if header.SamplingRate == 8000 {
+		audioData.SoundFormat = tag.SoundFormatMP3_8kHz
+	}
+
+	*flvTag = *newAudioTag(uint32(im.elapsed/1000), audioData, frame)
+	im.elapsed += uint64(header.SamplesPerFrame()) * 1000000 / uint64(header.SamplingRate)
+
+	return nil
+}
+
+// mp3SoundRateOf returns the nearest SoundRate. Decoders use the rate in MP3 frame headers.
+func mp3SoundRateOf(rate uint32) tag.SoundRate {
+	switch {
+	case rate >= 32000:
+		return tag.SoundRate44kHz
+	case rate >= 16000:
+		return tag.SoundRate22kHz
+	default:
+		return tag.SoundRate11kHz
+	}
+}
+
+// MP3ToFLV converts an MP3 elementary stream into FLV.
+func MP3ToFLV(w io.Writer, r io.Reader) error {
+	im := NewMP3Importer(r)
+
+	enc, err := flv.NewEncoder(w, flv.FlagsAudio)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var flvTag tag.FlvTag
+		if err := im.Decode(&flvTag); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := enc.Encode(&flvTag); err != nil {
+			return err
+		}
+	}
+}
+
+// ========================================
+// Export
+
+// MP3Writer writes MP3 audio tags as an MP3 elementary stream.
+type MP3Writer struct {
+	w io.Writer
+}
+
+func NewMP3Writer(w io.Writer) *MP3Writer {
+	return &MP3Writer{
+		w: w,
+	}
+}
+
+// WriteTag writes an audio tag. Other tags are ignored.
+func (w *MP3Writer) WriteTag(flvTag *tag.FlvTag) error {
+	audioData, ok := flvTag.Data.(*tag.AudioData)
+	if !ok {
+		return nil
+	}
+
+	if audioData.SoundFormat != tag.SoundFormatMP3 && audioData.SoundFormat != tag.SoundFormatMP3_8kHz {
+		return fmt.Errorf("unsupported sound format for MP3: %+v", audioData.SoundFormat)
+	}
+
+	_, err := io.Copy(w.w, audioData.Data)
+	return err
+}
+
+// ExportMP3 reads all tags from dec and writes audio as an MP3 elementary stream.
+func ExportMP3(dec *flv.Decoder, w io.Writer) error {
+	return packaging.Run(dec, packaging.NopCloser(NewMP3Writer(w)))
+}
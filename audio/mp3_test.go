@@ -0,0 +1,77 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package audio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestMP3RoundTrip(t *testing.T) {
+	// MPEG-1 Layer III, 128kbps, 44100Hz, joint stereo (417 bytes)
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x64}, bytes.Repeat([]byte{0x55}, 413)...)
+	src := bytes.Repeat(frame, 3)
+
+	var flvBuf bytes.Buffer
+	err := MP3ToFLV(&flvBuf, bytes.NewReader(src))
+	require.Nil(t, err)
+
+	dec, err := flv.NewDecoder(bytes.NewReader(flvBuf.Bytes()))
+	require.Nil(t, err)
+	var timestamps []uint32
+	for {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+
+		audioData := flvTag.Data.(*tag.AudioData)
+		require.Equal(t, tag.SoundFormatMP3, audioData.SoundFormat)
+		require.Equal(t, tag.SoundRate44kHz, audioData.SoundRate)
+		require.Equal(t, tag.SoundSize16Bit, audioData.SoundSize)
+		require.Equal(t, tag.SoundTypeStereo, audioData.SoundType)
+		timestamps = append(timestamps, flvTag.Timestamp)
+		flvTag.Close()
+	}
+	require.Equal(t, []uint32{0, 26, 52}, timestamps)
+
+	dec, err = flv.NewDecoder(bytes.NewReader(flvBuf.Bytes()))
+	require.Nil(t, err)
+	var dst bytes.Buffer
+	err = ExportMP3(dec, &dst)
+	require.Nil(t, err)
+	require.Equal(t, src, dst.Bytes())
+}
+
+func TestMP3Importer8kHz(t *testing.T) {
+	// MPEG-2.5 Layer III, 8kbps, 8000Hz, mono (72 bytes)
+	frame := append([]byte{0xff, 0xe3, 0x18, 0xc4}, bytes.Repeat([]byte{0x55}, 68)...)
+
+	im := NewMP3Importer(bytes.NewReader(frame))
+	var flvTag tag.FlvTag
+	err := im.Decode(&flvTag)
+	require.Nil(t, err)
+
+	audioData := flvTag.Data.(*tag.AudioData)
+	require.Equal(t, tag.SoundFormatMP3_8kHz, audioData.SoundFormat)
+	require.Equal(t, tag.SoundTypeMono, audioData.SoundType)
+}
+
+func TestMP3WriterUnsupportedFormat(t *testing.T) {
+	w := NewMP3Writer(io.Discard)
+	err := w.WriteTag(newAudioTag(0, &tag.AudioData{SoundFormat: tag.SoundFormatAAC}, []byte{0x12, 0x10}))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,244 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package audio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/internal/packaging"
+	"github.com/yutopp/go-flv/tag"
+	"github.com/yutopp/go-flv/wav"
+)
+
+// SamplesPerTag is a number of sample frames in a tag made from WAV.
+const SamplesPerTag = 1024
+
+// ========================================
+// Import
+
+// WAVImporter reads WAV and produces audio tags. Supported encodings are 8/16bit linear PCM
+// (5512, 11025, 22050 or 44100Hz) and G.711 A-law/mu-law (8000Hz), in mono or stereo.
+type WAVImporter struct {
+	r         *wav.Reader
+	audioData tag.AudioData
+	buf       []byte
+	samples   uint64
+}
+
+func NewWAVImporter(r io.Reader) (*WAVImporter, error) {
+	wr, err := wav.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	audioData, err := audioDataOfWAVFormat(wr.Format())
+	if err != nil {
+		return nil, err
+	}
+
+	return &WAVImporter{
+		r:         wr,
+		audioData: *audioData,
+		buf:       make([]byte, SamplesPerTag*wr.Format().BlockAlign()),
+	}, nil
+}
+
+func audioDataOfWAVFormat(format *wav.Format) (*tag.AudioData, error) {
+	if format.Channels > 2 {
+		return nil, fmt.Errorf("unsupported number of channels: %d", format.Channels)
+	}
+	soundType := soundTypeOf(int(format.Channels))
+
+	switch format.FormatTag {
+	case wav.FormatTagPCM:
+		soundRate, ok := soundRateOf(format.SampleRate)
+		if !ok {
+			return nil, fmt.Errorf("unsupported sampling rate for linear PCM: %d", format.SampleRate)
+		}
+
+		var soundSize tag.SoundSize
+		switch format.BitsPerSample {
+		case 8:
+			soundSize = tag.SoundSize8Bit
+		case 16:
+			soundSize = tag.SoundSize16Bit
+		default:
+			return nil, fmt.Errorf("unsupported bits per sample for linear PCM: %d", format.BitsPerSample)
+		}
+
+		return &tag.AudioData{
+			SoundFormat: tag.SoundFormatLinearPCMLittleEndian,
+			SoundRate:   soundRate,
+			SoundSize:   soundSize,
+			SoundType:   soundType,
+		}, nil
+
+	case wav.FormatTagALaw, wav.FormatTagMuLaw:
+		if format.SampleRate != G711SamplingRate || format.BitsPerSample != 8 {
+			return nil, fmt.Errorf("unsupported G.711 format: %+v", format)
+		}
+
+		soundFormat := tag.SoundFormatG711ALawLogarithmicPCM
+		if format.FormatTag == wav.FormatTagMuLaw {
+			soundFormat = tag.SoundFormatG711muLawLogarithmicPCM
+		}
+		return &tag.AudioData{
+			SoundFormat: soundFormat,
+			SoundRate:   tag.SoundRate5_5kHz, // ignored by decoders
+			SoundSize:   tag.SoundSize16Bit,
+			SoundType:   soundType,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported WAV format tag: 0x%04x", format.FormatTag)
+	}
+}
+
+// Decode reads the next tag. It returns io.EOF at the end of the stream.
+func (im *WAVImporter) Decode(flvTag *tag.FlvTag) error {
+	blockAlign := im.r.Format().BlockAlign()
+
+	n, err := io.ReadFull(im.r, im.buf)
+	if err == io.ErrUnexpectedEOF {
+		n -= n % blockAlign // drops an incomplete sample frame
+		if n == 0 {
+			return io.EOF
+		}
+	} else if err != nil {
+		return err
+	}
+
+	audioData := im.audioData
+	timestamp := uint32(im.samples * 1000 / uint64(im.r.Format().SampleRate))
+	*flvTag = *newAudioTag(timestamp, &audioData, append([]byte(nil), im.buf[:n]...))
+	im.samples += uint64(n / blockAlign)
+
+	return nil
+}
+
+// WAVToFLV converts WAV into FLV.
+func WAVToFLV(w io.Writer, r io.Reader) error {
+	im, err := NewWAVImporter(r)
+	if err != nil {
+		return err
+	}
+
+	enc, err := flv.NewEncoder(w, flv.FlagsAudio)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var flvTag tag.FlvTag
+		if err := im.Decode(&flvTag); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := enc.Encode(&flvTag); err != nil {
+			return err
+		}
+	}
+}
+
+// ========================================
+// Export
+
+// WAVWriter writes linear PCM or G.711 audio tags as WAV. Linear PCM in platform endian is
+// assumed to be little endian as every known producer does.
+type WAVWriter struct {
+	w      io.Writer
+	ww     *wav.Writer
+	format *wav.Format
+}
+
+// NewWAVWriter makes a writer. Sizes in the WAV header are fixed up by Close when w is an io.WriteSeeker.
+func NewWAVWriter(w io.Writer) *WAVWriter {
+	return &WAVWriter{
+		w: w,
+	}
+}
+
+// WriteTag writes an audio tag. Other tags are ignored.
+func (w *WAVWriter) WriteTag(flvTag *tag.FlvTag) error {
+	audioData, ok := flvTag.Data.(*tag.AudioData)
+	if !ok {
+		return nil
+	}
+
+	format, err := wavFormatOfAudioData(audioData)
+	if err != nil {
+		return err
+	}
+
+	if w.ww == nil {
+		ww, err := wav.NewWriter(w.w, format)
+		if err != nil {
+			return err
+		}
+		w.ww = ww
+		w.format = format
+	} else if *w.format != *format {
+		return fmt.Errorf("audio format is changed: %+v -> %+v", w.format, format)
+	}
+
+	_, err = io.Copy(w.ww, audioData.Data)
+	return err
+}
+
+func wavFormatOfAudioData(audioData *tag.AudioData) (*wav.Format, error) {
+	channels := uint16(1)
+	if audioData.SoundType == tag.SoundTypeStereo {
+		channels = 2
+	}
+
+	switch audioData.SoundFormat {
+	case tag.SoundFormatLinearPCMPlatformEndian, tag.SoundFormatLinearPCMLittleEndian:
+		bitsPerSample := uint16(16)
+		if audioData.SoundSize == tag.SoundSize8Bit {
+			bitsPerSample = 8
+		}
+		return &wav.Format{
+			FormatTag:     wav.FormatTagPCM,
+			Channels:      channels,
+			SampleRate:    soundRates[audioData.SoundRate],
+			BitsPerSample: bitsPerSample,
+		}, nil
+
+	case tag.SoundFormatG711ALawLogarithmicPCM, tag.SoundFormatG711muLawLogarithmicPCM:
+		formatTag := wav.FormatTagALaw
+		if audioData.SoundFormat == tag.SoundFormatG711muLawLogarithmicPCM {
+			formatTag = wav.FormatTagMuLaw
+		}
+		return &wav.Format{
+			FormatTag:     formatTag,
+			Channels:      channels,
+			SampleRate:    G711SamplingRate,
+			BitsPerSample: 8,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported sound format for WAV: %+v", audioData.SoundFormat)
+	}
+}
+
+// Close finishes the WAV. It does not close the underlying writer.
+func (w *WAVWriter) Close() error {
+	if w.ww == nil {
+		return fmt.Errorf("no audio tags are written")
+	}
+	return w.ww.Close()
+}
+
+// ExportWAV reads all tags from dec and writes audio as WAV.
+func ExportWAV(dec *flv.Decoder, w io.Writer) error {
+	return packaging.Run(dec, NewWAVWriter(w))
+}
@@ -0,0 +1,182 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package audio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+	"github.com/yutopp/go-flv/wav"
+)
+
+func makeWAV(t *testing.T, format *wav.Format, samples []byte) []byte {
+	f, err := os.Create(filepath.Join(t.TempDir(), "src.wav"))
+	require.Nil(t, err)
+	defer f.Close()
+
+	w, err := wav.NewWriter(f, format)
+	require.Nil(t, err)
+	_, err = w.Write(samples)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.Nil(t, err)
+	b, err := io.ReadAll(f)
+	require.Nil(t, err)
+
+	return b
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Format     *wav.Format
+		AudioData  tag.AudioData
+		Timestamps []uint32
+	}
+
+	testCases := []testCase{
+		{
+			Name: "PCM 16bit stereo 44100Hz",
+			Format: &wav.Format{
+				FormatTag:     wav.FormatTagPCM,
+				Channels:      2,
+				SampleRate:    44100,
+				BitsPerSample: 16,
+			},
+			AudioData: tag.AudioData{
+				SoundFormat: tag.SoundFormatLinearPCMLittleEndian,
+				SoundRate:   tag.SoundRate44kHz,
+				SoundSize:   tag.SoundSize16Bit,
+				SoundType:   tag.SoundTypeStereo,
+			},
+			Timestamps: []uint32{0, 23, 46},
+		},
+		{
+			Name: "PCM 8bit mono 11025Hz",
+			Format: &wav.Format{
+				FormatTag:     wav.FormatTagPCM,
+				Channels:      1,
+				SampleRate:    11025,
+				BitsPerSample: 8,
+			},
+			AudioData: tag.AudioData{
+				SoundFormat: tag.SoundFormatLinearPCMLittleEndian,
+				SoundRate:   tag.SoundRate11kHz,
+				SoundSize:   tag.SoundSize8Bit,
+				SoundType:   tag.SoundTypeMono,
+			},
+			Timestamps: []uint32{0, 92, 185},
+		},
+		{
+			Name: "G.711 mu-law mono",
+			Format: &wav.Format{
+				FormatTag:     wav.FormatTagMuLaw,
+				Channels:      1,
+				SampleRate:    8000,
+				BitsPerSample: 8,
+			},
+			AudioData: tag.AudioData{
+				SoundFormat: tag.SoundFormatG711muLawLogarithmicPCM,
+				SoundRate:   tag.SoundRate5_5kHz,
+				SoundSize:   tag.SoundSize16Bit,
+				SoundType:   tag.SoundTypeMono,
+			},
+			Timestamps: []uint32{0, 128, 256},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			// 2.5 tags
+			samples := make([]byte, SamplesPerTag*5/2*tc.Format.BlockAlign())
+			for i := range samples {
+				samples[i] = byte(i)
+			}
+			src := makeWAV(t, tc.Format, samples)
+
+			var flvBuf bytes.Buffer
+			err := WAVToFLV(&flvBuf, bytes.NewReader(src))
+			require.Nil(t, err)
+
+			dec, err := flv.NewDecoder(bytes.NewReader(flvBuf.Bytes()))
+			require.Nil(t, err)
+			var timestamps []uint32
+			for {
+				var flvTag tag.FlvTag
+				err := dec.Decode(&flvTag)
+				if err == io.EOF {
+					break
+				}
+				require.Nil(t, err)
+
+				audioData := flvTag.Data.(*tag.AudioData)
+				require.Equal(t, tc.AudioData.SoundFormat, audioData.SoundFormat)
+				require.Equal(t, tc.AudioData.SoundRate, audioData.SoundRate)
+				require.Equal(t, tc.AudioData.SoundSize, audioData.SoundSize)
+				require.Equal(t, tc.AudioData.SoundType, audioData.SoundType)
+				timestamps = append(timestamps, flvTag.Timestamp)
+				flvTag.Close()
+			}
+			require.Equal(t, tc.Timestamps, timestamps)
+
+			dec, err = flv.NewDecoder(bytes.NewReader(flvBuf.Bytes()))
+			require.Nil(t, err)
+			dst, err := os.Create(filepath.Join(t.TempDir(), "dst.wav"))
+			require.Nil(t, err)
+			defer dst.Close()
+			err = ExportWAV(dec, dst)
+			require.Nil(t, err)
+
+			_, err = dst.Seek(0, io.SeekStart)
+			require.Nil(t, err)
+			actual, err := io.ReadAll(dst)
+			require.Nil(t, err)
+			require.Equal(t, src, actual)
+		})
+	}
+}
+
+func TestWAVUnsupportedFormat(t *testing.T) {
+	src := makeWAV(t, &wav.Format{
+		FormatTag:     wav.FormatTagPCM,
+		Channels:      2,
+		SampleRate:    48000,
+		BitsPerSample: 16,
+	}, []byte{0, 0, 0, 0})
+
+	_, err := NewWAVImporter(bytes.NewReader(src))
+	require.NotNil(t, err)
+}
+
+func TestWAVWriterFormatChange(t *testing.T) {
+	w := NewWAVWriter(io.Discard)
+
+	newTag := func(soundType tag.SoundType) *tag.FlvTag {
+		return newAudioTag(0, &tag.AudioData{
+			SoundFormat: tag.SoundFormatLinearPCMLittleEndian,
+			SoundRate:   tag.SoundRate22kHz,
+			SoundSize:   tag.SoundSize16Bit,
+			SoundType:   soundType,
+		}, []byte{0, 0, 0, 0})
+	}
+
+	require.Nil(t, w.WriteTag(newTag(tag.SoundTypeStereo)))
+	require.NotNil(t, w.WriteTag(newTag(tag.SoundTypeMono)))
+}
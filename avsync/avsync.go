@@ -0,0 +1,34 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avsync
+
+import (
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/internal/packaging"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// Repair reads all tags from dec, normalizes their timestamps and writes them to enc.
+func Repair(dec *flv.Decoder, enc *flv.Encoder, config *Config) (Report, error) {
+	r := &repairer{
+		n:   NewNormalizer(config),
+		enc: enc,
+	}
+	err := packaging.Run(dec, packaging.NopCloser(r))
+	return r.n.Report(), err
+}
+
+type repairer struct {
+	n   *Normalizer
+	enc *flv.Encoder
+}
+
+func (r *repairer) WriteTag(flvTag *tag.FlvTag) error {
+	r.n.Normalize(flvTag)
+	return r.enc.Encode(flvTag)
+}
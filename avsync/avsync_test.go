@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avsync
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestRepair(t *testing.T) {
+	var in bytes.Buffer
+	enc, err := flv.NewEncoder(&in, flv.FlagsAudio)
+	require.Nil(t, err)
+	for _, ts := range []uint32{5000, 5023, 5020, 5046} {
+		err := enc.Encode(&tag.FlvTag{
+			TagType:   tag.TagTypeAudio,
+			Timestamp: ts,
+			Data: &tag.AudioData{
+				SoundFormat: tag.SoundFormatMP3,
+				Data:        bytes.NewReader([]byte{byte(ts)}),
+			},
+		})
+		require.Nil(t, err)
+	}
+
+	dec, err := flv.NewDecoder(&in)
+	require.Nil(t, err)
+
+	var out bytes.Buffer
+	enc, err = flv.NewEncoder(&out, flv.FlagsAudio)
+	require.Nil(t, err)
+
+	report, err := Repair(dec, enc, nil)
+	require.Nil(t, err)
+	require.Equal(t, uint64(4), report.Tags)
+	require.Equal(t, map[CorrectionKind]uint64{
+		CorrectionRebase: 1,
+		CorrectionJitter: 1,
+	}, report.Corrections)
+
+	dec, err = flv.NewDecoder(&out)
+	require.Nil(t, err)
+
+	var timestamps []uint32
+	for {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		timestamps = append(timestamps, flvTag.Timestamp)
+		flvTag.Close()
+	}
+	require.Equal(t, []uint32{0, 23, 24, 46}, timestamps)
+}
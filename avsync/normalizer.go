@@ -0,0 +1,269 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package avsync normalizes timestamps of tag streams and keeps audio and video aligned.
+package avsync
+
+import (
+	"time"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+const (
+	DefaultMaxGap          = 1 * time.Second
+	DefaultMaxBackwardJump = 500 * time.Millisecond
+	DefaultFrameDuration   = 20 * time.Millisecond
+	DefaultMaxJitter       = 10 * time.Millisecond
+)
+
+type Config struct {
+	// MaxGap is a limit of forward jumps. Larger jumps are collapsed to a frame duration.
+	MaxGap time.Duration
+	// MaxBackwardJump is a limit of backward jumps which are spread forward from the previous
+	// timestamp of the track by 1ms until the input catches up. Larger jumps are regarded as
+	// discontinuities and bridged with a frame duration.
+	MaxBackwardJump time.Duration
+	// MaxJitter is a limit of deviations from the frame interval of the track which are smoothed to the
+	// interval. Deviations of 1ms are regarded as rounding of timestamps and kept as is.
+	MaxJitter time.Duration
+	// DefaultFrameDuration is used to bridge discontinuities until a frame duration of the track is known.
+	DefaultFrameDuration time.Duration
+	// OnCorrection is called for each correction if set.
+	OnCorrection func(*Correction)
+}
+
+type CorrectionKind int
+
+const (
+	// CorrectionRebase shifts the first timestamp to zero.
+	CorrectionRebase CorrectionKind = iota
+	// CorrectionGap collapses a forward jump larger than MaxGap.
+	CorrectionGap
+	// CorrectionBackwardJump bridges a backward jump larger than MaxBackwardJump.
+	CorrectionBackwardJump
+	// CorrectionJitter smooths a tag which deviates from the frame interval of the track by up to
+	// MaxJitter, or spreads a tag which does not advance by 1ms to keep the track strictly increasing.
+	CorrectionJitter
+	// CorrectionRealign adopts a shift made by another track to keep tracks aligned.
+	CorrectionRealign
+)
+
+func (k CorrectionKind) String() string {
+	switch k {
+	case CorrectionRebase:
+		return "rebase"
+	case CorrectionGap:
+		return "gap"
+	case CorrectionBackwardJump:
+		return "backward jump"
+	case CorrectionJitter:
+		return "jitter"
+	case CorrectionRealign:
+		return "realign"
+	default:
+		return "unknown"
+	}
+}
+
+type Correction struct {
+	Kind      CorrectionKind
+	TagType   tag.TagType
+	Original  uint32
+	Corrected uint32
+}
+
+// Report is a summary of corrections.
+type Report struct {
+	Tags        uint64
+	Corrections map[CorrectionKind]uint64
+}
+
+// Normalizer rewrites timestamps of tags in place: the first timestamp is rebased to zero,
+// jumps are bridged, jitter is smoothed so that each track is strictly increasing, and shifts are shared
+// between audio and video when possible to keep them aligned.
+type Normalizer struct {
+	config Config
+
+	started bool
+	lastIn  uint32
+	in      int64 // unwrapped input in milliseconds
+	shift   int64 // shift made by the latest correction
+	tracks  map[tag.TagType]*track
+	report  Report
+}
+
+type track struct {
+	shift    int64
+	lastOut  int64
+	lastIn   int64 // lastOut before smoothing and spreading
+	duration int64
+	measured bool // duration is measured from the track
+}
+
+func NewNormalizer(config *Config) *Normalizer {
+	var c Config
+	if config != nil {
+		c = *config
+	}
+	if c.MaxGap == 0 {
+		c.MaxGap = DefaultMaxGap
+	}
+	if c.MaxBackwardJump == 0 {
+		c.MaxBackwardJump = DefaultMaxBackwardJump
+	}
+	if c.DefaultFrameDuration == 0 {
+		c.DefaultFrameDuration = DefaultFrameDuration
+	}
+	if c.MaxJitter == 0 {
+		c.MaxJitter = DefaultMaxJitter
+	}
+
+	return &Normalizer{
+		config: c,
+		tracks: make(map[tag.TagType]*track),
+		report: Report{
+			Corrections: make(map[CorrectionKind]uint64),
+		},
+	}
+}
+
+// Normalize rewrites a timestamp of the tag.
+func (n *Normalizer) Normalize(flvTag *tag.FlvTag) {
+	n.report.Tags++
+
+	original := flvTag.Timestamp
+	if !n.started {
+		n.started = true
+		n.in = int64(original)
+		n.shift = -n.in
+		if original != 0 {
+			n.correct(CorrectionRebase, flvTag.TagType, original, 0)
+		}
+	} else {
+		n.in += int64(int32(original - n.lastIn)) // wrap around safely
+	}
+	n.lastIn = original
+
+	if flvTag.TagType != tag.TagTypeAudio && flvTag.TagType != tag.TagTypeVideo {
+		// script data follow the latest shift
+		flvTag.Timestamp = uint32(nonNegative(n.in + n.shift))
+		return
+	}
+
+	t, ok := n.tracks[flvTag.TagType]
+	if !ok {
+		t = &track{
+			shift:    n.shift,
+			lastOut:  -1,
+			duration: n.config.DefaultFrameDuration.Milliseconds(),
+		}
+		n.tracks[flvTag.TagType] = t
+	}
+
+	out := n.in + t.shift
+	if t.lastOut >= 0 {
+		out = n.adjust(t, flvTag.TagType, original, out)
+	}
+	out = nonNegative(out)
+	t.lastOut = out
+	t.lastIn = n.in + t.shift
+
+	flvTag.Timestamp = uint32(out)
+}
+
+func (n *Normalizer) adjust(t *track, tagType tag.TagType, original uint32, out int64) int64 {
+	delta := out - t.lastOut
+	if n.acceptable(delta) {
+		return n.smooth(t, tagType, original, out)
+	}
+
+	// another track may have already corrected the same discontinuity
+	if n.shift != t.shift {
+		realigned := n.in + n.shift
+		if d := realigned - t.lastOut; n.acceptable(d) && d >= 0 {
+			t.shift = n.shift
+			n.correct(CorrectionRealign, tagType, original, realigned)
+			return realigned
+		}
+	}
+
+	kind := CorrectionGap
+	if delta < 0 {
+		kind = CorrectionBackwardJump
+	}
+	corrected := t.lastOut + t.duration
+	t.shift += corrected - out
+	n.shift = t.shift
+	n.correct(kind, tagType, original, corrected)
+
+	return corrected
+}
+
+// smooth snaps a tag to the frame interval of the track if it deviates slightly, and spreads it by 1ms if
+// it does not advance. Smoothed tags stay within MaxJitter of the input, so that the track does not drift.
+func (n *Normalizer) smooth(t *track, tagType tag.TagType, original uint32, out int64) int64 {
+	corrected := out
+	expected := t.lastOut + t.duration
+	if d := out - expected; t.measured && (d < -1 || d > 1) && abs(d) <= n.config.MaxJitter.Milliseconds() {
+		corrected = expected
+	} else if d := out - t.lastOut; d > 0 && t.lastOut == t.lastIn {
+		// intervals from smoothed tags are not measured
+		t.duration = d
+		t.measured = true
+	}
+	if corrected <= t.lastOut {
+		corrected = t.lastOut + 1
+	}
+	if corrected != out {
+		n.correct(CorrectionJitter, tagType, original, corrected)
+	}
+
+	return corrected
+}
+
+func (n *Normalizer) acceptable(delta int64) bool {
+	return delta <= n.config.MaxGap.Milliseconds() && -delta <= n.config.MaxBackwardJump.Milliseconds()
+}
+
+func (n *Normalizer) correct(kind CorrectionKind, tagType tag.TagType, original uint32, corrected int64) {
+	n.report.Corrections[kind]++
+	if n.config.OnCorrection != nil {
+		n.config.OnCorrection(&Correction{
+			Kind:      kind,
+			TagType:   tagType,
+			Original:  original,
+			Corrected: uint32(nonNegative(corrected)),
+		})
+	}
+}
+
+// Report returns a summary of corrections so far.
+func (n *Normalizer) Report() Report {
+	r := Report{
+		Tags:        n.report.Tags,
+		Corrections: make(map[CorrectionKind]uint64, len(n.report.Corrections)),
+	}
+	for k, v := range n.report.Corrections {
+		r.Corrections[k] = v
+	}
+	return r
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func nonNegative(v int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avsync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+const (
+	a = tag.TagTypeAudio
+	v = tag.TagTypeVideo
+	s = tag.TagTypeScriptData
+)
+
+type stamp struct {
+	TagType   tag.TagType
+	Timestamp uint32
+}
+
+func TestNormalizer(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Input       []stamp
+		Expected    []uint32
+		Corrections []CorrectionKind
+	}
+
+	testCases := []testCase{
+		{
+			Name:     "Clean",
+			Input:    []stamp{{s, 0}, {v, 0}, {a, 0}, {a, 23}, {v, 33}, {a, 46}},
+			Expected: []uint32{0, 0, 0, 23, 33, 46},
+		},
+		{
+			Name:        "Rebase",
+			Input:       []stamp{{v, 5000}, {a, 5010}, {v, 5033}, {a, 5033}},
+			Expected:    []uint32{0, 10, 33, 33},
+			Corrections: []CorrectionKind{CorrectionRebase},
+		},
+		{
+			Name:        "Wrap",
+			Input:       []stamp{{v, 0xffffffe0}, {v, 0x10}},
+			Expected:    []uint32{0, 0x30},
+			Corrections: []CorrectionKind{CorrectionRebase},
+		},
+		{
+			Name:        "GapInBothTracks",
+			Input:       []stamp{{v, 0}, {a, 0}, {v, 40}, {a, 20}, {v, 60040}, {a, 60020}, {v, 60080}, {a, 60040}},
+			Expected:    []uint32{0, 0, 40, 20, 80, 60, 120, 80},
+			Corrections: []CorrectionKind{CorrectionGap, CorrectionRealign},
+		},
+		{
+			Name:        "ClockReset",
+			Input:       []stamp{{v, 60000}, {a, 60000}, {v, 60040}, {a, 60020}, {v, 0}, {a, 0}, {v, 40}, {a, 20}},
+			Expected:    []uint32{0, 0, 40, 20, 80, 80, 120, 100}, // aligned as the input
+			Corrections: []CorrectionKind{CorrectionRebase, CorrectionBackwardJump, CorrectionRealign},
+		},
+		{
+			Name:        "GapInOneTrack",
+			Input:       []stamp{{v, 0}, {a, 0}, {v, 40}, {a, 20}, {v, 10040}, {a, 40}, {a, 60}, {v, 10080}},
+			Expected:    []uint32{0, 0, 40, 20, 80, 40, 60, 120},
+			Corrections: []CorrectionKind{CorrectionGap},
+		},
+		{
+			Name:        "BackwardJitter",
+			Input:       []stamp{{a, 0}, {a, 23}, {a, 20}, {a, 46}},
+			Expected:    []uint32{0, 23, 24, 46},
+			Corrections: []CorrectionKind{CorrectionJitter},
+		},
+		{
+			Name:        "BackwardJitterRun",
+			Input:       []stamp{{a, 0}, {a, 100}, {a, 40}, {a, 60}, {a, 80}, {a, 120}, {a, 140}},
+			Expected:    []uint32{0, 100, 101, 102, 103, 120, 140}, // spread until the input catches up
+			Corrections: []CorrectionKind{CorrectionJitter, CorrectionJitter, CorrectionJitter},
+		},
+		{
+			Name:        "DuplicatedTimestamps",
+			Input:       []stamp{{v, 0}, {v, 40}, {v, 40}, {v, 80}},
+			Expected:    []uint32{0, 40, 41, 80},
+			Corrections: []CorrectionKind{CorrectionJitter},
+		},
+		{
+			Name:        "ForwardJitter",
+			Input:       []stamp{{v, 0}, {v, 40}, {v, 80}, {v, 125}, {v, 160}, {v, 200}},
+			Expected:    []uint32{0, 40, 80, 120, 160, 200},
+			Corrections: []CorrectionKind{CorrectionJitter},
+		},
+		{
+			Name:     "Rounding",
+			Input:    []stamp{{a, 0}, {a, 23}, {a, 46}, {a, 70}, {a, 93}, {a, 116}, {a, 139}, {a, 163}},
+			Expected: []uint32{0, 23, 46, 70, 93, 116, 139, 163}, // 1024 samples at 44.1kHz
+		},
+		{
+			Name:     "FrameRateChange",
+			Input:    []stamp{{v, 0}, {v, 40}, {v, 80}, {v, 100}, {v, 120}, {v, 140}},
+			Expected: []uint32{0, 40, 80, 100, 120, 140},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var corrections []CorrectionKind
+			n := NewNormalizer(&Config{
+				OnCorrection: func(c *Correction) {
+					corrections = append(corrections, c.Kind)
+				},
+			})
+
+			actual := make([]uint32, len(tc.Input))
+			for i, st := range tc.Input {
+				flvTag := &tag.FlvTag{
+					TagType:   st.TagType,
+					Timestamp: st.Timestamp,
+				}
+				n.Normalize(flvTag)
+				actual[i] = flvTag.Timestamp
+			}
+			require.Equal(t, tc.Expected, actual)
+			requireStrictlyIncreasing(t, tc.Input, actual)
+			require.Equal(t, tc.Corrections, corrections)
+
+			report := n.Report()
+			require.Equal(t, uint64(len(tc.Input)), report.Tags)
+			var total uint64
+			for _, c := range report.Corrections {
+				total += c
+			}
+			require.Equal(t, uint64(len(tc.Corrections)), total)
+		})
+	}
+}
+
+func requireStrictlyIncreasing(t *testing.T, input []stamp, actual []uint32) {
+	last := make(map[tag.TagType]uint32)
+	for i, st := range input {
+		if st.TagType == s {
+			continue
+		}
+		if prev, ok := last[st.TagType]; ok {
+			require.True(t, actual[i] > prev, "tag %d of type %d: %d <= %d", i, st.TagType, actual[i], prev)
+		}
+		last[st.TagType] = actual[i]
+	}
+}
@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// loopReader reads head once, then repeats body forever.
+type loopReader struct {
+	head []byte
+	body []byte
+	off  int
+}
+
+func (r *loopReader) Read(p []byte) (int, error) {
+	if len(r.head) > 0 {
+		n := copy(p, r.head)
+		r.head = r.head[n:]
+		return n, nil
+	}
+
+	n := copy(p, r.body[r.off:])
+	r.off = (r.off + n) % len(r.body)
+	return n, nil
+}
+
+func newBenchTag(payload []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: 10,
+		Data: &tag.VideoData{
+			FrameType:     tag.FrameTypeInterFrame,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: tag.AVCPacketTypeNALU,
+			Data:          tag.NewBuffer(payload),
+		},
+	}
+}
+
+// newBenchDecoder returns a decoder which decodes the same video tag forever.
+func newBenchDecoder(tb testing.TB, payloadSize int) *Decoder {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsVideo)
+	require.Nil(tb, err)
+	headerSize := buf.Len()
+
+	// previous tag size(0) + tag + previous tag size
+	err = enc.Encode(newBenchTag(make([]byte, payloadSize)))
+	require.Nil(tb, err)
+	err = enc.Encode(newBenchTag(make([]byte, payloadSize)))
+	require.Nil(tb, err)
+
+	b := buf.Bytes()
+	head := b[:headerSize+4] // header + previous tag size(0)
+	tagSize := (len(b) - len(head)) / 2
+	body := b[len(head)+tagSize:] // previous tag size + tag
+
+	dec, err := NewDecoder(&loopReader{head: head, body: body})
+	require.Nil(tb, err)
+
+	return dec
+}
+
+func decodeAndReadPayload(dec *Decoder, flvTag *tag.FlvTag) error {
+	if err := dec.Decode(flvTag); err != nil {
+		return err
+	}
+
+	buf, err := tag.ReadBuffer(flvTag.Data.(*tag.VideoData).Data)
+	if err != nil {
+		return err
+	}
+	buf.Release()
+
+	return nil
+}
+
+func BenchmarkDecoderDecode(b *testing.B) {
+	dec := newBenchDecoder(b, 4096)
+
+	var flvTag tag.FlvTag
+	b.ReportAllocs()
+	b.SetBytes(4096)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := decodeAndReadPayload(dec, &flvTag); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoderEncode(b *testing.B) {
+	enc, err := NewEncoder(io.Discard, FlagsVideo)
+	require.Nil(b, err)
+
+	flvTag := newBenchTag(make([]byte, 4096))
+	b.ReportAllocs()
+	b.SetBytes(4096)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(flvTag); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
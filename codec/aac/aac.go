@@ -0,0 +1,242 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package aac
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/internal/bitreader"
+)
+
+type AudioObjectType uint8
+
+const (
+	AudioObjectTypeAACMain AudioObjectType = 1
+	AudioObjectTypeAACLC   AudioObjectType = 2
+	AudioObjectTypeAACSSR  AudioObjectType = 3
+	AudioObjectTypeAACLTP  AudioObjectType = 4
+	AudioObjectTypeSBR     AudioObjectType = 5
+	AudioObjectTypePS      AudioObjectType = 29
+)
+
+var SamplingFrequencies = []uint32{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// SamplesPerFrame is a number of PCM samples in a raw AAC frame.
+const SamplesPerFrame = 1024
+
+// SamplingFrequencyIndexOf returns an index of SamplingFrequencies, or false if the frequency cannot be indexed.
+func SamplingFrequencyIndexOf(freq uint32) (uint8, bool) {
+	for i, f := range SamplingFrequencies {
+		if f == freq {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+// ========================================
+// AudioSpecificConfig (ISO/IEC 14496-3)
+
+type AudioSpecificConfig struct {
+	ObjectType             AudioObjectType
+	SamplingFrequencyIndex uint8 // 0x0f means SamplingFrequency is explicit
+	SamplingFrequency      uint32
+	ChannelConfiguration   uint8
+}
+
+// Codec returns a codec string defined in RFC 6381 (e.g. mp4a.40.2).
+func (c *AudioSpecificConfig) Codec() string {
+	return fmt.Sprintf("mp4a.40.%d", c.ObjectType)
+}
+
+// Channels returns a number of output channels. 0 means it is defined in the program config element.
+func (c *AudioSpecificConfig) Channels() int {
+	switch c.ChannelConfiguration {
+	case 7:
+		return 8
+	default:
+		return int(c.ChannelConfiguration)
+	}
+}
+
+func DecodeAudioSpecificConfig(r io.Reader, config *AudioSpecificConfig) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	br := bitreader.New(b)
+
+	objectType := AudioObjectType(br.ReadBits(5))
+	if objectType == 31 {
+		objectType = AudioObjectType(32 + br.ReadBits(6))
+	}
+
+	freqIndex := uint8(br.ReadBits(4))
+	var freq uint32
+	if freqIndex == 0x0f {
+		freq = br.ReadBits(24)
+	} else if int(freqIndex) < len(SamplingFrequencies) {
+		freq = SamplingFrequencies[freqIndex]
+	} else {
+		return fmt.Errorf("invalid sampling frequency index: %d", freqIndex)
+	}
+
+	channelConfig := uint8(br.ReadBits(4))
+
+	if err := br.Err(); err != nil {
+		return err
+	}
+
+	*config = AudioSpecificConfig{
+		ObjectType:             objectType,
+		SamplingFrequencyIndex: freqIndex,
+		SamplingFrequency:      freq,
+		ChannelConfiguration:   channelConfig,
+	}
+
+	return nil
+}
+
+func EncodeAudioSpecificConfig(w io.Writer, config *AudioSpecificConfig) error {
+	var bw bitWriter
+	if config.ObjectType >= 31 {
+		bw.write(31, 5)
+		bw.write(uint32(config.ObjectType-32), 6)
+	} else {
+		bw.write(uint32(config.ObjectType), 5)
+	}
+	bw.write(uint32(config.SamplingFrequencyIndex), 4)
+	if config.SamplingFrequencyIndex == 0x0f {
+		bw.write(config.SamplingFrequency, 24)
+	}
+	bw.write(uint32(config.ChannelConfiguration), 4)
+
+	_, err := w.Write(bw.bytes())
+	return err
+}
+
+// ========================================
+// ADTS (ISO/IEC 13818-7)
+
+const ADTSHeaderLength = 7
+
+type ADTSHeader struct {
+	ObjectType             AudioObjectType
+	SamplingFrequencyIndex uint8
+	ChannelConfiguration   uint8
+	FrameLength            int // includes the header
+	HeaderLength           int // 7, or 9 when CRC is present
+}
+
+// NewADTSHeader makes a header for a raw frame whose length is payloadLength.
+func NewADTSHeader(config *AudioSpecificConfig, payloadLength int) (*ADTSHeader, error) {
+	if config.ObjectType < 1 || config.ObjectType > 4 {
+		return nil, fmt.Errorf("object type cannot be represented in ADTS: %d", config.ObjectType)
+	}
+	if config.SamplingFrequencyIndex >= 0x0f {
+		return nil, fmt.Errorf("explicit sampling frequency cannot be represented in ADTS: %d", config.SamplingFrequency)
+	}
+	if payloadLength+ADTSHeaderLength > 0x1fff {
+		return nil, fmt.Errorf("frame is too large for ADTS: %d", payloadLength)
+	}
+
+	return &ADTSHeader{
+		ObjectType:             config.ObjectType,
+		SamplingFrequencyIndex: config.SamplingFrequencyIndex,
+		ChannelConfiguration:   config.ChannelConfiguration,
+		FrameLength:            payloadLength + ADTSHeaderLength,
+		HeaderLength:           ADTSHeaderLength,
+	}, nil
+}
+
+// AudioSpecificConfig returns a config equivalent to the header.
+func (h *ADTSHeader) AudioSpecificConfig() *AudioSpecificConfig {
+	var freq uint32
+	if int(h.SamplingFrequencyIndex) < len(SamplingFrequencies) {
+		freq = SamplingFrequencies[h.SamplingFrequencyIndex]
+	}
+
+	return &AudioSpecificConfig{
+		ObjectType:             h.ObjectType,
+		SamplingFrequencyIndex: h.SamplingFrequencyIndex,
+		SamplingFrequency:      freq,
+		ChannelConfiguration:   h.ChannelConfiguration,
+	}
+}
+
+// AppendADTSHeader appends a 7 bytes header (without CRC) to dst.
+func AppendADTSHeader(dst []byte, header *ADTSHeader) []byte {
+	profile := byte(header.ObjectType-1) & 0x03
+	freq := header.SamplingFrequencyIndex & 0x0f
+	ch := header.ChannelConfiguration & 0x07
+	length := header.FrameLength
+
+	return append(dst,
+		0xff,
+		0xf1, // MPEG-4, Layer 0, protection absent
+		profile<<6|freq<<2|ch>>2,
+		(ch&0x03)<<6|byte(length>>11)&0x03,
+		byte(length>>3),
+		byte(length&0x07)<<5|0x1f, // buffer fullness 0x7ff (VBR)
+		0xfc,                      // number of raw data blocks - 1 = 0
+	)
+}
+
+// ParseADTSHeader parses a header at the head of b.
+func ParseADTSHeader(b []byte) (*ADTSHeader, error) {
+	if len(b) < ADTSHeaderLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+		return nil, fmt.Errorf("ADTS sync word is not found")
+	}
+
+	headerLength := ADTSHeaderLength
+	if b[1]&0x01 == 0 { // protection absent = 0
+		headerLength += 2
+	}
+
+	header := &ADTSHeader{
+		ObjectType:             AudioObjectType(b[2]>>6) + 1,
+		SamplingFrequencyIndex: (b[2] >> 2) & 0x0f,
+		ChannelConfiguration:   (b[2]&0x01)<<2 | b[3]>>6,
+		FrameLength:            int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5,
+		HeaderLength:           headerLength,
+	}
+	if header.FrameLength < headerLength {
+		return nil, fmt.Errorf("invalid ADTS frame length: %d", header.FrameLength)
+	}
+
+	return header, nil
+}
+
+// ========================================
+// bit utilities
+
+type bitWriter struct {
+	b   []byte
+	pos int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		bit := byte(v>>uint(i)) & 0x01
+		w.b[len(w.b)-1] |= bit << (7 - uint(w.pos%8))
+		w.pos++
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.b
+}
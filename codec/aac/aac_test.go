@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package aac
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudioSpecificConfig(t *testing.T) {
+	bin := []byte{0x12, 0x10} // AAC-LC, 44.1kHz, 2ch
+
+	var config AudioSpecificConfig
+	err := DecodeAudioSpecificConfig(bytes.NewReader(bin), &config)
+	require.Nil(t, err)
+	require.Equal(t, AudioSpecificConfig{
+		ObjectType:             AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 4,
+		SamplingFrequency:      44100,
+		ChannelConfiguration:   2,
+	}, config)
+	require.Equal(t, "mp4a.40.2", config.Codec())
+	require.Equal(t, 2, config.Channels())
+
+	var buf bytes.Buffer
+	err = EncodeAudioSpecificConfig(&buf, &config)
+	require.Nil(t, err)
+	require.Equal(t, bin, buf.Bytes())
+}
+
+func TestDecodeBrokenAudioSpecificConfig(t *testing.T) {
+	var config AudioSpecificConfig
+	err := DecodeAudioSpecificConfig(bytes.NewReader([]byte{0x12}), &config)
+	require.NotNil(t, err)
+}
+
+func TestADTSHeader(t *testing.T) {
+	config := &AudioSpecificConfig{
+		ObjectType:             AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 3,
+		SamplingFrequency:      48000,
+		ChannelConfiguration:   2,
+	}
+
+	header, err := NewADTSHeader(config, 100)
+	require.Nil(t, err)
+
+	b := AppendADTSHeader(nil, header)
+	require.Equal(t, []byte{0xff, 0xf1, 0x4c, 0x80, 0x0d, 0x7f, 0xfc}, b)
+
+	actual, err := ParseADTSHeader(b)
+	require.Nil(t, err)
+	require.Equal(t, header, actual)
+	require.Equal(t, config, actual.AudioSpecificConfig())
+
+	_, err = ParseADTSHeader([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,203 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package av1
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/internal/bitreader"
+)
+
+type OBUType uint8
+
+const (
+	OBUTypeSequenceHeader       OBUType = 1
+	OBUTypeTemporalDelimiter    OBUType = 2
+	OBUTypeFrameHeader          OBUType = 3
+	OBUTypeTileGroup            OBUType = 4
+	OBUTypeMetadata             OBUType = 5
+	OBUTypeFrame                OBUType = 6
+	OBUTypeRedundantFrameHeader OBUType = 7
+	OBUTypeTileList             OBUType = 8
+	OBUTypePadding              OBUType = 15
+)
+
+type OBU struct {
+	Type    OBUType
+	Payload []byte // excluding the header and the size
+}
+
+// SplitOBUs splits OBUs in the low overhead bitstream format. The last OBU may omit its size.
+func SplitOBUs(b []byte) ([]OBU, error) {
+	var obus []OBU
+	for len(b) > 0 {
+		header := b[0]
+		if header&0x80 != 0 { // obu_forbidden_bit
+			return nil, fmt.Errorf("invalid OBU header")
+		}
+		obu := OBU{Type: OBUType(header >> 3 & 0x0f)}
+		b = b[1:]
+		if header&0x04 != 0 { // obu_extension_flag
+			if len(b) < 1 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			b = b[1:]
+		}
+
+		size := uint64(len(b))
+		if header&0x02 != 0 { // obu_has_size_field
+			var n int
+			var err error
+			if size, n, err = readLEB128(b); err != nil {
+				return nil, err
+			}
+			b = b[n:]
+			if size > uint64(len(b)) {
+				return nil, io.ErrUnexpectedEOF
+			}
+		}
+
+		obu.Payload = b[:size]
+		b = b[size:]
+		obus = append(obus, obu)
+	}
+	return obus, nil
+}
+
+func readLEB128(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0, io.ErrUnexpectedEOF
+		}
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid leb128")
+}
+
+// ========================================
+// Sequence header OBU (AV1 Bitstream & Decoding Process Specification 5.5)
+
+// SequenceHeader is a subset of fields in a sequence header OBU.
+type SequenceHeader struct {
+	SeqProfile     uint8
+	StillPicture   bool
+	MaxFrameWidth  uint32
+	MaxFrameHeight uint32
+}
+
+// FindSequenceHeader parses the first sequence header OBU in b. It returns nil if it is not found.
+func FindSequenceHeader(b []byte) (*SequenceHeader, error) {
+	obus, err := SplitOBUs(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, obu := range obus {
+		if obu.Type == OBUTypeSequenceHeader {
+			return ParseSequenceHeader(obu.Payload)
+		}
+	}
+	return nil, nil
+}
+
+// ParseSequenceHeader parses a payload of a sequence header OBU.
+func ParseSequenceHeader(b []byte) (*SequenceHeader, error) {
+	br := bitreader.New(b)
+
+	h := &SequenceHeader{
+		SeqProfile:   uint8(br.ReadBits(3)),
+		StillPicture: br.ReadBit() == 1,
+	}
+	if br.ReadBit() == 1 { // reduced_still_picture_header
+		br.ReadBits(5) // seq_level_idx[0]
+	} else {
+		decoderModelInfoPresent := false
+		bufferDelayLength := 0
+		if br.ReadBit() == 1 { // timing_info_present_flag
+			br.ReadBits(32)        // num_units_in_display_tick
+			br.ReadBits(32)        // time_scale
+			if br.ReadBit() == 1 { // equal_picture_interval
+				readUVLC(br) // num_ticks_per_picture_minus_1
+			}
+
+			decoderModelInfoPresent = br.ReadBit() == 1
+			if decoderModelInfoPresent {
+				bufferDelayLength = int(br.ReadBits(5)) + 1
+				br.ReadBits(32) // num_units_in_decoding_tick
+				br.ReadBits(5)  // buffer_removal_time_length_minus_1
+				br.ReadBits(5)  // frame_presentation_time_length_minus_1
+			}
+		}
+		initialDisplayDelayPresent := br.ReadBit() == 1
+
+		operatingPoints := int(br.ReadBits(5)) + 1
+		for i := 0; i < operatingPoints && br.Err() == nil; i++ {
+			br.ReadBits(12)         // operating_point_idc[i]
+			if br.ReadBits(5) > 7 { // seq_level_idx[i]
+				br.ReadBit() // seq_tier[i]
+			}
+			if decoderModelInfoPresent && br.ReadBit() == 1 { // decoder_model_present_for_this_op[i]
+				br.ReadBits(bufferDelayLength) // decoder_buffer_delay
+				br.ReadBits(bufferDelayLength) // encoder_buffer_delay
+				br.ReadBit()                   // low_delay_mode_flag
+			}
+			if initialDisplayDelayPresent && br.ReadBit() == 1 { // initial_display_delay_present_for_this_op[i]
+				br.ReadBits(4) // initial_display_delay_minus_1[i]
+			}
+		}
+	}
+
+	widthBits := int(br.ReadBits(4)) + 1
+	heightBits := int(br.ReadBits(4)) + 1
+	h.MaxFrameWidth = br.ReadBits(widthBits) + 1
+	h.MaxFrameHeight = br.ReadBits(heightBits) + 1
+
+	if err := br.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func readUVLC(br *bitreader.Reader) uint32 {
+	leadingZeros := 0
+	for br.ReadBit() == 0 && br.Err() == nil {
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return 1<<32 - 1
+	}
+	return br.ReadBits(leadingZeros) + (1<<uint(leadingZeros) - 1)
+}
+
+// ========================================
+// AV1CodecConfigurationRecord (AV1 Codec ISO Media File Format Binding 2.3)
+
+type CodecConfigurationRecord struct {
+	SeqProfile   uint8
+	SeqLevelIdx0 uint8
+	ConfigOBUs   []byte
+}
+
+func ParseCodecConfigurationRecord(b []byte) (*CodecConfigurationRecord, error) {
+	if len(b) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if b[0] != 0x81 { // marker, version
+		return nil, fmt.Errorf("unsupported AV1CodecConfigurationRecord: %#x", b[0])
+	}
+
+	return &CodecConfigurationRecord{
+		SeqProfile:   b[1] >> 5,
+		SeqLevelIdx0: b[1] & 0x1f,
+		ConfigOBUs:   b[4:],
+	}, nil
+}
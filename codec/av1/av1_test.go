@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package av1
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testSequenceHeader is a sequence header of 1920x1080 of main profile.
+var testSequenceHeader = []byte{0x00, 0x00, 0x00, 0x42, 0xab, 0xbf, 0xc3, 0x78}
+
+func TestSplitOBUs(t *testing.T) {
+	b := []byte{0x12, 0x00, 0x0a, 0x08}
+	b = append(b, testSequenceHeader...)
+	b = append(b, 0x30, 0x01, 0x02) // the last OBU without the size
+
+	obus, err := SplitOBUs(b)
+	require.Nil(t, err)
+	require.Equal(t, []OBU{
+		{Type: OBUTypeTemporalDelimiter, Payload: []byte{}},
+		{Type: OBUTypeSequenceHeader, Payload: testSequenceHeader},
+		{Type: OBUTypeFrame, Payload: []byte{0x01, 0x02}},
+	}, obus)
+
+	_, err = SplitOBUs([]byte{0x0a, 0x08, 0x00})
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestFindSequenceHeader(t *testing.T) {
+	h, err := FindSequenceHeader(append([]byte{0x0a, 0x08}, testSequenceHeader...))
+	require.Nil(t, err)
+	require.Equal(t, &SequenceHeader{MaxFrameWidth: 1920, MaxFrameHeight: 1080}, h)
+
+	h, err = FindSequenceHeader([]byte{0x12, 0x00})
+	require.Nil(t, err)
+	require.Nil(t, h)
+
+	_, err = ParseSequenceHeader(testSequenceHeader[:5])
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestParseCodecConfigurationRecord(t *testing.T) {
+	record := append([]byte{0x81, 0x08, 0x0c, 0x00, 0x0a, 0x08}, testSequenceHeader...)
+
+	r, err := ParseCodecConfigurationRecord(record)
+	require.Nil(t, err)
+	require.Equal(t, uint8(0), r.SeqProfile)
+	require.Equal(t, uint8(8), r.SeqLevelIdx0)
+	require.Equal(t, record[4:], r.ConfigOBUs)
+
+	_, err = ParseCodecConfigurationRecord([]byte{0x01, 0x08, 0x0c, 0x00})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ========================================
+// NAL units
+
+type NALUnitType uint8
+
+const (
+	NALUnitTypeNonIDR NALUnitType = 1
+	NALUnitTypeIDR    NALUnitType = 5
+	NALUnitTypeSEI    NALUnitType = 6
+	NALUnitTypeSPS    NALUnitType = 7
+	NALUnitTypePPS    NALUnitType = 8
+	NALUnitTypeAUD    NALUnitType = 9
+)
+
+// NALUnitTypeOf returns a type of the NAL unit. nalu must not be empty.
+func NALUnitTypeOf(nalu []byte) NALUnitType {
+	return NALUnitType(nalu[0] & 0x1f) // 0b00011111
+}
+
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// AccessUnitDelimiter is an AUD NAL unit which accepts any primary picture type.
+var AccessUnitDelimiter = []byte{0x09, 0xf0}
+
+// SplitAVCC splits length-prefixed NAL units (the format used in FLV/MP4).
+func SplitAVCC(b []byte, lengthSize int) ([][]byte, error) {
+	if lengthSize < 1 || lengthSize > 4 {
+		return nil, fmt.Errorf("invalid NAL unit length size: %d", lengthSize)
+	}
+
+	var nalus [][]byte
+	for len(b) > 0 {
+		if len(b) < lengthSize {
+			return nil, fmt.Errorf("NAL unit length is truncated: Remain = %d", len(b))
+		}
+
+		var size int
+		for i := 0; i < lengthSize; i++ {
+			size = size<<8 | int(b[i])
+		}
+		b = b[lengthSize:]
+
+		if size > len(b) {
+			return nil, fmt.Errorf("NAL unit is truncated: Size = %d, Remain = %d", size, len(b))
+		}
+		if size > 0 {
+			nalus = append(nalus, b[:size])
+		}
+		b = b[size:]
+	}
+
+	return nalus, nil
+}
+
+// AppendAVCC appends NAL units to dst with 4 bytes length prefixes.
+func AppendAVCC(dst []byte, nalus [][]byte) []byte {
+	ui32 := make([]byte, 4)
+	for _, nalu := range nalus {
+		binary.BigEndian.PutUint32(ui32, uint32(len(nalu)))
+		dst = append(dst, ui32...)
+		dst = append(dst, nalu...)
+	}
+	return dst
+}
+
+// SplitAnnexB splits a byte stream delimited by start codes (ITU-T H.264 Annex B).
+func SplitAnnexB(b []byte) [][]byte {
+	var nalus [][]byte
+
+	start := -1
+	for i := 0; i+2 < len(b); {
+		if b[i] != 0x00 || b[i+1] != 0x00 || b[i+2] != 0x01 {
+			i++
+			continue
+		}
+
+		if start >= 0 {
+			nalus = appendNALU(nalus, b[start:i])
+		}
+		i += 3
+		start = i
+	}
+	if start >= 0 {
+		nalus = appendNALU(nalus, b[start:])
+	}
+
+	return nalus
+}
+
+func appendNALU(nalus [][]byte, nalu []byte) [][]byte {
+	// trailing zeros belong to the next 4 bytes start code (or trailing_zero_8bits)
+	nalu = bytes.TrimRight(nalu, "\x00")
+	if len(nalu) == 0 {
+		return nalus
+	}
+	return append(nalus, nalu)
+}
+
+// AppendAnnexB appends NAL units to dst with 4 bytes start codes.
+func AppendAnnexB(dst []byte, nalus [][]byte) []byte {
+	for _, nalu := range nalus {
+		dst = append(dst, startCode...)
+		dst = append(dst, nalu...)
+	}
+	return dst
+}
+
+// ========================================
+// AVCDecoderConfigurationRecord (ISO/IEC 14496-15)
+
+type DecoderConfigurationRecord struct {
+	ConfigurationVersion uint8
+	AVCProfileIndication uint8
+	ProfileCompatibility uint8
+	AVCLevelIndication   uint8
+	LengthSizeMinusOne   uint8
+	SPS                  [][]byte
+	PPS                  [][]byte
+}
+
+// NewDecoderConfigurationRecord makes a record from parameter sets. At least one SPS is required.
+func NewDecoderConfigurationRecord(sps, pps [][]byte) (*DecoderConfigurationRecord, error) {
+	if len(sps) == 0 || len(sps[0]) < 4 {
+		return nil, fmt.Errorf("SPS is required")
+	}
+
+	return &DecoderConfigurationRecord{
+		ConfigurationVersion: 1,
+		AVCProfileIndication: sps[0][1],
+		ProfileCompatibility: sps[0][2],
+		AVCLevelIndication:   sps[0][3],
+		LengthSizeMinusOne:   3,
+		SPS:                  sps,
+		PPS:                  pps,
+	}, nil
+}
+
+// LengthSize returns a size of NAL unit length prefixes.
+func (r *DecoderConfigurationRecord) LengthSize() int {
+	return int(r.LengthSizeMinusOne) + 1
+}
+
+// Codec returns a codec string defined in RFC 6381 (e.g. avc1.64001f).
+func (r *DecoderConfigurationRecord) Codec() string {
+	return fmt.Sprintf("avc1.%02x%02x%02x", r.AVCProfileIndication, r.ProfileCompatibility, r.AVCLevelIndication)
+}
+
+// ParameterSets returns all SPS and PPS NAL units in this order.
+func (r *DecoderConfigurationRecord) ParameterSets() [][]byte {
+	nalus := make([][]byte, 0, len(r.SPS)+len(r.PPS))
+	nalus = append(nalus, r.SPS...)
+	nalus = append(nalus, r.PPS...)
+	return nalus
+}
+
+func DecodeDecoderConfigurationRecord(r io.Reader, record *DecoderConfigurationRecord) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if len(b) < 6 {
+		return io.ErrUnexpectedEOF
+	}
+	if b[0] != 1 {
+		return fmt.Errorf("unsupported configuration version: %d", b[0])
+	}
+
+	*record = DecoderConfigurationRecord{
+		ConfigurationVersion: b[0],
+		AVCProfileIndication: b[1],
+		ProfileCompatibility: b[2],
+		AVCLevelIndication:   b[3],
+		LengthSizeMinusOne:   b[4] & 0x03, // 0b00000011
+	}
+
+	numSPS := int(b[5] & 0x1f) // 0b00011111
+	b = b[6:]
+	if record.SPS, b, err = readParameterSets(b, numSPS); err != nil {
+		return fmt.Errorf("failed to decode SPS: %w", err)
+	}
+
+	if len(b) < 1 {
+		return io.ErrUnexpectedEOF
+	}
+	numPPS := int(b[0])
+	b = b[1:]
+	if record.PPS, _, err = readParameterSets(b, numPPS); err != nil {
+		return fmt.Errorf("failed to decode PPS: %w", err)
+	}
+
+	// extensions for high profiles are ignored
+
+	return nil
+}
+
+func readParameterSets(b []byte, n int) ([][]byte, []byte, error) {
+	sets := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if len(b) < 2 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		size := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < size {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		sets = append(sets, b[:size])
+		b = b[size:]
+	}
+	return sets, b, nil
+}
+
+func EncodeDecoderConfigurationRecord(w io.Writer, record *DecoderConfigurationRecord) error {
+	if len(record.SPS) > 0x1f {
+		return fmt.Errorf("too many SPS: %d", len(record.SPS))
+	}
+	if len(record.PPS) > 0xff {
+		return fmt.Errorf("too many PPS: %d", len(record.PPS))
+	}
+
+	buf := []byte{
+		record.ConfigurationVersion,
+		record.AVCProfileIndication,
+		record.ProfileCompatibility,
+		record.AVCLevelIndication,
+		0xfc | record.LengthSizeMinusOne&0x03, // reserved 0b111111
+		0xe0 | byte(len(record.SPS)),          // reserved 0b111
+	}
+	buf = appendParameterSets(buf, record.SPS)
+	buf = append(buf, byte(len(record.PPS)))
+	buf = appendParameterSets(buf, record.PPS)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendParameterSets(buf []byte, sets [][]byte) []byte {
+	ui16 := make([]byte, 2)
+	for _, set := range sets {
+		binary.BigEndian.PutUint16(ui16, uint16(len(set)))
+		buf = append(buf, ui16...)
+		buf = append(buf, set...)
+	}
+	return buf
+}
@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 1280x720, High profile, Level 3.1
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+func TestDecoderConfigurationRecord(t *testing.T) {
+	record, err := NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	require.Equal(t, "avc1.64001f", record.Codec())
+	require.Equal(t, 4, record.LengthSize())
+
+	var buf bytes.Buffer
+	err = EncodeDecoderConfigurationRecord(&buf, record)
+	require.Nil(t, err)
+
+	var actual DecoderConfigurationRecord
+	err = DecodeDecoderConfigurationRecord(&buf, &actual)
+	require.Nil(t, err)
+	require.Equal(t, record, &actual)
+}
+
+func TestDecodeBrokenDecoderConfigurationRecord(t *testing.T) {
+	var record DecoderConfigurationRecord
+	err := DecodeDecoderConfigurationRecord(bytes.NewReader([]byte{0x01, 0x64, 0x00, 0x1f, 0xff, 0xe1, 0x00, 0x10}), &record)
+	require.NotNil(t, err)
+}
+
+func TestAVCC(t *testing.T) {
+	nalus := [][]byte{testSPS, testPPS, {0x65, 0x88, 0x84}}
+
+	b := AppendAVCC(nil, nalus)
+	actual, err := SplitAVCC(b, 4)
+	require.Nil(t, err)
+	require.Equal(t, nalus, actual)
+
+	_, err = SplitAVCC(b[:len(b)-1], 4)
+	require.NotNil(t, err)
+}
+
+func TestAnnexB(t *testing.T) {
+	nalus := [][]byte{testSPS, testPPS, {0x65, 0x88, 0x84}}
+
+	b := AppendAnnexB(nil, nalus)
+	require.Equal(t, nalus, SplitAnnexB(b))
+
+	// 3 bytes start codes and trailing zeros
+	b = []byte{0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x00, 0x00, 0x01, 0x41, 0x9a, 0x00}
+	require.Equal(t, [][]byte{{0x09, 0xf0}, {0x65, 0x88}, {0x41, 0x9a}}, SplitAnnexB(b))
+
+	require.Equal(t, NALUnitTypeIDR, NALUnitTypeOf([]byte{0x65}))
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, err := ParseSPS(testSPS)
+	require.Nil(t, err)
+	require.Equal(t, uint8(100), sps.ProfileIdc)
+	require.Equal(t, uint8(31), sps.LevelIdc)
+	require.Equal(t, uint32(1280), sps.Width)
+	require.Equal(t, uint32(720), sps.Height)
+
+	_, err = ParseSPS(testPPS)
+	require.NotNil(t, err)
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	require.Equal(t, []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x03}, RemoveEmulationPrevention([]byte{0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x03}))
+}
+
+func TestParseSliceType(t *testing.T) {
+	for _, tc := range []struct {
+		nalu      []byte
+		sliceType SliceType
+	}{
+		{[]byte{0x65, 0x88, 0x84}, SliceTypeI}, // 7
+		{[]byte{0x41, 0x9a}, SliceTypeP},       // 5
+		{[]byte{0x01, 0xa0}, SliceTypeB},       // 1
+		{[]byte{0x01, 0x9c}, SliceTypeB},       // 6
+	} {
+		sliceType, err := ParseSliceType(tc.nalu)
+		require.Nil(t, err)
+		require.Equal(t, tc.sliceType, sliceType)
+	}
+
+	_, err := ParseSliceType(testSPS)
+	require.NotNil(t, err)
+	_, err = ParseSliceType([]byte{0x41, 0x00})
+	require.NotNil(t, err)
+}
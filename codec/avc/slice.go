@@ -0,0 +1,48 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avc
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/internal/bitreader"
+)
+
+type SliceType uint8
+
+const (
+	SliceTypeP  SliceType = 0
+	SliceTypeB  SliceType = 1
+	SliceTypeI  SliceType = 2
+	SliceTypeSP SliceType = 3
+	SliceTypeSI SliceType = 4
+)
+
+// ParseSliceType reads slice_type in the header of a slice NAL unit (including the NAL header).
+// Values 5-9 which mean all slices of the picture have the same type are folded into 0-4.
+func ParseSliceType(nalu []byte) (SliceType, error) {
+	if len(nalu) < 2 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if t := NALUnitTypeOf(nalu); t != NALUnitTypeNonIDR && t != NALUnitTypeIDR {
+		return 0, fmt.Errorf("not a slice: Type = %d", t)
+	}
+
+	br := bitreader.New(RemoveEmulationPrevention(nalu[1:]))
+	br.ReadUE() // first_mb_in_slice
+	sliceType := br.ReadUE()
+	if err := br.Err(); err != nil {
+		return 0, err
+	}
+	if sliceType > 9 {
+		return 0, fmt.Errorf("invalid slice type: %d", sliceType)
+	}
+
+	return SliceType(sliceType % 5), nil
+}
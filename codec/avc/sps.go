@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package avc
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/internal/bitreader"
+)
+
+// SPS is a subset of fields in a sequence parameter set.
+type SPS struct {
+	ProfileIdc      uint8
+	ConstraintFlags uint8
+	LevelIdc        uint8
+	ChromaFormatIdc uint32
+	Width           uint32 // cropped
+	Height          uint32 // cropped
+}
+
+// ParseSPS parses a SPS NAL unit (including the NAL header).
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if NALUnitTypeOf(nalu) != NALUnitTypeSPS {
+		return nil, fmt.Errorf("not a SPS: Type = %d", NALUnitTypeOf(nalu))
+	}
+
+	sps := &SPS{
+		ProfileIdc:      nalu[1],
+		ConstraintFlags: nalu[2],
+		LevelIdc:        nalu[3],
+		ChromaFormatIdc: 1,
+	}
+
+	br := bitreader.New(RemoveEmulationPrevention(nalu[4:]))
+	br.ReadUE() // seq_parameter_set_id
+
+	separateColourPlane := false
+	switch sps.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.ChromaFormatIdc = br.ReadUE()
+		if sps.ChromaFormatIdc == 3 {
+			separateColourPlane = br.ReadBit() == 1
+		}
+		br.ReadUE()            // bit_depth_luma_minus8
+		br.ReadUE()            // bit_depth_chroma_minus8
+		br.ReadBit()           // qpprime_y_zero_transform_bypass_flag
+		if br.ReadBit() == 1 { // seq_scaling_matrix_present_flag
+			n := 8
+			if sps.ChromaFormatIdc == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if br.ReadBit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipScalingList(br, size)
+			}
+		}
+	}
+
+	br.ReadUE()          // log2_max_frame_num_minus4
+	switch br.ReadUE() { // pic_order_cnt_type
+	case 0:
+		br.ReadUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		br.ReadBit() // delta_pic_order_always_zero_flag
+		br.ReadSE()  // offset_for_non_ref_pic
+		br.ReadSE()  // offset_for_top_to_bottom_field
+		n := br.ReadUE()
+		for i := uint32(0); i < n && br.Err() == nil; i++ {
+			br.ReadSE() // offset_for_ref_frame
+		}
+	}
+	br.ReadUE()  // max_num_ref_frames
+	br.ReadBit() // gaps_in_frame_num_value_allowed_flag
+
+	widthInMbs := br.ReadUE() + 1
+	heightInMapUnits := br.ReadUE() + 1
+	frameMbsOnly := br.ReadBit()
+	if frameMbsOnly == 0 {
+		br.ReadBit() // mb_adaptive_frame_field_flag
+	}
+	br.ReadBit() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if br.ReadBit() == 1 { // frame_cropping_flag
+		cropLeft = br.ReadUE()
+		cropRight = br.ReadUE()
+		cropTop = br.ReadUE()
+		cropBottom = br.ReadUE()
+	}
+
+	if br.Err() != nil {
+		return nil, br.Err()
+	}
+
+	cropUnitX, cropUnitY := uint32(1), 2-frameMbsOnly
+	if !separateColourPlane && sps.ChromaFormatIdc != 0 {
+		subWidthC, subHeightC := uint32(2), uint32(2) // 4:2:0
+		switch sps.ChromaFormatIdc {
+		case 2: // 4:2:2
+			subHeightC = 1
+		case 3: // 4:4:4
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX = subWidthC
+		cropUnitY = subHeightC * (2 - frameMbsOnly)
+	}
+
+	sps.Width = widthInMbs*16 - (cropLeft+cropRight)*cropUnitX
+	sps.Height = (2-frameMbsOnly)*heightInMapUnits*16 - (cropTop+cropBottom)*cropUnitY
+
+	return sps, nil
+}
+
+// RemoveEmulationPrevention converts a NAL unit payload into RBSP (removes 0x03 of 0x000003).
+func RemoveEmulationPrevention(b []byte) []byte {
+	rbsp := make([]byte, 0, len(b))
+	zeros := 0
+	for _, v := range b {
+		if zeros >= 2 && v == 0x03 {
+			zeros = 0
+			continue
+		}
+		if v == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, v)
+	}
+	return rbsp
+}
+
+func skipScalingList(r *bitreader.Reader, size int) {
+	lastScale, nextScale := int32(8), int32(8)
+	for i := 0; i < size && r.Err() == nil; i++ {
+		if nextScale != 0 {
+			delta := r.ReadSE()
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
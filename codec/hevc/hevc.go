@@ -0,0 +1,198 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hevc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ========================================
+// NAL units
+
+type NALUnitType uint8
+
+const (
+	NALUnitTypeBLAWLP    NALUnitType = 16
+	NALUnitTypeCRANUT    NALUnitType = 21
+	NALUnitTypeRSVIRAP23 NALUnitType = 23
+	NALUnitTypeVPS       NALUnitType = 32
+	NALUnitTypeSPS       NALUnitType = 33
+	NALUnitTypePPS       NALUnitType = 34
+	NALUnitTypeAUD       NALUnitType = 35
+)
+
+// NALUnitTypeOf returns a type of the NAL unit. nalu must not be empty.
+func NALUnitTypeOf(nalu []byte) NALUnitType {
+	return NALUnitType(nalu[0]>>1) & 0x3f // 0b01111110
+}
+
+// IsIRAP reports whether the NAL unit is a intra random access point picture.
+func IsIRAP(t NALUnitType) bool {
+	return t >= NALUnitTypeBLAWLP && t <= NALUnitTypeRSVIRAP23
+}
+
+// AccessUnitDelimiter is an AUD NAL unit which accepts any slice type.
+var AccessUnitDelimiter = []byte{0x46, 0x01, 0x50}
+
+// ========================================
+// HEVCDecoderConfigurationRecord (ISO/IEC 14496-15)
+
+type DecoderConfigurationRecord struct {
+	ConfigurationVersion             uint8
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  bool
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  uint64 // 48bits
+	GeneralLevelIdc                  uint8
+	MinSpatialSegmentationIdc        uint16
+	ParallelismType                  uint8
+	ChromaFormatIdc                  uint8
+	BitDepthLumaMinus8               uint8
+	BitDepthChromaMinus8             uint8
+	AvgFrameRate                     uint16
+	ConstantFrameRate                uint8
+	NumTemporalLayers                uint8
+	TemporalIDNested                 bool
+	LengthSizeMinusOne               uint8
+	Arrays                           []*NALUnitArray
+}
+
+type NALUnitArray struct {
+	ArrayCompleteness bool
+	NALUnitType       NALUnitType
+	NALUnits          [][]byte
+}
+
+const recordHeaderLength = 23
+
+// LengthSize returns a size of NAL unit length prefixes.
+func (r *DecoderConfigurationRecord) LengthSize() int {
+	return int(r.LengthSizeMinusOne) + 1
+}
+
+// ParameterSets returns all NAL units in arrays (VPS, SPS and PPS in the order of arrays).
+func (r *DecoderConfigurationRecord) ParameterSets() [][]byte {
+	var nalus [][]byte
+	for _, array := range r.Arrays {
+		nalus = append(nalus, array.NALUnits...)
+	}
+	return nalus
+}
+
+func DecodeDecoderConfigurationRecord(r io.Reader, record *DecoderConfigurationRecord) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if len(b) < recordHeaderLength {
+		return io.ErrUnexpectedEOF
+	}
+	if b[0] != 1 {
+		return fmt.Errorf("unsupported configuration version: %d", b[0])
+	}
+
+	*record = DecoderConfigurationRecord{
+		ConfigurationVersion:             b[0],
+		GeneralProfileSpace:              b[1] >> 6,
+		GeneralTierFlag:                  b[1]&0x20 != 0,
+		GeneralProfileIdc:                b[1] & 0x1f,
+		GeneralProfileCompatibilityFlags: binary.BigEndian.Uint32(b[2:]),
+		GeneralConstraintIndicatorFlags:  uint64(binary.BigEndian.Uint16(b[6:]))<<32 | uint64(binary.BigEndian.Uint32(b[8:])),
+		GeneralLevelIdc:                  b[12],
+		MinSpatialSegmentationIdc:        binary.BigEndian.Uint16(b[13:]) & 0x0fff,
+		ParallelismType:                  b[15] & 0x03,
+		ChromaFormatIdc:                  b[16] & 0x03,
+		BitDepthLumaMinus8:               b[17] & 0x07,
+		BitDepthChromaMinus8:             b[18] & 0x07,
+		AvgFrameRate:                     binary.BigEndian.Uint16(b[19:]),
+		ConstantFrameRate:                b[21] >> 6,
+		NumTemporalLayers:                (b[21] >> 3) & 0x07,
+		TemporalIDNested:                 b[21]&0x04 != 0,
+		LengthSizeMinusOne:               b[21] & 0x03,
+	}
+
+	numOfArrays := int(b[22])
+	b = b[recordHeaderLength:]
+	for i := 0; i < numOfArrays; i++ {
+		if len(b) < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		array := &NALUnitArray{
+			ArrayCompleteness: b[0]&0x80 != 0,
+			NALUnitType:       NALUnitType(b[0] & 0x3f),
+		}
+		numNalus := int(binary.BigEndian.Uint16(b[1:]))
+		b = b[3:]
+		for j := 0; j < numNalus; j++ {
+			if len(b) < 2 {
+				return io.ErrUnexpectedEOF
+			}
+			size := int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+			if len(b) < size {
+				return io.ErrUnexpectedEOF
+			}
+			array.NALUnits = append(array.NALUnits, b[:size])
+			b = b[size:]
+		}
+		record.Arrays = append(record.Arrays, array)
+	}
+
+	return nil
+}
+
+func EncodeDecoderConfigurationRecord(w io.Writer, record *DecoderConfigurationRecord) error {
+	if len(record.Arrays) > 0xff {
+		return fmt.Errorf("too many arrays: %d", len(record.Arrays))
+	}
+
+	buf := make([]byte, recordHeaderLength, 64)
+	buf[0] = record.ConfigurationVersion
+	buf[1] = record.GeneralProfileSpace<<6 | record.GeneralProfileIdc&0x1f
+	if record.GeneralTierFlag {
+		buf[1] |= 0x20
+	}
+	binary.BigEndian.PutUint32(buf[2:], record.GeneralProfileCompatibilityFlags)
+	binary.BigEndian.PutUint16(buf[6:], uint16(record.GeneralConstraintIndicatorFlags>>32))
+	binary.BigEndian.PutUint32(buf[8:], uint32(record.GeneralConstraintIndicatorFlags))
+	buf[12] = record.GeneralLevelIdc
+	binary.BigEndian.PutUint16(buf[13:], 0xf000|record.MinSpatialSegmentationIdc&0x0fff)
+	buf[15] = 0xfc | record.ParallelismType&0x03
+	buf[16] = 0xfc | record.ChromaFormatIdc&0x03
+	buf[17] = 0xf8 | record.BitDepthLumaMinus8&0x07
+	buf[18] = 0xf8 | record.BitDepthChromaMinus8&0x07
+	binary.BigEndian.PutUint16(buf[19:], record.AvgFrameRate)
+	buf[21] = record.ConstantFrameRate<<6 | (record.NumTemporalLayers&0x07)<<3 | record.LengthSizeMinusOne&0x03
+	if record.TemporalIDNested {
+		buf[21] |= 0x04
+	}
+	buf[22] = byte(len(record.Arrays))
+
+	ui16 := make([]byte, 2)
+	for _, array := range record.Arrays {
+		v := byte(array.NALUnitType) & 0x3f
+		if array.ArrayCompleteness {
+			v |= 0x80
+		}
+		buf = append(buf, v)
+		binary.BigEndian.PutUint16(ui16, uint16(len(array.NALUnits)))
+		buf = append(buf, ui16...)
+		for _, nalu := range array.NALUnits {
+			binary.BigEndian.PutUint16(ui16, uint16(len(nalu)))
+			buf = append(buf, ui16...)
+			buf = append(buf, nalu...)
+		}
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
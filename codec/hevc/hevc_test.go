@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hevc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Parameter sets are dummies except NAL unit headers
+var (
+	testVPS = []byte{0x40, 0x01, 0x0c, 0x01}
+	testSPS = []byte{0x42, 0x01, 0x01, 0x01}
+	testPPS = []byte{0x44, 0x01, 0xc1, 0x72}
+)
+
+func TestDecoderConfigurationRecord(t *testing.T) {
+	record := &DecoderConfigurationRecord{
+		ConfigurationVersion:             1,
+		GeneralProfileIdc:                1,
+		GeneralProfileCompatibilityFlags: 0x60000000,
+		GeneralConstraintIndicatorFlags:  0x900000000000,
+		GeneralLevelIdc:                  93,
+		ChromaFormatIdc:                  1,
+		NumTemporalLayers:                1,
+		TemporalIDNested:                 true,
+		LengthSizeMinusOne:               3,
+		Arrays: []*NALUnitArray{
+			{ArrayCompleteness: true, NALUnitType: NALUnitTypeVPS, NALUnits: [][]byte{testVPS}},
+			{ArrayCompleteness: true, NALUnitType: NALUnitTypeSPS, NALUnits: [][]byte{testSPS}},
+			{ArrayCompleteness: true, NALUnitType: NALUnitTypePPS, NALUnits: [][]byte{testPPS}},
+		},
+	}
+	require.Equal(t, 4, record.LengthSize())
+	require.Equal(t, [][]byte{testVPS, testSPS, testPPS}, record.ParameterSets())
+
+	var buf bytes.Buffer
+	err := EncodeDecoderConfigurationRecord(&buf, record)
+	require.Nil(t, err)
+	require.Equal(t, 23+3*(3+2+4), buf.Len())
+
+	var actual DecoderConfigurationRecord
+	err = DecodeDecoderConfigurationRecord(&buf, &actual)
+	require.Nil(t, err)
+	require.Equal(t, record, &actual)
+}
+
+func TestDecodeBrokenDecoderConfigurationRecord(t *testing.T) {
+	var record DecoderConfigurationRecord
+	err := DecodeDecoderConfigurationRecord(bytes.NewReader([]byte{0x01, 0x01, 0x60}), &record)
+	require.NotNil(t, err)
+}
+
+func TestNALUnitTypeOf(t *testing.T) {
+	require.Equal(t, NALUnitTypeVPS, NALUnitTypeOf(testVPS))
+	require.Equal(t, NALUnitTypeSPS, NALUnitTypeOf(testSPS))
+	require.Equal(t, NALUnitTypePPS, NALUnitTypeOf(testPPS))
+
+	require.True(t, IsIRAP(NALUnitTypeOf([]byte{0x26, 0x01})))  // IDR_W_RADL
+	require.False(t, IsIRAP(NALUnitTypeOf([]byte{0x02, 0x01}))) // TRAIL_R
+}
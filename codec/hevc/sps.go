@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hevc
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/internal/bitreader"
+)
+
+// SPS is a subset of fields in a sequence parameter set.
+type SPS struct {
+	GeneralProfileIdc uint8
+	GeneralLevelIdc   uint8
+	ChromaFormatIdc   uint32
+	Width             uint32 // cropped
+	Height            uint32 // cropped
+}
+
+// ParseSPS parses a SPS NAL unit (including the 2 bytes NAL header).
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 3 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if NALUnitTypeOf(nalu) != NALUnitTypeSPS {
+		return nil, fmt.Errorf("not a SPS: Type = %d", NALUnitTypeOf(nalu))
+	}
+
+	br := bitreader.New(avc.RemoveEmulationPrevention(nalu[2:]))
+	br.ReadBits(4) // sps_video_parameter_set_id
+	maxSubLayersMinus1 := int(br.ReadBits(3))
+	br.ReadBit() // sps_temporal_id_nesting_flag
+
+	// profile_tier_level(1, sps_max_sub_layers_minus1)
+	br.ReadBits(3) // general_profile_space, general_tier_flag
+	sps := &SPS{
+		GeneralProfileIdc: uint8(br.ReadBits(5)),
+	}
+	br.ReadBits(32) // general_profile_compatibility_flag[32]
+	br.ReadBits(32) // general_progressive_source_flag ... (48 bits)
+	br.ReadBits(16)
+	sps.GeneralLevelIdc = uint8(br.ReadBits(8))
+
+	subLayerProfilePresent := make([]bool, maxSubLayersMinus1)
+	subLayerLevelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		subLayerProfilePresent[i] = br.ReadBit() == 1
+		subLayerLevelPresent[i] = br.ReadBit() == 1
+	}
+	if maxSubLayersMinus1 > 0 {
+		for i := maxSubLayersMinus1; i < 8; i++ {
+			br.ReadBits(2) // reserved_zero_2bits
+		}
+	}
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if subLayerProfilePresent[i] {
+			br.ReadBits(32) // 88 bits
+			br.ReadBits(32)
+			br.ReadBits(24)
+		}
+		if subLayerLevelPresent[i] {
+			br.ReadBits(8) // sub_layer_level_idc
+		}
+	}
+
+	br.ReadUE() // sps_seq_parameter_set_id
+	sps.ChromaFormatIdc = br.ReadUE()
+	separateColourPlane := false
+	if sps.ChromaFormatIdc == 3 {
+		separateColourPlane = br.ReadBit() == 1
+	}
+	width := br.ReadUE()  // pic_width_in_luma_samples
+	height := br.ReadUE() // pic_height_in_luma_samples
+
+	var confLeft, confRight, confTop, confBottom uint32
+	if br.ReadBit() == 1 { // conformance_window_flag
+		confLeft = br.ReadUE()
+		confRight = br.ReadUE()
+		confTop = br.ReadUE()
+		confBottom = br.ReadUE()
+	}
+
+	if br.Err() != nil {
+		return nil, br.Err()
+	}
+
+	subWidthC, subHeightC := uint32(1), uint32(1)
+	if !separateColourPlane {
+		switch sps.ChromaFormatIdc {
+		case 1: // 4:2:0
+			subWidthC, subHeightC = 2, 2
+		case 2: // 4:2:2
+			subWidthC = 2
+		}
+	}
+
+	sps.Width = width - (confLeft+confRight)*subWidthC
+	sps.Height = height - (confTop+confBottom)*subHeightC
+
+	return sps, nil
+}
@@ -0,0 +1,39 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hevc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 1920x1080 (cropped from 1920x1088), Main profile, Level 4
+var testRealSPS = []byte{
+	0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
+	0x00, 0x78, 0xa0, 0x03, 0xc0, 0x80, 0x10, 0xe5, 0x96, 0x66, 0x69, 0x24, 0xca, 0xe0, 0x10, 0x00,
+	0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x01, 0xe0, 0x80,
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, err := ParseSPS(testRealSPS)
+	require.Nil(t, err)
+	require.Equal(t, &SPS{
+		GeneralProfileIdc: 1,
+		GeneralLevelIdc:   120,
+		ChromaFormatIdc:   1,
+		Width:             1920,
+		Height:            1080,
+	}, sps)
+
+	_, err = ParseSPS(testRealSPS[:20])
+	require.NotNil(t, err)
+
+	_, err = ParseSPS(testVPS)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// HeaderLength is a size of MPEG audio frame headers.
+const HeaderLength = 4
+
+type Version uint8
+
+const (
+	Version2_5 Version = 0
+	Version2   Version = 2
+	Version1   Version = 3
+)
+
+type Layer uint8
+
+const (
+	Layer3 Layer = 1
+	Layer2 Layer = 2
+	Layer1 Layer = 3
+)
+
+type ChannelMode uint8
+
+const (
+	ChannelModeStereo      ChannelMode = 0
+	ChannelModeJointStereo ChannelMode = 1
+	ChannelModeDualChannel ChannelMode = 2
+	ChannelModeMono        ChannelMode = 3
+)
+
+// in kbps, indexed by [version == 1 ? 0 : 1][layer][bitrate index]
+var bitrates = [2][4][16]uint32{
+	{
+		{},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+	},
+	{
+		{},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+	},
+}
+
+// indexed by [version][sampling rate index]
+var samplingRates = [4][3]uint32{
+	{11025, 12000, 8000},
+	{},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+// FrameHeader is a header of MPEG-1/2/2.5 audio frames (ISO/IEC 11172-3, 13818-3).
+type FrameHeader struct {
+	Version      Version
+	Layer        Layer
+	Protected    bool // CRC follows the header
+	Bitrate      uint32
+	SamplingRate uint32
+	Padding      bool
+	ChannelMode  ChannelMode
+}
+
+// Channels returns a number of channels.
+func (h *FrameHeader) Channels() int {
+	if h.ChannelMode == ChannelModeMono {
+		return 1
+	}
+	return 2
+}
+
+// SamplesPerFrame returns a number of PCM samples in the frame.
+func (h *FrameHeader) SamplesPerFrame() int {
+	switch {
+	case h.Layer == Layer1:
+		return 384
+	case h.Layer == Layer3 && h.Version != Version1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// FrameLength returns a size of the frame including the header.
+func (h *FrameHeader) FrameLength() int {
+	if h.Layer == Layer1 {
+		length := int(12 * h.Bitrate / h.SamplingRate)
+		if h.Padding {
+			length++
+		}
+		return length * 4
+	}
+
+	length := int(uint32(h.SamplesPerFrame()/8) * h.Bitrate / h.SamplingRate)
+	if h.Padding {
+		length++
+	}
+	return length
+}
+
+// IsSync reports whether b starts with a frame sync word.
+func IsSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xff && b[1]&0xe0 == 0xe0
+}
+
+// ParseFrameHeader parses a header at the head of b.
+func ParseFrameHeader(b []byte) (*FrameHeader, error) {
+	if len(b) < HeaderLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if !IsSync(b) {
+		return nil, fmt.Errorf("MPEG audio sync word is not found")
+	}
+
+	version := Version((b[1] >> 3) & 0x03)
+	if version == 1 {
+		return nil, fmt.Errorf("reserved MPEG audio version")
+	}
+	layer := Layer((b[1] >> 1) & 0x03)
+	if layer == 0 {
+		return nil, fmt.Errorf("reserved MPEG audio layer")
+	}
+
+	bitrateIndex := b[2] >> 4
+	if bitrateIndex == 0 {
+		return nil, fmt.Errorf("free format bitrate is not supported")
+	}
+	if bitrateIndex == 0x0f {
+		return nil, fmt.Errorf("invalid bitrate index: %d", bitrateIndex)
+	}
+	samplingRateIndex := (b[2] >> 2) & 0x03
+	if samplingRateIndex == 0x03 {
+		return nil, fmt.Errorf("invalid sampling rate index: %d", samplingRateIndex)
+	}
+
+	bitrateTable := 0
+	if version != Version1 {
+		bitrateTable = 1
+	}
+
+	return &FrameHeader{
+		Version:      version,
+		Layer:        layer,
+		Protected:    b[1]&0x01 == 0,
+		Bitrate:      bitrates[bitrateTable][layer][bitrateIndex] * 1000,
+		SamplingRate: samplingRates[version][samplingRateIndex],
+		Padding:      b[2]&0x02 != 0,
+		ChannelMode:  ChannelMode(b[3] >> 6),
+	}, nil
+}
+
+// ========================================
+// Elementary streams
+
+// Reader reads frames from an MPEG audio elementary stream (e.g. .mp3 files).
+type Reader struct {
+	r       *bufio.Reader
+	started bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// ReadFrame returns the header and the whole frame including the header. It returns io.EOF at the end of the stream.
+// An ID3v2 tag at the head of the stream and garbage between frames (e.g. an ID3v1 tag) are skipped.
+func (r *Reader) ReadFrame() (*FrameHeader, []byte, error) {
+	if !r.started {
+		r.started = true
+		if err := r.skipID3v2(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for {
+		b, err := r.r.Peek(HeaderLength)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil, io.EOF
+			}
+			return nil, nil, err
+		}
+
+		header, err := ParseFrameHeader(b)
+		if err != nil {
+			// resync
+			if _, err := r.r.Discard(1); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		frame := make([]byte, header.FrameLength())
+		if _, err := io.ReadFull(r.r, frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, nil, err
+		}
+
+		return header, frame, nil
+	}
+}
+
+const id3v2HeaderLength = 10
+
+func (r *Reader) skipID3v2() error {
+	b, err := r.r.Peek(id3v2HeaderLength)
+	if err != nil {
+		if err == io.EOF {
+			return nil // too short to have a tag
+		}
+		return err
+	}
+	if string(b[0:3]) != "ID3" {
+		return nil
+	}
+
+	// size is a syncsafe integer which excludes the header and the footer
+	size := int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f)
+	size += id3v2HeaderLength
+	if b[5]&0x10 != 0 { // footer present
+		size += id3v2HeaderLength
+	}
+
+	_, err = r.r.Discard(size)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
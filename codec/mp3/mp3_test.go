@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFrameHeader(t *testing.T) {
+	type testCase struct {
+		Name            string
+		Binary          []byte
+		Header          *FrameHeader
+		FrameLength     int
+		SamplesPerFrame int
+		Channels        int
+	}
+
+	testCases := []testCase{
+		{
+			Name:   "MPEG-1 Layer III, 128kbps, 44100Hz, joint stereo",
+			Binary: []byte{0xff, 0xfb, 0x90, 0x64},
+			Header: &FrameHeader{
+				Version:      Version1,
+				Layer:        Layer3,
+				Bitrate:      128000,
+				SamplingRate: 44100,
+				ChannelMode:  ChannelModeJointStereo,
+			},
+			FrameLength:     417,
+			SamplesPerFrame: 1152,
+			Channels:        2,
+		},
+		{
+			Name:   "MPEG-2 Layer III, 64kbps, 22050Hz, mono, padded",
+			Binary: []byte{0xff, 0xf3, 0x82, 0xc4},
+			Header: &FrameHeader{
+				Version:      Version2,
+				Layer:        Layer3,
+				Bitrate:      64000,
+				SamplingRate: 22050,
+				Padding:      true,
+				ChannelMode:  ChannelModeMono,
+			},
+			FrameLength:     209,
+			SamplesPerFrame: 576,
+			Channels:        1,
+		},
+		{
+			Name:   "MPEG-2.5 Layer III, 8kbps, 8000Hz, mono",
+			Binary: []byte{0xff, 0xe3, 0x18, 0xc4},
+			Header: &FrameHeader{
+				Version:      Version2_5,
+				Layer:        Layer3,
+				Bitrate:      8000,
+				SamplingRate: 8000,
+				ChannelMode:  ChannelModeMono,
+			},
+			FrameLength:     72,
+			SamplesPerFrame: 576,
+			Channels:        1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			header, err := ParseFrameHeader(tc.Binary)
+			require.Nil(t, err)
+			require.Equal(t, tc.Header, header)
+			require.Equal(t, tc.FrameLength, header.FrameLength())
+			require.Equal(t, tc.SamplesPerFrame, header.SamplesPerFrame())
+			require.Equal(t, tc.Channels, header.Channels())
+		})
+	}
+}
+
+func TestParseBrokenFrameHeader(t *testing.T) {
+	_, err := ParseFrameHeader([]byte{0xff, 0xfb})
+	require.NotNil(t, err)
+
+	_, err = ParseFrameHeader([]byte{0x49, 0x44, 0x33, 0x04}) // ID3
+	require.NotNil(t, err)
+
+	_, err = ParseFrameHeader([]byte{0xff, 0xfb, 0x00, 0x64}) // free format
+	require.NotNil(t, err)
+}
+
+func TestReader(t *testing.T) {
+	frame := append([]byte{0xff, 0xe3, 0x18, 0xc4}, bytes.Repeat([]byte{0x55}, 68)...) // 72 bytes
+
+	var stream []byte
+	stream = append(stream, 'I', 'D', '3', 0x04, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00) // 128 bytes
+	stream = append(stream, bytes.Repeat([]byte{0xff}, 128)...)                      // looks like sync words
+	stream = append(stream, frame...)
+	stream = append(stream, 0x00, 0x01) // garbage
+	stream = append(stream, frame...)
+	stream = append(stream, 'T', 'A', 'G') // ID3v1 (truncated)
+
+	r := NewReader(bytes.NewReader(stream))
+	for i := 0; i < 2; i++ {
+		header, actual, err := r.ReadFrame()
+		require.Nil(t, err)
+		require.Equal(t, uint32(8000), header.SamplingRate)
+		require.Equal(t, frame, actual)
+	}
+	_, _, err := r.ReadFrame()
+	require.Equal(t, io.EOF, err)
+}
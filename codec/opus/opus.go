@@ -0,0 +1,48 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package opus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SampleRate is a sampling rate of decoded Opus, which is always 48kHz regardless of the input.
+const SampleRate = 48000
+
+// IDHeaderLength is a size of identification headers without the channel mapping table.
+const IDHeaderLength = 19
+
+// IDHeader is an identification header "OpusHead" (RFC 7845 5.1).
+type IDHeader struct {
+	Version              uint8
+	ChannelCount         uint8
+	PreSkip              uint16 // in 48kHz samples
+	InputSampleRate      uint32
+	OutputGain           int16
+	ChannelMappingFamily uint8
+}
+
+func ParseIDHeader(b []byte) (*IDHeader, error) {
+	if len(b) < IDHeaderLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if string(b[:8]) != "OpusHead" {
+		return nil, fmt.Errorf("magic signature is not matched")
+	}
+
+	return &IDHeader{
+		Version:              b[8],
+		ChannelCount:         b[9],
+		PreSkip:              binary.LittleEndian.Uint16(b[10:]),
+		InputSampleRate:      binary.LittleEndian.Uint32(b[12:]),
+		OutputGain:           int16(binary.LittleEndian.Uint16(b[16:])),
+		ChannelMappingFamily: b[18],
+	}, nil
+}
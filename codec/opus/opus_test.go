@@ -0,0 +1,42 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package opus
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIDHeader(t *testing.T) {
+	b := []byte{
+		'O', 'p', 'u', 's', 'H', 'e', 'a', 'd',
+		0x01,       // version
+		0x02,       // channel count
+		0x38, 0x01, // pre-skip 312
+		0x80, 0xbb, 0x00, 0x00, // input sample rate 48000
+		0x00, 0x00, // output gain
+		0x00, // channel mapping family
+	}
+
+	h, err := ParseIDHeader(b)
+	require.Nil(t, err)
+	require.Equal(t, &IDHeader{
+		Version:         1,
+		ChannelCount:    2,
+		PreSkip:         312,
+		InputSampleRate: 48000,
+	}, h)
+
+	_, err = ParseIDHeader(b[:18])
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = ParseIDHeader(append([]byte("OpusTags"), b[8:]...))
+	require.EqualError(t, err, "magic signature is not matched")
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package vp9
+
+import (
+	"fmt"
+
+	"github.com/yutopp/go-flv/internal/bitreader"
+)
+
+const (
+	frameMarker = 2
+	syncCode    = 0x498342
+	csRGB       = 7
+)
+
+// FrameHeader is a subset of fields in an uncompressed header of a frame (VP9 Bitstream
+// Specification 6.2). Width and Height are set only for key frames.
+type FrameHeader struct {
+	Profile           uint8
+	ShowExistingFrame bool
+	KeyFrame          bool
+	Width             uint32
+	Height            uint32
+}
+
+// ParseFrameHeader parses the header of a frame. For a superframe, it is the first frame.
+func ParseFrameHeader(b []byte) (*FrameHeader, error) {
+	br := bitreader.New(b)
+	if br.ReadBits(2) != frameMarker {
+		return nil, fmt.Errorf("invalid frame marker")
+	}
+	profileLow := br.ReadBit()
+	profile := br.ReadBit()<<1 | profileLow
+	if profile == 3 {
+		br.ReadBit() // reserved_zero
+	}
+
+	h := &FrameHeader{Profile: uint8(profile)}
+	if br.ReadBit() == 1 { // show_existing_frame
+		h.ShowExistingFrame = true
+		return h, br.Err()
+	}
+	h.KeyFrame = br.ReadBit() == 0 // frame_type
+	br.ReadBit()                   // show_frame
+	br.ReadBit()                   // error_resilient_mode
+	if !h.KeyFrame {
+		return h, br.Err()
+	}
+
+	if br.ReadBits(24) != syncCode {
+		if err := br.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid sync code")
+	}
+
+	// color_config
+	if profile >= 2 {
+		br.ReadBit() // ten_or_twelve_bit
+	}
+	if br.ReadBits(3) != csRGB { // color_space
+		br.ReadBit() // color_range
+		if profile == 1 || profile == 3 {
+			br.ReadBits(3) // subsampling_x, subsampling_y, reserved_zero
+		}
+	} else if profile == 1 || profile == 3 {
+		br.ReadBit() // reserved_zero
+	}
+
+	// frame_size
+	h.Width = br.ReadBits(16) + 1
+	h.Height = br.ReadBits(16) + 1
+
+	if err := br.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,34 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package vp9
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyFrame is a header of a 1280x720 key frame of profile 0.
+var testKeyFrame = []byte{0x82, 0x49, 0x83, 0x42, 0x00, 0x4f, 0xf0, 0x2c, 0xf0}
+
+func TestParseFrameHeader(t *testing.T) {
+	h, err := ParseFrameHeader(testKeyFrame)
+	require.Nil(t, err)
+	require.Equal(t, &FrameHeader{KeyFrame: true, Width: 1280, Height: 720}, h)
+
+	h, err = ParseFrameHeader([]byte{0x86, 0x00}) // inter frame
+	require.Nil(t, err)
+	require.Equal(t, &FrameHeader{}, h)
+
+	_, err = ParseFrameHeader([]byte{0x02, 0x00})
+	require.EqualError(t, err, "invalid frame marker")
+
+	_, err = ParseFrameHeader(testKeyFrame[:6])
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Subset of ISO/IEC 23009-1 MPD elements.
+
+type MPD struct {
+	XMLName                    xml.Name `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                   string   `xml:"profiles,attr"`
+	Type                       string   `xml:"type,attr"`
+	AvailabilityStartTime      string   `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime                string   `xml:"publishTime,attr,omitempty"`
+	MediaPresentationDuration  string   `xml:"mediaPresentationDuration,attr,omitempty"`
+	MinimumUpdatePeriod        string   `xml:"minimumUpdatePeriod,attr,omitempty"`
+	MinBufferTime              string   `xml:"minBufferTime,attr"`
+	TimeShiftBufferDepth       string   `xml:"timeShiftBufferDepth,attr,omitempty"`
+	SuggestedPresentationDelay string   `xml:"suggestedPresentationDelay,attr,omitempty"`
+	Periods                    []*Period
+}
+
+type Period struct {
+	XMLName        xml.Name `xml:"Period"`
+	ID             string   `xml:"id,attr"`
+	Start          string   `xml:"start,attr"`
+	AdaptationSets []*AdaptationSet
+}
+
+type AdaptationSet struct {
+	XMLName          xml.Name `xml:"AdaptationSet"`
+	ID               int      `xml:"id,attr"`
+	ContentType      string   `xml:"contentType,attr"`
+	MimeType         string   `xml:"mimeType,attr"`
+	SegmentAlignment bool     `xml:"segmentAlignment,attr"`
+	StartWithSAP     int      `xml:"startWithSAP,attr"`
+	SegmentTemplate  *SegmentTemplate
+	Representations  []*Representation
+}
+
+type SegmentTemplate struct {
+	XMLName         xml.Name `xml:"SegmentTemplate"`
+	Timescale       uint32   `xml:"timescale,attr"`
+	Initialization  string   `xml:"initialization,attr"`
+	Media           string   `xml:"media,attr"`
+	SegmentTimeline *SegmentTimeline
+}
+
+type SegmentTimeline struct {
+	XMLName xml.Name `xml:"SegmentTimeline"`
+	S       []*S
+}
+
+type S struct {
+	XMLName xml.Name `xml:"S"`
+	T       uint64   `xml:"t,attr"`
+	D       uint64   `xml:"d,attr"`
+	R       int      `xml:"r,attr,omitempty"`
+}
+
+type Representation struct {
+	XMLName                   xml.Name `xml:"Representation"`
+	ID                        string   `xml:"id,attr"`
+	Codecs                    string   `xml:"codecs,attr"`
+	Bandwidth                 uint64   `xml:"bandwidth,attr"`
+	Width                     uint16   `xml:"width,attr,omitempty"`
+	Height                    uint16   `xml:"height,attr,omitempty"`
+	AudioSamplingRate         uint32   `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannelConfiguration *AudioChannelConfiguration
+}
+
+type AudioChannelConfiguration struct {
+	XMLName     xml.Name `xml:"AudioChannelConfiguration"`
+	SchemeIDURI string   `xml:"schemeIdUri,attr"`
+	Value       int      `xml:"value,attr"`
+}
+
+const audioChannelConfigurationScheme = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
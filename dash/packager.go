@@ -0,0 +1,452 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/internal/packaging"
+	"github.com/yutopp/go-flv/mp4"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// FLV timestamps are in milliseconds
+const timescale = 1000
+
+const (
+	initializationTemplate = "$RepresentationID$-init.mp4"
+	mediaTemplate          = "$RepresentationID$-$Time$.m4s"
+)
+
+type PackagerConfig struct {
+	Dir             string
+	ManifestName    string        // Default: manifest.mpd
+	SegmentDuration time.Duration // Default: 2s
+	Live            bool          // Writes a dynamic MPD which is updated on every segment
+
+	// WindowSize is a number of segments per representation kept in the SegmentTimeline of the
+	// dynamic MPD. It also decides timeShiftBufferDepth. Default: 5
+	WindowSize int
+	// DeleteSegments deletes .m4s files which are dropped from the SegmentTimeline of the dynamic MPD.
+	DeleteSegments bool
+
+	// Now is used for availabilityStartTime and publishTime of the dynamic MPD. Default: time.Now
+	Now func() time.Time
+}
+
+// Packager splits FLV tags (H.264/AAC) into CMAF segments and maintains a DASH manifest.
+// Video and audio are written as separate adaptation sets.
+type Packager struct {
+	config PackagerConfig
+
+	video *representation
+	audio *representation
+
+	availabilityStartTime time.Time
+	started               bool
+}
+
+type representation struct {
+	id              string
+	adaptationSetID int
+	track           *mp4.Track
+
+	samples          []*mp4.Sample
+	lastDecodeTime   int64 // ms
+	segmentStartedAt int64 // ms
+	cutAt            int64 // ms
+	hasCutAt         bool
+
+	timeline       []*timelineEntry
+	sequenceNumber uint32
+	totalBytes     uint64
+	totalDuration  uint64 // ms
+}
+
+type timelineEntry struct {
+	t, d uint64
+	name string
+}
+
+func NewPackager(config *PackagerConfig) (*Packager, error) {
+	c := *config
+	if c.ManifestName == "" {
+		c.ManifestName = "manifest.mpd"
+	}
+	if c.SegmentDuration <= 0 {
+		c.SegmentDuration = 2 * time.Second
+	}
+	if c.WindowSize <= 0 {
+		c.WindowSize = 5
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Packager{
+		config: c,
+	}, nil
+}
+
+// WriteTag writes a tag. Sequence headers create the track and its initialization segment, and
+// payloads of frames are read into samples of the next fragment.
+func (p *Packager) WriteTag(flvTag *tag.FlvTag) error {
+	switch data := flvTag.Data.(type) {
+	case *tag.AudioData:
+		return p.writeAudioData(int64(flvTag.Timestamp), data)
+	case *tag.VideoData:
+		return p.writeVideoData(int64(flvTag.Timestamp), data)
+	case *tag.ScriptData, *tag.UnknownData:
+		return nil
+	default:
+		return fmt.Errorf("unexpected data is set: %T", flvTag.Data)
+	}
+}
+
+func (p *Packager) writeVideoData(timestamp int64, videoData *tag.VideoData) error {
+	if videoData.CodecID != tag.CodecIDAVC {
+		return fmt.Errorf("unsupported video codec: %+v", videoData.CodecID)
+	}
+
+	switch videoData.AVCPacketType {
+	case tag.AVCPacketTypeSequenceHeader:
+		var record avc.DecoderConfigurationRecord
+		if err := avc.DecodeDecoderConfigurationRecord(videoData.Data, &record); err != nil {
+			return fmt.Errorf("failed to decode AVCDecoderConfigurationRecord: %w", err)
+		}
+		track, err := mp4.NewVideoTrack(1, timescale, &record)
+		if err != nil {
+			return err
+		}
+		return p.setTrack(&p.video, "video", 0, track)
+
+	case tag.AVCPacketTypeNALU:
+		if p.video == nil {
+			return fmt.Errorf("AVC sequence header is not received")
+		}
+
+		data, err := io.ReadAll(videoData.Data)
+		if err != nil {
+			return err
+		}
+
+		keyframe := videoData.FrameType == tag.FrameTypeKeyFrame
+		if len(p.video.samples) == 0 && !keyframe {
+			// fragments must start with a SAP (StartWithSAP=1), thus frames before an IDR are dropped
+			return nil
+		}
+
+		if keyframe && len(p.video.samples) > 0 && timestamp-p.video.segmentStartedAt >= p.config.SegmentDuration.Milliseconds() {
+			if err := p.flush(p.video, timestamp); err != nil {
+				return err
+			}
+			if p.audio != nil {
+				p.audio.cutAt = timestamp
+				p.audio.hasCutAt = true
+			}
+		}
+
+		p.appendSample(p.video, timestamp, &mp4.Sample{
+			CompositionTimeOffset: videoData.CompositionTime,
+			Keyframe:              keyframe,
+			Data:                  data,
+		})
+		return nil
+
+	case tag.AVCPacketTypeEOS:
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported AVC packet type: %+v", videoData.AVCPacketType)
+	}
+}
+
+func (p *Packager) writeAudioData(timestamp int64, audioData *tag.AudioData) error {
+	if audioData.SoundFormat != tag.SoundFormatAAC {
+		return fmt.Errorf("unsupported sound format: %+v", audioData.SoundFormat)
+	}
+
+	switch audioData.AACPacketType {
+	case tag.AACPacketTypeSequenceHeader:
+		var config aac.AudioSpecificConfig
+		if err := aac.DecodeAudioSpecificConfig(audioData.Data, &config); err != nil {
+			return fmt.Errorf("failed to decode AudioSpecificConfig: %w", err)
+		}
+		return p.setTrack(&p.audio, "audio", 1, mp4.NewAudioTrack(2, timescale, &config))
+
+	case tag.AACPacketTypeRaw:
+		if p.audio == nil {
+			return fmt.Errorf("AAC sequence header is not received")
+		}
+
+		data, err := io.ReadAll(audioData.Data)
+		if err != nil {
+			return err
+		}
+
+		if len(p.audio.samples) > 0 {
+			// follows cuts of the video to align segments
+			cut := p.audio.hasCutAt && timestamp >= p.audio.cutAt
+			if p.video == nil {
+				cut = timestamp-p.audio.segmentStartedAt >= p.config.SegmentDuration.Milliseconds()
+			}
+			if cut {
+				p.audio.hasCutAt = false
+				if err := p.flush(p.audio, timestamp); err != nil {
+					return err
+				}
+			}
+		}
+
+		p.appendSample(p.audio, timestamp, &mp4.Sample{
+			Keyframe: true,
+			Data:     data,
+		})
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported AAC packet type: %+v", audioData.AACPacketType)
+	}
+}
+
+func (p *Packager) setTrack(rep **representation, id string, adaptationSetID int, track *mp4.Track) error {
+	if *rep == nil {
+		*rep = &representation{
+			id:              id,
+			adaptationSetID: adaptationSetID,
+		}
+	}
+	(*rep).track = track
+
+	name := fmt.Sprintf("%s-init.mp4", id)
+	return packaging.WriteFile(filepath.Join(p.config.Dir, name), func(w io.Writer) error {
+		return mp4.EncodeInitSegment(w, []*mp4.Track{track})
+	})
+}
+
+func (p *Packager) appendSample(rep *representation, timestamp int64, sample *mp4.Sample) {
+	if !p.started {
+		p.availabilityStartTime = p.config.Now().Add(-time.Duration(timestamp) * time.Millisecond)
+		p.started = true
+	}
+
+	if n := len(rep.samples); n > 0 {
+		rep.samples[n-1].Duration = durationBetween(rep.lastDecodeTime, timestamp)
+	} else {
+		rep.segmentStartedAt = timestamp
+	}
+	rep.samples = append(rep.samples, sample)
+	rep.lastDecodeTime = timestamp
+}
+
+func durationBetween(from, to int64) uint32 {
+	if to < from {
+		return 0
+	}
+	return uint32(to - from)
+}
+
+// flush writes buffered samples as a segment. nextDecodeTime is used as the end of the last sample.
+func (p *Packager) flush(rep *representation, nextDecodeTime int64) error {
+	rep.samples[len(rep.samples)-1].Duration = durationBetween(rep.lastDecodeTime, nextDecodeTime)
+	return p.writeSegment(rep)
+}
+
+func (p *Packager) writeSegment(rep *representation) error {
+	samples := rep.samples
+	rep.samples = nil
+
+	var duration uint64
+	for _, sample := range samples {
+		duration += uint64(sample.Duration)
+		rep.totalBytes += uint64(len(sample.Data))
+	}
+	rep.totalDuration += duration
+
+	t := uint64(rep.segmentStartedAt)
+	name := fmt.Sprintf("%s-%d.m4s", rep.id, t)
+
+	rep.sequenceNumber++
+	seq := rep.sequenceNumber
+	if err := packaging.WriteFile(filepath.Join(p.config.Dir, name), func(w io.Writer) error {
+		return mp4.EncodeFragment(w, seq, rep.track.ID, t, samples)
+	}); err != nil {
+		return err
+	}
+
+	rep.timeline = append(rep.timeline, &timelineEntry{t: t, d: duration, name: name})
+	if p.config.Live {
+		for len(rep.timeline) > p.config.WindowSize {
+			removed := rep.timeline[0]
+			rep.timeline = rep.timeline[1:]
+			if p.config.DeleteSegments {
+				if err := os.Remove(filepath.Join(p.config.Dir, removed.name)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+
+		return p.writeManifest(false)
+	}
+
+	return nil
+}
+
+// Close writes buffered samples and finalizes the manifest.
+func (p *Packager) Close() error {
+	for _, rep := range []*representation{p.video, p.audio} {
+		if rep == nil || len(rep.samples) == 0 {
+			continue
+		}
+
+		// assumes the last sample has the same duration as the previous one
+		n := len(rep.samples)
+		if n > 1 {
+			rep.samples[n-1].Duration = rep.samples[n-2].Duration
+		}
+		if err := p.writeSegment(rep); err != nil {
+			return err
+		}
+	}
+
+	return p.writeManifest(true)
+}
+
+// MPD returns the current manifest.
+func (p *Packager) MPD(ended bool) *MPD {
+	mpd := &MPD{
+		Profiles:      "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:          "static",
+		MinBufferTime: formatDuration(p.config.SegmentDuration),
+	}
+
+	var end uint64
+	period := &Period{ID: "0", Start: formatDuration(0)}
+	for _, rep := range []*representation{p.video, p.audio} {
+		if rep == nil || rep.track == nil {
+			continue
+		}
+		period.AdaptationSets = append(period.AdaptationSets, rep.adaptationSet())
+
+		if n := len(rep.timeline); n > 0 {
+			if e := rep.timeline[n-1].t + rep.timeline[n-1].d; e > end {
+				end = e
+			}
+		}
+	}
+	mpd.Periods = []*Period{period}
+
+	if p.config.Live {
+		mpd.Type = "dynamic"
+		mpd.AvailabilityStartTime = formatTime(p.availabilityStartTime)
+		mpd.PublishTime = formatTime(p.config.Now())
+		mpd.TimeShiftBufferDepth = formatDuration(time.Duration(p.config.WindowSize) * p.config.SegmentDuration)
+		mpd.SuggestedPresentationDelay = formatDuration(2 * p.config.SegmentDuration)
+		if !ended {
+			mpd.MinimumUpdatePeriod = formatDuration(p.config.SegmentDuration)
+		}
+	}
+	if ended {
+		mpd.MediaPresentationDuration = formatDuration(time.Duration(end) * time.Millisecond)
+	}
+
+	return mpd
+}
+
+func (p *Packager) writeManifest(ended bool) error {
+	mpd := p.MPD(ended)
+	return packaging.WriteFile(filepath.Join(p.config.Dir, p.config.ManifestName), func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(mpd); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+}
+
+func (rep *representation) adaptationSet() *AdaptationSet {
+	var bandwidth uint64
+	if rep.totalDuration > 0 {
+		bandwidth = rep.totalBytes * 8 * 1000 / rep.totalDuration
+	}
+
+	r := &Representation{
+		ID:        rep.id,
+		Codecs:    rep.track.Codec(),
+		Bandwidth: bandwidth,
+	}
+	as := &AdaptationSet{
+		ID:               rep.adaptationSetID,
+		SegmentAlignment: true,
+		StartWithSAP:     1,
+		SegmentTemplate: &SegmentTemplate{
+			Timescale:       timescale,
+			Initialization:  initializationTemplate,
+			Media:           mediaTemplate,
+			SegmentTimeline: rep.segmentTimeline(),
+		},
+		Representations: []*Representation{r},
+	}
+
+	switch rep.track.Type {
+	case mp4.TrackTypeVideo:
+		as.ContentType, as.MimeType = "video", "video/mp4"
+		r.Width, r.Height = rep.track.Width, rep.track.Height
+	case mp4.TrackTypeAudio:
+		as.ContentType, as.MimeType = "audio", "audio/mp4"
+		r.AudioSamplingRate = rep.track.AACConfig.SamplingFrequency
+		r.AudioChannelConfiguration = &AudioChannelConfiguration{
+			SchemeIDURI: audioChannelConfigurationScheme,
+			Value:       rep.track.AACConfig.Channels(),
+		}
+	}
+
+	return as
+}
+
+func (rep *representation) segmentTimeline() *SegmentTimeline {
+	timeline := &SegmentTimeline{}
+	var last *S
+	for _, entry := range rep.timeline {
+		// contiguous segments which have the same duration are merged
+		if last != nil && last.D == entry.d && last.T+last.D*uint64(last.R+1) == entry.t {
+			last.R++
+			continue
+		}
+		last = &S{T: entry.t, D: entry.d}
+		timeline.S = append(timeline.S, last)
+	}
+	return timeline
+}
+
+// Package reads all tags from the decoder and writes segments and a manifest.
+func Package(dec *flv.Decoder, config *PackagerConfig) error {
+	p, err := NewPackager(config)
+	if err != nil {
+		return err
+	}
+
+	return packaging.Run(dec, p)
+}
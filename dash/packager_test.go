@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+var testNow = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testTags(t *testing.T, to uint32) []*tag.FlvTag {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var recordBuf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+
+	tags := []*tag.FlvTag{
+		{
+			TagType: tag.TagTypeVideo,
+			Data: &tag.VideoData{
+				FrameType:     tag.FrameTypeKeyFrame,
+				CodecID:       tag.CodecIDAVC,
+				AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+				Data:          &recordBuf,
+			},
+		},
+		{
+			TagType: tag.TagTypeAudio,
+			Data: &tag.AudioData{
+				SoundFormat:   tag.SoundFormatAAC,
+				AACPacketType: tag.AACPacketTypeSequenceHeader,
+				Data:          bytes.NewReader([]byte{0x12, 0x10}),
+			},
+		},
+	}
+
+	// 25fps video with a keyframe every 1s, and audio every 20ms
+	for ts := uint32(0); ts < to; ts += 20 {
+		if ts%40 == 0 {
+			frameType, naluType := tag.FrameTypeInterFrame, byte(0x41)
+			if ts%1000 == 0 {
+				frameType, naluType = tag.FrameTypeKeyFrame, 0x65
+			}
+			tags = append(tags, &tag.FlvTag{
+				TagType:   tag.TagTypeVideo,
+				Timestamp: ts,
+				Data: &tag.VideoData{
+					FrameType:     frameType,
+					CodecID:       tag.CodecIDAVC,
+					AVCPacketType: tag.AVCPacketTypeNALU,
+					Data:          bytes.NewReader(avc.AppendAVCC(nil, [][]byte{{naluType, 0x00, 0x01}})),
+				},
+			})
+		}
+		tags = append(tags, &tag.FlvTag{
+			TagType:   tag.TagTypeAudio,
+			Timestamp: ts,
+			Data: &tag.AudioData{
+				SoundFormat:   tag.SoundFormatAAC,
+				AACPacketType: tag.AACPacketTypeRaw,
+				Data:          bytes.NewReader([]byte{0x21, 0x00}),
+			},
+		})
+	}
+
+	return tags
+}
+
+func TestPackagerStatic(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPackager(&PackagerConfig{
+		Dir:             dir,
+		SegmentDuration: 2 * time.Second,
+		Now:             func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	for _, flvTag := range testTags(t, 5000) {
+		err := p.WriteTag(flvTag)
+		require.Nil(t, err)
+	}
+	err = p.Close()
+	require.Nil(t, err)
+
+	manifest, err := os.ReadFile(filepath.Join(dir, "manifest.mpd"))
+	require.Nil(t, err)
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT5.000S" minBufferTime="PT2.000S">
+  <Period id="0" start="PT0.000S">
+    <AdaptationSet id="0" contentType="video" mimeType="video/mp4" segmentAlignment="true" startWithSAP="1">
+      <SegmentTemplate timescale="1000" initialization="$RepresentationID$-init.mp4" media="$RepresentationID$-$Time$.m4s">
+        <SegmentTimeline>
+          <S t="0" d="2000" r="1"></S>
+          <S t="4000" d="1000"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="video" codecs="avc1.64001f" bandwidth="1400" width="1280" height="720"></Representation>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="audio" mimeType="audio/mp4" segmentAlignment="true" startWithSAP="1">
+      <SegmentTemplate timescale="1000" initialization="$RepresentationID$-init.mp4" media="$RepresentationID$-$Time$.m4s">
+        <SegmentTimeline>
+          <S t="0" d="2000" r="1"></S>
+          <S t="4000" d="1000"></S>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="audio" codecs="mp4a.40.2" bandwidth="800" audioSamplingRate="44100">
+        <AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="2"></AudioChannelConfiguration>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`, string(manifest))
+
+	for _, name := range []string{"video-init.mp4", "audio-init.mp4", "video-0.m4s", "video-2000.m4s", "video-4000.m4s", "audio-4000.m4s"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.Nil(t, err, name)
+	}
+}
+
+func TestPackagerLive(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	enc, err := flv.NewEncoder(&buf, flv.FlagsAudio|flv.FlagsVideo)
+	require.Nil(t, err)
+	for _, flvTag := range testTags(t, 7000) {
+		err := enc.Encode(flvTag)
+		require.Nil(t, err)
+	}
+
+	dec, err := flv.NewDecoder(&buf)
+	require.Nil(t, err)
+
+	err = Package(dec, &PackagerConfig{
+		Dir:             dir,
+		SegmentDuration: 1 * time.Second,
+		Live:            true,
+		WindowSize:      3,
+		DeleteSegments:  true,
+		Now:             func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	manifest, err := os.ReadFile(filepath.Join(dir, "manifest.mpd"))
+	require.Nil(t, err)
+	require.Contains(t, string(manifest), `type="dynamic" availabilityStartTime="2018-01-02T03:04:05.000Z"`)
+	require.Contains(t, string(manifest), `<S t="4000" d="1000" r="2"></S>`)
+	require.NotContains(t, string(manifest), `minimumUpdatePeriod`)
+
+	_, err = os.Stat(filepath.Join(dir, "video-0.m4s"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -9,66 +9,217 @@ package flv
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/yutopp/go-flv/tag"
 )
 
+type DecoderConfig struct {
+	// UnwrapTimestamps makes Timestamp of decoded tags unwrapped. Full durations are returned by
+	// Decoder.Time.
+	UnwrapTimestamps bool
+	// Detect24BitWrap enables detection of timestamps wrapping at 24bits. It requires UnwrapTimestamps.
+	Detect24BitWrap bool
+	// PassthroughUnknownTags makes tags whose type is not supported decoded as *tag.UnknownData,
+	// which Encoder writes back as is. Otherwise they are errors and skipped.
+	PassthroughUnknownTags bool
+
+	// Follow makes the decoder wait for more data on EOF like `tail -f`, to read files which are
+	// still being written. A partially written tag is completed when the rest is written. The header
+	// is also waited in NewDecoderWithConfig.
+	Follow bool
+	// FollowInterval is an interval of polling in Follow mode. Defaults to DefaultFollowInterval.
+	FollowInterval time.Duration
+	// FollowIdleTimeout makes the decoder return io.EOF when nothing is written for the duration
+	// in Follow mode. Zero waits forever, or until ctx of DecodeContext is done. If it fires in the
+	// middle of a tag, including its payload, the decoder cannot continue and returns a DecodeError
+	// matching ErrTruncated for all subsequent calls.
+	FollowIdleTimeout time.Duration
+}
+
 type Decoder struct {
-	r           io.Reader
+	r           io.Reader // reads src through cr
+	src         io.Reader
+	cr          countingReader
+	follower    *followReader
+	sizeRead    bool  // previous tag size of the next tag is already read
+	boundary    int64 // offset where decoding can be resumed from
+	err         error // sticky
 	header      *Header
 	decodedOnce bool
+	index       int         // index of the next tag
+	tagType     tag.TagType // type of the last tag whose header is decoded
+	buf         [4]byte
+	scratch     tag.Scratch
+	tagConfig   tag.DecoderConfig
+
+	config    DecoderConfig
+	unwrapper TimestampUnwrapper
+	time      time.Duration
 }
 
 func NewDecoder(r io.Reader) (*Decoder, error) {
-	header, err := DecodeFlvHeader(r)
+	return NewDecoderWithConfig(r, nil)
+}
+
+func NewDecoderWithConfig(r io.Reader, config *DecoderConfig) (*Decoder, error) {
+	var c DecoderConfig
+	if config != nil {
+		c = *config
+	}
+	if c.FollowInterval == 0 {
+		c.FollowInterval = DefaultFollowInterval
+	}
+
+	dec := &Decoder{
+		src:    r,
+		config: c,
+		tagConfig: tag.DecoderConfig{
+			PassthroughUnknownTags: c.PassthroughUnknownTags,
+		},
+		unwrapper: TimestampUnwrapper{
+			Detect24BitWrap: c.Detect24BitWrap,
+		},
+	}
+	dec.cr.r = r
+	if c.Follow {
+		dec.follower = &followReader{
+			r:           r,
+			ctx:         context.Background(),
+			interval:    c.FollowInterval,
+			idleTimeout: c.FollowIdleTimeout,
+		}
+		dec.cr.r = dec.follower
+	}
+	dec.r = &dec.cr
+
+	header, err := DecodeFlvHeader(dec.r)
 	if err != nil {
-		return nil, err
+		return nil, &DecodeError{Index: -1, Err: err}
 	}
 
 	if header.DataOffset > HeaderLength {
 		offset := header.DataOffset - HeaderLength
-		if _, err := io.CopyN(io.Discard, r, int64(offset)); err != nil {
-			return nil, err
+		if _, err := io.CopyN(io.Discard, dec.r, int64(offset)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, &DecodeError{Index: -1, Err: fmt.Errorf("failed to skip the header: %w", err)}
 		}
 	}
+	dec.header = header
 
-	return &Decoder{
-		r:      r,
-		header: header,
-	}, nil
+	return dec, nil
 }
 
 func (dec *Decoder) Header() *Header {
 	return dec.header
 }
 
+// Decode decodes the next tag. The tag refers to buffers of the decoder, so it is valid until the
+// next call. Call tag.FlvTag.Materialize to keep it.
+//
+// It returns io.EOF when the stream ends between tags. Other errors are *DecodeError.
 func (dec *Decoder) Decode(flvTag *tag.FlvTag) error {
-	// read previous tag size
-	previousTagSize, err := dec.decodeTagSize()
-	if err != nil {
-		return fmt.Errorf("failed to decode tag size: %w", err)
+	if dec.err != nil {
+		return dec.err
 	}
-	// first size must be 0
-	if !dec.decodedOnce {
-		if previousTagSize != 0 {
-			return fmt.Errorf("initial tag size should be 0: Actual = %d", previousTagSize)
+	if dec.follower != nil && dec.follower.timedOut {
+		// timed out while the payload of the last tag was read
+		dec.err = &DecodeError{
+			Offset:  dec.boundary,
+			Index:   dec.index - 1,
+			TagType: dec.tagType,
+			Err:     fmt.Errorf("idle timeout in the middle of the payload: %w", io.ErrUnexpectedEOF),
+		}
+		return dec.err
+	}
+
+	if !dec.sizeRead {
+		dec.boundary = dec.cr.n
+
+		// read previous tag size
+		previousTagSize, err := dec.decodeTagSize()
+		if err != nil {
+			if err == io.EOF {
+				return dec.idleTimedOut(err) // between tags
+			}
+			return dec.idleTimedOut(dec.decodeError(0, fmt.Errorf("failed to decode tag size: %w", err)))
+		}
+		// first size must be 0
+		if !dec.decodedOnce {
+			if previousTagSize != 0 {
+				return dec.decodeError(0, fmt.Errorf("%w: initial tag size should be 0: Actual = %d", ErrInvalidTagSize, previousTagSize))
+			}
+
+			dec.decodedOnce = true
 		}
 
-		dec.decodedOnce = true
+		// the size is not read again if nothing of the tag is read, e.g. on EOF in Follow mode
+		dec.sizeRead = true
+		dec.boundary = dec.cr.n
 	}
+
 	// decode tag
-	if err := tag.DecodeFlvTag(dec.r, flvTag); err != nil {
+	err := dec.scratch.DecodeFlvTagWithConfig(dec.r, flvTag, &dec.tagConfig)
+	if err != nil && err != io.EOF {
+		err = dec.decodeError(flvTag.TagType, err)
+	}
+	err = dec.idleTimedOut(err)
+	if err == nil || dec.cr.n != dec.boundary {
+		dec.sizeRead = false
+		dec.index++
+	}
+	if err != nil {
 		return err
 	}
+	dec.tagType = flvTag.TagType
+
+	if dec.config.UnwrapTimestamps {
+		dec.time = dec.unwrapper.Unwrap(flvTag.Timestamp)
+		flvTag.Timestamp = uint32(dec.time.Milliseconds()) // lower 32bits
+	} else {
+		dec.time = toDuration(int64(flvTag.Timestamp))
+	}
+
 	return nil
 }
 
+// Time returns a timestamp of the last decoded tag. It is unwrapped if UnwrapTimestamps is enabled.
+func (dec *Decoder) Time() time.Duration {
+	return dec.time
+}
+
+// idleTimedOut makes err sticky if FollowIdleTimeout fired in the middle of a tag, since the rest
+// of the tag may be written later and decoding cannot be resumed from there.
+func (dec *Decoder) idleTimedOut(err error) error {
+	if dec.follower == nil || !dec.follower.timedOut {
+		return err
+	}
+
+	dec.follower.timedOut = false
+	if dec.cr.n != dec.boundary {
+		dec.err = err
+	}
+	return err
+}
+
+func (dec *Decoder) decodeError(tagType tag.TagType, err error) error {
+	return &DecodeError{
+		Offset:  dec.boundary,
+		Index:   dec.index,
+		TagType: tagType,
+		Err:     err,
+	}
+}
+
 func (dec *Decoder) decodeTagSize() (uint32, error) {
-	buf := make([]byte, 4)
-	if _, err := io.ReadAtLeast(dec.r, buf, len(buf)); err != nil {
+	buf := dec.buf[:]
+	if _, err := io.ReadFull(dec.r, buf); err != nil {
 		return 0, err
 	}
 
@@ -83,7 +234,7 @@ func DecodeFlvHeader(r io.Reader) (*Header, error) {
 
 	signature := buf[0:3]
 	if !bytes.Equal(signature, HeaderSignature) {
-		return nil, fmt.Errorf("signature is not matched (FLV): %+v", signature)
+		return nil, fmt.Errorf("%w (FLV): %+v", ErrSignatureMismatch, signature)
 	}
 
 	version := buf[3]
@@ -108,3 +259,15 @@ func DecodeFlvHeader(r io.Reader) (*Header, error) {
 
 	return header, nil
 }
+
+// countingReader counts bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// readDeadliner is implemented by net.Conn, os.File and so on.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+var aLongTimeAgo = time.Unix(1, 0)
+
+// DecodeContext is Decode which stops when ctx is done.
+//
+// In Follow mode, waits for more data are interrupted. Otherwise if the underlying reader has
+// SetReadDeadline (e.g. net.Conn), a blocking read is interrupted by setting a past deadline, and
+// the deadline is cleared afterwards. Otherwise ctx is only checked before reading. When a tag is
+// interrupted in the middle, the decoder cannot continue and returns the error for all subsequent
+// calls.
+func (dec *Decoder) DecodeContext(ctx context.Context, flvTag *tag.FlvTag) error {
+	if dec.err != nil {
+		return dec.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if dec.follower != nil {
+		// waits in Follow mode are interrupted by ctx
+		dec.follower.ctx = ctx
+		defer func() {
+			dec.follower.ctx = context.Background()
+		}()
+
+		err := dec.Decode(flvTag)
+		return dec.interrupted(ctx, err)
+	}
+
+	d, ok := dec.src.(readDeadliner)
+	if !ok || ctx.Done() == nil {
+		return dec.Decode(flvTag)
+	}
+
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = d.SetReadDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+
+	err := dec.Decode(flvTag)
+	close(stop)
+
+	if !<-interrupted {
+		return err
+	}
+
+	// the deadline is set regardless of the result
+	_ = d.SetReadDeadline(time.Time{})
+	if err == nil {
+		return nil
+	}
+	return dec.interrupted(ctx, ctx.Err())
+}
+
+// interrupted converts err caused by ctx into ctx.Err(). If a tag is interrupted in the middle,
+// the decoder cannot continue anymore.
+func (dec *Decoder) interrupted(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if err == nil || ctxErr == nil || !errors.Is(err, ctxErr) {
+		return err
+	}
+
+	if dec.cr.n != dec.boundary {
+		dec.err = fmt.Errorf("interrupted in the middle of a tag: %w", ctxErr)
+		return dec.err
+	}
+	return ctxErr
+}
+
+// ========================================
+// Follow mode
+
+const DefaultFollowInterval = 100 * time.Millisecond
+
+// followReader waits for more data on EOF.
+type followReader struct {
+	r           io.Reader
+	ctx         context.Context
+	interval    time.Duration
+	idleTimeout time.Duration
+	timedOut    bool // io.EOF is returned by idleTimeout, cleared by the decoder
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	var idle time.Duration
+	for {
+		n, err := f.r.Read(p)
+		if n > 0 {
+			return n, nil // EOF is checked by the next read
+		}
+		if err != io.EOF {
+			return n, err
+		}
+
+		if f.idleTimeout > 0 && idle >= f.idleTimeout {
+			f.timedOut = true
+			return 0, io.EOF
+		}
+
+		timer := time.NewTimer(f.interval)
+		select {
+		case <-timer.C:
+		case <-f.ctx.Done():
+			timer.Stop()
+			return 0, f.ctx.Err()
+		}
+		idle += f.interval
+	}
+}
+
+// DecodeResult is a result of Tags. Either Tag or Err is set.
+type DecodeResult struct {
+	Tag *tag.FlvTag
+	Err error
+}
+
+// Tags decodes tags in a goroutine and sends them until io.EOF, an error or ctx is done. The channel
+// is closed after that. Tags are materialized, so that they can be used after receiving the next one.
+// Call tag.FlvTag.Release when they are no longer used.
+func (dec *Decoder) Tags(ctx context.Context) <-chan DecodeResult {
+	ch := make(chan DecodeResult)
+	go func() {
+		defer close(ch)
+
+		for {
+			var result DecodeResult
+
+			flvTag := &tag.FlvTag{}
+			err := dec.DecodeContext(ctx, flvTag)
+			if err == nil {
+				err = flvTag.Materialize()
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				result.Err = err
+			} else {
+				result.Tag = flvTag
+			}
+
+			select {
+			case ch <- result:
+			case <-ctx.Done():
+				if result.Tag != nil {
+					result.Tag.Release()
+				}
+				return
+			}
+			if result.Err != nil {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func encodeTestTags(t *testing.T, timestamps ...uint32) []byte {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsVideo)
+	require.Nil(t, err)
+	for _, ts := range timestamps {
+		err := enc.Encode(newInterleaveTag(tag.TagTypeVideo, ts))
+		require.Nil(t, err)
+	}
+	return buf.Bytes()
+}
+
+// newPipeDecoder returns a decoder reading from a pipe, and the other side of it.
+func newPipeDecoder(t *testing.T) (*Decoder, net.Conn) {
+	r, w := net.Pipe()
+	t.Cleanup(func() {
+		_ = r.Close()
+		_ = w.Close()
+	})
+
+	go func() {
+		_, _ = w.Write(encodeTestTags(t)[:HeaderLength])
+	}()
+	dec, err := NewDecoder(r)
+	require.Nil(t, err)
+
+	return dec, w
+}
+
+func TestDecodeContextInterruptIdle(t *testing.T) {
+	dec, w := newPipeDecoder(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var flvTag tag.FlvTag
+	err := dec.DecodeContext(ctx, &flvTag)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// nothing was read, thus the decoder can continue
+	go func() {
+		_, _ = w.Write(encodeTestTags(t, 10)[HeaderLength:])
+	}()
+	err = dec.DecodeContext(context.Background(), &flvTag)
+	require.Nil(t, err)
+	require.Equal(t, uint32(10), flvTag.Timestamp)
+}
+
+func TestDecodeContextInterruptInTheMiddle(t *testing.T) {
+	dec, w := newPipeDecoder(t)
+
+	go func() {
+		_, _ = w.Write(encodeTestTags(t, 10)[HeaderLength : HeaderLength+6]) // tag size + a part of the header
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var flvTag tag.FlvTag
+	err := dec.DecodeContext(ctx, &flvTag)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	err = dec.Decode(&flvTag)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestDecodeContextCanceled(t *testing.T) {
+	dec, err := NewDecoder(bytes.NewReader(encodeTestTags(t, 10)))
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var flvTag tag.FlvTag
+	err = dec.DecodeContext(ctx, &flvTag)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestDecoderTags(t *testing.T) {
+	dec, err := NewDecoder(bytes.NewReader(encodeTestTags(t, 10, 20, 30)))
+	require.Nil(t, err)
+
+	var tags []*tag.FlvTag
+	for result := range dec.Tags(context.Background()) {
+		require.Nil(t, result.Err)
+		tags = append(tags, result.Tag)
+	}
+	require.Equal(t, 3, len(tags))
+
+	// tags are still valid
+	for i, flvTag := range tags {
+		require.Equal(t, uint32(10*(i+1)), flvTag.Timestamp)
+
+		payload, ok := flvTag.Data.(*tag.VideoData).Payload()
+		require.True(t, ok)
+		require.Equal(t, []byte{byte(10 * (i + 1))}, payload)
+
+		flvTag.Release()
+	}
+}
+
+func TestDecoderTagsCanceled(t *testing.T) {
+	dec, w := newPipeDecoder(t)
+
+	go func() {
+		_, _ = w.Write(encodeTestTags(t, 10)[HeaderLength:])
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := dec.Tags(ctx)
+
+	result := <-ch
+	require.Nil(t, result.Err)
+	require.Equal(t, uint32(10), result.Tag.Timestamp)
+
+	cancel()
+	for result := range ch {
+		require.True(t, errors.Is(result.Err, context.Canceled))
+	}
+}
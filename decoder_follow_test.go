@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// newGrowingFile returns a file for reading, and a function to append data to it.
+func newGrowingFile(t *testing.T) (*os.File, func([]byte)) {
+	path := filepath.Join(t.TempDir(), "recording.flv")
+
+	w, err := os.Create(path)
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	r, err := os.Open(path)
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = r.Close() })
+
+	return r, func(b []byte) {
+		_, err := w.Write(b)
+		require.Nil(t, err)
+	}
+}
+
+func TestDecodeFollow(t *testing.T) {
+	r, write := newGrowingFile(t)
+
+	bin := encodeTestTags(t, 10, 20)
+	tagLen := (len(bin) - int(HeaderLength) - 4) / 2
+	write(bin[:HeaderLength+4+5]) // header + tag size + a part of the first tag
+
+	config := &DecoderConfig{
+		Follow:            true,
+		FollowInterval:    time.Millisecond,
+		FollowIdleTimeout: 100 * time.Millisecond,
+	}
+	dec, err := NewDecoderWithConfig(r, config)
+	require.Nil(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		write(bin[HeaderLength+4+5:]) // the rest
+	}()
+
+	var timestamps []uint32
+	for flvTag, err := range dec.All() {
+		require.Nil(t, err)
+		timestamps = append(timestamps, flvTag.Timestamp)
+	}
+	require.Equal(t, []uint32{10, 20}, timestamps) // ends by the idle timeout
+	require.True(t, tagLen > 5)
+}
+
+func TestDecodeFollowIdleTimeoutInTheMiddle(t *testing.T) {
+	bin := encodeTestTags(t, 10, 20)
+	tagLen := (len(bin) - int(HeaderLength) - 4) / 2 // includes the trailing size
+
+	testCases := []struct {
+		name    string
+		written int
+	}{
+		{name: "header", written: int(HeaderLength) + 4 + 5},
+		{name: "payload", written: int(HeaderLength) + 4 + tagLen - 4 - 1},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, write := newGrowingFile(t)
+			write(bin[:tc.written])
+
+			dec, err := NewDecoderWithConfig(r, &DecoderConfig{
+				Follow:            true,
+				FollowInterval:    time.Millisecond,
+				FollowIdleTimeout: 10 * time.Millisecond,
+			})
+			require.Nil(t, err)
+
+			var flvTag tag.FlvTag
+			err = dec.Decode(&flvTag)
+			if err == nil {
+				flvTag.Close() // the payload is read until the timeout
+
+				err = dec.Decode(&flvTag)
+			}
+			require.True(t, errors.Is(err, ErrTruncated), "%+v", err)
+
+			// the rest of the tag is written after the timeout, but decoding cannot be resumed
+			write(bin[tc.written:])
+			for i := 0; i < 2; i++ {
+				err = dec.Decode(&flvTag)
+				var decErr *DecodeError
+				require.True(t, errors.As(err, &decErr), "%+v", err)
+				require.True(t, errors.Is(err, ErrTruncated), "%+v", err)
+				require.Equal(t, 0, decErr.Index)
+			}
+		})
+	}
+}
+
+func TestDecodeFollowContext(t *testing.T) {
+	r, write := newGrowingFile(t)
+	write(encodeTestTags(t)[:HeaderLength])
+
+	dec, err := NewDecoderWithConfig(r, &DecoderConfig{
+		Follow:         true,
+		FollowInterval: time.Millisecond,
+	})
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var flvTag tag.FlvTag
+	err = dec.DecodeContext(ctx, &flvTag)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// nothing was read, thus the decoder can continue
+	write(encodeTestTags(t, 10)[HeaderLength:])
+	err = dec.DecodeContext(context.Background(), &flvTag)
+	require.Nil(t, err)
+	require.Equal(t, uint32(10), flvTag.Timestamp)
+	flvTag.Close()
+
+	// no more data
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = dec.DecodeContext(ctx, &flvTag)
+	require.False(t, errors.Is(err, io.EOF))
+	require.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"errors"
+	"io"
+	"iter"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// All returns an iterator over tags until io.EOF. An error is yielded once and stops the iteration.
+//
+// The tag is reused and valid only during the iteration. Its payload is drained after each
+// iteration even if it is not read or the loop breaks, so that decoding can continue. To keep
+// the tag, copy it and call tag.FlvTag.Materialize on the copy.
+func (dec *Decoder) All() iter.Seq2[*tag.FlvTag, error] {
+	return dec.filter(nil)
+}
+
+// VideoTags returns an iterator over video tags. See All.
+func (dec *Decoder) VideoTags() iter.Seq2[*tag.FlvTag, error] {
+	return dec.filter(func(flvTag *tag.FlvTag) bool {
+		return flvTag.TagType == tag.TagTypeVideo
+	})
+}
+
+// AudioTags returns an iterator over audio tags. See All.
+func (dec *Decoder) AudioTags() iter.Seq2[*tag.FlvTag, error] {
+	return dec.filter(func(flvTag *tag.FlvTag) bool {
+		return flvTag.TagType == tag.TagTypeAudio
+	})
+}
+
+// Keyframes returns an iterator over video keyframes except sequence headers. See All.
+func (dec *Decoder) Keyframes() iter.Seq2[*tag.FlvTag, error] {
+	return dec.filter(func(flvTag *tag.FlvTag) bool {
+		videoData, ok := flvTag.Data.(*tag.VideoData)
+		if !ok {
+			return false
+		}
+		return videoData.FrameType == tag.FrameTypeKeyFrame && !videoData.IsSequenceHeader()
+	})
+}
+
+func (dec *Decoder) filter(pred func(*tag.FlvTag) bool) iter.Seq2[*tag.FlvTag, error] {
+	return func(yield func(*tag.FlvTag, error) bool) {
+		var flvTag tag.FlvTag
+		for {
+			if err := dec.Decode(&flvTag); err != nil {
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				yield(nil, err)
+				return
+			}
+
+			if pred != nil && !pred(&flvTag) {
+				flvTag.Close()
+				continue
+			}
+
+			cont := yield(&flvTag, nil)
+			flvTag.Close()
+			if !cont {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"iter"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func newIterTestDecoder(t *testing.T) *Decoder {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsAudio|FlagsVideo)
+	require.Nil(t, err)
+
+	tags := []*tag.FlvTag{
+		newBenchTag([]byte{0x00}), // video
+		newInterleaveTag(tag.TagTypeAudio, 10),
+		newBenchTag([]byte{0x01}),
+		newInterleaveTag(tag.TagTypeAudio, 20),
+	}
+	tags[0].Timestamp = 0
+	tags[0].Data.(*tag.VideoData).FrameType = tag.FrameTypeKeyFrame
+	tags[0].Data.(*tag.VideoData).AVCPacketType = tag.AVCPacketTypeSequenceHeader
+	tags[2].Timestamp = 30
+	tags[2].Data.(*tag.VideoData).FrameType = tag.FrameTypeKeyFrame
+	for _, flvTag := range tags {
+		err := enc.Encode(flvTag)
+		require.Nil(t, err)
+	}
+
+	dec, err := NewDecoder(&buf)
+	require.Nil(t, err)
+
+	return dec
+}
+
+func TestDecoderIterators(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Seq      func(dec *Decoder) iter.Seq2[*tag.FlvTag, error]
+		Expected []uint32
+	}
+
+	testCases := []testCase{
+		{Name: "All", Seq: (*Decoder).All, Expected: []uint32{0, 10, 30, 20}},
+		{Name: "VideoTags", Seq: (*Decoder).VideoTags, Expected: []uint32{0, 30}},
+		{Name: "AudioTags", Seq: (*Decoder).AudioTags, Expected: []uint32{10, 20}},
+		{Name: "Keyframes", Seq: (*Decoder).Keyframes, Expected: []uint32{30}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			dec := newIterTestDecoder(t)
+
+			var timestamps []uint32
+			for flvTag, err := range tc.Seq(dec) {
+				require.Nil(t, err)
+				timestamps = append(timestamps, flvTag.Timestamp) // payloads are not read
+			}
+			require.Equal(t, tc.Expected, timestamps)
+		})
+	}
+}
+
+func TestDecoderAllBreak(t *testing.T) {
+	dec := newIterTestDecoder(t)
+
+	for flvTag, err := range dec.All() {
+		require.Nil(t, err)
+		require.Equal(t, uint32(0), flvTag.Timestamp)
+		break
+	}
+
+	// the payload was drained, thus decoding can continue
+	var timestamps []uint32
+	for flvTag, err := range dec.All() {
+		require.Nil(t, err)
+		timestamps = append(timestamps, flvTag.Timestamp)
+	}
+	require.Equal(t, []uint32{10, 30, 20}, timestamps)
+}
+
+func TestDecoderAllError(t *testing.T) {
+	bin := encodeTestTags(t, 10)
+	dec, err := NewDecoder(bytes.NewReader(bin[:HeaderLength+4+5])) // truncated in the tag header
+	require.Nil(t, err)
+
+	var errs []error
+	for flvTag, err := range dec.All() {
+		require.Nil(t, flvTag)
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], io.ErrUnexpectedEOF))
+	require.True(t, errors.Is(errs[0], ErrTruncated))
+}
+
+func TestDecoderKeyframesOfVP6(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsVideo)
+	require.Nil(t, err)
+
+	for i, frameType := range []tag.FrameType{tag.FrameTypeKeyFrame, tag.FrameTypeInterFrame, tag.FrameTypeKeyFrame} {
+		err := enc.Encode(&tag.FlvTag{
+			TagType:   tag.TagTypeVideo,
+			Timestamp: uint32(i * 10),
+			Data: &tag.VideoData{
+				FrameType: frameType,
+				CodecID:   tag.CodecIDOn2VP6,
+				Data:      bytes.NewReader([]byte{0x00, 0x01}),
+			},
+		})
+		require.Nil(t, err)
+	}
+
+	dec, err := NewDecoder(&buf)
+	require.Nil(t, err)
+
+	// AVCPacketType is zero for VP6, but it is not a sequence header
+	var timestamps []uint32
+	for flvTag, err := range dec.Keyframes() {
+		require.Nil(t, err)
+		timestamps = append(timestamps, flvTag.Timestamp)
+	}
+	require.Equal(t, []uint32{0, 20}, timestamps)
+}
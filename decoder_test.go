@@ -9,7 +9,9 @@ package flv
 
 import (
 	"bytes"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -55,3 +57,112 @@ func TestDecodeSkipBrokenTag(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, tag.TagTypeVideo, flvTag.TagType)
 }
+
+func TestDecodeUnwrapTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoderWithConfig(&buf, FlagsVideo, &EncoderConfig{
+		Wrap24BitTimestamps: true, // emulates broken encoders
+	})
+	require.Nil(t, err)
+
+	times := []time.Duration{
+		0xfffff0 * time.Millisecond,
+		(1<<24 + 0x10) * time.Millisecond,
+		(1<<32 + 0x20) * time.Millisecond,
+	}
+	for _, tm := range times {
+		err := enc.EncodeWithTime(newBenchTag([]byte{0x01}), tm)
+		require.Nil(t, err)
+	}
+
+	dec, err := NewDecoderWithConfig(&buf, &DecoderConfig{
+		UnwrapTimestamps: true,
+		Detect24BitWrap:  true,
+	})
+	require.Nil(t, err)
+
+	expectedTimestamps := []uint32{0xfffff0, 1<<24 + 0x10}
+	for i, tm := range times[:2] {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		require.Nil(t, err)
+		require.Equal(t, expectedTimestamps[i], flvTag.Timestamp)
+		require.Equal(t, tm, dec.Time())
+		flvTag.Close()
+	}
+
+	// the 32bits jump cannot be recovered from 24bits timestamps
+	var flvTag tag.FlvTag
+	err = dec.Decode(&flvTag)
+	require.Nil(t, err)
+	require.Equal(t, (1<<24+0x20)*time.Millisecond, dec.Time())
+}
+
+func TestDecodePassthroughUnknownTags(t *testing.T) {
+	bin := encodeTestTags(t, 10)
+	bin = append(bin,
+		0x0f, 0x00, 0x00, 0x02, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x00, // vendor specific, 2Bytes
+		0xaa, 0xbb,
+		0x00, 0x00, 0x00, 0x0d,
+	)
+
+	dec, err := NewDecoderWithConfig(bytes.NewReader(bin), &DecoderConfig{
+		PassthroughUnknownTags: true,
+	})
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsVideo)
+	require.Nil(t, err)
+
+	var types []tag.TagType
+	for flvTag, err := range dec.All() {
+		require.Nil(t, err)
+		types = append(types, flvTag.TagType)
+
+		err = enc.Encode(flvTag)
+		require.Nil(t, err)
+	}
+	require.Equal(t, []tag.TagType{tag.TagTypeVideo, 0x0f}, types)
+
+	// relayed unchanged
+	require.Equal(t, bin, buf.Bytes())
+}
+
+func TestDecodeHEVCTags(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsVideo)
+	require.Nil(t, err)
+	for _, packetType := range []tag.AVCPacketType{tag.AVCPacketTypeSequenceHeader, tag.AVCPacketTypeNALU} {
+		err := enc.Encode(&tag.FlvTag{
+			TagType: tag.TagTypeVideo,
+			Data: &tag.VideoData{
+				FrameType:       tag.FrameTypeKeyFrame,
+				CodecID:         tag.CodecIDHEVC,
+				AVCPacketType:   packetType,
+				CompositionTime: 40,
+				Data:            bytes.NewReader([]byte{0x01, 0x02}),
+			},
+		})
+		require.Nil(t, err)
+	}
+
+	dec, err := NewDecoder(&buf)
+	require.Nil(t, err)
+
+	var packetTypes []tag.AVCPacketType
+	for flvTag, err := range dec.All() {
+		require.Nil(t, err)
+		videoData := flvTag.Data.(*tag.VideoData)
+		require.Equal(t, tag.CodecIDHEVC, videoData.CodecID)
+		require.Equal(t, int32(40), videoData.CompositionTime)
+
+		// the packet header is not a part of the payload
+		payload, err := io.ReadAll(videoData.Data)
+		require.Nil(t, err)
+		require.Equal(t, []byte{0x01, 0x02}, payload)
+
+		packetTypes = append(packetTypes, videoData.AVCPacketType)
+	}
+	require.Equal(t, []tag.AVCPacketType{tag.AVCPacketTypeSequenceHeader, tag.AVCPacketTypeNALU}, packetTypes)
+}
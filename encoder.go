@@ -10,64 +10,279 @@ package flv
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
+	"time"
 
 	"github.com/yutopp/go-flv/tag"
 )
 
+const DefaultDetectTags = 32
+
+type EncoderConfig struct {
+	// Wrap24BitTimestamps makes timestamps wrap at 24bits for players which ignore TimestampExtended.
+	Wrap24BitTimestamps bool
+
+	// DetectFlags makes flags of the header computed from tags actually encoded, since players may
+	// ignore tracks which are not flagged or wait for tracks which never come. Flags given to the
+	// constructor are only used until the detected flags are written.
+	//
+	// If the writer is a seekable io.WriteSeeker, the header is written first and its flags are
+	// patched on Close. Otherwise the header is deferred and tags are buffered until DetectTags
+	// tags are encoded, DetectTimeout passes, or Flush or Close is called.
+	DetectFlags bool
+	// DetectTags is a number of tags buffered before the deferred header. Defaults to DefaultDetectTags.
+	DetectTags int
+	// DetectTimeout limits a duration (wall clock) of buffering from the first tag. It is checked when
+	// tags are encoded and by Encoder.Tick. Zero disables it.
+	DetectTimeout time.Duration
+}
+
 type Encoder struct {
 	w           io.Writer
 	header      *Header
 	encodedOnce bool
-	cacheBuffer bytes.Buffer
+	buf         [4]byte
+	scratch     tag.Scratch
+	config      EncoderConfig
+	now         func() time.Time
+	err         error // sticky
+
+	detected     Flags
+	deferred     bool          // the header is not written yet
+	pending      []*tag.FlvTag // buffered until the deferred header
+	pendingSince time.Time
+	patcher      io.WriteSeeker // patches flags of the header on Close
+	headerOffset int64
 }
 
 func NewEncoder(w io.Writer, flags Flags) (*Encoder, error) {
+	return NewEncoderWithConfig(w, flags, nil)
+}
+
+func NewEncoderWithConfig(w io.Writer, flags Flags, config *EncoderConfig) (*Encoder, error) {
+	var c EncoderConfig
+	if config != nil {
+		c = *config
+	}
+	if c.DetectTags == 0 {
+		c.DetectTags = DefaultDetectTags
+	}
+
 	header := &Header{
 		Version:    1, // only supports 1 currently
 		Flags:      flags,
 		DataOffset: HeaderLength,
 	}
+	enc := &Encoder{
+		w:      w,
+		header: header,
+		config: c,
+		now:    time.Now,
+	}
+
+	if c.DetectFlags {
+		// pipes may be io.WriteSeekers which cannot seek, e.g. os.Stdout
+		if ws, ok := w.(io.WriteSeeker); ok {
+			if offset, err := ws.Seek(0, io.SeekCurrent); err == nil {
+				enc.patcher = ws
+				enc.headerOffset = offset
+			}
+		}
+		if enc.patcher == nil {
+			enc.deferred = true
+			return enc, nil
+		}
+	}
+
 	if err := EncodeFlvHeader(w, header); err != nil {
 		return nil, err
 	}
 
-	return &Encoder{
-		w:      w,
-		header: header,
-	}, nil
+	return enc, nil
 }
 
+// Header returns the header. In DetectFlags mode, its flags are updated when detected flags are
+// written.
 func (enc *Encoder) Header() *Header {
 	return enc.header
 }
 
+// Encode encodes a tag followed by its size. Payloads whose length is known are written without
+// intermediate copies (see tag.Scratch.EncodeFlvTag). While the header is deferred in DetectFlags
+// mode, tags are copied into Buffers owned by the encoder and buffered instead.
+//
+// In both modes, the encoder neither retains nor releases the tag and its payload after Encode
+// returns, so the caller keeps the ownership of its Buffers, e.g. from tag.ReadBuffer.
+//
+// If a payload does not match its length (tag.ErrPayloadSizeMismatch), the output is broken by the
+// partially written tag, thus the encoder returns the error for all subsequent calls.
 func (enc *Encoder) Encode(flvTag *tag.FlvTag) error {
-	var previousTagSize uint32
+	if enc.err != nil {
+		return enc.err
+	}
+
+	switch flvTag.TagType {
+	case tag.TagTypeAudio:
+		enc.detected |= FlagsAudio
+	case tag.TagTypeVideo:
+		enc.detected |= FlagsVideo
+	}
+
+	if enc.deferred {
+		return enc.buffer(flvTag)
+	}
+
+	return enc.encode(flvTag)
+}
+
+func (enc *Encoder) encode(flvTag *tag.FlvTag) error {
 	if !enc.encodedOnce {
-		goto tagSize
+		// first previous tag size is 0
+		buf := enc.buf[:]
+		binary.BigEndian.PutUint32(buf, 0)
+		if _, err := enc.w.Write(buf); err != nil {
+			return err
+		}
+
+		enc.encodedOnce = true
+	}
+
+	if enc.config.Wrap24BitTimestamps && flvTag.Timestamp >= uint32(timestampWrap24) {
+		t := *flvTag
+		t.Timestamp = uint32(int64(flvTag.Timestamp) % timestampWrap24)
+		flvTag = &t
+	}
+
+	err := enc.scratch.EncodeFlvTagWithSize(enc.w, flvTag)
+	if errors.Is(err, tag.ErrPayloadSizeMismatch) {
+		enc.err = err
 	}
+	return err
+}
 
-body:
-	enc.cacheBuffer.Reset()
-	if err := tag.EncodeFlvTag(&enc.cacheBuffer, flvTag); err != nil {
+// EncodeWithTime encodes a tag with a timestamp converted from t, which may exceed 32bits.
+func (enc *Encoder) EncodeWithTime(flvTag *tag.FlvTag, t time.Duration) error {
+	ft := *flvTag
+	ft.Timestamp = WrapTimestamp(t, enc.config.Wrap24BitTimestamps)
+
+	return enc.Encode(&ft)
+}
+
+func (enc *Encoder) buffer(flvTag *tag.FlvTag) error {
+	// Buffers of the caller are copied as well, since pending tags are released by Flush
+	t := *flvTag
+	switch data := t.Data.(type) {
+	case *tag.AudioData:
+		if b, ok := data.Data.(*tag.Buffer); ok {
+			v := *data
+			v.Data = bytes.NewReader(b.Bytes())
+			t.Data = &v
+		}
+	case *tag.VideoData:
+		if b, ok := data.Data.(*tag.Buffer); ok {
+			v := *data
+			v.Data = bytes.NewReader(b.Bytes())
+			t.Data = &v
+		}
+	}
+	if err := t.Materialize(); err != nil {
 		return err
 	}
-	previousTagSize = uint32(enc.cacheBuffer.Len())
-	if _, err := io.CopyN(enc.w, &enc.cacheBuffer, int64(previousTagSize)); err != nil {
+
+	if len(enc.pending) == 0 {
+		enc.pendingSince = enc.now()
+	}
+	enc.pending = append(enc.pending, &t)
+
+	if len(enc.pending) >= enc.config.DetectTags || enc.detectTimedOut() {
+		return enc.Flush()
+	}
+
+	return nil
+}
+
+// Tick writes the deferred header and buffered tags if DetectTimeout has passed in DetectFlags mode.
+// The timeout is otherwise checked only when tags are encoded, thus call it periodically, e.g. by
+// a time.Ticker, when tags may stop coming. It must not be called concurrently with Encode.
+func (enc *Encoder) Tick() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	if !enc.detectTimedOut() {
+		return nil
+	}
+
+	return enc.Flush()
+}
+
+func (enc *Encoder) detectTimedOut() bool {
+	timeout := enc.config.DetectTimeout
+	if !enc.deferred || len(enc.pending) == 0 || timeout <= 0 {
+		return false
+	}
+	return enc.now().Sub(enc.pendingSince) >= timeout
+}
+
+// Flush writes the deferred header with detected flags and buffered tags in DetectFlags mode.
+// Tags are not buffered after that.
+func (enc *Encoder) Flush() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	if !enc.deferred {
+		return nil
+	}
+	enc.deferred = false
+
+	pending := enc.pending
+	enc.pending = nil
+	defer func() {
+		for _, t := range pending {
+			t.Release()
+		}
+	}()
+
+	enc.header.Flags = enc.detected
+	if err := EncodeFlvHeader(enc.w, enc.header); err != nil {
 		return err
 	}
 
-tagSize:
-	buf := make([]byte, 4)
-	binary.BigEndian.PutUint32(buf, previousTagSize)
-	if _, err := enc.w.Write(buf); err != nil {
+	for _, t := range pending {
+		if err := enc.encode(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close finishes the stream in DetectFlags mode: the deferred header and buffered tags are written,
+// or flags of the header are patched for seekable writers. It does not close the underlying writer.
+func (enc *Encoder) Close() error {
+	if err := enc.Flush(); err != nil {
 		return err
 	}
+	if enc.patcher == nil {
+		return nil
+	}
 
-	if !enc.encodedOnce {
-		enc.encodedOnce = true
-		goto body
+	ws := enc.patcher
+	enc.patcher = nil
+
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(enc.headerOffset+4, io.SeekStart); err != nil { // Signature + Version
+		return err
+	}
+	enc.header.Flags = enc.detected
+	if _, err := ws.Write([]byte{flagsByte(enc.header.Flags)}); err != nil {
+		return err
+	}
+	if _, err := ws.Seek(end, io.SeekStart); err != nil {
+		return err
 	}
 
 	return nil
@@ -80,16 +295,21 @@ func EncodeFlvHeader(w io.Writer, header *Header) error {
 
 	buf[3] = header.Version
 
-	buf[4] = 0
-	if (header.Flags & FlagsAudio) != 0 {
-		buf[4] |= 0x04 // 0b00000100
-	}
-	if (header.Flags & FlagsVideo) != 0 {
-		buf[4] |= 0x01 // 0b00000001
-	}
+	buf[4] = flagsByte(header.Flags)
 
 	binary.BigEndian.PutUint32(buf[5:9], HeaderLength)
 
 	_, err := w.Write(buf)
 	return err
 }
+
+func flagsByte(flags Flags) byte {
+	var b byte
+	if (flags & FlagsAudio) != 0 {
+		b |= 0x04 // 0b00000100
+	}
+	if (flags & FlagsVideo) != 0 {
+		b |= 0x01 // 0b00000001
+	}
+	return b
+}
@@ -0,0 +1,296 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestEncoderTimestamps(t *testing.T) {
+	type testCase struct {
+		Name      string
+		Config    *EncoderConfig
+		Timestamp uint32
+		Time      time.Duration
+		Expected  []byte // Timestamp + TimestampExtended
+	}
+
+	testCases := []testCase{
+		{
+			Name:      "Timestamp",
+			Timestamp: 0x01020304,
+			Expected:  []byte{0x02, 0x03, 0x04, 0x01},
+		},
+		{
+			Name:      "Timestamp24Bit",
+			Config:    &EncoderConfig{Wrap24BitTimestamps: true},
+			Timestamp: 0x01020304,
+			Expected:  []byte{0x02, 0x03, 0x04, 0x00},
+		},
+		{
+			Name:     "Time",
+			Time:     (1<<32 + 0x01020304) * time.Millisecond,
+			Expected: []byte{0x02, 0x03, 0x04, 0x01},
+		},
+		{
+			Name:     "Time24Bit",
+			Config:   &EncoderConfig{Wrap24BitTimestamps: true},
+			Time:     (1<<32 + 0x01020304) * time.Millisecond,
+			Expected: []byte{0x02, 0x03, 0x04, 0x00},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			enc, err := NewEncoderWithConfig(&buf, FlagsVideo, tc.Config)
+			require.Nil(t, err)
+
+			flvTag := newBenchTag([]byte{0x01})
+			if tc.Time > 0 {
+				err = enc.EncodeWithTime(flvTag, tc.Time)
+			} else {
+				flvTag.Timestamp = tc.Timestamp
+				err = enc.Encode(flvTag)
+			}
+			require.Nil(t, err)
+
+			b := buf.Bytes()[HeaderLength+4:] // header + previous tag size
+			require.Equal(t, tc.Expected, b[4:8])
+		})
+	}
+}
+
+func TestEncoderPayloadSizeMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsAudio)
+	require.Nil(t, err)
+
+	audioData := &tag.AudioData{
+		SoundFormat: tag.SoundFormatMP3,
+	}
+	audioData.SetPayloadReader(bytes.NewReader([]byte{0x01}), 4)
+	err = enc.Encode(&tag.FlvTag{
+		TagType: tag.TagTypeAudio,
+		Data:    audioData,
+	})
+	require.True(t, errors.Is(err, tag.ErrPayloadSizeMismatch), "%+v", err)
+	written := buf.Len()
+
+	// the tag is partially written, thus following tags are not written
+	for i := 0; i < 2; i++ {
+		err2 := enc.Encode(newInterleaveTag(tag.TagTypeAudio, 10))
+		require.Equal(t, err, err2)
+		require.Equal(t, written, buf.Len())
+	}
+	require.Equal(t, err, enc.Flush())
+}
+
+func TestEncoderDetectFlagsDeferred(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoderWithConfig(&buf, FlagsAudio|FlagsVideo, &EncoderConfig{
+		DetectFlags: true,
+		DetectTags:  3,
+	})
+	require.Nil(t, err)
+
+	// buffered until 3 tags
+	for _, ts := range []uint32{0, 40} {
+		err := enc.Encode(newInterleaveTag(tag.TagTypeVideo, ts))
+		require.Nil(t, err)
+	}
+	require.Equal(t, 0, buf.Len())
+
+	err = enc.Encode(newInterleaveTag(tag.TagTypeVideo, 80))
+	require.Nil(t, err)
+	require.Equal(t, FlagsVideo, enc.Header().Flags)
+
+	// written directly after that
+	err = enc.Encode(newInterleaveTag(tag.TagTypeVideo, 120))
+	require.Nil(t, err)
+
+	err = enc.Close()
+	require.Nil(t, err)
+
+	dec, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Equal(t, FlagsVideo, dec.Header().Flags)
+	require.Equal(t, []string{"v0", "v40", "v80", "v120"}, decodeOrder(t, &buf))
+}
+
+func TestEncoderDetectFlagsTimeout(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoderWithConfig(&buf, 0, &EncoderConfig{
+		DetectFlags:   true,
+		DetectTimeout: time.Second,
+	})
+	require.Nil(t, err)
+
+	now := time.Unix(0, 0)
+	enc.now = func() time.Time { return now }
+
+	err = enc.Encode(newInterleaveTag(tag.TagTypeAudio, 0))
+	require.Nil(t, err)
+	require.Equal(t, 0, buf.Len())
+
+	now = now.Add(time.Second)
+	err = enc.Encode(newInterleaveTag(tag.TagTypeVideo, 20))
+	require.Nil(t, err)
+	require.Equal(t, FlagsAudio|FlagsVideo, enc.Header().Flags)
+	require.Equal(t, []string{"a0", "v20"}, decodeOrder(t, &buf))
+}
+
+func TestEncoderDetectFlagsTick(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoderWithConfig(&buf, 0, &EncoderConfig{
+		DetectFlags:   true,
+		DetectTimeout: time.Second,
+	})
+	require.Nil(t, err)
+
+	now := time.Unix(0, 0)
+	enc.now = func() time.Time { return now }
+
+	// nothing is buffered
+	now = now.Add(time.Second)
+	require.Nil(t, enc.Tick())
+	require.Equal(t, 0, buf.Len())
+
+	err = enc.Encode(newInterleaveTag(tag.TagTypeAudio, 0))
+	require.Nil(t, err)
+
+	now = now.Add(time.Second - 1)
+	require.Nil(t, enc.Tick())
+	require.Equal(t, 0, buf.Len())
+
+	// no more tags come, but the timeout is checked
+	now = now.Add(1)
+	require.Nil(t, enc.Tick())
+	require.Equal(t, FlagsAudio, enc.Header().Flags)
+	require.Equal(t, []string{"a0"}, decodeOrder(t, &buf))
+
+	// tags are written directly after that
+	err = enc.Encode(newInterleaveTag(tag.TagTypeAudio, 10))
+	require.Nil(t, err)
+	require.Nil(t, enc.Tick())
+	require.Equal(t, []string{"a0", "a10"}, decodeOrder(t, &buf))
+}
+
+func TestEncoderDetectFlagsBufferOwnership(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoderWithConfig(&buf, 0, &EncoderConfig{
+		DetectFlags: true,
+	})
+	require.Nil(t, err)
+
+	payload, err := tag.ReadBuffer(bytes.NewReader([]byte{0x01, 0x02, 0x03}))
+	require.Nil(t, err)
+	defer payload.Release()
+
+	flvTag := &tag.FlvTag{
+		TagType: tag.TagTypeVideo,
+		Data: &tag.VideoData{
+			FrameType:     tag.FrameTypeKeyFrame,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: tag.AVCPacketTypeNALU,
+			Data:          payload,
+		},
+	}
+	require.Nil(t, enc.Encode(flvTag))
+	require.Nil(t, enc.Encode(flvTag))
+	require.Nil(t, enc.Flush())
+
+	// the pooled Buffer is still owned by the caller
+	require.Equal(t, []byte{0x01, 0x02, 0x03}, payload.Bytes())
+
+	dec, err := NewDecoder(&buf)
+	require.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		var decoded tag.FlvTag
+		require.Nil(t, dec.Decode(&decoded))
+		b, err := io.ReadAll(decoded.Data.(*tag.VideoData).Data)
+		require.Nil(t, err)
+		require.Equal(t, []byte{0x01, 0x02, 0x03}, b)
+	}
+}
+
+func TestEncoderDetectFlagsClose(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoderWithConfig(&buf, FlagsVideo, &EncoderConfig{
+		DetectFlags: true,
+	})
+	require.Nil(t, err)
+
+	err = enc.Encode(newInterleaveTag(tag.TagTypeAudio, 0))
+	require.Nil(t, err)
+	require.Equal(t, 0, buf.Len())
+
+	err = enc.Close()
+	require.Nil(t, err)
+
+	dec, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Equal(t, FlagsAudio, dec.Header().Flags)
+	require.Equal(t, []string{"a0"}, decodeOrder(t, &buf))
+}
+
+func TestEncoderDetectFlagsPatch(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "recording.flv"))
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	_, err = f.Write([]byte("prefix"))
+	require.Nil(t, err)
+
+	enc, err := NewEncoderWithConfig(f, FlagsVideo, &EncoderConfig{
+		DetectFlags: true,
+	})
+	require.Nil(t, err)
+
+	// written without buffering
+	err = enc.Encode(newInterleaveTag(tag.TagTypeAudio, 0))
+	require.Nil(t, err)
+
+	readFile := func() *bytes.Buffer {
+		b, err := os.ReadFile(f.Name())
+		require.Nil(t, err)
+		return bytes.NewBuffer(b[len("prefix"):])
+	}
+	dec, err := NewDecoder(readFile())
+	require.Nil(t, err)
+	require.Equal(t, FlagsVideo, dec.Header().Flags) // given flags
+
+	err = enc.Close()
+	require.Nil(t, err)
+
+	// the file position is kept at the end
+	pos, err := f.Seek(0, io.SeekCurrent)
+	require.Nil(t, err)
+	info, err := f.Stat()
+	require.Nil(t, err)
+	require.Equal(t, info.Size(), pos)
+
+	dec, err = NewDecoder(readFile())
+	require.Nil(t, err)
+	require.Equal(t, FlagsAudio, dec.Header().Flags)
+	require.Equal(t, []string{"a0"}, decodeOrder(t, readFile()))
+}
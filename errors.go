@@ -0,0 +1,52 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+var (
+	// ErrSignatureMismatch is wrapped by errors of headers which do not start with "FLV".
+	ErrSignatureMismatch = errors.New("signature is not matched")
+	// ErrInvalidTagSize is wrapped by errors of previous tag sizes which are inconsistent.
+	ErrInvalidTagSize = errors.New("invalid previous tag size")
+	// ErrTruncated matches DecodeErrors of streams which end in the middle of the header or a tag.
+	// An end of the stream between tags is reported as io.EOF as it is, not as a DecodeError.
+	ErrTruncated = errors.New("truncated")
+)
+
+// DecodeError is an error of Decoder with the position where it occurred. It wraps the cause, e.g.
+// ErrSignatureMismatch, ErrInvalidTagSize, tag.ErrUnsupportedTagType, tag.ErrMalformedData or
+// io.ErrUnexpectedEOF, and also matches ErrTruncated for the last one.
+type DecodeError struct {
+	// Offset is a byte offset of the tag, or its preceding previous tag size, counted from the
+	// beginning of the header.
+	Offset int64
+	// Index is a zero-based index of the tag in the stream, or -1 for the header.
+	Index int
+	// TagType is a type of the tag. It is zero if the tag header is not decoded.
+	TagType tag.TagType
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v: Offset = %d, Index = %d, TagType = %d", e.Err, e.Offset, e.Index, e.TagType)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrTruncated && errors.Is(e.Err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestDecodeErrorOfHeader(t *testing.T) {
+	_, err := NewDecoder(bytes.NewReader([]byte{0x46, 0x4c, 0x57, 0x01, 0x05, 0x00, 0x00, 0x00, 0x09}))
+
+	var decErr *DecodeError
+	require.True(t, errors.As(err, &decErr))
+	require.True(t, errors.Is(err, ErrSignatureMismatch))
+	require.False(t, errors.Is(err, ErrTruncated))
+	require.Equal(t, int64(0), decErr.Offset)
+	require.Equal(t, -1, decErr.Index)
+
+	_, err = NewDecoder(bytes.NewReader([]byte{0x46, 0x4c, 0x56, 0x01}))
+	require.True(t, errors.Is(err, ErrTruncated))
+}
+
+func TestDecodeErrorOfTags(t *testing.T) {
+	bin := encodeTestTags(t, 10, 20)
+	tagLen := (len(bin) - int(HeaderLength) - 4) / 2 // includes the trailing size
+	secondTag := int64(HeaderLength) + 4 + int64(tagLen)
+
+	testCases := []struct {
+		name    string
+		binary  []byte
+		offset  int64
+		index   int
+		tagType tag.TagType
+		err     error
+	}{
+		{
+			name:   "initial tag size",
+			binary: append(append([]byte{}, bin[:HeaderLength]...), 0x00, 0x00, 0x00, 0x01),
+			offset: int64(HeaderLength),
+			index:  0,
+			err:    ErrInvalidTagSize,
+		},
+		{
+			name:   "truncated in the tag size",
+			binary: bin[:secondTag-2],
+			offset: secondTag - 4,
+			index:  1,
+			err:    ErrTruncated,
+		},
+		{
+			name:   "truncated in the tag header",
+			binary: bin[:secondTag+5],
+			offset: secondTag,
+			index:  1,
+			err:    ErrTruncated,
+		},
+		{
+			name:    "truncated in the data",
+			binary:  bin[:secondTag+tag.TagHeaderLength],
+			offset:  secondTag,
+			index:   1,
+			tagType: tag.TagTypeVideo,
+			err:     ErrTruncated,
+		},
+		{
+			name: "unsupported tag type",
+			binary: append(append([]byte{}, bin[:secondTag]...),
+				0x07, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			),
+			offset:  secondTag,
+			index:   1,
+			tagType: 0x07,
+			err:     tag.ErrUnsupportedTagType,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dec, err := NewDecoder(bytes.NewReader(tc.binary))
+			require.Nil(t, err)
+
+			var flvTag tag.FlvTag
+			for {
+				err = dec.Decode(&flvTag)
+				if err != nil {
+					break
+				}
+				flvTag.Close()
+			}
+
+			var decErr *DecodeError
+			require.True(t, errors.As(err, &decErr), "%+v", err)
+			require.True(t, errors.Is(err, tc.err), "%+v", err)
+			require.Equal(t, tc.offset, decErr.Offset)
+			require.Equal(t, tc.index, decErr.Index)
+			require.Equal(t, tc.tagType, decErr.TagType)
+		})
+	}
+}
+
+func TestDecodeErrorEOFBetweenTags(t *testing.T) {
+	bin := encodeTestTags(t, 10)
+
+	for _, b := range [][]byte{bin, bin[:len(bin)-4]} { // with or without the trailing size
+		dec, err := NewDecoder(bytes.NewReader(b))
+		require.Nil(t, err)
+
+		var flvTag tag.FlvTag
+		err = dec.Decode(&flvTag)
+		require.Nil(t, err)
+		flvTag.Close()
+
+		err = dec.Decode(&flvTag)
+		require.Equal(t, io.EOF, err)
+	}
+}
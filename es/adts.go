@@ -0,0 +1,98 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// ADTSConverter converts AAC audio data into ADTS frames. Headers are built from the
+// AudioSpecificConfig in the sequence header.
+type ADTSConverter struct {
+	config *aac.AudioSpecificConfig
+
+	payloadBuf bytes.Buffer
+	cacheBuf   []byte
+}
+
+// Config returns the AudioSpecificConfig in the last sequence header, or nil if it is not received.
+func (c *ADTSConverter) Config() *aac.AudioSpecificConfig {
+	return c.config
+}
+
+// Convert returns an ADTS frame of raw AAC data. The frame is valid until the next call.
+// A sequence header updates the config and nil is returned for it.
+func (c *ADTSConverter) Convert(audioData *tag.AudioData) ([]byte, error) {
+	if audioData.SoundFormat != tag.SoundFormatAAC {
+		return nil, fmt.Errorf("unsupported sound format: %+v", audioData.SoundFormat)
+	}
+
+	switch audioData.AACPacketType {
+	case tag.AACPacketTypeSequenceHeader:
+		var config aac.AudioSpecificConfig
+		if err := aac.DecodeAudioSpecificConfig(audioData.Data, &config); err != nil {
+			return nil, fmt.Errorf("failed to decode AudioSpecificConfig: %w", err)
+		}
+		c.config = &config
+		return nil, nil
+
+	case tag.AACPacketTypeRaw:
+		if c.config == nil {
+			return nil, fmt.Errorf("AAC sequence header is not received")
+		}
+
+		c.payloadBuf.Reset()
+		if _, err := c.payloadBuf.ReadFrom(audioData.Data); err != nil {
+			return nil, err
+		}
+		header, err := aac.NewADTSHeader(c.config, c.payloadBuf.Len())
+		if err != nil {
+			return nil, err
+		}
+		frame := aac.AppendADTSHeader(c.cacheBuf[:0], header)
+		frame = append(frame, c.payloadBuf.Bytes()...)
+		c.cacheBuf = frame
+
+		return frame, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported AAC packet type: %+v", audioData.AACPacketType)
+	}
+}
+
+// ADTSWriter writes AAC audio tags as a raw ADTS stream.
+type ADTSWriter struct {
+	w    io.Writer
+	conv ADTSConverter
+}
+
+func NewADTSWriter(w io.Writer) *ADTSWriter {
+	return &ADTSWriter{
+		w: w,
+	}
+}
+
+// WriteTag writes an audio tag. Other tags are ignored.
+func (w *ADTSWriter) WriteTag(flvTag *tag.FlvTag) error {
+	audioData, ok := flvTag.Data.(*tag.AudioData)
+	if !ok {
+		return nil
+	}
+
+	frame, err := w.conv.Convert(audioData)
+	if err != nil || frame == nil {
+		return err
+	}
+	_, err = w.w.Write(frame)
+	return err
+}
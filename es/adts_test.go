@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func audioTag(aacPacketType tag.AACPacketType, payload []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType: tag.TagTypeAudio,
+		Data: &tag.AudioData{
+			SoundFormat:   tag.SoundFormatAAC,
+			AACPacketType: aacPacketType,
+			Data:          bytes.NewReader(payload),
+		},
+	}
+}
+
+func TestADTSWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewADTSWriter(&buf)
+
+	frame := []byte{0x21, 0x00, 0x49, 0x90}
+
+	err := w.WriteTag(audioTag(tag.AACPacketTypeRaw, frame))
+	require.NotNil(t, err)
+
+	// AAC-LC, 44100Hz, stereo
+	require.Nil(t, w.WriteTag(audioTag(tag.AACPacketTypeSequenceHeader, []byte{0x12, 0x10})))
+	require.Nil(t, w.WriteTag(audioTag(tag.AACPacketTypeRaw, frame)))
+	require.Nil(t, w.WriteTag(audioTag(tag.AACPacketTypeRaw, frame)))
+
+	b := buf.Bytes()
+	require.Equal(t, 2*(aac.ADTSHeaderLength+len(frame)), len(b))
+
+	header, err := aac.ParseADTSHeader(b)
+	require.Nil(t, err)
+	require.Equal(t, aac.ADTSHeaderLength+len(frame), int(header.FrameLength))
+	require.Equal(t, uint8(2), header.ChannelConfiguration)
+	require.Equal(t, frame, b[aac.ADTSHeaderLength:aac.ADTSHeaderLength+len(frame)])
+}
+
+func TestADTSWriterUnsupportedFormat(t *testing.T) {
+	w := NewADTSWriter(&bytes.Buffer{})
+	err := w.WriteTag(&tag.FlvTag{
+		TagType: tag.TagTypeAudio,
+		Data: &tag.AudioData{
+			SoundFormat: tag.SoundFormatMP3,
+			Data:        bytes.NewReader([]byte{0xff, 0xfb}),
+		},
+	})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/codec/hevc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// AnnexBConverter converts H.264 or H.265 video data into Annex B access units.
+// Parameter sets in the sequence header are injected before each keyframe unless the
+// keyframe already carries them in-band.
+type AnnexBConverter struct {
+	// InsertAUD replaces AUDs in access units with one at the beginning, as MPEG-TS requires.
+	InsertAUD bool
+
+	codecID       tag.CodecID
+	lengthSize    int
+	parameterSets [][]byte
+
+	payloadBuf bytes.Buffer
+	cacheBuf   []byte
+}
+
+// CodecID returns the codec in the last sequence header, or zero if it is not received.
+func (c *AnnexBConverter) CodecID() tag.CodecID {
+	return c.codecID
+}
+
+// Convert returns an access unit of NAL units. The access unit is valid until the next call.
+// A sequence header updates parameter sets, and nil is returned for it and an end of sequence.
+func (c *AnnexBConverter) Convert(videoData *tag.VideoData) ([]byte, error) {
+	if videoData.CodecID != tag.CodecIDAVC && videoData.CodecID != tag.CodecIDHEVC {
+		return nil, fmt.Errorf("unsupported video codec: %+v", videoData.CodecID)
+	}
+
+	switch videoData.AVCPacketType {
+	case tag.AVCPacketTypeSequenceHeader:
+		return nil, c.readSequenceHeader(videoData)
+
+	case tag.AVCPacketTypeNALU:
+		if c.parameterSets == nil || c.codecID != videoData.CodecID {
+			if videoData.CodecID == tag.CodecIDHEVC {
+				return nil, fmt.Errorf("HEVC sequence header is not received")
+			}
+			return nil, fmt.Errorf("AVC sequence header is not received")
+		}
+
+		c.payloadBuf.Reset()
+		if _, err := c.payloadBuf.ReadFrom(videoData.Data); err != nil {
+			return nil, err
+		}
+		nalus, err := avc.SplitAVCC(c.payloadBuf.Bytes(), c.lengthSize)
+		if err != nil {
+			return nil, err
+		}
+
+		injectParameterSets := videoData.FrameType == tag.FrameTypeKeyFrame && !c.hasParameterSets(nalus)
+
+		au := c.cacheBuf[:0]
+		if c.InsertAUD {
+			au = avc.AppendAnnexB(au, [][]byte{c.accessUnitDelimiter()})
+		}
+		for i, nalu := range nalus {
+			if c.isAUD(nalu) {
+				if c.InsertAUD {
+					continue
+				}
+			} else if injectParameterSets {
+				au = avc.AppendAnnexB(au, c.parameterSets)
+				injectParameterSets = false
+			}
+			au = avc.AppendAnnexB(au, nalus[i:i+1])
+		}
+		c.cacheBuf = au
+
+		return au, nil
+
+	case tag.AVCPacketTypeEOS:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported AVC packet type: %+v", videoData.AVCPacketType)
+	}
+}
+
+func (c *AnnexBConverter) readSequenceHeader(videoData *tag.VideoData) error {
+	switch videoData.CodecID {
+	case tag.CodecIDAVC:
+		var record avc.DecoderConfigurationRecord
+		if err := avc.DecodeDecoderConfigurationRecord(videoData.Data, &record); err != nil {
+			return fmt.Errorf("failed to decode AVCDecoderConfigurationRecord: %w", err)
+		}
+		c.lengthSize = record.LengthSize()
+		c.parameterSets = record.ParameterSets()
+
+	case tag.CodecIDHEVC:
+		var record hevc.DecoderConfigurationRecord
+		if err := hevc.DecodeDecoderConfigurationRecord(videoData.Data, &record); err != nil {
+			return fmt.Errorf("failed to decode HEVCDecoderConfigurationRecord: %w", err)
+		}
+		c.lengthSize = record.LengthSize()
+		c.parameterSets = record.ParameterSets()
+	}
+	if c.parameterSets == nil {
+		c.parameterSets = [][]byte{}
+	}
+	c.codecID = videoData.CodecID
+
+	return nil
+}
+
+func (c *AnnexBConverter) hasParameterSets(nalus [][]byte) bool {
+	for _, nalu := range nalus {
+		switch c.codecID {
+		case tag.CodecIDAVC:
+			if avc.NALUnitTypeOf(nalu) == avc.NALUnitTypeSPS {
+				return true
+			}
+		case tag.CodecIDHEVC:
+			if hevc.NALUnitTypeOf(nalu) == hevc.NALUnitTypeSPS {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *AnnexBConverter) isAUD(nalu []byte) bool {
+	switch c.codecID {
+	case tag.CodecIDAVC:
+		return avc.NALUnitTypeOf(nalu) == avc.NALUnitTypeAUD
+	case tag.CodecIDHEVC:
+		return hevc.NALUnitTypeOf(nalu) == hevc.NALUnitTypeAUD
+	}
+	return false
+}
+
+func (c *AnnexBConverter) accessUnitDelimiter() []byte {
+	if c.codecID == tag.CodecIDHEVC {
+		return hevc.AccessUnitDelimiter
+	}
+	return avc.AccessUnitDelimiter
+}
+
+// AnnexBWriter writes H.264 or H.265 video tags as a raw Annex B elementary stream.
+type AnnexBWriter struct {
+	w    io.Writer
+	conv AnnexBConverter
+}
+
+func NewAnnexBWriter(w io.Writer) *AnnexBWriter {
+	return &AnnexBWriter{
+		w: w,
+	}
+}
+
+// WriteTag writes a video tag. Other tags are ignored.
+func (w *AnnexBWriter) WriteTag(flvTag *tag.FlvTag) error {
+	videoData, ok := flvTag.Data.(*tag.VideoData)
+	if !ok {
+		return nil
+	}
+
+	au, err := w.conv.Convert(videoData)
+	if err != nil || au == nil {
+		return err
+	}
+	_, err = w.w.Write(au)
+	return err
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/codec/hevc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+var (
+	testIDR    = []byte{0x65, 0x88, 0x84, 0x21}
+	testNonIDR = []byte{0x41, 0x9a, 0x02, 0x21}
+)
+
+func avcSequenceHeader(t *testing.T) *tag.FlvTag {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&buf, record))
+
+	return &tag.FlvTag{
+		TagType: tag.TagTypeVideo,
+		Data: &tag.VideoData{
+			FrameType:     tag.FrameTypeKeyFrame,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+			Data:          &buf,
+		},
+	}
+}
+
+func videoTag(codecID tag.CodecID, frameType tag.FrameType, nalus ...[]byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType: tag.TagTypeVideo,
+		Data: &tag.VideoData{
+			FrameType:     frameType,
+			CodecID:       codecID,
+			AVCPacketType: tag.AVCPacketTypeNALU,
+			Data:          bytes.NewReader(avc.AppendAVCC(nil, nalus)),
+		},
+	}
+}
+
+func TestAnnexBWriterAVC(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAnnexBWriter(&buf)
+
+	err := w.WriteTag(videoTag(tag.CodecIDAVC, tag.FrameTypeKeyFrame, testIDR))
+	require.NotNil(t, err)
+
+	require.Nil(t, w.WriteTag(avcSequenceHeader(t)))
+	require.Nil(t, w.WriteTag(videoTag(tag.CodecIDAVC, tag.FrameTypeKeyFrame, testIDR)))
+	require.Nil(t, w.WriteTag(videoTag(tag.CodecIDAVC, tag.FrameTypeInterFrame, testNonIDR)))
+	require.Nil(t, w.WriteTag(videoTag(tag.CodecIDAVC, tag.FrameTypeKeyFrame, avc.AccessUnitDelimiter, testIDR)))
+	require.Nil(t, w.WriteTag(videoTag(tag.CodecIDAVC, tag.FrameTypeKeyFrame, testSPS, testPPS, testIDR)))
+
+	expected := avc.AppendAnnexB(nil, [][]byte{
+		testSPS, testPPS, testIDR,
+		testNonIDR,
+		avc.AccessUnitDelimiter, testSPS, testPPS, testIDR,
+		testSPS, testPPS, testIDR,
+	})
+	require.Equal(t, expected, buf.Bytes())
+}
+
+func TestAnnexBWriterHEVC(t *testing.T) {
+	vps := []byte{0x40, 0x01, 0x0c, 0x01}
+	sps := []byte{0x42, 0x01, 0x01, 0x01}
+	pps := []byte{0x44, 0x01, 0xc1, 0x72}
+	idr := []byte{0x26, 0x01, 0xaf, 0x00}
+
+	record := &hevc.DecoderConfigurationRecord{
+		ConfigurationVersion: 1,
+		LengthSizeMinusOne:   3,
+		Arrays: []*hevc.NALUnitArray{
+			{NALUnitType: hevc.NALUnitTypeVPS, NALUnits: [][]byte{vps}},
+			{NALUnitType: hevc.NALUnitTypeSPS, NALUnits: [][]byte{sps}},
+			{NALUnitType: hevc.NALUnitTypePPS, NALUnits: [][]byte{pps}},
+		},
+	}
+	var recordBuf bytes.Buffer
+	require.Nil(t, hevc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+
+	var buf bytes.Buffer
+	w := NewAnnexBWriter(&buf)
+	require.Nil(t, w.WriteTag(&tag.FlvTag{
+		TagType: tag.TagTypeVideo,
+		Data: &tag.VideoData{
+			FrameType:     tag.FrameTypeKeyFrame,
+			CodecID:       tag.CodecIDHEVC,
+			AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+			Data:          &recordBuf,
+		},
+	}))
+	require.Nil(t, w.WriteTag(videoTag(tag.CodecIDHEVC, tag.FrameTypeKeyFrame, idr)))
+
+	require.Equal(t, avc.AppendAnnexB(nil, [][]byte{vps, sps, pps, idr}), buf.Bytes())
+}
+
+func TestAnnexBWriterUnsupportedCodec(t *testing.T) {
+	w := NewAnnexBWriter(&bytes.Buffer{})
+	err := w.WriteTag(videoTag(tag.CodecIDScreenVideo, tag.FrameTypeKeyFrame, testIDR))
+	require.NotNil(t, err)
+}
+
+func TestAnnexBConverterInsertAUD(t *testing.T) {
+	c := &AnnexBConverter{InsertAUD: true}
+
+	au, err := c.Convert(avcSequenceHeader(t).Data.(*tag.VideoData))
+	require.Nil(t, err)
+	require.Nil(t, au)
+
+	au, err = c.Convert(videoTag(tag.CodecIDAVC, tag.FrameTypeKeyFrame, testIDR).Data.(*tag.VideoData))
+	require.Nil(t, err)
+	require.Equal(t, avc.AppendAnnexB(nil, [][]byte{avc.AccessUnitDelimiter, testSPS, testPPS, testIDR}), au)
+
+	au, err = c.Convert(videoTag(tag.CodecIDAVC, tag.FrameTypeInterFrame, avc.AccessUnitDelimiter, testNonIDR).Data.(*tag.VideoData))
+	require.Nil(t, err)
+	require.Equal(t, avc.AppendAnnexB(nil, [][]byte{avc.AccessUnitDelimiter, testNonIDR}), au)
+}
@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package es extracts elementary streams from FLV.
+package es
+
+import (
+	"io"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/internal/packaging"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// Extract reads all tags from dec and writes video as Annex B and audio as ADTS.
+// A nil writer skips the corresponding stream.
+func Extract(dec *flv.Decoder, video, audio io.Writer) error {
+	var e extractor
+	if video != nil {
+		e.annexBWriter = NewAnnexBWriter(video)
+	}
+	if audio != nil {
+		e.adtsWriter = NewADTSWriter(audio)
+	}
+
+	return packaging.Run(dec, packaging.NopCloser(&e))
+}
+
+type extractor struct {
+	annexBWriter *AnnexBWriter
+	adtsWriter   *ADTSWriter
+}
+
+func (e *extractor) WriteTag(flvTag *tag.FlvTag) error {
+	switch flvTag.Data.(type) {
+	case *tag.VideoData:
+		if e.annexBWriter != nil {
+			return e.annexBWriter.WriteTag(flvTag)
+		}
+	case *tag.AudioData:
+		if e.adtsWriter != nil {
+			return e.adtsWriter.WriteTag(flvTag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestExtract(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := flv.NewEncoder(&buf, flv.FlagsAudio|flv.FlagsVideo)
+	require.Nil(t, err)
+
+	flvTags := []*tag.FlvTag{
+		avcSequenceHeader(t),
+		audioTag(tag.AACPacketTypeSequenceHeader, []byte{0x12, 0x10}),
+		videoTag(tag.CodecIDAVC, tag.FrameTypeKeyFrame, testIDR),
+		audioTag(tag.AACPacketTypeRaw, []byte{0x21, 0x00}),
+		videoTag(tag.CodecIDAVC, tag.FrameTypeInterFrame, testNonIDR),
+	}
+	for _, flvTag := range flvTags {
+		require.Nil(t, enc.Encode(flvTag))
+	}
+
+	t.Run("Both", func(t *testing.T) {
+		dec, err := flv.NewDecoder(bytes.NewReader(buf.Bytes()))
+		require.Nil(t, err)
+
+		var video, audio bytes.Buffer
+		err = Extract(dec, &video, &audio)
+		require.Nil(t, err)
+
+		require.Equal(t, avc.AppendAnnexB(nil, [][]byte{testSPS, testPPS, testIDR, testNonIDR}), video.Bytes())
+		require.Equal(t, aac.ADTSHeaderLength+2, audio.Len())
+	})
+
+	t.Run("VideoOnly", func(t *testing.T) {
+		dec, err := flv.NewDecoder(bytes.NewReader(buf.Bytes()))
+		require.Nil(t, err)
+
+		var video bytes.Buffer
+		err = Extract(dec, &video, nil)
+		require.Nil(t, err)
+		require.NotZero(t, video.Len())
+	})
+}
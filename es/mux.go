@@ -0,0 +1,277 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+const DefaultFrameRate = 30
+
+type MuxConfig struct {
+	// FrameRate of the video stream. Default is DefaultFrameRate.
+	FrameRate float64
+}
+
+// MuxToFLV builds FLV from a raw H.264 Annex B stream and a raw AAC ADTS stream.
+// A nil reader omits the corresponding stream.
+//
+// Video timestamps are assigned from FrameRate in decoding order and composition times are
+// always 0, thus streams must not contain B-frames. An error is returned when a B-slice is found.
+// Audio timestamps are assigned from the sampling frequency in ADTS headers.
+func MuxToFLV(w io.Writer, video, audio io.Reader, config *MuxConfig) error {
+	var c MuxConfig
+	if config != nil {
+		c = *config
+	}
+	if c.FrameRate == 0 {
+		c.FrameRate = DefaultFrameRate
+	}
+	if c.FrameRate < 0 {
+		return fmt.Errorf("invalid frame rate: %f", c.FrameRate)
+	}
+
+	var flags flv.Flags
+	m := &muxer{
+		frameRate: c.FrameRate,
+	}
+	if video != nil {
+		flags |= flv.FlagsVideo
+		m.videoReader = NewAnnexBReader(video)
+	}
+	if audio != nil {
+		flags |= flv.FlagsAudio
+		m.audioReader = NewADTSReader(audio)
+	}
+
+	enc, err := flv.NewEncoder(w, flags)
+	if err != nil {
+		return err
+	}
+	m.enc = enc
+
+	return m.run()
+}
+
+type videoFrame struct {
+	timestamp uint32
+	nalus     [][]byte
+}
+
+type audioFrame struct {
+	timestamp uint32
+	header    *aac.ADTSHeader
+	payload   []byte
+}
+
+type muxer struct {
+	enc       *flv.Encoder
+	frameRate float64
+
+	videoReader *AnnexBReader
+	videoFrames int
+	nextVideo   *videoFrame
+	sps, pps    []byte
+	avcUpdated  bool
+
+	audioReader *ADTSReader
+	audioConfig *aac.AudioSpecificConfig
+	audioTime   uint64 // in samples
+	nextAudio   *audioFrame
+}
+
+func (m *muxer) run() error {
+	for {
+		if err := m.readVideo(); err != nil {
+			return fmt.Errorf("failed to read video: %w", err)
+		}
+		if err := m.readAudio(); err != nil {
+			return fmt.Errorf("failed to read audio: %w", err)
+		}
+
+		switch {
+		case m.nextVideo != nil && (m.nextAudio == nil || m.nextVideo.timestamp <= m.nextAudio.timestamp):
+			if err := m.writeVideo(m.nextVideo); err != nil {
+				return err
+			}
+			m.nextVideo = nil
+
+		case m.nextAudio != nil:
+			if err := m.writeAudio(m.nextAudio); err != nil {
+				return err
+			}
+			m.nextAudio = nil
+
+		default:
+			return nil
+		}
+	}
+}
+
+func (m *muxer) readVideo() error {
+	if m.videoReader == nil || m.nextVideo != nil {
+		return nil
+	}
+
+	nalus, err := m.videoReader.ReadAccessUnit()
+	if err == io.EOF {
+		m.videoReader = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.nextVideo = &videoFrame{
+		timestamp: uint32(math.Round(float64(m.videoFrames) * 1000 / m.frameRate)),
+		nalus:     nalus,
+	}
+	m.videoFrames++
+
+	return nil
+}
+
+func (m *muxer) readAudio() error {
+	if m.audioReader == nil || m.nextAudio != nil {
+		return nil
+	}
+
+	header, payload, err := m.audioReader.ReadFrame()
+	if err == io.EOF {
+		m.audioReader = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	config := header.AudioSpecificConfig()
+	if config.SamplingFrequency == 0 {
+		return fmt.Errorf("invalid sampling frequency index: %d", header.SamplingFrequencyIndex)
+	}
+
+	m.nextAudio = &audioFrame{
+		timestamp: uint32(m.audioTime * 1000 / uint64(config.SamplingFrequency)),
+		header:    header,
+		payload:   payload,
+	}
+	m.audioTime += aac.SamplesPerFrame
+
+	return nil
+}
+
+func (m *muxer) writeVideo(frame *videoFrame) error {
+	keyframe := false
+	slices := make([][]byte, 0, len(frame.nalus))
+	for _, nalu := range frame.nalus {
+		switch avc.NALUnitTypeOf(nalu) {
+		case avc.NALUnitTypeSPS:
+			if !bytes.Equal(m.sps, nalu) {
+				m.sps = nalu
+				m.avcUpdated = true
+			}
+		case avc.NALUnitTypePPS:
+			if !bytes.Equal(m.pps, nalu) {
+				m.pps = nalu
+				m.avcUpdated = true
+			}
+		case avc.NALUnitTypeAUD:
+			// AUDs are not used in FLV
+		case avc.NALUnitTypeIDR:
+			keyframe = true
+			slices = append(slices, nalu)
+		case avc.NALUnitTypeNonIDR:
+			sliceType, err := avc.ParseSliceType(nalu)
+			if err != nil {
+				return fmt.Errorf("failed to parse slice: %w", err)
+			}
+			if sliceType == avc.SliceTypeB {
+				// composition times are unknown without reordering
+				return fmt.Errorf("B-slices are not supported: Timestamp = %d", frame.timestamp)
+			}
+			slices = append(slices, nalu)
+		default:
+			slices = append(slices, nalu)
+		}
+	}
+
+	if m.sps == nil || m.pps == nil {
+		return fmt.Errorf("SPS and PPS are not found before the first picture")
+	}
+
+	if m.avcUpdated {
+		record, err := avc.NewDecoderConfigurationRecord([][]byte{m.sps}, [][]byte{m.pps})
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := avc.EncodeDecoderConfigurationRecord(&buf, record); err != nil {
+			return err
+		}
+		if err := m.enc.Encode(newAVCTag(frame.timestamp, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader, buf.Bytes())); err != nil {
+			return err
+		}
+		m.avcUpdated = false
+	}
+
+	if len(slices) == 0 {
+		return nil
+	}
+
+	frameType := tag.FrameTypeInterFrame
+	if keyframe {
+		frameType = tag.FrameTypeKeyFrame
+	}
+	return m.enc.Encode(newAVCTag(frame.timestamp, frameType, tag.AVCPacketTypeNALU, avc.AppendAVCC(nil, slices)))
+}
+
+func (m *muxer) writeAudio(frame *audioFrame) error {
+	config := frame.header.AudioSpecificConfig()
+	if m.audioConfig == nil || *m.audioConfig != *config {
+		m.audioConfig = config
+
+		var buf bytes.Buffer
+		if err := aac.EncodeAudioSpecificConfig(&buf, config); err != nil {
+			return err
+		}
+		if err := m.enc.Encode(&tag.FlvTag{
+			TagType:   tag.TagTypeAudio,
+			Timestamp: frame.timestamp,
+			Data:      tag.NewAACAudioData(tag.AACPacketTypeSequenceHeader, buf.Bytes()),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return m.enc.Encode(&tag.FlvTag{
+		TagType:   tag.TagTypeAudio,
+		Timestamp: frame.timestamp,
+		Data:      tag.NewAACAudioData(tag.AACPacketTypeRaw, frame.payload),
+	})
+}
+
+func newAVCTag(timestamp uint32, frameType tag.FrameType, packetType tag.AVCPacketType, data []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:     frameType,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: packetType,
+			Data:          bytes.NewReader(data),
+		},
+	}
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestMuxToFLV(t *testing.T) {
+	video := avc.AppendAnnexB(nil, [][]byte{
+		avc.AccessUnitDelimiter, testSPS, testPPS, testIDR,
+		avc.AccessUnitDelimiter, testNonIDR,
+		avc.AccessUnitDelimiter, testNonIDR,
+	})
+
+	// AAC-LC, 48000Hz, stereo
+	config := &aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 3,
+		SamplingFrequency:      48000,
+		ChannelConfiguration:   2,
+	}
+	var audio []byte
+	for i := 0; i < 4; i++ {
+		header, err := aac.NewADTSHeader(config, 2)
+		require.Nil(t, err)
+		audio = aac.AppendADTSHeader(audio, header)
+		audio = append(audio, 0x21, byte(i))
+	}
+
+	var buf bytes.Buffer
+	err := MuxToFLV(&buf, bytes.NewReader(video), bytes.NewReader(audio), &MuxConfig{
+		FrameRate: 25,
+	})
+	require.Nil(t, err)
+
+	dec, err := flv.NewDecoder(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Equal(t, flv.FlagsAudio|flv.FlagsVideo, dec.Header().Flags)
+
+	type entry struct {
+		TagType   tag.TagType
+		Timestamp uint32
+		Keyframe  bool
+	}
+	var entries []entry
+	for {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+
+		e := entry{TagType: flvTag.TagType, Timestamp: flvTag.Timestamp}
+		if v, ok := flvTag.Data.(*tag.VideoData); ok {
+			e.Keyframe = v.FrameType == tag.FrameTypeKeyFrame
+		}
+		entries = append(entries, e)
+		flvTag.Close()
+	}
+
+	require.Equal(t, []entry{
+		{TagType: tag.TagTypeVideo, Timestamp: 0, Keyframe: true}, // sequence header
+		{TagType: tag.TagTypeVideo, Timestamp: 0, Keyframe: true},
+		{TagType: tag.TagTypeAudio, Timestamp: 0}, // sequence header
+		{TagType: tag.TagTypeAudio, Timestamp: 0},
+		{TagType: tag.TagTypeAudio, Timestamp: 21},
+		{TagType: tag.TagTypeVideo, Timestamp: 40},
+		{TagType: tag.TagTypeAudio, Timestamp: 42},
+		{TagType: tag.TagTypeAudio, Timestamp: 64},
+		{TagType: tag.TagTypeVideo, Timestamp: 80},
+	}, entries)
+
+	// extract them again
+	dec, err = flv.NewDecoder(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+
+	var extractedVideo, extractedAudio bytes.Buffer
+	err = Extract(dec, &extractedVideo, &extractedAudio)
+	require.Nil(t, err)
+	require.Equal(t, avc.AppendAnnexB(nil, [][]byte{testSPS, testPPS, testIDR, testNonIDR, testNonIDR}), extractedVideo.Bytes())
+	require.Equal(t, audio, extractedAudio.Bytes())
+}
+
+func TestMuxToFLVWithoutParameterSets(t *testing.T) {
+	video := avc.AppendAnnexB(nil, [][]byte{testIDR})
+
+	err := MuxToFLV(io.Discard, bytes.NewReader(video), nil, nil)
+	require.NotNil(t, err)
+}
+
+func TestMuxToFLVWithBSlices(t *testing.T) {
+	bSlice := []byte{0x01, 0x9c, 0x00} // slice_type = 6
+	video := avc.AppendAnnexB(nil, [][]byte{testSPS, testPPS, testIDR, avc.AccessUnitDelimiter, bSlice})
+
+	err := MuxToFLV(io.Discard, bytes.NewReader(video), nil, nil)
+	require.EqualError(t, err, "B-slices are not supported: Timestamp = 33")
+}
@@ -0,0 +1,205 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+)
+
+const readChunkSize = 64 * 1024
+
+var startCodePrefix = []byte{0x00, 0x00, 0x01}
+
+// ========================================
+// H.264 Annex B
+
+// AnnexBReader reads access units from a raw H.264 Annex B stream.
+type AnnexBReader struct {
+	r   io.Reader
+	eof bool
+
+	buf []byte
+	off int
+
+	next []byte // the NAL unit which begins the next access unit
+}
+
+func NewAnnexBReader(r io.Reader) *AnnexBReader {
+	return &AnnexBReader{
+		r: r,
+	}
+}
+
+// ReadAccessUnit returns NAL units of the next access unit. It returns io.EOF at the end of the stream.
+// Boundaries are detected by the rules of ITU-T H.264 7.4.1.2.3.
+func (r *AnnexBReader) ReadAccessUnit() ([][]byte, error) {
+	var nalus [][]byte
+	hasVCL := false
+
+	if r.next != nil {
+		nalus = append(nalus, r.next)
+		hasVCL = isVCL(r.next)
+		r.next = nil
+	}
+
+	for {
+		nalu, err := r.readNALUnit()
+		if err == io.EOF {
+			if len(nalus) == 0 {
+				return nil, io.EOF
+			}
+			return nalus, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hasVCL && beginsAccessUnit(nalu) {
+			r.next = nalu
+			return nalus, nil
+		}
+		nalus = append(nalus, nalu)
+		hasVCL = hasVCL || isVCL(nalu)
+	}
+}
+
+func isVCL(nalu []byte) bool {
+	t := avc.NALUnitTypeOf(nalu)
+	return t >= avc.NALUnitTypeNonIDR && t <= avc.NALUnitTypeIDR
+}
+
+func beginsAccessUnit(nalu []byte) bool {
+	switch t := avc.NALUnitTypeOf(nalu); {
+	case t == avc.NALUnitTypeAUD, t == avc.NALUnitTypeSPS, t == avc.NALUnitTypePPS, t == avc.NALUnitTypeSEI:
+		return true
+	case t >= 14 && t <= 18: // prefix NAL unit, subset SPS, etc.
+		return true
+	case isVCL(nalu):
+		// first_mb_in_slice is ue(v) at the head of slice_header. 0 is encoded as a single bit "1".
+		return len(nalu) > 1 && nalu[1]&0x80 != 0
+	default:
+		return false
+	}
+}
+
+func (r *AnnexBReader) readNALUnit() ([]byte, error) {
+	for {
+		// find the beginning of a NAL unit
+		for {
+			if i := bytes.Index(r.buf[r.off:], startCodePrefix); i >= 0 {
+				r.off += i + len(startCodePrefix)
+				break
+			}
+			if r.eof {
+				return nil, io.EOF
+			}
+			if rest := len(r.buf) - r.off; rest > 2 {
+				r.off = len(r.buf) - 2 // keep a partial prefix
+			}
+			if err := r.fill(); err != nil {
+				return nil, err
+			}
+		}
+
+		// find the end of the NAL unit
+		scanned := 0
+		for {
+			var nalu []byte
+			if i := bytes.Index(r.buf[r.off+scanned:], startCodePrefix); i >= 0 {
+				nalu = r.buf[r.off : r.off+scanned+i]
+				r.off += scanned + i
+			} else if r.eof {
+				nalu = r.buf[r.off:]
+				r.off = len(r.buf)
+			} else {
+				if rest := len(r.buf) - r.off; rest > 2 {
+					scanned = rest - 2
+				}
+				if err := r.fill(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// trailing zeros belong to the next 4 bytes start code (or trailing_zero_8bits)
+			nalu = bytes.TrimRight(nalu, "\x00")
+			if len(nalu) == 0 {
+				break // empty, find the next one
+			}
+			return append([]byte(nil), nalu...), nil
+		}
+	}
+}
+
+func (r *AnnexBReader) fill() error {
+	if r.off > 0 {
+		n := copy(r.buf, r.buf[r.off:])
+		r.buf = r.buf[:n]
+		r.off = 0
+	}
+	if cap(r.buf)-len(r.buf) < readChunkSize {
+		buf := make([]byte, len(r.buf), 2*cap(r.buf)+readChunkSize)
+		copy(buf, r.buf)
+		r.buf = buf
+	}
+
+	n, err := r.r.Read(r.buf[len(r.buf):cap(r.buf)])
+	r.buf = r.buf[:len(r.buf)+n]
+	if err == io.EOF {
+		r.eof = true
+		return nil
+	}
+	return err
+}
+
+// ========================================
+// AAC ADTS
+
+// ADTSReader reads frames from a raw AAC ADTS stream.
+type ADTSReader struct {
+	r io.Reader
+
+	headerBuf [aac.ADTSHeaderLength]byte
+}
+
+func NewADTSReader(r io.Reader) *ADTSReader {
+	return &ADTSReader{
+		r: r,
+	}
+}
+
+// ReadFrame returns the header and the raw payload of the next frame. It returns io.EOF at the end of the stream.
+func (r *ADTSReader) ReadFrame() (*aac.ADTSHeader, []byte, error) {
+	if _, err := io.ReadFull(r.r, r.headerBuf[:]); err != nil {
+		return nil, nil, err
+	}
+
+	header, err := aac.ParseADTSHeader(r.headerBuf[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.headerBuf[6]&0x03 != 0 {
+		return nil, nil, fmt.Errorf("ADTS frames which have multiple raw data blocks are not supported")
+	}
+
+	body := make([]byte, header.FrameLength-aac.ADTSHeaderLength)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+
+	// skip CRC if present
+	return header, body[header.HeaderLength-aac.ADTSHeaderLength:], nil
+}
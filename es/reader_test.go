@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package es
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+)
+
+func TestAnnexBReader(t *testing.T) {
+	secondSlice := []byte{0x41, 0x40, 0x01, 0x21} // first_mb_in_slice != 0
+	largeSlice := append([]byte{0x41, 0x9a}, bytes.Repeat([]byte{0xab}, 3*readChunkSize)...)
+
+	expected := [][][]byte{
+		{avc.AccessUnitDelimiter, testSPS, testPPS, testIDR},
+		{testNonIDR, secondSlice},
+		{largeSlice},
+		{testNonIDR},
+	}
+
+	var stream []byte
+	stream = append(stream, 0x00) // leading_zero_8bits
+	for _, au := range expected {
+		stream = avc.AppendAnnexB(stream, au)
+	}
+	stream = append(stream, 0x00, 0x00) // trailing_zero_8bits
+
+	for _, r := range []io.Reader{bytes.NewReader(stream), iotest.HalfReader(bytes.NewReader(stream))} {
+		ar := NewAnnexBReader(r)
+
+		var actual [][][]byte
+		for {
+			au, err := ar.ReadAccessUnit()
+			if err == io.EOF {
+				break
+			}
+			require.Nil(t, err)
+			actual = append(actual, au)
+		}
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestADTSReader(t *testing.T) {
+	config := &aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 4,
+		SamplingFrequency:      44100,
+		ChannelConfiguration:   2,
+	}
+	frames := [][]byte{{0x21, 0x00, 0x49, 0x90}, {0x21, 0x00}}
+
+	var stream []byte
+	for _, frame := range frames {
+		header, err := aac.NewADTSHeader(config, len(frame))
+		require.Nil(t, err)
+		stream = aac.AppendADTSHeader(stream, header)
+		stream = append(stream, frame...)
+	}
+
+	r := NewADTSReader(bytes.NewReader(stream))
+	for _, frame := range frames {
+		header, payload, err := r.ReadFrame()
+		require.Nil(t, err)
+		require.Equal(t, config, header.AudioSpecificConfig())
+		require.Equal(t, frame, payload)
+	}
+	_, _, err := r.ReadFrame()
+	require.Equal(t, io.EOF, err)
+
+	r = NewADTSReader(bytes.NewReader(stream[:len(stream)-1]))
+	_, _, err = r.ReadFrame()
+	require.Nil(t, err)
+	_, _, err = r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -1,6 +1,6 @@
 module github.com/yutopp/go-flv
 
-go 1.19
+go 1.23
 
 require (
 	github.com/stretchr/testify v1.2.2
@@ -0,0 +1,359 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/internal/packaging"
+	"github.com/yutopp/go-flv/mpegts"
+	"github.com/yutopp/go-flv/tag"
+)
+
+type PlaylistType int
+
+const (
+	// PlaylistTypeLive keeps the latest WindowSize segments in the playlist.
+	PlaylistTypeLive PlaylistType = iota
+	// PlaylistTypeEvent appends segments to the playlist as they are written.
+	PlaylistTypeEvent
+	// PlaylistTypeVOD writes the playlist once when the segmenter is closed.
+	PlaylistTypeVOD
+)
+
+type SegmenterConfig struct {
+	Dir               string
+	PlaylistName      string // Default: index.m3u8
+	SegmentNameFormat string // Default: segment%d.ts. Formatted with a sequence number.
+	PlaylistType      PlaylistType
+
+	// Segments are cut at the first keyframe after TargetDuration. They are cut at any frame when
+	// they reach TargetDuration rounded up to seconds, which is EXT-X-TARGETDURATION. Default: 6s
+	TargetDuration time.Duration
+
+	WindowSize     int  // Live only. Default: 5
+	DeleteSegments bool // Live only. Removes segments which are out of the window.
+
+	// Timestamp jumps larger than this are treated as discontinuities. Default: 3s
+	DiscontinuityThreshold time.Duration
+
+	Now func() time.Time // Default: time.Now
+}
+
+type Segment struct {
+	SequenceNumber  uint64
+	Name            string
+	Duration        time.Duration
+	Discontinuity   bool
+	ProgramDateTime time.Time
+}
+
+// Segmenter splits FLV tags into MPEG-TS segments and maintains a m3u8 playlist.
+type Segmenter struct {
+	config SegmenterConfig
+	muxer  *mpegts.Muxer
+
+	segments              []*Segment // in the playlist
+	nextSequenceNumber    uint64
+	discontinuitySequence uint64
+	targetSeconds         int64 // EXT-X-TARGETDURATION
+
+	current          *Segment
+	currentFile      *os.File
+	currentWriter    *bufio.Writer
+	currentStartedAt int64 // ms
+	currentEndedAt   int64 // ms, the last timestamp written to the current segment
+
+	lastTimestamp      int64 // ms
+	hasLastTimestamp   bool
+	pendingDiscontinue bool
+}
+
+func NewSegmenter(config *SegmenterConfig) (*Segmenter, error) {
+	c := *config
+	if c.PlaylistName == "" {
+		c.PlaylistName = "index.m3u8"
+	}
+	if c.SegmentNameFormat == "" {
+		c.SegmentNameFormat = "segment%d.ts"
+	}
+	if c.TargetDuration <= 0 {
+		c.TargetDuration = 6 * time.Second
+	}
+	if c.WindowSize <= 0 {
+		c.WindowSize = 5
+	}
+	if c.DiscontinuityThreshold <= 0 {
+		c.DiscontinuityThreshold = 3 * time.Second
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Segmenter{
+		config:        c,
+		muxer:         mpegts.NewMuxer(io.Discard),
+		targetSeconds: int64((c.TargetDuration + time.Second - 1) / time.Second),
+	}, nil
+}
+
+// Segments returns segments which are currently listed in the playlist.
+func (s *Segmenter) Segments() []*Segment {
+	return s.segments
+}
+
+// WriteTag writes a tag. The payload of the tag is consumed. Video must be AVC.
+func (s *Segmenter) WriteTag(flvTag *tag.FlvTag) error {
+	if data, ok := flvTag.Data.(*tag.VideoData); ok {
+		// segments are MPEG-TS which carries H.264 only
+		if data.ExHeader {
+			return fmt.Errorf("unsupported video codec: %v", data.FourCC)
+		}
+		if data.CodecID != tag.CodecIDAVC {
+			return fmt.Errorf("unsupported video codec: %+v", data.CodecID)
+		}
+	}
+
+	if !isMediaFrame(flvTag) {
+		// sequence headers update configurations of the muxer
+		return s.muxer.WriteTag(flvTag)
+	}
+
+	timestamp := int64(flvTag.Timestamp)
+	if s.hasLastTimestamp {
+		diff := timestamp - s.lastTimestamp
+		threshold := s.config.DiscontinuityThreshold.Milliseconds()
+		if diff > threshold || -diff > threshold {
+			s.pendingDiscontinue = true
+		}
+	}
+	s.lastTimestamp = timestamp
+	s.hasLastTimestamp = true
+
+	keyframe := isVideoKeyFrame(flvTag)
+	if (s.current == nil || s.pendingDiscontinue) && s.muxer.HasVideo() && !keyframe {
+		// segments must start with a keyframe, also after discontinuities
+		return nil
+	}
+
+	if s.shouldCut(timestamp, keyframe) {
+		if err := s.cut(timestamp); err != nil {
+			return err
+		}
+	}
+	if timestamp > s.currentEndedAt {
+		s.currentEndedAt = timestamp
+	}
+
+	return s.muxer.WriteTag(flvTag)
+}
+
+func (s *Segmenter) shouldCut(timestamp int64, keyframe bool) bool {
+	if s.current == nil || s.pendingDiscontinue {
+		return true
+	}
+
+	elapsed := timestamp - s.currentStartedAt
+	if elapsed >= s.targetSeconds*1000 {
+		// keeps EXT-X-TARGETDURATION even if keyframes are sparse
+		return true
+	}
+	if elapsed < s.config.TargetDuration.Milliseconds() {
+		return false
+	}
+
+	// audio only streams can be split at any frame
+	return keyframe || !s.muxer.HasVideo()
+}
+
+func (s *Segmenter) cut(timestamp int64) error {
+	now := s.config.Now()
+
+	var programDateTime time.Time
+	if s.current != nil {
+		duration := timestamp - s.currentStartedAt
+		if s.pendingDiscontinue {
+			duration = s.currentEndedAt - s.currentStartedAt
+		}
+		if err := s.closeCurrent(time.Duration(duration) * time.Millisecond); err != nil {
+			return err
+		}
+	}
+	if len(s.segments) > 0 && !(s.pendingDiscontinue && s.config.PlaylistType == PlaylistTypeLive) {
+		last := s.segments[len(s.segments)-1]
+		programDateTime = last.ProgramDateTime.Add(last.Duration)
+	} else {
+		programDateTime = now
+	}
+
+	seq := s.nextSequenceNumber
+	s.nextSequenceNumber++
+
+	segment := &Segment{
+		SequenceNumber:  seq,
+		Name:            fmt.Sprintf(s.config.SegmentNameFormat, seq),
+		Discontinuity:   s.pendingDiscontinue && len(s.segments) > 0,
+		ProgramDateTime: programDateTime,
+	}
+	s.pendingDiscontinue = false
+
+	f, err := os.Create(filepath.Join(s.config.Dir, segment.Name))
+	if err != nil {
+		return err
+	}
+
+	s.current = segment
+	s.currentFile = f
+	s.currentWriter = bufio.NewWriter(f)
+	s.currentStartedAt = timestamp
+	s.currentEndedAt = timestamp
+	s.muxer.Reset(s.currentWriter)
+
+	return nil
+}
+
+func (s *Segmenter) closeCurrent(duration time.Duration) error {
+	segment := s.current
+	s.current = nil
+
+	if err := s.currentWriter.Flush(); err != nil {
+		_ = s.currentFile.Close()
+		return err
+	}
+	if err := s.currentFile.Close(); err != nil {
+		return err
+	}
+
+	if duration < 0 {
+		duration = 0
+	}
+	segment.Duration = duration
+
+	s.segments = append(s.segments, segment)
+	if s.config.PlaylistType == PlaylistTypeLive {
+		for len(s.segments) > s.config.WindowSize {
+			removed := s.segments[0]
+			s.segments = s.segments[1:]
+			if removed.Discontinuity {
+				s.discontinuitySequence++
+			}
+			if s.config.DeleteSegments {
+				if err := os.Remove(filepath.Join(s.config.Dir, removed.Name)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+
+	if s.config.PlaylistType == PlaylistTypeVOD {
+		return nil
+	}
+	return s.writePlaylist(false)
+}
+
+// Close finalizes the current segment and the playlist.
+func (s *Segmenter) Close() error {
+	if s.current != nil {
+		if err := s.closeCurrent(time.Duration(s.currentEndedAt-s.currentStartedAt) * time.Millisecond); err != nil {
+			return err
+		}
+	}
+
+	return s.writePlaylist(true)
+}
+
+func (s *Segmenter) writePlaylist(ended bool) error {
+	return packaging.WriteFile(filepath.Join(s.config.Dir, s.config.PlaylistName), func(w io.Writer) error {
+		return s.encodePlaylist(w, ended)
+	})
+}
+
+func (s *Segmenter) encodePlaylist(w io.Writer, ended bool) error {
+	var mediaSequence uint64
+	if len(s.segments) > 0 {
+		mediaSequence = s.segments[0].SequenceNumber
+	}
+
+	if _, err := fmt.Fprintf(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:%d\n", s.targetSeconds, mediaSequence); err != nil {
+		return err
+	}
+	if s.discontinuitySequence > 0 {
+		if _, err := fmt.Fprintf(w, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", s.discontinuitySequence); err != nil {
+			return err
+		}
+	}
+	switch s.config.PlaylistType {
+	case PlaylistTypeEvent:
+		if _, err := io.WriteString(w, "#EXT-X-PLAYLIST-TYPE:EVENT\n"); err != nil {
+			return err
+		}
+	case PlaylistTypeVOD:
+		if _, err := io.WriteString(w, "#EXT-X-PLAYLIST-TYPE:VOD\n"); err != nil {
+			return err
+		}
+	}
+
+	for _, segment := range s.segments {
+		if segment.Discontinuity {
+			if _, err := io.WriteString(w, "#EXT-X-DISCONTINUITY\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "#EXT-X-PROGRAM-DATE-TIME:%s\n#EXTINF:%.3f,\n%s\n",
+			segment.ProgramDateTime.Format("2006-01-02T15:04:05.000Z07:00"),
+			segment.Duration.Seconds(),
+			segment.Name,
+		); err != nil {
+			return err
+		}
+	}
+
+	if ended {
+		if _, err := io.WriteString(w, "#EXT-X-ENDLIST\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Package reads all tags from the decoder and writes segments and a playlist.
+func Package(dec *flv.Decoder, config *SegmenterConfig) error {
+	s, err := NewSegmenter(config)
+	if err != nil {
+		return err
+	}
+
+	return packaging.Run(dec, s)
+}
+
+func isMediaFrame(flvTag *tag.FlvTag) bool {
+	switch data := flvTag.Data.(type) {
+	case *tag.AudioData:
+		return data.SoundFormat != tag.SoundFormatAAC || data.AACPacketType == tag.AACPacketTypeRaw
+	case *tag.VideoData:
+		return data.AVCPacketType == tag.AVCPacketTypeNALU
+	default:
+		return false
+	}
+}
+
+func isVideoKeyFrame(flvTag *tag.FlvTag) bool {
+	data, ok := flvTag.Data.(*tag.VideoData)
+	return ok && data.FrameType == tag.FrameTypeKeyFrame
+}
@@ -0,0 +1,312 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hls
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/mpegts"
+	"github.com/yutopp/go-flv/tag"
+)
+
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+var testNow = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func sequenceHeaderTags(t *testing.T) []*tag.FlvTag {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var recordBuf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+
+	return []*tag.FlvTag{
+		{
+			TagType: tag.TagTypeVideo,
+			Data: &tag.VideoData{
+				FrameType:     tag.FrameTypeKeyFrame,
+				CodecID:       tag.CodecIDAVC,
+				AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+				Data:          &recordBuf,
+			},
+		},
+		{
+			TagType: tag.TagTypeAudio,
+			Data: &tag.AudioData{
+				SoundFormat:   tag.SoundFormatAAC,
+				AACPacketType: tag.AACPacketTypeSequenceHeader,
+				Data:          bytes.NewReader([]byte{0x12, 0x10}),
+			},
+		},
+	}
+}
+
+// frameTags makes 25fps video with a keyframe every 2s, and audio every 40ms.
+func frameTags(from, to uint32) []*tag.FlvTag {
+	var tags []*tag.FlvTag
+	for ts := from; ts < to; ts += 40 {
+		frameType, naluType := tag.FrameTypeInterFrame, byte(0x41)
+		if (ts-from)%2000 == 0 {
+			frameType, naluType = tag.FrameTypeKeyFrame, 0x65
+		}
+		tags = append(tags, &tag.FlvTag{
+			TagType:   tag.TagTypeVideo,
+			Timestamp: ts,
+			Data: &tag.VideoData{
+				FrameType:     frameType,
+				CodecID:       tag.CodecIDAVC,
+				AVCPacketType: tag.AVCPacketTypeNALU,
+				Data:          bytes.NewReader(avc.AppendAVCC(nil, [][]byte{{naluType, 0x00, 0x01}})),
+			},
+		}, &tag.FlvTag{
+			TagType:   tag.TagTypeAudio,
+			Timestamp: ts,
+			Data: &tag.AudioData{
+				SoundFormat:   tag.SoundFormatAAC,
+				AACPacketType: tag.AACPacketTypeRaw,
+				Data:          bytes.NewReader([]byte{0x21, 0x00}),
+			},
+		})
+	}
+	return tags
+}
+
+func TestSegmenterVOD(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSegmenter(&SegmenterConfig{
+		Dir:            dir,
+		TargetDuration: 4 * time.Second,
+		PlaylistType:   PlaylistTypeVOD,
+		Now:            func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	tags := sequenceHeaderTags(t)
+	tags = append(tags, frameTags(0, 10000)...)
+	tags = append(tags, frameTags(0, 2000)...) // timestamps are reset
+	for _, flvTag := range tags {
+		err := s.WriteTag(flvTag)
+		require.Nil(t, err)
+	}
+	err = s.Close()
+	require.Nil(t, err)
+
+	playlist, err := os.ReadFile(filepath.Join(dir, "index.m3u8"))
+	require.Nil(t, err)
+	require.Equal(t, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-PROGRAM-DATE-TIME:2018-01-02T03:04:05.000Z
+#EXTINF:4.000,
+segment0.ts
+#EXT-X-PROGRAM-DATE-TIME:2018-01-02T03:04:09.000Z
+#EXTINF:4.000,
+segment1.ts
+#EXT-X-PROGRAM-DATE-TIME:2018-01-02T03:04:13.000Z
+#EXTINF:1.960,
+segment2.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2018-01-02T03:04:14.960Z
+#EXTINF:1.960,
+segment3.ts
+#EXT-X-ENDLIST
+`, string(playlist))
+
+	for _, segment := range s.Segments() {
+		b, err := os.ReadFile(filepath.Join(dir, segment.Name))
+		require.Nil(t, err)
+		require.NotEqual(t, 0, len(b))
+		require.Equal(t, 0, len(b)%188)
+	}
+}
+
+func TestSegmenterDiscontinuityOnInterFrame(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSegmenter(&SegmenterConfig{
+		Dir:            dir,
+		TargetDuration: 4 * time.Second,
+		PlaylistType:   PlaylistTypeVOD,
+		Now:            func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	tags := sequenceHeaderTags(t)
+	tags = append(tags, frameTags(0, 6000)...)
+	tags = append(tags, frameTags(0, 4000)[2:]...) // timestamps are reset at an inter frame
+	for _, flvTag := range tags {
+		err := s.WriteTag(flvTag)
+		require.Nil(t, err)
+	}
+	err = s.Close()
+	require.Nil(t, err)
+
+	segments := s.Segments()
+	require.Equal(t, 3, len(segments))
+	require.True(t, segments[2].Discontinuity)
+	require.Equal(t, 1960*time.Millisecond, segments[2].Duration) // frames until the keyframe are dropped
+
+	// the segment starts with the keyframe
+	f, err := os.Open(filepath.Join(dir, segments[2].Name))
+	require.Nil(t, err)
+	defer f.Close()
+
+	dec := mpegts.NewDemuxer(f)
+	for {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		require.Nil(t, err)
+
+		if videoData, ok := flvTag.Data.(*tag.VideoData); ok && videoData.AVCPacketType == tag.AVCPacketTypeNALU {
+			require.Equal(t, tag.FrameTypeKeyFrame, videoData.FrameType)
+			break
+		}
+	}
+}
+
+func TestSegmenterLiveWindow(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSegmenter(&SegmenterConfig{
+		Dir:            dir,
+		TargetDuration: 2 * time.Second,
+		WindowSize:     2,
+		DeleteSegments: true,
+		Now:            func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	tags := sequenceHeaderTags(t)
+	tags = append(tags, frameTags(0, 8000)...)
+	for _, flvTag := range tags {
+		err := s.WriteTag(flvTag)
+		require.Nil(t, err)
+	}
+
+	// the 4th segment is still being written
+	playlist, err := os.ReadFile(filepath.Join(dir, "index.m3u8"))
+	require.Nil(t, err)
+	require.Equal(t, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:1
+#EXT-X-PROGRAM-DATE-TIME:2018-01-02T03:04:07.000Z
+#EXTINF:2.000,
+segment1.ts
+#EXT-X-PROGRAM-DATE-TIME:2018-01-02T03:04:09.000Z
+#EXTINF:2.000,
+segment2.ts
+`, string(playlist))
+
+	_, err = os.Stat(filepath.Join(dir, "segment0.ts"))
+	require.True(t, os.IsNotExist(err))
+
+	err = s.Close()
+	require.Nil(t, err)
+}
+
+func TestSegmenterForcedCut(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSegmenter(&SegmenterConfig{
+		Dir:            dir,
+		TargetDuration: 1 * time.Second,
+		PlaylistType:   PlaylistTypeVOD,
+		Now:            func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	tags := sequenceHeaderTags(t)
+	tags = append(tags, frameTags(0, 3000)...) // a keyframe every 2s
+	for _, flvTag := range tags {
+		err := s.WriteTag(flvTag)
+		require.Nil(t, err)
+	}
+	err = s.Close()
+	require.Nil(t, err)
+
+	// segments do not exceed EXT-X-TARGETDURATION
+	var durations []time.Duration
+	for _, segment := range s.Segments() {
+		durations = append(durations, segment.Duration)
+	}
+	require.Equal(t, []time.Duration{1 * time.Second, 1 * time.Second, 960 * time.Millisecond}, durations)
+
+	playlist, err := os.ReadFile(filepath.Join(dir, "index.m3u8"))
+	require.Nil(t, err)
+	require.Contains(t, string(playlist), "#EXT-X-TARGETDURATION:1\n")
+}
+
+func TestSegmenterUnsupportedVideoCodec(t *testing.T) {
+	s, err := NewSegmenter(&SegmenterConfig{
+		Dir: t.TempDir(),
+	})
+	require.Nil(t, err)
+
+	for _, videoData := range []*tag.VideoData{
+		{
+			FrameType:     tag.FrameTypeKeyFrame,
+			CodecID:       tag.CodecIDHEVC,
+			AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+			Data:          bytes.NewReader(nil),
+		},
+		{
+			FrameType:       tag.FrameTypeKeyFrame,
+			ExHeader:        true,
+			VideoPacketType: tag.VideoPacketTypeCodedFrames,
+			FourCC:          tag.FourCCHEVC,
+			Data:            bytes.NewReader(nil),
+		},
+	} {
+		err := s.WriteTag(&tag.FlvTag{TagType: tag.TagTypeVideo, Data: videoData})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "unsupported video codec")
+	}
+	require.Equal(t, 0, len(s.Segments()))
+}
+
+func TestPackage(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := flv.NewEncoder(&buf, flv.FlagsAudio|flv.FlagsVideo)
+	require.Nil(t, err)
+
+	tags := sequenceHeaderTags(t)
+	tags = append(tags, frameTags(0, 4000)...)
+	for _, flvTag := range tags {
+		err := enc.Encode(flvTag)
+		require.Nil(t, err)
+	}
+
+	dec, err := flv.NewDecoder(&buf)
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	err = Package(dec, &SegmenterConfig{
+		Dir:            dir,
+		TargetDuration: 2 * time.Second,
+		PlaylistType:   PlaylistTypeEvent,
+		Now:            func() time.Time { return testNow },
+	})
+	require.Nil(t, err)
+
+	playlist, err := os.ReadFile(filepath.Join(dir, "index.m3u8"))
+	require.Nil(t, err)
+	require.Contains(t, string(playlist), "#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	require.Contains(t, string(playlist), "segment1.ts\n#EXT-X-ENDLIST\n")
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package httpflv serves live FLV streams over HTTP.
+package httpflv
+
+import (
+	"bufio"
+	"net/http"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/hub"
+)
+
+type SlowClientPolicy = hub.Policy
+
+const (
+	// SlowClientPolicyDisconnect disconnects clients whose queue is full.
+	SlowClientPolicyDisconnect = hub.PolicyDisconnect
+	// SlowClientPolicySkipFrames drops tags for clients whose queue is full until the next video keyframe.
+	SlowClientPolicySkipFrames = hub.PolicySkipFrames
+	// SlowClientPolicyDropOldest drops the oldest queued tags of clients whose queue is full. Sequence headers
+	// and metadata are kept.
+	SlowClientPolicyDropOldest = hub.PolicyDropOldest
+)
+
+const DefaultQueueSize = hub.DefaultQueueSize
+
+type HandlerConfig struct {
+	// Flags in FLV headers sent to clients. Default is both audio and video.
+	Flags flv.Flags
+	// QueueSize is a number of tags buffered per client. Default is DefaultQueueSize.
+	QueueSize int
+	// SlowClientPolicy is applied to clients whose queue is full. The publisher is never blocked.
+	SlowClientPolicy SlowClientPolicy
+}
+
+// Handler serves a live stream published to a hub. New clients receive the latest onMetaData,
+// sequence headers and the current GOP first, so that they can start from a keyframe.
+type Handler struct {
+	hub    *hub.Hub
+	config HandlerConfig
+}
+
+func NewHandler(h *hub.Hub, config *HandlerConfig) *Handler {
+	var c HandlerConfig
+	if config != nil {
+		c = *config
+	}
+	if c.Flags == 0 {
+		c.Flags = flv.FlagsAudio | flv.FlagsVideo
+	}
+
+	return &Handler{
+		hub:    h,
+		config: c,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.hub.Subscribe(&hub.SubscriberConfig{
+		QueueSize: h.config.QueueSize,
+		Policy:    h.config.SlowClientPolicy,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "video/x-flv")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(w)
+	enc, err := flv.NewEncoder(bw, h.config.Flags)
+	if err != nil {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		if sub.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		p, err := sub.Recv(r.Context())
+		if err != nil {
+			_ = bw.Flush()
+			return
+		}
+		if err := enc.Encode(p.Tag()); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package httpflv
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/hub"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func videoTag(timestamp uint32, frameType tag.FrameType, packetType tag.AVCPacketType) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:     frameType,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: packetType,
+			Data:          bytes.NewReader([]byte{0x01, 0x02}),
+		},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := hub.NewHub()
+	server := httptest.NewServer(NewHandler(h, nil))
+	defer server.Close()
+
+	published := []*tag.FlvTag{
+		{
+			TagType: tag.TagTypeScriptData,
+			Data: &tag.ScriptData{
+				Objects: map[string]amf0.ECMAArray{
+					"onMetaData": {"width": float64(1280)},
+				},
+			},
+		},
+		videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader),
+		videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+		videoTag(40, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+		videoTag(80, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+		videoTag(120, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+	}
+	for _, flvTag := range published {
+		require.Nil(t, h.Publish(flvTag))
+	}
+
+	resp, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "video/x-flv", resp.Header.Get("Content-Type"))
+
+	dec, err := flv.NewDecoder(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, flv.FlagsAudio|flv.FlagsVideo, dec.Header().Flags)
+
+	type entry struct {
+		TagType   tag.TagType
+		Timestamp uint32
+	}
+	read := func() entry {
+		var flvTag tag.FlvTag
+		require.Nil(t, dec.Decode(&flvTag))
+		defer flvTag.Close()
+		return entry{TagType: flvTag.TagType, Timestamp: flvTag.Timestamp}
+	}
+
+	// metadata, sequence header and the current GOP
+	require.Equal(t, entry{tag.TagTypeScriptData, 0}, read())
+	require.Equal(t, entry{tag.TagTypeVideo, 0}, read())
+	require.Equal(t, entry{tag.TagTypeVideo, 80}, read())
+	require.Equal(t, entry{tag.TagTypeVideo, 120}, read())
+
+	// live
+	require.Nil(t, h.Publish(videoTag(160, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU)))
+	require.Equal(t, entry{tag.TagTypeVideo, 160}, read())
+
+	h.Close()
+	var flvTag tag.FlvTag
+	require.Equal(t, io.EOF, dec.Decode(&flvTag))
+
+	resp2, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer resp2.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp2.StatusCode)
+}
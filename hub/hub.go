@@ -0,0 +1,301 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package hub fans out a live stream from a publisher to subscribers.
+package hub
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+var (
+	ErrClosed         = errors.New("hub is closed")
+	ErrSlowSubscriber = errors.New("subscriber is too slow")
+)
+
+// Policy is applied to subscribers whose queue is full. The publisher is never blocked.
+type Policy int
+
+const (
+	// PolicyDisconnect closes subscribers whose queue is full.
+	PolicyDisconnect Policy = iota
+	// PolicySkipFrames drops packets for subscribers whose queue is full until the next video keyframe.
+	PolicySkipFrames
+	// PolicyDropOldest drops the oldest queued media packet to make room. Sequence headers and metadata
+	// are kept. Video packets which depend on a dropped one are dropped until the next video keyframe.
+	// Subscribers whose queue has no media packets are closed.
+	PolicyDropOldest
+)
+
+const DefaultQueueSize = 256
+
+// MaxGOPCacheSize is a limit of packets in the GOP cache. The cache is dropped when a GOP exceeds it.
+const MaxGOPCacheSize = 4096
+
+type SubscriberConfig struct {
+	// QueueSize is a number of packets buffered for the subscriber. Default is DefaultQueueSize.
+	QueueSize int
+	Policy    Policy
+}
+
+// Hub caches the latest onMetaData, sequence headers and the current GOP, so that new subscribers
+// can start from a keyframe.
+type Hub struct {
+	m           sync.Mutex
+	closed      bool
+	metadata    *Packet
+	videoHeader *Packet
+	audioHeader *Packet
+	hasVideo    bool
+	gop         []*Packet
+	subscribers map[*Subscriber]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Publish buffers the payload of flvTag and sends it to all subscribers.
+func (h *Hub) Publish(flvTag *tag.FlvTag) error {
+	p, err := NewPacket(flvTag)
+	if err != nil {
+		return err
+	}
+	return h.PublishPacket(p)
+}
+
+func (h *Hub) PublishPacket(p *Packet) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.closed {
+		return ErrClosed
+	}
+
+	switch {
+	case p.IsMetadata():
+		h.metadata = p
+	case p.IsSequenceHeader():
+		if p.IsVideo() {
+			h.videoHeader = p
+			h.hasVideo = true
+		} else {
+			h.audioHeader = p
+		}
+	case p.IsKeyframe():
+		h.hasVideo = true
+		h.gop = append(h.gop[:0:0], p)
+	case len(h.gop) > 0:
+		if len(h.gop) >= MaxGOPCacheSize {
+			h.gop = nil
+		} else {
+			h.gop = append(h.gop, p)
+		}
+	}
+
+	for s := range h.subscribers {
+		h.send(s, p)
+	}
+
+	return nil
+}
+
+func (h *Hub) send(s *Subscriber, p *Packet) {
+	// sequence headers and metadata are always delivered. audio-only streams have no keyframes to resume from.
+	isMedia := !p.IsSequenceHeader() && !p.IsMetadata()
+	resumable := !isMedia || !h.hasVideo || p.IsKeyframe()
+	if s.waitKeyframe && !resumable {
+		return
+	}
+
+	for {
+		select {
+		case s.ch <- p:
+			if isMedia {
+				s.waitKeyframe = false
+			}
+			return
+		default:
+		}
+
+		switch s.policy {
+		case PolicySkipFrames:
+			s.waitKeyframe = true
+			return
+		case PolicyDropOldest:
+			if !h.dropOldest(s) {
+				h.remove(s, ErrSlowSubscriber)
+				return
+			}
+			if s.waitKeyframe && !resumable {
+				return
+			}
+			// retry
+		default:
+			h.remove(s, ErrSlowSubscriber)
+			return
+		}
+	}
+}
+
+// dropOldest drops the oldest media packet queued for s, and following video packets until a keyframe.
+// It returns false if there are no media packets.
+func (h *Hub) dropOldest(s *Subscriber) bool {
+	var queued []*Packet
+	for drained := false; !drained; {
+		select {
+		case p := <-s.ch:
+			queued = append(queued, p)
+		default:
+			drained = true
+		}
+	}
+
+	dropped, dropVideo := false, false
+	for _, p := range queued {
+		isMedia := !p.IsSequenceHeader() && !p.IsMetadata()
+		switch {
+		case !isMedia:
+		case dropVideo && p.IsVideo() && !p.IsKeyframe():
+			continue
+		case dropVideo && p.IsVideo():
+			dropVideo = false
+		case !dropped:
+			dropped = true
+			dropVideo = p.IsVideo()
+			continue
+		}
+		// only the hub sends to the queue, thus there is room
+		s.ch <- p
+	}
+	if dropVideo {
+		s.waitKeyframe = true
+	}
+
+	return dropped
+}
+
+// Subscribe registers a subscriber. It receives cached packets first.
+func (h *Hub) Subscribe(config *SubscriberConfig) (*Subscriber, error) {
+	var c SubscriberConfig
+	if config != nil {
+		c = *config
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	var cached []*Packet
+	for _, p := range []*Packet{h.metadata, h.videoHeader, h.audioHeader} {
+		if p != nil {
+			cached = append(cached, p)
+		}
+	}
+	cached = append(cached, h.gop...)
+
+	s := &Subscriber{
+		hub:    h,
+		policy: c.Policy,
+		ch:     make(chan *Packet, c.QueueSize),
+		cached: cached,
+		// no keyframe is cached before the first one or after the cache overflowed
+		waitKeyframe: h.hasVideo && len(h.gop) == 0,
+	}
+	h.subscribers[s] = struct{}{}
+
+	return s, nil
+}
+
+func (h *Hub) remove(s *Subscriber, err error) {
+	if _, ok := h.subscribers[s]; !ok {
+		return
+	}
+	delete(h.subscribers, s)
+	s.err = err
+	close(s.ch)
+}
+
+// Close ends the stream. Subscribers receive io.EOF after queued packets.
+func (h *Hub) Close() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.closed = true
+	for s := range h.subscribers {
+		h.remove(s, io.EOF)
+	}
+	h.metadata, h.videoHeader, h.audioHeader, h.gop = nil, nil, nil, nil
+}
+
+// Subscriber receives packets from a hub. Recv must not be called concurrently.
+type Subscriber struct {
+	hub    *Hub
+	policy Policy
+
+	ch     chan *Packet // closed when the subscriber is removed
+	err    error        // set before ch is closed
+	cached []*Packet
+
+	waitKeyframe bool // guarded by hub.m
+}
+
+// Recv returns the next packet. It returns io.EOF when the hub is closed, or ErrSlowSubscriber
+// when the subscriber is disconnected by PolicyDisconnect.
+func (s *Subscriber) Recv(ctx context.Context) (*Packet, error) {
+	if len(s.cached) > 0 {
+		p := s.cached[0]
+		s.cached = s.cached[1:]
+		return p, nil
+	}
+
+	// Prefer packets which are already queued over the context
+	select {
+	case p, ok := <-s.ch:
+		if !ok {
+			return nil, s.err
+		}
+		return p, nil
+	default:
+	}
+
+	select {
+	case p, ok := <-s.ch:
+		if !ok {
+			return nil, s.err
+		}
+		return p, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Buffered returns a number of packets which can be received without blocking.
+func (s *Subscriber) Buffered() int {
+	return len(s.cached) + len(s.ch)
+}
+
+// Close unregisters the subscriber.
+func (s *Subscriber) Close() {
+	s.hub.m.Lock()
+	defer s.hub.m.Unlock()
+
+	s.hub.remove(s, ErrClosed)
+}
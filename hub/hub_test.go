@@ -0,0 +1,226 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hub
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// receiveAll returns timestamps of packets which can be received without blocking.
+func receiveAll(t *testing.T, s *Subscriber) ([]uint32, error) {
+	var timestamps []uint32
+	for s.Buffered() > 0 {
+		p, err := s.Recv(context.Background())
+		require.Nil(t, err)
+		timestamps = append(timestamps, p.Timestamp())
+	}
+
+	// check whether the subscriber is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Recv(ctx)
+	if err == context.Canceled {
+		err = nil
+	}
+	return timestamps, err
+}
+
+func TestHubGOPCache(t *testing.T) {
+	h := NewHub()
+
+	for _, flvTag := range []*tag.FlvTag{
+		videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader),
+		audioTag(1, tag.AACPacketTypeSequenceHeader),
+		videoTag(10, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+		videoTag(20, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+		videoTag(30, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+		audioTag(31, tag.AACPacketTypeRaw),
+	} {
+		require.Nil(t, h.Publish(flvTag))
+	}
+
+	s, err := h.Subscribe(nil)
+	require.Nil(t, err)
+
+	timestamps, err := receiveAll(t, s)
+	require.Nil(t, err)
+	require.Equal(t, []uint32{0, 1, 30, 31}, timestamps)
+
+	require.Nil(t, h.Publish(videoTag(40, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU)))
+	timestamps, err = receiveAll(t, s)
+	require.Nil(t, err)
+	require.Equal(t, []uint32{40}, timestamps)
+
+	h.Close()
+	_, err = receiveAll(t, s)
+	require.Equal(t, io.EOF, err)
+
+	_, err = h.Subscribe(nil)
+	require.Equal(t, ErrClosed, err)
+	require.Equal(t, ErrClosed, h.Publish(videoTag(50, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU)))
+}
+
+func TestHubGOPCacheOverflow(t *testing.T) {
+	h := NewHub()
+
+	require.Nil(t, h.Publish(videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader)))
+	require.Nil(t, h.Publish(videoTag(1, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU)))
+	for i := 0; i < MaxGOPCacheSize; i++ {
+		require.Nil(t, h.Publish(videoTag(uint32(2+i), tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU)))
+	}
+
+	s, err := h.Subscribe(nil)
+	require.Nil(t, err)
+
+	// inter frames are not delivered until the next keyframe
+	require.Nil(t, h.Publish(videoTag(10000, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU)))
+	require.Nil(t, h.Publish(videoTag(10010, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU)))
+	require.Nil(t, h.Publish(videoTag(10020, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU)))
+
+	timestamps, err := receiveAll(t, s)
+	require.Nil(t, err)
+	require.Equal(t, []uint32{0, 10010, 10020}, timestamps)
+}
+
+func TestHubSubscribeBeforeKeyframe(t *testing.T) {
+	h := NewHub()
+
+	require.Nil(t, h.Publish(videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader)))
+
+	s, err := h.Subscribe(nil)
+	require.Nil(t, err)
+
+	require.Nil(t, h.Publish(videoTag(10, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU)))
+	require.Nil(t, h.Publish(videoTag(20, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU)))
+
+	timestamps, err := receiveAll(t, s)
+	require.Nil(t, err)
+	require.Equal(t, []uint32{0, 20}, timestamps)
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	publish := func(h *Hub, timestamp uint32, frameType tag.FrameType) {
+		require.Nil(t, h.Publish(videoTag(timestamp, frameType, tag.AVCPacketTypeNALU)))
+	}
+
+	t.Run("Disconnect", func(t *testing.T) {
+		h := NewHub()
+		s, err := h.Subscribe(&SubscriberConfig{QueueSize: 1, Policy: PolicyDisconnect})
+		require.Nil(t, err)
+
+		publish(h, 0, tag.FrameTypeKeyFrame)
+		publish(h, 10, tag.FrameTypeInterFrame) // full
+
+		timestamps, err := receiveAll(t, s)
+		require.Equal(t, ErrSlowSubscriber, err)
+		require.Equal(t, []uint32{0}, timestamps)
+	})
+
+	t.Run("SkipFrames", func(t *testing.T) {
+		h := NewHub()
+		s, err := h.Subscribe(&SubscriberConfig{QueueSize: 1, Policy: PolicySkipFrames})
+		require.Nil(t, err)
+
+		publish(h, 0, tag.FrameTypeKeyFrame)
+		publish(h, 10, tag.FrameTypeInterFrame) // full, then skipped
+
+		timestamps, err := receiveAll(t, s)
+		require.Nil(t, err)
+		require.Equal(t, []uint32{0}, timestamps)
+
+		publish(h, 20, tag.FrameTypeInterFrame) // waits for a keyframe
+		publish(h, 30, tag.FrameTypeKeyFrame)
+
+		timestamps, err = receiveAll(t, s)
+		require.Nil(t, err)
+		require.Equal(t, []uint32{30}, timestamps)
+	})
+
+	t.Run("DropOldest", func(t *testing.T) {
+		h := NewHub()
+		s, err := h.Subscribe(&SubscriberConfig{QueueSize: 3, Policy: PolicyDropOldest})
+		require.Nil(t, err)
+
+		require.Nil(t, h.Publish(videoTag(1, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader)))
+		publish(h, 10, tag.FrameTypeKeyFrame)
+		publish(h, 20, tag.FrameTypeInterFrame)
+		publish(h, 30, tag.FrameTypeKeyFrame) // full, then the GOP is dropped but the sequence header
+		publish(h, 40, tag.FrameTypeInterFrame)
+
+		timestamps, err := receiveAll(t, s)
+		require.Nil(t, err)
+		require.Equal(t, []uint32{1, 30, 40}, timestamps)
+	})
+
+	t.Run("DropOldestWaitsForKeyframe", func(t *testing.T) {
+		h := NewHub()
+		s, err := h.Subscribe(&SubscriberConfig{QueueSize: 2, Policy: PolicyDropOldest})
+		require.Nil(t, err)
+
+		publish(h, 0, tag.FrameTypeKeyFrame)
+		publish(h, 10, tag.FrameTypeInterFrame)
+		publish(h, 20, tag.FrameTypeInterFrame) // full, then skipped since its keyframe is dropped
+
+		timestamps, err := receiveAll(t, s)
+		require.Nil(t, err)
+		require.Equal(t, []uint32(nil), timestamps)
+
+		publish(h, 30, tag.FrameTypeInterFrame)
+		publish(h, 40, tag.FrameTypeKeyFrame)
+
+		timestamps, err = receiveAll(t, s)
+		require.Nil(t, err)
+		require.Equal(t, []uint32{40}, timestamps)
+	})
+
+	t.Run("DropOldestAudio", func(t *testing.T) {
+		h := NewHub()
+		s, err := h.Subscribe(&SubscriberConfig{QueueSize: 2, Policy: PolicyDropOldest})
+		require.Nil(t, err)
+
+		require.Nil(t, h.Publish(audioTag(0, tag.AACPacketTypeSequenceHeader)))
+		require.Nil(t, h.Publish(audioTag(10, tag.AACPacketTypeRaw)))
+		require.Nil(t, h.Publish(audioTag(20, tag.AACPacketTypeRaw))) // full
+
+		timestamps, err := receiveAll(t, s)
+		require.Nil(t, err)
+		require.Equal(t, []uint32{0, 20}, timestamps)
+	})
+
+	t.Run("DropOldestWithoutMedia", func(t *testing.T) {
+		h := NewHub()
+		s, err := h.Subscribe(&SubscriberConfig{QueueSize: 1, Policy: PolicyDropOldest})
+		require.Nil(t, err)
+
+		require.Nil(t, h.Publish(audioTag(0, tag.AACPacketTypeSequenceHeader)))
+		require.Nil(t, h.Publish(audioTag(10, tag.AACPacketTypeRaw))) // full
+
+		timestamps, err := receiveAll(t, s)
+		require.Equal(t, ErrSlowSubscriber, err)
+		require.Equal(t, []uint32{0}, timestamps)
+	})
+}
+
+func TestSubscriberClose(t *testing.T) {
+	h := NewHub()
+	s, err := h.Subscribe(nil)
+	require.Nil(t, err)
+
+	s.Close()
+	_, err = s.Recv(context.Background())
+	require.Equal(t, ErrClosed, err)
+
+	// the hub is still alive
+	require.Nil(t, h.Publish(videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU)))
+}
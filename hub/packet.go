@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hub
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+// Packet is a tag whose payload is buffered. Packets are shared by subscribers and must not be modified.
+type Packet struct {
+	header  tag.FlvTag // Data is *tag.AudioData or *tag.VideoData without the payload reader, or *tag.ScriptData
+	payload []byte
+}
+
+// NewPacket reads the payload of flvTag and makes a packet.
+func NewPacket(flvTag *tag.FlvTag) (*Packet, error) {
+	p := &Packet{
+		header: *flvTag,
+	}
+
+	switch data := flvTag.Data.(type) {
+	case *tag.AudioData:
+		payload, err := io.ReadAll(data.Data)
+		if err != nil {
+			return nil, err
+		}
+		audioData := *data
+		audioData.Data = nil
+		p.header.Data = &audioData
+		p.payload = payload
+
+	case *tag.VideoData:
+		payload, err := io.ReadAll(data.Data)
+		if err != nil {
+			return nil, err
+		}
+		videoData := *data
+		videoData.Data = nil
+		p.header.Data = &videoData
+		p.payload = payload
+
+	case *tag.ScriptData, *tag.UnknownData:
+		// shared as is
+
+	default:
+		return nil, fmt.Errorf("unexpected data is set: %T", flvTag.Data)
+	}
+
+	return p, nil
+}
+
+// Tag returns a new tag. Its payload is a tag.Buffer over the shared buffer.
+func (p *Packet) Tag() *tag.FlvTag {
+	flvTag := p.header
+	switch data := p.header.Data.(type) {
+	case *tag.AudioData:
+		audioData := *data
+		audioData.Data = tag.NewBuffer(p.payload)
+		flvTag.Data = &audioData
+	case *tag.VideoData:
+		videoData := *data
+		videoData.Data = tag.NewBuffer(p.payload)
+		flvTag.Data = &videoData
+	}
+	return &flvTag
+}
+
+// Payload returns the buffered payload. It must not be modified.
+func (p *Packet) Payload() []byte {
+	return p.payload
+}
+
+func (p *Packet) Timestamp() uint32 {
+	return p.header.Timestamp
+}
+
+func (p *Packet) IsVideo() bool {
+	_, ok := p.header.Data.(*tag.VideoData)
+	return ok
+}
+
+// IsKeyframe reports whether the packet is a video keyframe (excluding sequence headers).
+func (p *Packet) IsKeyframe() bool {
+	videoData, ok := p.header.Data.(*tag.VideoData)
+	return ok && videoData.FrameType == tag.FrameTypeKeyFrame && !p.IsSequenceHeader()
+}
+
+// IsSequenceHeader reports whether the packet is an AVC/HEVC or AAC sequence header, or an Enhanced
+// RTMP sequence start.
+func (p *Packet) IsSequenceHeader() bool {
+	switch data := p.header.Data.(type) {
+	case *tag.VideoData:
+		return data.IsSequenceHeader()
+	case *tag.AudioData:
+		return data.IsSequenceHeader()
+	default:
+		return false
+	}
+}
+
+// IsMetadata reports whether the packet is onMetaData.
+func (p *Packet) IsMetadata() bool {
+	scriptData, ok := p.header.Data.(*tag.ScriptData)
+	if !ok {
+		return false
+	}
+	_, ok = scriptData.Objects["onMetaData"]
+	return ok
+}
@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package hub
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func videoTag(timestamp uint32, frameType tag.FrameType, packetType tag.AVCPacketType) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:     frameType,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: packetType,
+			Data:          bytes.NewReader([]byte{byte(timestamp)}),
+		},
+	}
+}
+
+func audioTag(timestamp uint32, packetType tag.AACPacketType) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeAudio,
+		Timestamp: timestamp,
+		Data: &tag.AudioData{
+			SoundFormat:   tag.SoundFormatAAC,
+			AACPacketType: packetType,
+			Data:          bytes.NewReader([]byte{byte(timestamp)}),
+		},
+	}
+}
+
+func TestPacketTag(t *testing.T) {
+	p, err := NewPacket(videoTag(40, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU))
+	require.Nil(t, err)
+	require.Equal(t, []byte{40}, p.Payload())
+
+	// each tag has an independent reader
+	for i := 0; i < 2; i++ {
+		flvTag := p.Tag()
+		require.Equal(t, uint32(40), flvTag.Timestamp)
+
+		videoData := flvTag.Data.(*tag.VideoData)
+		require.Equal(t, tag.FrameTypeKeyFrame, videoData.FrameType)
+		payload, err := io.ReadAll(videoData.Data)
+		require.Nil(t, err)
+		require.Equal(t, []byte{40}, payload)
+	}
+}
+
+func TestPacketKinds(t *testing.T) {
+	type testCase struct {
+		Name             string
+		Tag              *tag.FlvTag
+		IsVideo          bool
+		IsKeyframe       bool
+		IsSequenceHeader bool
+		IsMetadata       bool
+	}
+
+	testCases := []testCase{
+		{
+			Name:             "VideoSequenceHeader",
+			Tag:              videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader),
+			IsVideo:          true,
+			IsSequenceHeader: true,
+		},
+		{
+			Name:       "Keyframe",
+			Tag:        videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+			IsVideo:    true,
+			IsKeyframe: true,
+		},
+		{
+			Name:    "InterFrame",
+			Tag:     videoTag(0, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+			IsVideo: true,
+		},
+		{
+			Name:             "AudioSequenceHeader",
+			Tag:              audioTag(0, tag.AACPacketTypeSequenceHeader),
+			IsSequenceHeader: true,
+		},
+		{
+			Name: "Audio",
+			Tag:  audioTag(0, tag.AACPacketTypeRaw),
+		},
+		{
+			Name: "Metadata",
+			Tag: &tag.FlvTag{
+				TagType: tag.TagTypeScriptData,
+				Data: &tag.ScriptData{
+					Objects: map[string]amf0.ECMAArray{"onMetaData": {}},
+				},
+			},
+			IsMetadata: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewPacket(tc.Tag)
+			require.Nil(t, err)
+			require.Equal(t, tc.IsVideo, p.IsVideo())
+			require.Equal(t, tc.IsKeyframe, p.IsKeyframe())
+			require.Equal(t, tc.IsSequenceHeader, p.IsSequenceHeader())
+			require.Equal(t, tc.IsMetadata, p.IsMetadata())
+		})
+	}
+}
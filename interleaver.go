@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+const DefaultInterleaveWindow = 500 * time.Millisecond
+
+type InterleaverConfig struct {
+	// Window is a limit of buffered duration. When the newest tag is ahead of a buffered tag by
+	// the window, the buffered tag is emitted without waiting for other tracks.
+	Window time.Duration
+	// SilenceTimeout makes tracks which have not written tags for the duration (wall clock) not
+	// waited until they write again. Zero disables it.
+	SilenceTimeout time.Duration
+}
+
+// Interleaver accepts tags of audio and video tracks, possibly from separate goroutines, and
+// encodes them in DTS order. Each track must write tags in DTS order. Tracks flagged in the
+// header of the encoder are waited from the beginning, others after they write tags. Script data
+// are emitted in order but never waited for.
+type Interleaver struct {
+	m      sync.Mutex
+	enc    *Encoder
+	config InterleaverConfig
+	now    func() time.Time
+
+	tracks    []*interleaveTrack // in order of appearance, which breaks ties
+	newest    uint32
+	hasNewest bool
+}
+
+type interleaveTrack struct {
+	tagType   tag.TagType
+	tags      []*tag.FlvTag
+	lastWrite time.Time
+	closed    bool
+}
+
+func NewInterleaver(enc *Encoder, config *InterleaverConfig) *Interleaver {
+	var c InterleaverConfig
+	if config != nil {
+		c = *config
+	}
+	if c.Window == 0 {
+		c.Window = DefaultInterleaveWindow
+	}
+
+	i := &Interleaver{
+		enc:    enc,
+		config: c,
+		now:    time.Now,
+	}
+
+	flags := enc.Header().Flags
+	if flags&FlagsVideo != 0 {
+		i.track(tag.TagTypeVideo).lastWrite = i.now()
+	}
+	if flags&FlagsAudio != 0 {
+		i.track(tag.TagTypeAudio).lastWrite = i.now()
+	}
+
+	return i
+}
+
+// WriteTag buffers a tag of the track decided by its type, and encodes tags which become ready.
+// Payloads are materialized, and owned Buffers are released after encoding.
+func (i *Interleaver) WriteTag(flvTag *tag.FlvTag) error {
+	t := *flvTag
+	if err := t.Materialize(); err != nil {
+		return err
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	tr := i.track(t.TagType)
+	tr.tags = append(tr.tags, &t)
+	tr.lastWrite = i.now()
+	tr.closed = false
+
+	if !i.hasNewest || before(i.newest, t.Timestamp) {
+		i.newest = t.Timestamp
+		i.hasNewest = true
+	}
+
+	return i.emit(false)
+}
+
+// CloseTrack marks the end of the track. It is not waited until it writes tags again.
+func (i *Interleaver) CloseTrack(tagType tag.TagType) error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.track(tagType).closed = true
+
+	return i.emit(false)
+}
+
+// Flush encodes all buffered tags in DTS order.
+func (i *Interleaver) Flush() error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	return i.emit(true)
+}
+
+func (i *Interleaver) track(tagType tag.TagType) *interleaveTrack {
+	for _, tr := range i.tracks {
+		if tr.tagType == tagType {
+			return tr
+		}
+	}
+
+	tr := &interleaveTrack{
+		tagType: tagType,
+	}
+	i.tracks = append(i.tracks, tr)
+
+	return tr
+}
+
+func (i *Interleaver) emit(all bool) error {
+	for {
+		var next *interleaveTrack
+		for _, tr := range i.tracks {
+			if len(tr.tags) == 0 {
+				continue
+			}
+			if next == nil || before(tr.tags[0].Timestamp, next.tags[0].Timestamp) {
+				next = tr
+			}
+		}
+		if next == nil {
+			return nil
+		}
+
+		head := next.tags[0]
+		if !all && !i.ready(head) {
+			return nil
+		}
+
+		next.tags[0] = nil
+		next.tags = next.tags[1:]
+
+		err := i.enc.Encode(head)
+		head.Release()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ready reports whether the head, which has the smallest timestamp, can be emitted.
+func (i *Interleaver) ready(head *tag.FlvTag) bool {
+	if time.Duration(i.newest-head.Timestamp)*time.Millisecond >= i.config.Window {
+		return true
+	}
+
+	now := i.now()
+	for _, tr := range i.tracks {
+		if tr.tagType != tag.TagTypeAudio && tr.tagType != tag.TagTypeVideo {
+			continue
+		}
+		if tr.closed {
+			continue
+		}
+		if i.config.SilenceTimeout > 0 && now.Sub(tr.lastWrite) >= i.config.SilenceTimeout {
+			continue
+		}
+		if len(tr.tags) == 0 {
+			return false // a tag earlier than the head may come
+		}
+	}
+
+	return true
+}
+
+// before reports whether timestamp a is before b, allowing wrap around.
+func before(a, b uint32) bool {
+	return int32(a-b) < 0
+}
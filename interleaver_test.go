@@ -0,0 +1,235 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/tag"
+)
+
+func newInterleaveTag(tagType tag.TagType, timestamp uint32) *tag.FlvTag {
+	flvTag := &tag.FlvTag{
+		TagType:   tagType,
+		Timestamp: timestamp,
+	}
+	payload := bytes.NewReader([]byte{byte(timestamp)})
+	switch tagType {
+	case tag.TagTypeAudio:
+		flvTag.Data = &tag.AudioData{
+			SoundFormat: tag.SoundFormatMP3,
+			Data:        payload,
+		}
+	case tag.TagTypeVideo:
+		flvTag.Data = &tag.VideoData{
+			FrameType: tag.FrameTypeKeyFrame,
+			CodecID:   tag.CodecIDOn2VP6,
+			Data:      payload,
+		}
+	}
+	return flvTag
+}
+
+// decodeOrder returns tags in buf as "a0", "v40", ...
+func decodeOrder(t *testing.T, buf *bytes.Buffer) []string {
+	dec, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+
+	var order []string
+	for {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		if errors.Is(err, io.EOF) {
+			return order
+		}
+		require.Nil(t, err)
+
+		name := "a"
+		if flvTag.TagType == tag.TagTypeVideo {
+			name = "v"
+		}
+		order = append(order, fmt.Sprintf("%s%d", name, flvTag.Timestamp))
+		flvTag.Close()
+	}
+}
+
+func TestInterleaver(t *testing.T) {
+	type write struct {
+		TagType   tag.TagType
+		Timestamp uint32
+	}
+
+	type testCase struct {
+		Name     string
+		Flags    Flags
+		Writes   []write
+		Expected []string // before Flush
+	}
+
+	const (
+		a = tag.TagTypeAudio
+		v = tag.TagTypeVideo
+	)
+
+	testCases := []testCase{
+		{
+			Name:     "Interleave",
+			Flags:    FlagsAudio | FlagsVideo,
+			Writes:   []write{{v, 0}, {v, 40}, {a, 0}, {a, 20}, {a, 40}, {a, 60}},
+			Expected: []string{"v0", "a0", "a20", "v40"}, // a40 waits for video
+		},
+		{
+			Name:     "WaitFlaggedTrack",
+			Flags:    FlagsAudio | FlagsVideo,
+			Writes:   []write{{v, 0}, {v, 40}},
+			Expected: nil,
+		},
+		{
+			Name:     "NotFlaggedTrack",
+			Flags:    FlagsVideo,
+			Writes:   []write{{v, 0}, {v, 40}},
+			Expected: []string{"v0", "v40"},
+		},
+		{
+			Name:     "Window",
+			Flags:    FlagsAudio | FlagsVideo,
+			Writes:   []write{{v, 0}, {v, 400}, {v, 500}, {v, 600}},
+			Expected: []string{"v0"}, // v600 is ahead of v0 by the window
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			enc, err := NewEncoder(&buf, tc.Flags)
+			require.Nil(t, err)
+			headerSize := buf.Len()
+
+			i := NewInterleaver(enc, nil)
+			for _, w := range tc.Writes {
+				err := i.WriteTag(newInterleaveTag(w.TagType, w.Timestamp))
+				require.Nil(t, err)
+			}
+			if len(tc.Expected) == 0 {
+				require.Equal(t, headerSize, buf.Len())
+			} else {
+				require.Equal(t, tc.Expected, decodeOrder(t, &buf))
+			}
+
+			err = i.Flush()
+			require.Nil(t, err)
+			require.Equal(t, len(tc.Writes), len(decodeOrder(t, &buf)))
+		})
+	}
+}
+
+func TestInterleaverSilence(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsAudio|FlagsVideo)
+	require.Nil(t, err)
+
+	now := time.Unix(0, 0)
+	i := NewInterleaver(enc, &InterleaverConfig{
+		SilenceTimeout: time.Second,
+	})
+	i.now = func() time.Time { return now }
+
+	err = i.WriteTag(newInterleaveTag(tag.TagTypeAudio, 0))
+	require.Nil(t, err)
+	err = i.WriteTag(newInterleaveTag(tag.TagTypeVideo, 0))
+	require.Nil(t, err)
+	require.Equal(t, []string{"v0"}, decodeOrder(t, &buf)) // ties are broken by the order of flags
+
+	// audio goes silent
+	now = now.Add(time.Second)
+	err = i.WriteTag(newInterleaveTag(tag.TagTypeVideo, 40))
+	require.Nil(t, err)
+	require.Equal(t, []string{"v0", "a0", "v40"}, decodeOrder(t, &buf))
+
+	// audio comes back, and is waited again
+	err = i.WriteTag(newInterleaveTag(tag.TagTypeAudio, 60))
+	require.Nil(t, err)
+	err = i.WriteTag(newInterleaveTag(tag.TagTypeVideo, 80))
+	require.Nil(t, err)
+	require.Equal(t, []string{"v0", "a0", "v40", "a60"}, decodeOrder(t, &buf))
+}
+
+func TestInterleaverCloseTrack(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsAudio|FlagsVideo)
+	require.Nil(t, err)
+
+	i := NewInterleaver(enc, nil)
+	err = i.WriteTag(newInterleaveTag(tag.TagTypeVideo, 0))
+	require.Nil(t, err)
+	require.Equal(t, 0, len(decodeOrder(t, &buf)))
+
+	err = i.CloseTrack(tag.TagTypeAudio)
+	require.Nil(t, err)
+	require.Equal(t, []string{"v0"}, decodeOrder(t, &buf))
+}
+
+func TestInterleaverConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, FlagsAudio|FlagsVideo)
+	require.Nil(t, err)
+
+	i := NewInterleaver(enc, &InterleaverConfig{
+		Window: time.Hour, // goroutines may be scheduled unfairly
+	})
+
+	var wg sync.WaitGroup
+	for _, tagType := range []tag.TagType{tag.TagTypeAudio, tag.TagTypeVideo} {
+		tagType := tagType
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ts := uint32(0); ts < 2000; ts += 20 {
+				if err := i.WriteTag(newInterleaveTag(tagType, ts)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	err = i.Flush()
+	require.Nil(t, err)
+
+	dec, err := NewDecoder(&buf)
+	require.Nil(t, err)
+
+	var count int
+	var last uint32
+	for {
+		var flvTag tag.FlvTag
+		err := dec.Decode(&flvTag)
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		require.True(t, last <= flvTag.Timestamp)
+		last = flvTag.Timestamp
+		count++
+		flvTag.Close()
+	}
+	require.Equal(t, 200, count)
+}
@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package bitreader reads bit fields of codec headers, e.g. SPS of H.264 and H.265.
+package bitreader
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reader reads bits in MSB first order. Errors are kept, and reads after an error return 0.
+type Reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func New(b []byte) *Reader {
+	return &Reader{b: b}
+}
+
+// Err returns io.ErrUnexpectedEOF if bits beyond the end are read, or an error of an invalid code.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+func (r *Reader) ReadBit() uint32 {
+	if r.pos/8 >= len(r.b) {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	bit := (r.b[r.pos/8] >> (7 - uint(r.pos%8))) & 0x01
+	r.pos++
+	return uint32(bit)
+}
+
+// ReadBits reads n (<= 32) bits.
+func (r *Reader) ReadBits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | r.ReadBit()
+	}
+	return v
+}
+
+// ReadUE reads an unsigned Exp-Golomb code.
+func (r *Reader) ReadUE() uint32 {
+	leadingZeros := 0
+	for r.ReadBit() == 0 {
+		if r.err != nil {
+			return 0
+		}
+		if leadingZeros >= 32 {
+			r.err = fmt.Errorf("invalid Exp-Golomb code")
+			return 0
+		}
+		leadingZeros++
+	}
+	return (1<<uint(leadingZeros) - 1) + r.ReadBits(leadingZeros)
+}
+
+// ReadSE reads a signed Exp-Golomb code.
+func (r *Reader) ReadSE() int32 {
+	v := r.ReadUE()
+	if v%2 == 0 {
+		return -int32(v / 2)
+	}
+	return int32((v + 1) / 2)
+}
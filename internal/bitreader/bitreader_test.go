@@ -0,0 +1,35 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package bitreader
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	// 101 | 1 | 010 | 011 | 00100 | 0
+	r := New([]byte{0xb4, 0xc8})
+	require.Equal(t, uint32(0x05), r.ReadBits(3))
+	require.Equal(t, uint32(0), r.ReadUE())
+	require.Equal(t, uint32(1), r.ReadUE())
+	require.Equal(t, int32(-1), r.ReadSE())
+	require.Equal(t, int32(2), r.ReadSE())
+	require.Nil(t, r.Err())
+
+	require.Equal(t, uint32(0), r.ReadBits(2))
+	require.Equal(t, io.ErrUnexpectedEOF, r.Err())
+}
+
+func TestReaderInvalidExpGolomb(t *testing.T) {
+	r := New(make([]byte, 8))
+	r.ReadUE()
+	require.EqualError(t, r.Err(), "invalid Exp-Golomb code")
+}
@@ -0,0 +1,89 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package packaging has helpers shared by packagers and exporters, e.g. the loop which writes all
+// decoded tags, and writing manifests to files.
+package packaging
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// WriteFile writes a file through a temporary file which is renamed at the end, so that clients
+// never read partially written manifests.
+func WriteFile(path string, f func(w io.Writer) error) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := f(w); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+type TagWriter interface {
+	WriteTag(flvTag *tag.FlvTag) error
+}
+
+type TagWriteCloser interface {
+	TagWriter
+	Close() error
+}
+
+// NopCloser returns a TagWriteCloser with a no-op Close method wrapping w.
+func NopCloser(w TagWriter) TagWriteCloser {
+	return nopCloser{w}
+}
+
+type nopCloser struct {
+	TagWriter
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Run writes all tags from the decoder to w, and closes w also on errors.
+func Run(dec *flv.Decoder, w TagWriteCloser) error {
+	for {
+		var flvTag tag.FlvTag
+		if err := dec.Decode(&flvTag); err != nil {
+			if err == io.EOF {
+				break
+			}
+			_ = w.Close()
+			return err
+		}
+
+		err := w.WriteTag(&flvTag)
+		flvTag.Close()
+		if err != nil {
+			_ = w.Close()
+			return err
+		}
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,112 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package packaging
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest")
+
+	err := WriteFile(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "first")
+		return err
+	})
+	require.Nil(t, err)
+
+	// the previous file is kept on errors
+	err = WriteFile(path, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "second")
+		return errors.New("failed")
+	})
+	require.EqualError(t, err, "failed")
+
+	b, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "first", string(b))
+}
+
+type recordWriteCloser struct {
+	timestamps []uint32
+	closed     bool
+	err        error
+}
+
+func (w *recordWriteCloser) WriteTag(flvTag *tag.FlvTag) error {
+	w.timestamps = append(w.timestamps, flvTag.Timestamp)
+	return w.err
+}
+
+func (w *recordWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := flv.NewEncoder(&buf, flv.FlagsVideo)
+	require.Nil(t, err)
+	for _, ts := range []uint32{0, 40} {
+		err := enc.Encode(&tag.FlvTag{
+			TagType:   tag.TagTypeVideo,
+			Timestamp: ts,
+			Data: &tag.VideoData{
+				FrameType: tag.FrameTypeKeyFrame,
+				CodecID:   tag.CodecIDOn2VP6,
+				Data:      bytes.NewReader([]byte{0x01}),
+			},
+		})
+		require.Nil(t, err)
+	}
+
+	type testCase struct {
+		Name       string
+		Err        error
+		Timestamps []uint32
+	}
+
+	testCases := []testCase{
+		{
+			Name:       "OK",
+			Timestamps: []uint32{0, 40},
+		},
+		{
+			Name:       "Error",
+			Err:        errors.New("failed"),
+			Timestamps: []uint32{0},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			dec, err := flv.NewDecoder(bytes.NewReader(buf.Bytes()))
+			require.Nil(t, err)
+
+			w := &recordWriteCloser{err: tc.Err}
+			err = Run(dec, w)
+			require.Equal(t, tc.Err, err)
+			require.Equal(t, tc.Timestamps, w.timestamps)
+			require.True(t, w.closed)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mkv
+
+import (
+	"math"
+)
+
+// Element IDs (RFC 8794, RFC 9559)
+const (
+	idEBML               = 0x1a45dfa3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42f7
+	idEBMLMaxIDLength    = 0x42f2
+	idEBMLMaxSizeLength  = 0x42f3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+	idVoid               = 0xec
+
+	idSegment      = 0x18538067
+	idSeekHead     = 0x114d9b74
+	idSeek         = 0x4dbb
+	idSeekID       = 0x53ab
+	idSeekPosition = 0x53ac
+
+	idInfo           = 0x1549a966
+	idTimestampScale = 0x2ad7b1
+	idDuration       = 0x4489
+	idMuxingApp      = 0x4d80
+	idWritingApp     = 0x5741
+
+	idTracks            = 0x1654ae6b
+	idTrackEntry        = 0xae
+	idTrackNumber       = 0xd7
+	idTrackUID          = 0x73c5
+	idTrackType         = 0x83
+	idFlagLacing        = 0x9c
+	idCodecID           = 0x86
+	idCodecPrivate      = 0x63a2
+	idCodecDelay        = 0x56aa
+	idSeekPreRoll       = 0x56bb
+	idVideo             = 0xe0
+	idPixelWidth        = 0xb0
+	idPixelHeight       = 0xba
+	idAudio             = 0xe1
+	idSamplingFrequency = 0xb5
+	idChannels          = 0x9f
+
+	idCluster     = 0x1f43b675
+	idTimestamp   = 0xe7
+	idSimpleBlock = 0xa3
+
+	idCues               = 0x1c53bb6b
+	idCuePoint           = 0xbb
+	idCueTime            = 0xb3
+	idCueTrackPositions  = 0xb7
+	idCueTrack           = 0xf7
+	idCueClusterPosition = 0xf1
+)
+
+// unknownSize is an 8 bytes element data size whose value is unknown.
+var unknownSize = []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// ebmlBuffer builds nested EBML elements in memory. Sizes of master elements are filled when they are ended.
+type ebmlBuffer struct {
+	b     []byte
+	stack []int
+}
+
+func (b *ebmlBuffer) start(id uint32) {
+	b.id(id)
+	b.stack = append(b.stack, len(b.b))
+	b.b = append(b.b, make([]byte, 8)...)
+}
+
+func (b *ebmlBuffer) end() {
+	offset := b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+
+	size := uint64(len(b.b) - offset - 8)
+	n := vintLength(size)
+	putVint(b.b[offset:offset+n], size)
+	copy(b.b[offset+n:], b.b[offset+8:])
+	b.b = b.b[:len(b.b)-(8-n)]
+}
+
+func (b *ebmlBuffer) id(id uint32) {
+	switch {
+	case id > 0xffffff:
+		b.b = append(b.b, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xffff:
+		b.b = append(b.b, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xff:
+		b.b = append(b.b, byte(id>>8), byte(id))
+	default:
+		b.b = append(b.b, byte(id))
+	}
+}
+
+func (b *ebmlBuffer) size(size uint64) {
+	n := vintLength(size)
+	b.b = append(b.b, make([]byte, n)...)
+	putVint(b.b[len(b.b)-n:], size)
+}
+
+func (b *ebmlBuffer) uint(id uint32, v uint64) {
+	n := 1
+	for v>>(8*uint(n)) != 0 && n < 8 {
+		n++
+	}
+	b.id(id)
+	b.size(uint64(n))
+	for i := n - 1; i >= 0; i-- {
+		b.b = append(b.b, byte(v>>(8*uint(i))))
+	}
+}
+
+// fixedUint writes an unsigned integer element whose data is always 8 bytes, to be overwritten later.
+func (b *ebmlBuffer) fixedUint(id uint32, v uint64) {
+	b.id(id)
+	b.size(8)
+	for i := 7; i >= 0; i-- {
+		b.b = append(b.b, byte(v>>(8*uint(i))))
+	}
+}
+
+func (b *ebmlBuffer) float(id uint32, v float64) {
+	b.fixedUint(id, math.Float64bits(v))
+}
+
+func (b *ebmlBuffer) str(id uint32, s string) {
+	b.id(id)
+	b.size(uint64(len(s)))
+	b.b = append(b.b, s...)
+}
+
+func (b *ebmlBuffer) bytes(id uint32, data []byte) {
+	b.id(id)
+	b.size(uint64(len(data)))
+	b.b = append(b.b, data...)
+}
+
+// void writes a Void element whose total length is n (n >= 2).
+func (b *ebmlBuffer) void(n int) {
+	b.id(idVoid)
+	if n-2 < 0x7f {
+		b.size(uint64(n - 2))
+		b.b = append(b.b, make([]byte, n-2)...)
+		return
+	}
+	b.b = append(b.b, make([]byte, 8)...) // 8 bytes length
+	putVint(b.b[len(b.b)-8:], uint64(n-9))
+	b.b = append(b.b, make([]byte, n-9)...)
+}
+
+func (b *ebmlBuffer) reset() {
+	b.b = b.b[:0]
+	b.stack = b.stack[:0]
+}
+
+// vintLength returns the minimum length to encode v. All ones are reserved for unknown sizes.
+func vintLength(v uint64) int {
+	n := 1
+	for n < 8 && v >= 1<<(7*uint(n))-1 {
+		n++
+	}
+	return n
+}
+
+// putVint encodes v into b with len(b) bytes.
+func putVint(b []byte, v uint64) {
+	n := len(b)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	b[0] |= 0x80 >> uint(n-1)
+}
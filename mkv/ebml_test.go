@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mkv
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type element struct {
+	id   uint32
+	data []byte
+}
+
+// readVint reads a variable length integer. If keepMarker is true, the length marker is kept (for IDs).
+func readVint(t *testing.T, b []byte, keepMarker bool) (uint64, int) {
+	require.NotZero(t, len(b))
+	n := bits.LeadingZeros8(b[0]) + 1
+	require.True(t, n <= len(b))
+
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= 0xff >> uint(n)
+	}
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// readElements reads sibling elements. An element of unknown size extends to the end.
+func readElements(t *testing.T, b []byte) []element {
+	var elements []element
+	for len(b) > 0 {
+		id, n := readVint(t, b, true)
+		b = b[n:]
+		size, n := readVint(t, b, false)
+		if size == 1<<(7*uint(n))-1 {
+			size = uint64(len(b) - n)
+		}
+		b = b[n:]
+		require.True(t, size <= uint64(len(b)))
+
+		elements = append(elements, element{id: uint32(id), data: b[:size]})
+		b = b[size:]
+	}
+	return elements
+}
+
+func findElements(elements []element, id uint32) []element {
+	var found []element
+	for _, e := range elements {
+		if e.id == id {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func TestEBMLBuffer(t *testing.T) {
+	var b ebmlBuffer
+	b.start(idCues)
+	b.start(idCuePoint)
+	b.uint(idCueTime, 0)
+	b.uint(idCueTrack, 0x0102)
+	b.end()
+	b.bytes(idCodecPrivate, make([]byte, 200))
+	b.end()
+	b.void(2)
+	b.void(200)
+
+	require.Equal(t, []byte{
+		0x1c, 0x53, 0xbb, 0x6b, 0x40, 0xd5, // Cues, 2 bytes size (213)
+		0xbb, 0x87, // CuePoint
+		0xb3, 0x81, 0x00, // CueTime
+		0xf7, 0x82, 0x01, 0x02, // CueTrack
+		0x63, 0xa2, 0x40, 0xc8, // CodecPrivate (200)
+	}, b.b[:19])
+
+	elements := readElements(t, b.b)
+	require.Equal(t, 3, len(elements))
+	require.Equal(t, uint32(idCues), elements[0].id)
+	require.Equal(t, uint32(idVoid), elements[1].id)
+	require.Equal(t, 0, len(elements[1].data))
+	require.Equal(t, 200-9, len(elements[2].data))
+}
+
+func TestVintLength(t *testing.T) {
+	require.Equal(t, 1, vintLength(0))
+	require.Equal(t, 1, vintLength(126))
+	require.Equal(t, 2, vintLength(127)) // all ones are reserved
+	require.Equal(t, 2, vintLength(16382))
+	require.Equal(t, 3, vintLength(16383))
+}
@@ -0,0 +1,807 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package mkv remuxes FLV into Matroska.
+//
+// Supported codecs are H.264, H.265, AAC and MP3, and also VP9, AV1 and Opus carried by Enhanced RTMP
+// extended headers.
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/av1"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/codec/hevc"
+	"github.com/yutopp/go-flv/codec/mp3"
+	"github.com/yutopp/go-flv/codec/opus"
+	"github.com/yutopp/go-flv/codec/vp9"
+	"github.com/yutopp/go-flv/tag"
+)
+
+const (
+	// MaxHeaderDelay is a duration (in ms) to wait for sequence headers of all tracks declared in FLV flags.
+	// Tracks whose sequence header has not been received by then are omitted.
+	MaxHeaderDelay = 10000
+
+	// AudioClusterDuration is a duration (in ms) of clusters when there is no video track.
+	AudioClusterDuration = 5000
+
+	appName = "go-flv"
+
+	trackTypeVideo = 1
+	trackTypeAudio = 2
+
+	// reserved for SeekHead: 3 Seek entries (68 bytes) and a Void element
+	seekHeadSize = 96
+
+	// opusSeekPreRoll is a duration (in ns) recommended to decode before a seek point of Opus.
+	opusSeekPreRoll = 80000000
+)
+
+type track struct {
+	number            uint64
+	trackType         uint64
+	codecID           string
+	codecPrivate      []byte
+	config            []byte // the sequence header which the track is created from
+	width, height     uint32 // zero until a keyframe is received for VP9 and AV1
+	samplingFrequency uint32
+	channels          int
+	codecDelay        uint64 // in ns
+	seekPreRoll       uint64 // in ns
+}
+
+type block struct {
+	video     bool
+	timestamp int64 // presentation time in ms
+	keyframe  bool
+	data      []byte
+}
+
+type cuePoint struct {
+	time            uint64
+	track           uint64
+	clusterPosition uint64
+}
+
+// Muxer writes FLV tags as Matroska. Tracks are determined by sequence headers, thus headers are
+// written when sequence headers of all tracks in flags have been received.
+//
+// If the writer is an io.WriteSeeker, the segment size, the duration and SeekHead are written by Close.
+type Muxer struct {
+	w     io.Writer
+	flags flv.Flags
+
+	seeker     io.WriteSeeker // nil if not seekable
+	baseOffset int64
+	offset     int64 // written bytes
+
+	video *track
+	audio *track
+
+	headerWritten bool
+	pending       []*block
+
+	segmentSizeOffset int64
+	segmentDataOffset int64
+	infoPosition      int64 // relative to segmentDataOffset
+	tracksPosition    int64 // relative to segmentDataOffset
+	durationOffset    int64
+
+	cluster          ebmlBuffer
+	clusterStarted   bool
+	clusterTimestamp int64
+
+	cues         []cuePoint
+	maxTimestamp int64
+}
+
+func NewMuxer(w io.Writer, flags flv.Flags) *Muxer {
+	return &Muxer{
+		w:     w,
+		flags: flags,
+	}
+}
+
+func (m *Muxer) WriteTag(flvTag *tag.FlvTag) error {
+	switch data := flvTag.Data.(type) {
+	case *tag.AudioData:
+		return m.writeAudioData(flvTag.Timestamp, data)
+	case *tag.VideoData:
+		return m.writeVideoData(flvTag.Timestamp, data)
+	case *tag.ScriptData, *tag.UnknownData:
+		return nil
+	default:
+		return fmt.Errorf("unexpected data is set: %T", flvTag.Data)
+	}
+}
+
+func (m *Muxer) writeVideoData(timestamp uint32, videoData *tag.VideoData) error {
+	if videoData.ExHeader {
+		return m.writeExVideoData(timestamp, videoData)
+	}
+
+	if videoData.CodecID != tag.CodecIDAVC && videoData.CodecID != tag.CodecIDHEVC {
+		return fmt.Errorf("unsupported video codec: %+v", videoData.CodecID)
+	}
+
+	switch videoData.AVCPacketType {
+	case tag.AVCPacketTypeSequenceHeader:
+		data, err := io.ReadAll(videoData.Data)
+		if err != nil {
+			return err
+		}
+
+		return m.setVideoTrack(data, func() (*track, error) {
+			return newVideoTrack(videoData.CodecID, data)
+		})
+
+	case tag.AVCPacketTypeNALU:
+		data, err := io.ReadAll(videoData.Data)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+
+		return m.pushBlock(&block{
+			video:     true,
+			timestamp: int64(timestamp) + int64(videoData.CompositionTime),
+			keyframe:  videoData.FrameType == tag.FrameTypeKeyFrame,
+			data:      data,
+		})
+
+	case tag.AVCPacketTypeEOS:
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported AVC packet type: %+v", videoData.AVCPacketType)
+	}
+}
+
+func (m *Muxer) writeExVideoData(timestamp uint32, videoData *tag.VideoData) error {
+	switch videoData.FourCC {
+	case tag.FourCCAVC, tag.FourCCHEVC, tag.FourCCVP9, tag.FourCCAV1:
+	default:
+		return fmt.Errorf("unsupported video codec: %v", videoData.FourCC)
+	}
+
+	switch videoData.VideoPacketType {
+	case tag.VideoPacketTypeSequenceStart:
+		data, err := io.ReadAll(videoData.Data)
+		if err != nil {
+			return err
+		}
+
+		return m.setVideoTrack(data, func() (*track, error) {
+			return newExVideoTrack(videoData.FourCC, data)
+		})
+
+	case tag.VideoPacketTypeCodedFrames, tag.VideoPacketTypeCodedFramesX:
+		data, err := io.ReadAll(videoData.Data)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+
+		keyframe := videoData.FrameType == tag.FrameTypeKeyFrame
+		if keyframe && m.video != nil && m.video.width == 0 && !m.headerWritten {
+			if err := m.video.setFrameSize(videoData.FourCC, data); err != nil {
+				return err
+			}
+		}
+
+		return m.pushBlock(&block{
+			video:     true,
+			timestamp: int64(timestamp) + int64(videoData.CompositionTime),
+			keyframe:  keyframe,
+			data:      data,
+		})
+
+	case tag.VideoPacketTypeSequenceEnd, tag.VideoPacketTypeMetadata:
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported video packet type: %+v", videoData.VideoPacketType)
+	}
+}
+
+// setVideoTrack sets a track created by newTrack from the sequence header config. Matroska cannot
+// represent changes of sequence headers, thus only the same one is accepted after that.
+func (m *Muxer) setVideoTrack(config []byte, newTrack func() (*track, error)) error {
+	if m.video != nil {
+		if bytes.Equal(m.video.config, config) {
+			return nil
+		}
+		return fmt.Errorf("video sequence header is changed, which cannot be represented in Matroska")
+	}
+
+	t, err := newTrack()
+	if err != nil {
+		return err
+	}
+	t.config = config
+	m.video = t
+	return nil
+}
+
+func (m *Muxer) setAudioTrack(config []byte, newTrack func() (*track, error)) error {
+	if m.audio != nil {
+		if bytes.Equal(m.audio.config, config) {
+			return nil
+		}
+		return fmt.Errorf("audio sequence header is changed, which cannot be represented in Matroska")
+	}
+
+	t, err := newTrack()
+	if err != nil {
+		return err
+	}
+	t.config = config
+	m.audio = t
+	return nil
+}
+
+func newVideoTrack(codecID tag.CodecID, record []byte) (*track, error) {
+	var codec string
+	var sps []byte
+	switch codecID {
+	case tag.CodecIDAVC:
+		var r avc.DecoderConfigurationRecord
+		if err := avc.DecodeDecoderConfigurationRecord(bytes.NewReader(record), &r); err != nil {
+			return nil, fmt.Errorf("failed to decode AVCDecoderConfigurationRecord: %w", err)
+		}
+		if len(r.SPS) == 0 {
+			return nil, fmt.Errorf("SPS is not found in AVCDecoderConfigurationRecord")
+		}
+		codec, sps = "V_MPEG4/ISO/AVC", r.SPS[0]
+
+	case tag.CodecIDHEVC:
+		var r hevc.DecoderConfigurationRecord
+		if err := hevc.DecodeDecoderConfigurationRecord(bytes.NewReader(record), &r); err != nil {
+			return nil, fmt.Errorf("failed to decode HEVCDecoderConfigurationRecord: %w", err)
+		}
+		for _, array := range r.Arrays {
+			if array.NALUnitType == hevc.NALUnitTypeSPS && len(array.NALUnits) > 0 {
+				sps = array.NALUnits[0]
+			}
+		}
+		if sps == nil {
+			return nil, fmt.Errorf("SPS is not found in HEVCDecoderConfigurationRecord")
+		}
+		codec = "V_MPEGH/ISO/HEVC"
+	}
+
+	t := &track{
+		trackType:    trackTypeVideo,
+		codecID:      codec,
+		codecPrivate: record,
+	}
+	if codecID == tag.CodecIDAVC {
+		s, err := avc.ParseSPS(sps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SPS: %w", err)
+		}
+		t.width, t.height = s.Width, s.Height
+	} else {
+		s, err := hevc.ParseSPS(sps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SPS: %w", err)
+		}
+		t.width, t.height = s.Width, s.Height
+	}
+
+	return t, nil
+}
+
+func newExVideoTrack(fourCC tag.FourCC, record []byte) (*track, error) {
+	switch fourCC {
+	case tag.FourCCAVC:
+		return newVideoTrack(tag.CodecIDAVC, record)
+
+	case tag.FourCCHEVC:
+		return newVideoTrack(tag.CodecIDHEVC, record)
+
+	case tag.FourCCVP9:
+		// VPCodecConfigurationRecord is not used as CodecPrivate of V_VP9, and it does not have the
+		// frame size, which is taken from the first keyframe.
+		return &track{
+			trackType: trackTypeVideo,
+			codecID:   "V_VP9",
+		}, nil
+
+	default: // tag.FourCCAV1
+		r, err := av1.ParseCodecConfigurationRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode AV1CodecConfigurationRecord: %w", err)
+		}
+		t := &track{
+			trackType:    trackTypeVideo,
+			codecID:      "V_AV1",
+			codecPrivate: record,
+		}
+		// configOBUs may be empty, then the frame size is taken from the first keyframe
+		if err := t.setFrameSize(fourCC, r.ConfigOBUs); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+}
+
+// setFrameSize sets the frame size of VP9 or AV1 from a keyframe, if any.
+func (t *track) setFrameSize(fourCC tag.FourCC, data []byte) error {
+	switch fourCC {
+	case tag.FourCCVP9:
+		h, err := vp9.ParseFrameHeader(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse VP9 frame header: %w", err)
+		}
+		t.width, t.height = h.Width, h.Height
+
+	case tag.FourCCAV1:
+		h, err := av1.FindSequenceHeader(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse AV1 sequence header: %w", err)
+		}
+		if h != nil {
+			t.width, t.height = h.MaxFrameWidth, h.MaxFrameHeight
+		}
+	}
+
+	return nil
+}
+
+func (m *Muxer) writeAudioData(timestamp uint32, audioData *tag.AudioData) error {
+	switch audioData.SoundFormat {
+	case tag.SoundFormatAAC:
+		data, err := io.ReadAll(audioData.Data)
+		if err != nil {
+			return err
+		}
+
+		switch audioData.AACPacketType {
+		case tag.AACPacketTypeSequenceHeader:
+			return m.setAudioTrack(data, func() (*track, error) {
+				return newAACTrack(data)
+			})
+
+		case tag.AACPacketTypeRaw:
+			return m.pushBlock(&block{
+				timestamp: int64(timestamp),
+				keyframe:  true,
+				data:      data,
+			})
+
+		default:
+			return fmt.Errorf("unsupported AAC packet type: %+v", audioData.AACPacketType)
+		}
+
+	case tag.SoundFormatMP3, tag.SoundFormatMP3_8kHz:
+		data, err := io.ReadAll(audioData.Data)
+		if err != nil {
+			return err
+		}
+
+		if m.audio == nil {
+			header, err := mp3.ParseFrameHeader(data)
+			if err != nil {
+				return fmt.Errorf("failed to parse MP3 frame header: %w", err)
+			}
+			m.audio = &track{
+				trackType:         trackTypeAudio,
+				codecID:           "A_MPEG/L3",
+				samplingFrequency: header.SamplingRate,
+				channels:          header.Channels(),
+			}
+		}
+
+		return m.pushBlock(&block{
+			timestamp: int64(timestamp),
+			keyframe:  true,
+			data:      data,
+		})
+
+	case tag.SoundFormatExHeader:
+		return m.writeExAudioData(timestamp, audioData)
+
+	default:
+		return fmt.Errorf("unsupported sound format: %+v", audioData.SoundFormat)
+	}
+}
+
+func (m *Muxer) writeExAudioData(timestamp uint32, audioData *tag.AudioData) error {
+	if audioData.FourCC != tag.FourCCOpus && audioData.FourCC != tag.FourCCAAC {
+		return fmt.Errorf("unsupported audio codec: %v", audioData.FourCC)
+	}
+
+	switch audioData.AudioPacketType {
+	case tag.AudioPacketTypeSequenceStart:
+		data, err := io.ReadAll(audioData.Data)
+		if err != nil {
+			return err
+		}
+
+		return m.setAudioTrack(data, func() (*track, error) {
+			if audioData.FourCC == tag.FourCCAAC {
+				return newAACTrack(data)
+			}
+			return newOpusTrack(data)
+		})
+
+	case tag.AudioPacketTypeCodedFrames:
+		data, err := io.ReadAll(audioData.Data)
+		if err != nil {
+			return err
+		}
+
+		return m.pushBlock(&block{
+			timestamp: int64(timestamp),
+			keyframe:  true,
+			data:      data,
+		})
+
+	case tag.AudioPacketTypeSequenceEnd, tag.AudioPacketTypeMultichannelConfig:
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported audio packet type: %+v", audioData.AudioPacketType)
+	}
+}
+
+func newAACTrack(config []byte) (*track, error) {
+	var c aac.AudioSpecificConfig
+	if err := aac.DecodeAudioSpecificConfig(bytes.NewReader(config), &c); err != nil {
+		return nil, fmt.Errorf("failed to decode AudioSpecificConfig: %w", err)
+	}
+
+	return &track{
+		trackType:         trackTypeAudio,
+		codecID:           "A_AAC",
+		codecPrivate:      config,
+		samplingFrequency: c.SamplingFrequency,
+		channels:          c.Channels(),
+	}, nil
+}
+
+func newOpusTrack(idHeader []byte) (*track, error) {
+	h, err := opus.ParseIDHeader(idHeader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpusHead: %w", err)
+	}
+
+	return &track{
+		trackType:         trackTypeAudio,
+		codecID:           "A_OPUS",
+		codecPrivate:      idHeader,
+		samplingFrequency: opus.SampleRate,
+		channels:          int(h.ChannelCount),
+		codecDelay:        uint64(h.PreSkip) * 1000000000 / opus.SampleRate,
+		seekPreRoll:       opusSeekPreRoll,
+	}, nil
+}
+
+func (m *Muxer) pushBlock(b *block) error {
+	if m.headerWritten {
+		return m.writeBlock(b)
+	}
+
+	m.pending = append(m.pending, b)
+	if !m.ready() && b.timestamp-m.pending[0].timestamp < MaxHeaderDelay {
+		return nil
+	}
+
+	return m.writeHeader()
+}
+
+func (m *Muxer) ready() bool {
+	if m.flags&flv.FlagsVideo != 0 && m.video == nil {
+		return false
+	}
+	if m.video != nil && m.video.width == 0 { // waits for a keyframe of VP9 or AV1
+		return false
+	}
+	if m.flags&flv.FlagsAudio != 0 && m.audio == nil {
+		return false
+	}
+	return m.video != nil || m.audio != nil
+}
+
+func (m *Muxer) write(b []byte) error {
+	n, err := m.w.Write(b)
+	m.offset += int64(n)
+	return err
+}
+
+func (m *Muxer) writeHeader() error {
+	if m.video == nil && m.audio == nil {
+		return fmt.Errorf("sequence headers are not received")
+	}
+
+	if s, ok := m.w.(io.WriteSeeker); ok {
+		// e.g. pipes implement io.Seeker but cannot seek
+		if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+			m.seeker = s
+			m.baseOffset = offset
+		}
+	}
+
+	var tracks []*track
+	for _, t := range []*track{m.video, m.audio} {
+		if t != nil {
+			t.number = uint64(len(tracks) + 1)
+			tracks = append(tracks, t)
+		}
+	}
+
+	var b ebmlBuffer
+	b.start(idEBML)
+	b.uint(idEBMLVersion, 1)
+	b.uint(idEBMLReadVersion, 1)
+	b.uint(idEBMLMaxIDLength, 4)
+	b.uint(idEBMLMaxSizeLength, 8)
+	b.str(idDocType, "matroska")
+	b.uint(idDocTypeVersion, 4)
+	b.uint(idDocTypeReadVersion, 2)
+	b.end()
+
+	b.id(idSegment)
+	m.segmentSizeOffset = m.offset + int64(len(b.b))
+	b.b = append(b.b, unknownSize...)
+	m.segmentDataOffset = m.offset + int64(len(b.b))
+
+	if m.seeker != nil {
+		b.void(seekHeadSize)
+	}
+
+	m.infoPosition = m.offset + int64(len(b.b)) - m.segmentDataOffset
+	b.start(idInfo)
+	b.uint(idTimestampScale, 1000000) // 1ms
+	b.str(idMuxingApp, appName)
+	b.str(idWritingApp, appName)
+	if m.seeker != nil {
+		b.float(idDuration, 0) // must be the last
+	}
+	b.end()
+	m.durationOffset = m.offset + int64(len(b.b)) - 8
+
+	m.tracksPosition = m.offset + int64(len(b.b)) - m.segmentDataOffset
+	b.start(idTracks)
+	for _, t := range tracks {
+		b.start(idTrackEntry)
+		b.uint(idTrackNumber, t.number)
+		b.uint(idTrackUID, t.number)
+		b.uint(idTrackType, t.trackType)
+		b.uint(idFlagLacing, 0)
+		b.str(idCodecID, t.codecID)
+		if t.codecPrivate != nil {
+			b.bytes(idCodecPrivate, t.codecPrivate)
+		}
+		if t.codecDelay != 0 {
+			b.uint(idCodecDelay, t.codecDelay)
+		}
+		if t.seekPreRoll != 0 {
+			b.uint(idSeekPreRoll, t.seekPreRoll)
+		}
+		switch t.trackType {
+		case trackTypeVideo:
+			b.start(idVideo)
+			b.uint(idPixelWidth, uint64(t.width))
+			b.uint(idPixelHeight, uint64(t.height))
+			b.end()
+		case trackTypeAudio:
+			b.start(idAudio)
+			b.float(idSamplingFrequency, float64(t.samplingFrequency))
+			b.uint(idChannels, uint64(t.channels))
+			b.end()
+		}
+		b.end()
+	}
+	b.end()
+
+	if err := m.write(b.b); err != nil {
+		return err
+	}
+	m.headerWritten = true
+
+	pending := m.pending
+	m.pending = nil
+	for _, blk := range pending {
+		if err := m.writeBlock(blk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Muxer) writeBlock(b *block) error {
+	t := m.audio
+	if b.video {
+		t = m.video
+	}
+	if t == nil || t.number == 0 {
+		return nil // omitted
+	}
+
+	relative := b.timestamp - m.clusterTimestamp
+	cut := !m.clusterStarted ||
+		relative < math.MinInt16 || relative > math.MaxInt16 ||
+		(m.video != nil && b.video && b.keyframe) ||
+		(m.video == nil && relative >= AudioClusterDuration)
+	if cut {
+		if err := m.flushCluster(); err != nil {
+			return err
+		}
+
+		m.clusterTimestamp = b.timestamp
+		if m.clusterTimestamp < 0 {
+			m.clusterTimestamp = 0
+		}
+		relative = b.timestamp - m.clusterTimestamp
+
+		if m.video == nil || b.video {
+			m.cues = append(m.cues, cuePoint{
+				time:            uint64(m.clusterTimestamp),
+				track:           t.number,
+				clusterPosition: uint64(m.offset - m.segmentDataOffset),
+			})
+		}
+
+		m.cluster.start(idCluster)
+		m.cluster.uint(idTimestamp, uint64(m.clusterTimestamp))
+		m.clusterStarted = true
+	}
+
+	var flags byte
+	if b.keyframe {
+		flags |= 0x80
+	}
+	m.cluster.id(idSimpleBlock)
+	m.cluster.size(uint64(vintLength(t.number) + 3 + len(b.data)))
+	m.cluster.size(t.number)
+	m.cluster.b = append(m.cluster.b, byte(uint16(relative)>>8), byte(relative), flags)
+	m.cluster.b = append(m.cluster.b, b.data...)
+
+	if b.timestamp > m.maxTimestamp {
+		m.maxTimestamp = b.timestamp
+	}
+
+	return nil
+}
+
+func (m *Muxer) flushCluster() error {
+	if !m.clusterStarted {
+		return nil
+	}
+
+	m.cluster.end()
+	err := m.write(m.cluster.b)
+	m.cluster.reset()
+	m.clusterStarted = false
+
+	return err
+}
+
+// Close writes remaining clusters and Cues. It does not close the underlying writer.
+func (m *Muxer) Close() error {
+	if !m.headerWritten {
+		if err := m.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if err := m.flushCluster(); err != nil {
+		return err
+	}
+
+	cuesPosition := m.offset - m.segmentDataOffset
+	if len(m.cues) > 0 {
+		var b ebmlBuffer
+		b.start(idCues)
+		for _, cue := range m.cues {
+			b.start(idCuePoint)
+			b.uint(idCueTime, cue.time)
+			b.start(idCueTrackPositions)
+			b.uint(idCueTrack, cue.track)
+			b.uint(idCueClusterPosition, cue.clusterPosition)
+			b.end()
+			b.end()
+		}
+		b.end()
+
+		if err := m.write(b.b); err != nil {
+			return err
+		}
+	}
+
+	if m.seeker == nil {
+		return nil
+	}
+
+	return m.finalize(cuesPosition)
+}
+
+func (m *Muxer) finalize(cuesPosition int64) error {
+	end := m.offset
+
+	segmentSize := make([]byte, 8)
+	putVint(segmentSize, uint64(end-m.segmentDataOffset))
+	if err := m.writeAt(m.segmentSizeOffset, segmentSize); err != nil {
+		return err
+	}
+
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(float64(m.maxTimestamp)))
+	if err := m.writeAt(m.durationOffset, duration); err != nil {
+		return err
+	}
+
+	var b ebmlBuffer
+	b.start(idSeekHead)
+	b.start(idSeek)
+	b.bytes(idSeekID, []byte{0x15, 0x49, 0xa9, 0x66}) // Info
+	b.fixedUint(idSeekPosition, uint64(m.infoPosition))
+	b.end()
+	b.start(idSeek)
+	b.bytes(idSeekID, []byte{0x16, 0x54, 0xae, 0x6b}) // Tracks
+	b.fixedUint(idSeekPosition, uint64(m.tracksPosition))
+	b.end()
+	if len(m.cues) > 0 {
+		b.start(idSeek)
+		b.bytes(idSeekID, []byte{0x1c, 0x53, 0xbb, 0x6b}) // Cues
+		b.fixedUint(idSeekPosition, uint64(cuesPosition))
+		b.end()
+	}
+	b.end()
+	b.void(seekHeadSize - len(b.b))
+	if err := m.writeAt(m.segmentDataOffset, b.b); err != nil {
+		return err
+	}
+
+	_, err := m.seeker.Seek(m.baseOffset+end, io.SeekStart)
+	return err
+}
+
+func (m *Muxer) writeAt(offset int64, b []byte) error {
+	if _, err := m.seeker.Seek(m.baseOffset+offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := m.seeker.Write(b)
+	return err
+}
+
+// Remux reads all tags from dec and writes them as Matroska.
+func Remux(dec *flv.Decoder, w io.Writer) error {
+	m := NewMuxer(w, dec.Header().Flags)
+	for {
+		var flvTag tag.FlvTag
+		if err := dec.Decode(&flvTag); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		err := m.WriteTag(&flvTag)
+		flvTag.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.Close()
+}
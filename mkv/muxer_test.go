@@ -0,0 +1,392 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+func videoTag(timestamp uint32, frameType tag.FrameType, packetType tag.AVCPacketType, ct int32, data []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:       frameType,
+			CodecID:         tag.CodecIDAVC,
+			AVCPacketType:   packetType,
+			CompositionTime: ct,
+			Data:            bytes.NewReader(data),
+		},
+	}
+}
+
+func audioTag(timestamp uint32, packetType tag.AACPacketType, data []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeAudio,
+		Timestamp: timestamp,
+		Data: &tag.AudioData{
+			SoundFormat:   tag.SoundFormatAAC,
+			SoundRate:     tag.SoundRate44kHz,
+			SoundSize:     tag.SoundSize16Bit,
+			SoundType:     tag.SoundTypeStereo,
+			AACPacketType: packetType,
+			Data:          bytes.NewReader(data),
+		},
+	}
+}
+
+func testFLV(t *testing.T) []byte {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var recordBuf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+
+	idr := avc.AppendAVCC(nil, [][]byte{{0x65, 0x88, 0x84, 0x21}})
+	nonIDR := avc.AppendAVCC(nil, [][]byte{{0x41, 0x9a, 0x02, 0x21}})
+
+	var buf bytes.Buffer
+	enc, err := flv.NewEncoder(&buf, flv.FlagsAudio|flv.FlagsVideo)
+	require.Nil(t, err)
+
+	flvTags := []*tag.FlvTag{
+		// audio sequence header is later than the first video frame
+		videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader, 0, recordBuf.Bytes()),
+		videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU, 40, idr),
+		audioTag(0, tag.AACPacketTypeSequenceHeader, []byte{0x12, 0x10}),
+		audioTag(0, tag.AACPacketTypeRaw, []byte{0x21, 0x00}),
+		videoTag(40, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU, 40, nonIDR),
+		audioTag(23, tag.AACPacketTypeRaw, []byte{0x21, 0x01}),
+		videoTag(80, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU, 40, idr),
+		audioTag(46, tag.AACPacketTypeRaw, []byte{0x21, 0x02}),
+	}
+	for _, flvTag := range flvTags {
+		require.Nil(t, enc.Encode(flvTag))
+	}
+
+	return buf.Bytes()
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
+
+func TestRemux(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.mkv"))
+	require.Nil(t, err)
+	defer f.Close()
+
+	dec, err := flv.NewDecoder(bytes.NewReader(testFLV(t)))
+	require.Nil(t, err)
+	err = Remux(dec, f)
+	require.Nil(t, err)
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.Nil(t, err)
+	b, err := io.ReadAll(f)
+	require.Nil(t, err)
+
+	top := readElements(t, b)
+	require.Equal(t, 2, len(top))
+	require.Equal(t, uint32(idEBML), top[0].id)
+	require.Equal(t, "matroska", string(findElements(readElements(t, top[0].data), idDocType)[0].data))
+
+	// segment size is fixed up
+	require.Equal(t, uint32(idSegment), top[1].id)
+	segmentOffset := len(b) - len(top[1].data)
+	require.Equal(t, byte(0x01), b[segmentOffset-8])
+	require.NotEqual(t, byte(0xff), b[segmentOffset-1])
+
+	segment := readElements(t, top[1].data)
+
+	// SeekHead points to elements
+	seekHeads := findElements(segment, idSeekHead)
+	require.Equal(t, 1, len(seekHeads))
+	seeks := findElements(readElements(t, seekHeads[0].data), idSeek)
+	require.Equal(t, 3, len(seeks))
+	for _, seek := range seeks {
+		children := readElements(t, seek.data)
+		id := uint32(readUint(findElements(children, idSeekID)[0].data))
+		position := readUint(findElements(children, idSeekPosition)[0].data)
+		actual, _ := readVint(t, top[1].data[position:], true)
+		require.Equal(t, uint64(id), actual)
+	}
+
+	info := readElements(t, findElements(segment, idInfo)[0].data)
+	require.Equal(t, uint64(1000000), readUint(findElements(info, idTimestampScale)[0].data))
+	duration := math.Float64frombits(binary.BigEndian.Uint64(findElements(info, idDuration)[0].data))
+	require.Equal(t, float64(120), duration)
+
+	entries := findElements(readElements(t, findElements(segment, idTracks)[0].data), idTrackEntry)
+	require.Equal(t, 2, len(entries))
+
+	video := readElements(t, entries[0].data)
+	require.Equal(t, "V_MPEG4/ISO/AVC", string(findElements(video, idCodecID)[0].data))
+	require.NotZero(t, len(findElements(video, idCodecPrivate)[0].data))
+	videoSettings := readElements(t, findElements(video, idVideo)[0].data)
+	require.Equal(t, uint64(1280), readUint(findElements(videoSettings, idPixelWidth)[0].data))
+	require.Equal(t, uint64(720), readUint(findElements(videoSettings, idPixelHeight)[0].data))
+
+	audio := readElements(t, entries[1].data)
+	require.Equal(t, "A_AAC", string(findElements(audio, idCodecID)[0].data))
+	require.Equal(t, []byte{0x12, 0x10}, findElements(audio, idCodecPrivate)[0].data)
+	require.Equal(t, uint64(2), readUint(findElements(readElements(t, findElements(audio, idAudio)[0].data), idChannels)[0].data))
+
+	// clusters are cut on keyframes
+	clusters := findElements(segment, idCluster)
+	require.Equal(t, 2, len(clusters))
+
+	type simpleBlock struct {
+		track    uint64
+		relative int16
+		keyframe bool
+	}
+	var blocks [][]simpleBlock
+	var timestamps []uint64
+	for _, cluster := range clusters {
+		children := readElements(t, cluster.data)
+		timestamps = append(timestamps, readUint(findElements(children, idTimestamp)[0].data))
+
+		var bs []simpleBlock
+		for _, e := range findElements(children, idSimpleBlock) {
+			bs = append(bs, simpleBlock{
+				track:    uint64(e.data[0] & 0x7f),
+				relative: int16(binary.BigEndian.Uint16(e.data[1:3])),
+				keyframe: e.data[3]&0x80 != 0,
+			})
+		}
+		blocks = append(blocks, bs)
+	}
+	require.Equal(t, []uint64{40, 120}, timestamps)
+	require.Equal(t, [][]simpleBlock{
+		{
+			{track: 1, relative: 0, keyframe: true},
+			{track: 2, relative: -40, keyframe: true},
+			{track: 1, relative: 40, keyframe: false},
+			{track: 2, relative: -17, keyframe: true},
+		},
+		{
+			{track: 1, relative: 0, keyframe: true},
+			{track: 2, relative: -74, keyframe: true},
+		},
+	}, blocks)
+
+	// cues point to clusters
+	cuePoints := findElements(readElements(t, findElements(segment, idCues)[0].data), idCuePoint)
+	require.Equal(t, 2, len(cuePoints))
+	for i, cuePoint := range cuePoints {
+		children := readElements(t, cuePoint.data)
+		require.Equal(t, timestamps[i], readUint(findElements(children, idCueTime)[0].data))
+
+		positions := readElements(t, findElements(children, idCueTrackPositions)[0].data)
+		require.Equal(t, uint64(1), readUint(findElements(positions, idCueTrack)[0].data))
+		position := readUint(findElements(positions, idCueClusterPosition)[0].data)
+		actual, _ := readVint(t, top[1].data[position:], true)
+		require.Equal(t, uint64(idCluster), actual)
+	}
+}
+
+func TestRemuxWithoutSeeker(t *testing.T) {
+	dec, err := flv.NewDecoder(bytes.NewReader(testFLV(t)))
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	err = Remux(dec, &buf)
+	require.Nil(t, err)
+
+	top := readElements(t, buf.Bytes())
+	require.Equal(t, 2, len(top))
+
+	// unknown size
+	segmentOffset := buf.Len() - len(top[1].data)
+	require.Equal(t, unknownSize, buf.Bytes()[segmentOffset-8:segmentOffset])
+
+	segment := readElements(t, top[1].data)
+	require.Equal(t, 0, len(findElements(segment, idSeekHead)))
+	require.Equal(t, 2, len(findElements(segment, idCluster)))
+	require.Equal(t, 1, len(findElements(segment, idCues)))
+}
+
+func TestMuxerMissingTrack(t *testing.T) {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var recordBuf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+	idr := avc.AppendAVCC(nil, [][]byte{{0x65, 0x88, 0x84, 0x21}})
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, flv.FlagsAudio|flv.FlagsVideo)
+	require.Nil(t, m.WriteTag(videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader, 0, recordBuf.Bytes())))
+	require.Nil(t, m.WriteTag(videoTag(0, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU, 0, idr)))
+	require.Zero(t, buf.Len()) // waits for audio
+
+	require.Nil(t, m.WriteTag(videoTag(MaxHeaderDelay, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU, 0, idr)))
+	require.NotZero(t, buf.Len())
+	require.Nil(t, m.Close())
+
+	segment := readElements(t, readElements(t, buf.Bytes())[1].data)
+	entries := findElements(readElements(t, findElements(segment, idTracks)[0].data), idTrackEntry)
+	require.Equal(t, 1, len(entries))
+}
+
+func exVideoTag(timestamp uint32, frameType tag.FrameType, fourCC tag.FourCC, packetType tag.VideoPacketType, data []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:       frameType,
+			ExHeader:        true,
+			FourCC:          fourCC,
+			VideoPacketType: packetType,
+			Data:            bytes.NewReader(data),
+		},
+	}
+}
+
+func exAudioTag(timestamp uint32, fourCC tag.FourCC, packetType tag.AudioPacketType, data []byte) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeAudio,
+		Timestamp: timestamp,
+		Data: &tag.AudioData{
+			SoundFormat:     tag.SoundFormatExHeader,
+			FourCC:          fourCC,
+			AudioPacketType: packetType,
+			Data:            bytes.NewReader(data),
+		},
+	}
+}
+
+var testOpusHead = []byte{
+	'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 0x01, 0x02, 0x38, 0x01, 0x80, 0xbb, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// testAV1SequenceHeader is a sequence header OBU of 1920x1080.
+var testAV1SequenceHeader = []byte{0x0a, 0x08, 0x00, 0x00, 0x00, 0x42, 0xab, 0xbf, 0xc3, 0x78}
+
+func TestMuxerExHeader(t *testing.T) {
+	vp9KeyFrame := []byte{0x82, 0x49, 0x83, 0x42, 0x00, 0x4f, 0xf0, 0x2c, 0xf0} // 1280x720
+	vp9InterFrame := []byte{0x86, 0x00}
+	av1Record := append([]byte{0x81, 0x08, 0x0c, 0x00}, testAV1SequenceHeader...)
+
+	testCases := []struct {
+		name    string
+		flvTags []*tag.FlvTag
+		codecID string
+		private []byte
+		width   uint64
+		height  uint64
+	}{
+		{
+			name: "VP9",
+			flvTags: []*tag.FlvTag{
+				exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCVP9, tag.VideoPacketTypeSequenceStart, []byte{0x01, 0x00, 0x00, 0x00}),
+				exAudioTag(0, tag.FourCCOpus, tag.AudioPacketTypeSequenceStart, testOpusHead),
+				exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCVP9, tag.VideoPacketTypeCodedFrames, vp9KeyFrame),
+				exAudioTag(0, tag.FourCCOpus, tag.AudioPacketTypeCodedFrames, []byte{0xfc, 0x00}),
+				exVideoTag(40, tag.FrameTypeInterFrame, tag.FourCCVP9, tag.VideoPacketTypeCodedFramesX, vp9InterFrame),
+			},
+			codecID: "V_VP9",
+			width:   1280,
+			height:  720,
+		},
+		{
+			name: "AV1",
+			flvTags: []*tag.FlvTag{
+				exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCAV1, tag.VideoPacketTypeSequenceStart, av1Record),
+				exAudioTag(0, tag.FourCCOpus, tag.AudioPacketTypeSequenceStart, testOpusHead),
+				exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCAV1, tag.VideoPacketTypeCodedFrames, append([]byte{0x12, 0x00}, testAV1SequenceHeader...)),
+				exAudioTag(0, tag.FourCCOpus, tag.AudioPacketTypeCodedFrames, []byte{0xfc, 0x00}),
+				exVideoTag(40, tag.FrameTypeInterFrame, tag.FourCCAV1, tag.VideoPacketTypeCodedFrames, []byte{0x12, 0x00, 0x32, 0x00}),
+			},
+			codecID: "V_AV1",
+			private: av1Record,
+			width:   1920,
+			height:  1080,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			m := NewMuxer(&buf, flv.FlagsAudio|flv.FlagsVideo)
+			for _, flvTag := range tc.flvTags {
+				require.Nil(t, m.WriteTag(flvTag))
+			}
+			require.Nil(t, m.Close())
+
+			segment := readElements(t, readElements(t, buf.Bytes())[1].data)
+			entries := findElements(readElements(t, findElements(segment, idTracks)[0].data), idTrackEntry)
+			require.Equal(t, 2, len(entries))
+
+			video := readElements(t, entries[0].data)
+			require.Equal(t, tc.codecID, string(findElements(video, idCodecID)[0].data))
+			if tc.private != nil {
+				require.Equal(t, tc.private, findElements(video, idCodecPrivate)[0].data)
+			} else {
+				require.Equal(t, 0, len(findElements(video, idCodecPrivate)))
+			}
+			videoSettings := readElements(t, findElements(video, idVideo)[0].data)
+			require.Equal(t, tc.width, readUint(findElements(videoSettings, idPixelWidth)[0].data))
+			require.Equal(t, tc.height, readUint(findElements(videoSettings, idPixelHeight)[0].data))
+
+			audio := readElements(t, entries[1].data)
+			require.Equal(t, "A_OPUS", string(findElements(audio, idCodecID)[0].data))
+			require.Equal(t, testOpusHead, findElements(audio, idCodecPrivate)[0].data)
+			require.Equal(t, uint64(6500000), readUint(findElements(audio, idCodecDelay)[0].data)) // 312 samples
+			require.Equal(t, uint64(80000000), readUint(findElements(audio, idSeekPreRoll)[0].data))
+			audioSettings := readElements(t, findElements(audio, idAudio)[0].data)
+			require.Equal(t, float64(48000), math.Float64frombits(binary.BigEndian.Uint64(findElements(audioSettings, idSamplingFrequency)[0].data)))
+			require.Equal(t, uint64(2), readUint(findElements(audioSettings, idChannels)[0].data))
+
+			clusters := findElements(segment, idCluster)
+			require.Equal(t, 1, len(clusters))
+			require.Equal(t, 3, len(findElements(readElements(t, clusters[0].data), idSimpleBlock)))
+		})
+	}
+}
+
+func TestMuxerExHeaderChanged(t *testing.T) {
+	av1Record := append([]byte{0x81, 0x08, 0x0c, 0x00}, testAV1SequenceHeader...)
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, flv.FlagsVideo)
+	require.Nil(t, m.WriteTag(exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCAV1, tag.VideoPacketTypeSequenceStart, av1Record)))
+	require.Nil(t, m.WriteTag(exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCAV1, tag.VideoPacketTypeSequenceStart, av1Record)))
+
+	err := m.WriteTag(exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCAV1, tag.VideoPacketTypeSequenceStart, av1Record[:4]))
+	require.EqualError(t, err, "video sequence header is changed, which cannot be represented in Matroska")
+
+	err = m.WriteTag(exVideoTag(0, tag.FrameTypeKeyFrame, tag.FourCCVP8, tag.VideoPacketTypeCodedFrames, []byte{0x00}))
+	require.EqualError(t, err, "unsupported video codec: vp08")
+}
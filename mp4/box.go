@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp4
+
+import (
+	"encoding/binary"
+)
+
+// boxBuffer builds nested ISO BMFF boxes in memory. Sizes are filled when boxes are ended.
+type boxBuffer struct {
+	b     []byte
+	stack []int
+}
+
+func (b *boxBuffer) start(boxType string) {
+	b.stack = append(b.stack, len(b.b))
+	b.b = append(b.b, 0x00, 0x00, 0x00, 0x00)
+	b.b = append(b.b, boxType[:4]...)
+}
+
+func (b *boxBuffer) startFull(boxType string, version uint8, flags uint32) {
+	b.start(boxType)
+	b.u8(version)
+	b.u8(uint8(flags >> 16))
+	b.u16(uint16(flags))
+}
+
+func (b *boxBuffer) end() {
+	offset := b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	binary.BigEndian.PutUint32(b.b[offset:], uint32(len(b.b)-offset))
+}
+
+func (b *boxBuffer) u8(v uint8) {
+	b.b = append(b.b, v)
+}
+
+func (b *boxBuffer) u16(v uint16) {
+	b.b = append(b.b, byte(v>>8), byte(v))
+}
+
+func (b *boxBuffer) u24(v uint32) {
+	b.b = append(b.b, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *boxBuffer) u32(v uint32) {
+	b.b = append(b.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *boxBuffer) u64(v uint64) {
+	b.u32(uint32(v >> 32))
+	b.u32(uint32(v))
+}
+
+func (b *boxBuffer) zeros(n int) {
+	for i := 0; i < n; i++ {
+		b.b = append(b.b, 0x00)
+	}
+}
+
+func (b *boxBuffer) bytes(v []byte) {
+	b.b = append(b.b, v...)
+}
+
+func (b *boxBuffer) str(v string) {
+	b.b = append(b.b, v...)
+}
+
+// offset returns the current position in the buffer.
+func (b *boxBuffer) offset() int {
+	return len(b.b)
+}
+
+func (b *boxBuffer) putU32At(offset int, v uint32) {
+	binary.BigEndian.PutUint32(b.b[offset:], v)
+}
+
+var unityMatrix = []uint32{
+	0x00010000, 0, 0,
+	0, 0x00010000, 0,
+	0, 0, 0x40000000,
+}
+
+func (b *boxBuffer) matrix() {
+	for _, v := range unityMatrix {
+		b.u32(v)
+	}
+}
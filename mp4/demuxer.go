@@ -0,0 +1,747 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// Demuxer reads samples of H.264/AAC tracks in a MP4/MOV file as FLV tags.
+// onMetaData and sequence headers are emitted first, then samples are interleaved by their decode time.
+// Edit lists are ignored.
+type Demuxer struct {
+	r        io.ReadSeeker
+	duration time.Duration
+	tracks   []*demuxTrack
+
+	headers []*tag.FlvTag // pending tags which are emitted before samples
+}
+
+type demuxTrack struct {
+	*Track
+	samples []*sampleEntry
+	next    int
+}
+
+type sampleEntry struct {
+	offset                int64
+	size                  uint32
+	decodeTime            uint64 // in the timescale of the track
+	compositionTimeOffset int32  // in the timescale of the track
+	keyframe              bool
+}
+
+// NewDemuxer parses a moov box. Tracks other than H.264 and AAC are skipped.
+func NewDemuxer(r io.ReadSeeker) (*Demuxer, error) {
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	moov, err := readTopLevelBox(r, "moov", fileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Demuxer{r: r}
+	if err := d.parseMoov(moov, fileSize); err != nil {
+		return nil, err
+	}
+	if len(d.tracks) == 0 {
+		return nil, fmt.Errorf("no supported tracks are found")
+	}
+
+	d.headers = append(d.headers, d.metadataTag())
+	for _, track := range d.tracks {
+		sequenceHeader, err := sequenceHeaderTag(track.Track)
+		if err != nil {
+			return nil, err
+		}
+		d.headers = append(d.headers, sequenceHeader)
+	}
+
+	return d, nil
+}
+
+// Tracks returns supported tracks.
+func (d *Demuxer) Tracks() []*Track {
+	tracks := make([]*Track, len(d.tracks))
+	for i, track := range d.tracks {
+		tracks[i] = track.Track
+	}
+	return tracks
+}
+
+// Duration returns a duration of the movie.
+func (d *Demuxer) Duration() time.Duration {
+	return d.duration
+}
+
+// Flags returns FLV header flags for tracks in the movie.
+func (d *Demuxer) Flags() flv.Flags {
+	var flags flv.Flags
+	for _, track := range d.tracks {
+		switch track.Type {
+		case TrackTypeVideo:
+			flags |= flv.FlagsVideo
+		case TrackTypeAudio:
+			flags |= flv.FlagsAudio
+		}
+	}
+	return flags
+}
+
+// Decode reads a next tag. io.EOF is returned after all samples are read.
+func (d *Demuxer) Decode(flvTag *tag.FlvTag) error {
+	if len(d.headers) > 0 {
+		*flvTag = *d.headers[0]
+		d.headers = d.headers[1:]
+		return nil
+	}
+
+	var track *demuxTrack
+	var trackDecodeTime uint64 // ms
+	for _, t := range d.tracks {
+		if t.next >= len(t.samples) {
+			continue
+		}
+		decodeTime := t.samples[t.next].decodeTime * 1000 / uint64(t.Timescale)
+		if track == nil || decodeTime < trackDecodeTime {
+			track, trackDecodeTime = t, decodeTime
+		}
+	}
+	if track == nil {
+		return io.EOF
+	}
+
+	sample := track.samples[track.next]
+	track.next++
+
+	data := make([]byte, sample.size) // bounded by the file size in parseSampleTable
+	if _, err := d.r.Seek(sample.offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return fmt.Errorf("failed to read a sample: Track = %d, %w", track.ID, err)
+	}
+
+	*flvTag = tag.FlvTag{
+		Timestamp: uint32(trackDecodeTime),
+	}
+	switch track.Type {
+	case TrackTypeVideo:
+		presentationTime := int64(sample.decodeTime) + int64(sample.compositionTimeOffset)
+		compositionTime := presentationTime*1000/int64(track.Timescale) - int64(trackDecodeTime)
+
+		frameType := tag.FrameTypeInterFrame
+		if sample.keyframe {
+			frameType = tag.FrameTypeKeyFrame
+		}
+		flvTag.TagType = tag.TagTypeVideo
+		flvTag.Data = &tag.VideoData{
+			FrameType:       frameType,
+			CodecID:         tag.CodecIDAVC,
+			AVCPacketType:   tag.AVCPacketTypeNALU,
+			CompositionTime: int32(compositionTime),
+			Data:            bytes.NewReader(data),
+		}
+
+	case TrackTypeAudio:
+		flvTag.TagType = tag.TagTypeAudio
+		flvTag.Data = tag.NewAACAudioData(tag.AACPacketTypeRaw, data)
+	}
+
+	return nil
+}
+
+func sequenceHeaderTag(track *Track) (*tag.FlvTag, error) {
+	var buf bytes.Buffer
+	switch track.Type {
+	case TrackTypeVideo:
+		if err := avc.EncodeDecoderConfigurationRecord(&buf, track.AVCConfig); err != nil {
+			return nil, err
+		}
+		return &tag.FlvTag{
+			TagType: tag.TagTypeVideo,
+			Data: &tag.VideoData{
+				FrameType:     tag.FrameTypeKeyFrame,
+				CodecID:       tag.CodecIDAVC,
+				AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+				Data:          &buf,
+			},
+		}, nil
+
+	case TrackTypeAudio:
+		if err := aac.EncodeAudioSpecificConfig(&buf, track.AACConfig); err != nil {
+			return nil, err
+		}
+		return &tag.FlvTag{
+			TagType: tag.TagTypeAudio,
+			Data:    tag.NewAACAudioData(tag.AACPacketTypeSequenceHeader, buf.Bytes()),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported track type: %d", track.Type)
+	}
+}
+
+func (d *Demuxer) metadataTag() *tag.FlvTag {
+	metadata := amf0.ECMAArray{
+		"duration": d.duration.Seconds(),
+	}
+	for _, track := range d.tracks {
+		switch track.Type {
+		case TrackTypeVideo:
+			metadata["width"] = float64(track.Width)
+			metadata["height"] = float64(track.Height)
+			metadata["videocodecid"] = float64(tag.CodecIDAVC)
+			if n := len(track.samples); n > 1 {
+				last := track.samples[n-1].decodeTime
+				if last > 0 {
+					metadata["framerate"] = float64(n-1) * float64(track.Timescale) / float64(last)
+				}
+			}
+		case TrackTypeAudio:
+			metadata["audiocodecid"] = float64(tag.SoundFormatAAC)
+			metadata["audiosamplerate"] = float64(track.AACConfig.SamplingFrequency)
+			metadata["stereo"] = track.AACConfig.Channels() >= 2
+		}
+	}
+
+	return &tag.FlvTag{
+		TagType: tag.TagTypeScriptData,
+		Data: &tag.ScriptData{
+			Objects: map[string]amf0.ECMAArray{
+				"onMetaData": metadata,
+			},
+		},
+	}
+}
+
+// RemuxToFLV converts a MP4/MOV file into FLV.
+func RemuxToFLV(w io.Writer, r io.ReadSeeker) error {
+	d, err := NewDemuxer(r)
+	if err != nil {
+		return err
+	}
+
+	enc, err := flv.NewEncoder(w, d.Flags())
+	if err != nil {
+		return err
+	}
+
+	for {
+		var flvTag tag.FlvTag
+		if err := d.Decode(&flvTag); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := enc.Encode(&flvTag); err != nil {
+			return err
+		}
+	}
+}
+
+// ========================================
+// box parsing
+
+// readTopLevelBox reads a payload of the box. fileSize bounds the size of the box so that a corrupted
+// size does not allocate more than the file.
+func readTopLevelBox(r io.ReadSeeker, boxType string, fileSize int64) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("%s box is not found", boxType)
+			}
+			return nil, err
+		}
+
+		size := uint64(binary.BigEndian.Uint32(header))
+		headerSize := uint64(8)
+		switch size {
+		case 0: // extends to the end of the file
+			if string(header[4:8]) == boxType {
+				return io.ReadAll(r)
+			}
+			return nil, fmt.Errorf("%s box is not found", boxType)
+		case 1: // large size
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			size = binary.BigEndian.Uint64(header[8:])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(fileSize) {
+			return nil, fmt.Errorf("invalid box size: Type = %s, Size = %d", string(header[4:8]), size)
+		}
+
+		if string(header[4:8]) == boxType {
+			payload := make([]byte, size-headerSize)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return nil, err
+			}
+			return payload, nil
+		}
+
+		if _, err := r.Seek(int64(size-headerSize), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// walkBoxes calls f for each box in b.
+func walkBoxes(b []byte, f func(boxType string, payload []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return io.ErrUnexpectedEOF
+		}
+		size := uint64(binary.BigEndian.Uint32(b))
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return io.ErrUnexpectedEOF
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(b)) {
+			return fmt.Errorf("invalid box size: Type = %s, Size = %d", string(b[4:8]), size)
+		}
+
+		if err := f(string(b[4:8]), b[headerSize:size]); err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// findChildBox returns a payload of the first box whose type is boxType.
+func findChildBox(b []byte, boxType string) []byte {
+	var found []byte
+	_ = walkBoxes(b, func(t string, payload []byte) error {
+		if found == nil && t == boxType {
+			found = payload
+		}
+		return nil
+	})
+	return found
+}
+
+func (d *Demuxer) parseMoov(moov []byte, fileSize int64) error {
+	return walkBoxes(moov, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "mvhd":
+			timescale, duration, err := parseTimescaleAndDuration(payload, 12, 20)
+			if err != nil {
+				return fmt.Errorf("failed to parse mvhd: %w", err)
+			}
+			if timescale > 0 {
+				d.duration = time.Duration(duration) * time.Second / time.Duration(timescale)
+			}
+		case "trak":
+			track, err := parseTrak(payload, fileSize)
+			if err != nil {
+				return fmt.Errorf("failed to parse trak: %w", err)
+			}
+			if track != nil {
+				d.tracks = append(d.tracks, track)
+			}
+		}
+		return nil
+	})
+}
+
+// parseTimescaleAndDuration parses mvhd/mdhd. offsetV0/offsetV1 are offsets of the timescale field.
+func parseTimescaleAndDuration(b []byte, offsetV0, offsetV1 int) (uint32, uint64, error) {
+	if len(b) < 1 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	if b[0] == 1 {
+		if len(b) < offsetV1+12 {
+			return 0, 0, io.ErrUnexpectedEOF
+		}
+		return binary.BigEndian.Uint32(b[offsetV1:]), binary.BigEndian.Uint64(b[offsetV1+4:]), nil
+	}
+	if len(b) < offsetV0+8 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	return binary.BigEndian.Uint32(b[offsetV0:]), uint64(binary.BigEndian.Uint32(b[offsetV0+4:])), nil
+}
+
+// parseTrak returns nil if the track is not supported.
+func parseTrak(trak []byte, fileSize int64) (*demuxTrack, error) {
+	tkhd := findChildBox(trak, "tkhd")
+	mdia := findChildBox(trak, "mdia")
+	if tkhd == nil || mdia == nil {
+		return nil, fmt.Errorf("tkhd or mdia is missing")
+	}
+
+	track := &demuxTrack{Track: &Track{}}
+
+	if len(tkhd) < 1 {
+		return nil, fmt.Errorf("failed to parse tkhd: %w", io.ErrUnexpectedEOF)
+	}
+	trackIDOffset := 12
+	if tkhd[0] == 1 {
+		trackIDOffset = 20
+	}
+	if len(tkhd) < trackIDOffset+4 {
+		return nil, fmt.Errorf("failed to parse tkhd: %w", io.ErrUnexpectedEOF)
+	}
+	track.ID = binary.BigEndian.Uint32(tkhd[trackIDOffset:])
+
+	timescale, _, err := parseTimescaleAndDuration(findChildBox(mdia, "mdhd"), 12, 20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mdhd: %w", err)
+	}
+	if timescale == 0 {
+		return nil, fmt.Errorf("timescale is 0: Track = %d", track.ID)
+	}
+	track.Timescale = timescale
+
+	stbl := findChildBox(findChildBox(mdia, "minf"), "stbl")
+	if stbl == nil {
+		return nil, fmt.Errorf("stbl is missing: Track = %d", track.ID)
+	}
+
+	supported, err := parseSampleDescription(track.Track, findChildBox(stbl, "stsd"))
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, nil
+	}
+
+	if track.samples, err = parseSampleTable(stbl, fileSize); err != nil {
+		return nil, fmt.Errorf("failed to parse sample table: Track = %d, %w", track.ID, err)
+	}
+
+	return track, nil
+}
+
+func parseSampleDescription(track *Track, stsd []byte) (bool, error) {
+	if len(stsd) < 8 {
+		return false, fmt.Errorf("stsd is missing")
+	}
+
+	var supported bool
+	err := walkBoxes(stsd[8:], func(boxType string, entry []byte) error {
+		if supported {
+			return nil // uses the first description only
+		}
+
+		switch boxType {
+		case "avc1", "avc3":
+			if len(entry) < 78 {
+				return io.ErrUnexpectedEOF
+			}
+			avcC := findChildBox(entry[78:], "avcC")
+			if avcC == nil {
+				return fmt.Errorf("avcC is missing")
+			}
+			var record avc.DecoderConfigurationRecord
+			if err := avc.DecodeDecoderConfigurationRecord(bytes.NewReader(avcC), &record); err != nil {
+				return err
+			}
+			track.Type = TrackTypeVideo
+			track.Width = binary.BigEndian.Uint16(entry[24:])
+			track.Height = binary.BigEndian.Uint16(entry[26:])
+			track.AVCConfig = &record
+			supported = true
+
+		case "mp4a":
+			if len(entry) < 28 {
+				return io.ErrUnexpectedEOF
+			}
+			headerSize := 28
+			switch binary.BigEndian.Uint16(entry[8:]) { // QuickTime sound description version
+			case 1:
+				headerSize += 16
+			case 2:
+				headerSize += 36
+			}
+			if len(entry) < headerSize {
+				return io.ErrUnexpectedEOF
+			}
+			esds := findChildBox(entry[headerSize:], "esds")
+			if esds == nil {
+				esds = findChildBox(findChildBox(entry[headerSize:], "wave"), "esds") // QuickTime
+			}
+			if esds == nil {
+				return fmt.Errorf("esds is missing")
+			}
+			info, err := parseDecoderSpecificInfo(esds)
+			if err != nil {
+				return fmt.Errorf("failed to parse esds: %w", err)
+			}
+			var config aac.AudioSpecificConfig
+			if err := aac.DecodeAudioSpecificConfig(bytes.NewReader(info), &config); err != nil {
+				return err
+			}
+			track.Type = TrackTypeAudio
+			track.AACConfig = &config
+			supported = true
+		}
+		return nil
+	})
+	return supported, err
+}
+
+// parseDecoderSpecificInfo extracts DecoderSpecificInfo from an ES_Descriptor in the esds box.
+func parseDecoderSpecificInfo(esds []byte) ([]byte, error) {
+	if len(esds) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := esds[4:] // version and flags
+
+	for len(b) > 0 {
+		descrTag := b[0]
+		b = b[1:]
+
+		// expandable size
+		var size int
+		for i := 0; i < 4; i++ {
+			if len(b) == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			v := b[0]
+			b = b[1:]
+			size = size<<7 | int(v&0x7f)
+			if v&0x80 == 0 {
+				break
+			}
+		}
+
+		switch descrTag {
+		case esDescrTag:
+			if len(b) < 3 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			flags := b[2]
+			skip := 3
+			if flags&0x80 != 0 { // streamDependenceFlag
+				skip += 2
+			}
+			if flags&0x40 != 0 { // URL_Flag
+				if len(b) < skip+1 {
+					return nil, io.ErrUnexpectedEOF
+				}
+				skip += 1 + int(b[skip])
+			}
+			if flags&0x20 != 0 { // OCRstreamFlag
+				skip += 2
+			}
+			if len(b) < skip {
+				return nil, io.ErrUnexpectedEOF
+			}
+			b = b[skip:]
+		case decoderConfigDescrTag:
+			if len(b) < 13 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			b = b[13:]
+		case decSpecificInfoTag:
+			if len(b) < size {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return b[:size], nil
+		default:
+			if len(b) < size {
+				return nil, io.ErrUnexpectedEOF
+			}
+			b = b[size:]
+		}
+	}
+
+	return nil, fmt.Errorf("DecoderSpecificInfo is not found")
+}
+
+// parseSampleTable returns samples which are located within fileSize bytes of the file.
+func parseSampleTable(stbl []byte, fileSize int64) ([]*sampleEntry, error) {
+	if findChildBox(stbl, "stsz") == nil {
+		return nil, fmt.Errorf("stsz is missing")
+	}
+
+	sizes, err := parseSampleSizes(findChildBox(stbl, "stsz"), fileSize)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]*sampleEntry, len(sizes))
+	for i, size := range sizes {
+		samples[i] = &sampleEntry{size: size, keyframe: true}
+	}
+
+	// decode times
+	var decodeTime uint64
+	i := 0
+	if err := eachEntry(findChildBox(stbl, "stts"), 8, func(e []byte) error {
+		count, delta := binary.BigEndian.Uint32(e), binary.BigEndian.Uint32(e[4:])
+		for j := uint32(0); j < count && i < len(samples); j++ {
+			samples[i].decodeTime = decodeTime
+			decodeTime += uint64(delta)
+			i++
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to parse stts: %w", err)
+	}
+
+	// composition time offsets (optional)
+	if ctts := findChildBox(stbl, "ctts"); ctts != nil {
+		i := 0
+		if err := eachEntry(ctts, 8, func(e []byte) error {
+			count, offset := binary.BigEndian.Uint32(e), int32(binary.BigEndian.Uint32(e[4:]))
+			for j := uint32(0); j < count && i < len(samples); j++ {
+				samples[i].compositionTimeOffset = offset
+				i++
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to parse ctts: %w", err)
+		}
+	}
+
+	// sync samples (optional, all samples are sync samples if missing)
+	if stss := findChildBox(stbl, "stss"); stss != nil {
+		for _, sample := range samples {
+			sample.keyframe = false
+		}
+		if err := eachEntry(stss, 4, func(e []byte) error {
+			n := binary.BigEndian.Uint32(e)
+			if n >= 1 && int(n) <= len(samples) {
+				samples[n-1].keyframe = true
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to parse stss: %w", err)
+		}
+	}
+
+	// chunk offsets
+	var chunkOffsets []int64
+	if stco := findChildBox(stbl, "stco"); stco != nil {
+		err = eachEntry(stco, 4, func(e []byte) error {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(e)))
+			return nil
+		})
+	} else if co64 := findChildBox(stbl, "co64"); co64 != nil {
+		err = eachEntry(co64, 8, func(e []byte) error {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(e)))
+			return nil
+		})
+	} else {
+		return nil, fmt.Errorf("stco/co64 is missing")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chunk offsets: %w", err)
+	}
+
+	// sample to chunk
+	type stscEntry struct{ firstChunk, samplesPerChunk uint32 }
+	var stsc []stscEntry
+	if err := eachEntry(findChildBox(stbl, "stsc"), 12, func(e []byte) error {
+		stsc = append(stsc, stscEntry{binary.BigEndian.Uint32(e), binary.BigEndian.Uint32(e[4:])})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to parse stsc: %w", err)
+	}
+
+	i = 0
+	for k, entry := range stsc {
+		lastChunk := uint32(len(chunkOffsets))
+		if k+1 < len(stsc) {
+			lastChunk = stsc[k+1].firstChunk - 1
+		}
+		for chunk := entry.firstChunk; chunk <= lastChunk && chunk >= 1 && int(chunk) <= len(chunkOffsets); chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for j := uint32(0); j < entry.samplesPerChunk && i < len(samples); j++ {
+				samples[i].offset = offset
+				offset += int64(samples[i].size)
+				if offset > fileSize {
+					return nil, fmt.Errorf("sample exceeds the file: Sample = %d, End = %d, FileSize = %d", i, offset, fileSize)
+				}
+				i++
+			}
+		}
+	}
+	if i != len(samples) {
+		return nil, fmt.Errorf("samples are not mapped to chunks: Mapped = %d, Samples = %d", i, len(samples))
+	}
+
+	return samples, nil
+}
+
+// parseSampleSizes parses stsz. A count of samples which have a constant size is not bounded by the
+// box, thus it is bounded by fileSize instead.
+func parseSampleSizes(stsz []byte, fileSize int64) ([]uint32, error) {
+	if len(stsz) < 12 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	sampleSize := binary.BigEndian.Uint32(stsz[4:])
+	count := int(binary.BigEndian.Uint32(stsz[8:]))
+
+	if sampleSize != 0 {
+		if int64(count)*int64(sampleSize) > fileSize {
+			return nil, fmt.Errorf("samples exceed the file: Count = %d, SampleSize = %d, FileSize = %d", count, sampleSize, fileSize)
+		}
+		sizes := make([]uint32, count)
+		for i := range sizes {
+			sizes[i] = sampleSize
+		}
+		return sizes, nil
+	}
+
+	if len(stsz) < 12+count*4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	sizes := make([]uint32, count)
+	for i := range sizes {
+		sizes[i] = binary.BigEndian.Uint32(stsz[12+i*4:])
+	}
+	return sizes, nil
+}
+
+// eachEntry iterates entries of a full box which has an entry count.
+func eachEntry(box []byte, entrySize int, f func(e []byte) error) error {
+	if len(box) < 8 {
+		return io.ErrUnexpectedEOF
+	}
+	count := int(binary.BigEndian.Uint32(box[4:]))
+	b := box[8:]
+	if len(b) < count*entrySize {
+		return io.ErrUnexpectedEOF
+	}
+	for i := 0; i < count; i++ {
+		if err := f(b[i*entrySize : (i+1)*entrySize]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+type testSample struct {
+	delta    uint32
+	offset   int32
+	keyframe bool
+	data     []byte
+}
+
+// encodeTestTrak writes a trak with a single chunk at chunkOffset.
+func encodeTestTrak(b *boxBuffer, track *Track, chunkOffset uint32, samples []testSample) {
+	var sampleEntry boxBuffer
+	_ = encodeSampleEntry(&sampleEntry, track)
+
+	b.start("trak")
+	b.startFull("tkhd", 0, 0x03)
+	b.zeros(8)
+	b.u32(track.ID)
+	b.zeros(4 + 4 + 8 + 8 + 36)
+	b.u32(uint32(track.Width) << 16)
+	b.u32(uint32(track.Height) << 16)
+	b.end()
+
+	b.start("mdia")
+	b.startFull("mdhd", 0, 0)
+	b.zeros(8)
+	b.u32(track.Timescale)
+	b.zeros(8)
+	b.end()
+
+	b.start("minf")
+	b.start("stbl")
+
+	b.startFull("stsd", 0, 0)
+	b.u32(1)
+	b.bytes(sampleEntry.b)
+	b.end()
+
+	b.startFull("stts", 0, 0)
+	b.u32(uint32(len(samples)))
+	for _, s := range samples {
+		b.u32(1)
+		b.u32(s.delta)
+	}
+	b.end()
+
+	b.startFull("ctts", 0, 0)
+	b.u32(uint32(len(samples)))
+	for _, s := range samples {
+		b.u32(1)
+		b.u32(uint32(s.offset))
+	}
+	b.end()
+
+	b.startFull("stss", 0, 0)
+	var syncs []uint32
+	for i, s := range samples {
+		if s.keyframe {
+			syncs = append(syncs, uint32(i+1))
+		}
+	}
+	b.u32(uint32(len(syncs)))
+	for _, n := range syncs {
+		b.u32(n)
+	}
+	b.end()
+
+	b.startFull("stsc", 0, 0)
+	b.u32(1)
+	b.u32(1)
+	b.u32(uint32(len(samples)))
+	b.u32(1)
+	b.end()
+
+	b.startFull("stsz", 0, 0)
+	b.u32(0)
+	b.u32(uint32(len(samples)))
+	for _, s := range samples {
+		b.u32(uint32(len(s.data)))
+	}
+	b.end()
+
+	b.startFull("stco", 0, 0)
+	b.u32(1)
+	b.u32(chunkOffset)
+	b.end()
+
+	b.end() // stbl
+	b.end() // minf
+	b.end() // mdia
+	b.end() // trak
+}
+
+func buildTestMovie(t *testing.T) []byte {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	video, err := NewVideoTrack(1, 90000, record)
+	require.Nil(t, err)
+	audio := NewAudioTrack(2, 44100, &aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 4,
+		SamplingFrequency:      44100,
+		ChannelConfiguration:   2,
+	})
+
+	videoSamples := []testSample{
+		{delta: 3000, offset: 3000, keyframe: true, data: []byte{0x00, 0x00, 0x00, 0x01, 0x65}},
+		{delta: 3000, offset: 6000, data: []byte{0x00, 0x00, 0x00, 0x01, 0x41}},
+		{delta: 3000, offset: 0, data: []byte{0x00, 0x00, 0x00, 0x01, 0x01}},
+	}
+	audioSamples := []testSample{
+		{delta: 1024, keyframe: true, data: []byte{0x21, 0x00}},
+		{delta: 1024, keyframe: true, data: []byte{0x21, 0x01}},
+	}
+
+	var b boxBuffer
+	b.start("ftyp")
+	b.str("isom")
+	b.u32(0)
+	b.str("isom")
+	b.end()
+
+	b.start("mdat")
+	videoOffset := uint32(b.offset())
+	for _, s := range videoSamples {
+		b.bytes(s.data)
+	}
+	audioOffset := uint32(b.offset())
+	for _, s := range audioSamples {
+		b.bytes(s.data)
+	}
+	b.end()
+
+	b.start("moov")
+	b.startFull("mvhd", 0, 0)
+	b.zeros(8)
+	b.u32(1000)
+	b.u32(100)
+	b.zeros(80)
+	b.end()
+	encodeTestTrak(&b, video, videoOffset, videoSamples)
+	encodeTestTrak(&b, audio, audioOffset, audioSamples)
+	b.end()
+
+	return b.b
+}
+
+func TestDemuxer(t *testing.T) {
+	d, err := NewDemuxer(bytes.NewReader(buildTestMovie(t)))
+	require.Nil(t, err)
+	require.Equal(t, 100*time.Millisecond, d.Duration())
+	require.Equal(t, flv.FlagsAudio|flv.FlagsVideo, d.Flags())
+	require.Equal(t, 2, len(d.Tracks()))
+
+	type result struct {
+		TagType         tag.TagType
+		Timestamp       uint32
+		CompositionTime int32
+		Keyframe        bool
+		Payload         []byte
+	}
+	var results []result
+	for {
+		var flvTag tag.FlvTag
+		err := d.Decode(&flvTag)
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+
+		r := result{TagType: flvTag.TagType, Timestamp: flvTag.Timestamp}
+		switch data := flvTag.Data.(type) {
+		case *tag.ScriptData:
+			metadata := data.Objects["onMetaData"]
+			require.Equal(t, amf0.ECMAArray{
+				"duration":        0.1,
+				"width":           float64(1280),
+				"height":          float64(720),
+				"videocodecid":    float64(7),
+				"framerate":       float64(30),
+				"audiocodecid":    float64(10),
+				"audiosamplerate": float64(44100),
+				"stereo":          true,
+			}, metadata)
+			continue
+		case *tag.VideoData:
+			if data.AVCPacketType == tag.AVCPacketTypeSequenceHeader {
+				var actual avc.DecoderConfigurationRecord
+				require.Nil(t, avc.DecodeDecoderConfigurationRecord(data.Data, &actual))
+				require.Equal(t, "avc1.64001f", actual.Codec())
+				continue
+			}
+			r.CompositionTime = data.CompositionTime
+			r.Keyframe = data.FrameType == tag.FrameTypeKeyFrame
+			r.Payload, _ = io.ReadAll(data.Data)
+		case *tag.AudioData:
+			if data.AACPacketType == tag.AACPacketTypeSequenceHeader {
+				payload, _ := io.ReadAll(data.Data)
+				require.Equal(t, []byte{0x12, 0x10}, payload)
+				continue
+			}
+			r.Keyframe = true
+			r.Payload, _ = io.ReadAll(data.Data)
+		}
+		results = append(results, r)
+	}
+
+	require.Equal(t, []result{
+		{tag.TagTypeVideo, 0, 33, true, []byte{0x00, 0x00, 0x00, 0x01, 0x65}},
+		{tag.TagTypeAudio, 0, 0, true, []byte{0x21, 0x00}},
+		{tag.TagTypeAudio, 23, 0, true, []byte{0x21, 0x01}},
+		{tag.TagTypeVideo, 33, 67, false, []byte{0x00, 0x00, 0x00, 0x01, 0x41}},
+		{tag.TagTypeVideo, 66, 0, false, []byte{0x00, 0x00, 0x00, 0x01, 0x01}},
+	}, results)
+}
+
+func TestRemuxToFLV(t *testing.T) {
+	var buf bytes.Buffer
+	err := RemuxToFLV(&buf, bytes.NewReader(buildTestMovie(t)))
+	require.Nil(t, err)
+
+	dec, err := flv.NewDecoder(&buf)
+	require.Nil(t, err)
+	require.Equal(t, flv.FlagsAudio|flv.FlagsVideo, dec.Header().Flags)
+
+	n := 0
+	for {
+		var flvTag tag.FlvTag
+		if err := dec.Decode(&flvTag); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		flvTag.Close()
+		n++
+	}
+	require.Equal(t, 8, n) // metadata, 2 sequence headers and 5 samples
+}
+
+func TestDemuxerWithoutMoov(t *testing.T) {
+	_, err := NewDemuxer(bytes.NewReader([]byte{0x00, 0x00, 0x00, 0x08, 'f', 'r', 'e', 'e'}))
+	require.EqualError(t, err, "moov box is not found")
+}
+
+func TestDemuxerWithMalformedSampleSizes(t *testing.T) {
+	testCases := []struct {
+		name  string
+		patch func(stsz []byte) // stsz is a payload of the box
+	}{
+		{
+			name: "constant size with a large count",
+			patch: func(stsz []byte) {
+				binary.BigEndian.PutUint32(stsz[4:], 1)
+				binary.BigEndian.PutUint32(stsz[8:], 0xffffffff)
+			},
+		},
+		{
+			name: "large sample size",
+			patch: func(stsz []byte) {
+				binary.BigEndian.PutUint32(stsz[12:], 0xffffffff)
+			},
+		},
+		{
+			name: "large count",
+			patch: func(stsz []byte) {
+				binary.BigEndian.PutUint32(stsz[8:], 0xffffffff)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			movie := buildTestMovie(t)
+			i := bytes.Index(movie, []byte("stsz"))
+			require.True(t, i >= 0)
+			tc.patch(movie[i+4:])
+
+			_, err := NewDemuxer(bytes.NewReader(movie))
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestDemuxerWithLargeBox(t *testing.T) {
+	_, err := NewDemuxer(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 'm', 'o', 'o', 'v'}))
+	require.EqualError(t, err, "invalid box size: Type = moov, Size = 4294967295")
+}
+
+func TestDemuxerWithEmptyTkhd(t *testing.T) {
+	movie := []byte{
+		0x00, 0x00, 0x00, 0x00, 'm', 'o', 'o', 'v', // sizes are filled below
+		0x00, 0x00, 0x00, 0x00, 't', 'r', 'a', 'k',
+		0x00, 0x00, 0x00, 0x08, 't', 'k', 'h', 'd', // empty
+		0x00, 0x00, 0x00, 0x08, 'm', 'd', 'i', 'a',
+	}
+	binary.BigEndian.PutUint32(movie, uint32(len(movie)))
+	binary.BigEndian.PutUint32(movie[8:], uint32(len(movie)-8))
+
+	_, err := NewDemuxer(bytes.NewReader(movie))
+	require.EqualError(t, err, "failed to parse trak: failed to parse tkhd: unexpected EOF")
+}
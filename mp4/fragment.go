@@ -0,0 +1,400 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+)
+
+type TrackType int
+
+const (
+	TrackTypeVideo TrackType = iota + 1
+	TrackTypeAudio
+)
+
+// Track describes a track in a (fragmented) movie.
+type Track struct {
+	ID        uint32
+	Type      TrackType
+	Timescale uint32
+
+	// Video
+	Width     uint16
+	Height    uint16
+	AVCConfig *avc.DecoderConfigurationRecord
+
+	// Audio
+	AACConfig *aac.AudioSpecificConfig
+}
+
+// NewVideoTrack makes a video track from an AVCDecoderConfigurationRecord. A size is parsed from the first SPS.
+func NewVideoTrack(id uint32, timescale uint32, record *avc.DecoderConfigurationRecord) (*Track, error) {
+	if len(record.SPS) == 0 {
+		return nil, fmt.Errorf("SPS is required")
+	}
+	sps, err := avc.ParseSPS(record.SPS[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SPS: %w", err)
+	}
+
+	return &Track{
+		ID:        id,
+		Type:      TrackTypeVideo,
+		Timescale: timescale,
+		Width:     uint16(sps.Width),
+		Height:    uint16(sps.Height),
+		AVCConfig: record,
+	}, nil
+}
+
+// NewAudioTrack makes an audio track from an AudioSpecificConfig.
+func NewAudioTrack(id uint32, timescale uint32, config *aac.AudioSpecificConfig) *Track {
+	return &Track{
+		ID:        id,
+		Type:      TrackTypeAudio,
+		Timescale: timescale,
+		AACConfig: config,
+	}
+}
+
+// Codec returns a codec string defined in RFC 6381.
+func (t *Track) Codec() string {
+	switch {
+	case t.AVCConfig != nil:
+		return t.AVCConfig.Codec()
+	case t.AACConfig != nil:
+		return t.AACConfig.Codec()
+	default:
+		return ""
+	}
+}
+
+type Sample struct {
+	Duration              uint32 // in the timescale of the track
+	CompositionTimeOffset int32  // in the timescale of the track
+	Keyframe              bool
+	Data                  []byte // AVCC for video, raw frames for audio
+}
+
+const (
+	sampleFlagsKeyframe    uint32 = 0x02000000 // sample_depends_on = 2
+	sampleFlagsNonKeyframe uint32 = 0x01010000 // sample_depends_on = 1, sample_is_non_sync_sample = 1
+)
+
+// EncodeInitSegment writes ftyp and moov boxes for fragmented MP4 (CMAF).
+func EncodeInitSegment(w io.Writer, tracks []*Track) error {
+	var b boxBuffer
+
+	b.start("ftyp")
+	b.str("iso6") // major brand
+	b.u32(0)      // minor version
+	b.str("iso6")
+	b.str("cmfc")
+	b.str("mp41")
+	b.end()
+
+	b.start("moov")
+
+	b.startFull("mvhd", 0, 0)
+	b.u32(0)    // creation time
+	b.u32(0)    // modification time
+	b.u32(1000) // timescale
+	b.u32(0)    // duration
+	b.u32(0x00010000)
+	b.u16(0x0100)
+	b.zeros(10)
+	b.matrix()
+	b.zeros(24)
+	var nextTrackID uint32
+	for _, track := range tracks {
+		if track.ID >= nextTrackID {
+			nextTrackID = track.ID + 1
+		}
+	}
+	b.u32(nextTrackID)
+	b.end()
+
+	for _, track := range tracks {
+		if err := encodeTrak(&b, track); err != nil {
+			return err
+		}
+	}
+
+	b.start("mvex")
+	for _, track := range tracks {
+		b.startFull("trex", 0, 0)
+		b.u32(track.ID)
+		b.u32(1) // default sample description index
+		b.u32(0) // default sample duration
+		b.u32(0) // default sample size
+		b.u32(0) // default sample flags
+		b.end()
+	}
+	b.end()
+
+	b.end() // moov
+
+	_, err := w.Write(b.b)
+	return err
+}
+
+func encodeTrak(b *boxBuffer, track *Track) error {
+	b.start("trak")
+
+	b.startFull("tkhd", 0, 0x03) // enabled, in movie
+	b.u32(0)                     // creation time
+	b.u32(0)                     // modification time
+	b.u32(track.ID)
+	b.u32(0) // reserved
+	b.u32(0) // duration
+	b.zeros(8)
+	b.u16(0) // layer
+	b.u16(0) // alternate group
+	if track.Type == TrackTypeAudio {
+		b.u16(0x0100)
+	} else {
+		b.u16(0)
+	}
+	b.u16(0)
+	b.matrix()
+	b.u32(uint32(track.Width) << 16)
+	b.u32(uint32(track.Height) << 16)
+	b.end()
+
+	b.start("mdia")
+
+	b.startFull("mdhd", 0, 0)
+	b.u32(0) // creation time
+	b.u32(0) // modification time
+	b.u32(track.Timescale)
+	b.u32(0)      // duration
+	b.u16(0x55c4) // und
+	b.u16(0)
+	b.end()
+
+	b.startFull("hdlr", 0, 0)
+	b.u32(0)
+	switch track.Type {
+	case TrackTypeVideo:
+		b.str("vide")
+		b.zeros(12)
+		b.str("VideoHandler\x00")
+	case TrackTypeAudio:
+		b.str("soun")
+		b.zeros(12)
+		b.str("SoundHandler\x00")
+	default:
+		return fmt.Errorf("unsupported track type: %d", track.Type)
+	}
+	b.end()
+
+	b.start("minf")
+	if track.Type == TrackTypeVideo {
+		b.startFull("vmhd", 0, 0x01)
+		b.zeros(8)
+		b.end()
+	} else {
+		b.startFull("smhd", 0, 0)
+		b.zeros(4)
+		b.end()
+	}
+
+	b.start("dinf")
+	b.startFull("dref", 0, 0)
+	b.u32(1)
+	b.startFull("url ", 0, 0x01) // self contained
+	b.end()
+	b.end()
+	b.end()
+
+	b.start("stbl")
+	b.startFull("stsd", 0, 0)
+	b.u32(1)
+	if err := encodeSampleEntry(b, track); err != nil {
+		return err
+	}
+	b.end()
+	for _, boxType := range []string{"stts", "stsc", "stco"} {
+		b.startFull(boxType, 0, 0)
+		b.u32(0)
+		b.end()
+	}
+	b.startFull("stsz", 0, 0)
+	b.u32(0) // sample size
+	b.u32(0) // sample count
+	b.end()
+	b.end() // stbl
+
+	b.end() // minf
+	b.end() // mdia
+	b.end() // trak
+
+	return nil
+}
+
+func encodeSampleEntry(b *boxBuffer, track *Track) error {
+	switch {
+	case track.AVCConfig != nil:
+		b.start("avc1")
+		b.zeros(6)
+		b.u16(1) // data reference index
+		b.zeros(16)
+		b.u16(track.Width)
+		b.u16(track.Height)
+		b.u32(0x00480000) // 72dpi
+		b.u32(0x00480000) // 72dpi
+		b.u32(0)
+		b.u16(1) // frame count
+		b.zeros(32)
+		b.u16(0x0018) // depth
+		b.u16(0xffff)
+
+		var record bytes.Buffer
+		if err := avc.EncodeDecoderConfigurationRecord(&record, track.AVCConfig); err != nil {
+			return err
+		}
+		b.start("avcC")
+		b.bytes(record.Bytes())
+		b.end()
+
+		b.end()
+
+	case track.AACConfig != nil:
+		var config bytes.Buffer
+		if err := aac.EncodeAudioSpecificConfig(&config, track.AACConfig); err != nil {
+			return err
+		}
+
+		channels := track.AACConfig.Channels()
+		if channels == 0 {
+			channels = 2
+		}
+
+		b.start("mp4a")
+		b.zeros(6)
+		b.u16(1) // data reference index
+		b.zeros(8)
+		b.u16(uint16(channels))
+		b.u16(16) // sample size
+		b.zeros(4)
+		b.u32(track.AACConfig.SamplingFrequency << 16)
+
+		b.startFull("esds", 0, 0)
+		encodeESDescriptor(b, config.Bytes())
+		b.end()
+
+		b.end()
+
+	default:
+		return fmt.Errorf("codec configuration is not set: Track = %d", track.ID)
+	}
+
+	return nil
+}
+
+// ISO/IEC 14496-1 descriptors
+const (
+	esDescrTag            = 0x03
+	decoderConfigDescrTag = 0x04
+	decSpecificInfoTag    = 0x05
+	slConfigDescrTag      = 0x06
+)
+
+func encodeESDescriptor(b *boxBuffer, decoderSpecificInfo []byte) {
+	decSpecificInfoLen := len(decoderSpecificInfo)
+	decoderConfigLen := 13 + 2 + decSpecificInfoLen
+	esLen := 3 + 2 + decoderConfigLen + 3
+
+	b.u8(esDescrTag)
+	b.u8(byte(esLen))
+	b.u16(0) // ES_ID
+	b.u8(0)  // flags
+
+	b.u8(decoderConfigDescrTag)
+	b.u8(byte(decoderConfigLen))
+	b.u8(0x40)           // Audio ISO/IEC 14496-3
+	b.u8(0x05<<2 | 0x01) // audio stream
+	b.u24(0)             // buffer size
+	b.u32(0)             // max bitrate
+	b.u32(0)             // avg bitrate
+
+	b.u8(decSpecificInfoTag)
+	b.u8(byte(decSpecificInfoLen))
+	b.bytes(decoderSpecificInfo)
+
+	b.u8(slConfigDescrTag)
+	b.u8(1)
+	b.u8(0x02) // predefined (MP4)
+}
+
+// EncodeFragment writes a moof box and a mdat box which contain samples of a track.
+func EncodeFragment(w io.Writer, sequenceNumber uint32, trackID uint32, baseMediaDecodeTime uint64, samples []*Sample) error {
+	var b boxBuffer
+
+	b.start("moof")
+
+	b.startFull("mfhd", 0, 0)
+	b.u32(sequenceNumber)
+	b.end()
+
+	b.start("traf")
+
+	b.startFull("tfhd", 0, 0x020000) // default-base-is-moof
+	b.u32(trackID)
+	b.end()
+
+	b.startFull("tfdt", 1, 0)
+	b.u64(baseMediaDecodeTime)
+	b.end()
+
+	// data offset, sample duration, size, flags and composition time offset
+	b.startFull("trun", 1, 0x000001|0x000100|0x000200|0x000400|0x000800)
+	b.u32(uint32(len(samples)))
+	dataOffsetPos := b.offset()
+	b.u32(0) // data offset (set later)
+	for _, sample := range samples {
+		b.u32(sample.Duration)
+		b.u32(uint32(len(sample.Data)))
+		if sample.Keyframe {
+			b.u32(sampleFlagsKeyframe)
+		} else {
+			b.u32(sampleFlagsNonKeyframe)
+		}
+		b.u32(uint32(sample.CompositionTimeOffset))
+	}
+	b.end()
+
+	b.end() // traf
+	b.end() // moof
+
+	b.putU32At(dataOffsetPos, uint32(b.offset()+8)) // moof size + mdat header
+
+	var mdatSize int
+	for _, sample := range samples {
+		mdatSize += len(sample.Data)
+	}
+	b.u32(uint32(8 + mdatSize))
+	b.str("mdat")
+
+	if _, err := w.Write(b.b); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		if _, err := w.Write(sample.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
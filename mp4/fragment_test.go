@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+)
+
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+// findBox returns a payload of the box specified by a path. Header sizes of container-like boxes are given by skips.
+func findBox(t *testing.T, b []byte, path ...string) []byte {
+	skips := map[string]int{"stsd": 8, "avc1": 78, "mp4a": 28}
+
+	for i, boxType := range path {
+		found := false
+		for len(b) >= 8 {
+			size := int(binary.BigEndian.Uint32(b))
+			require.True(t, size >= 8 && size <= len(b), "invalid box size: %s", string(b[4:8]))
+			if string(b[4:8]) == boxType {
+				b = b[8:size]
+				found = true
+				break
+			}
+			b = b[size:]
+		}
+		require.True(t, found, "box is not found: %v", path[:i+1])
+		if i != len(path)-1 {
+			b = b[skips[boxType]:]
+		}
+	}
+	return b
+}
+
+func TestEncodeInitSegment(t *testing.T) {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	video, err := NewVideoTrack(1, 1000, record)
+	require.Nil(t, err)
+	require.Equal(t, uint16(1280), video.Width)
+	require.Equal(t, uint16(720), video.Height)
+	require.Equal(t, "avc1.64001f", video.Codec())
+
+	audio := NewAudioTrack(2, 1000, &aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 4,
+		SamplingFrequency:      44100,
+		ChannelConfiguration:   2,
+	})
+	require.Equal(t, "mp4a.40.2", audio.Codec())
+
+	var buf bytes.Buffer
+	err = EncodeInitSegment(&buf, []*Track{video, audio})
+	require.Nil(t, err)
+
+	b := buf.Bytes()
+	require.Equal(t, []byte("iso6"), findBox(t, b, "ftyp")[:4])
+
+	avcC := findBox(t, b, "moov", "trak", "mdia", "minf", "stbl", "stsd", "avc1", "avcC")
+	var actual avc.DecoderConfigurationRecord
+	err = avc.DecodeDecoderConfigurationRecord(bytes.NewReader(avcC), &actual)
+	require.Nil(t, err)
+	require.Equal(t, record, &actual)
+
+	trex := findBox(t, b, "moov", "mvex", "trex")
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(trex[4:]))
+}
+
+func TestEncodeFragment(t *testing.T) {
+	samples := []*Sample{
+		{Duration: 40, Keyframe: true, Data: []byte{0x00, 0x00, 0x00, 0x01, 0x65}},
+		{Duration: 40, CompositionTimeOffset: 80, Data: []byte{0x00, 0x00, 0x00, 0x01, 0x41}},
+	}
+
+	var buf bytes.Buffer
+	err := EncodeFragment(&buf, 3, 1, 1000, samples)
+	require.Nil(t, err)
+
+	b := buf.Bytes()
+	require.Equal(t, uint32(3), binary.BigEndian.Uint32(findBox(t, b, "moof", "mfhd")[4:]))
+	require.Equal(t, uint64(1000), binary.BigEndian.Uint64(findBox(t, b, "moof", "traf", "tfdt")[4:]))
+
+	trun := findBox(t, b, "moof", "traf", "trun")
+	require.Equal(t, uint32(2), binary.BigEndian.Uint32(trun[4:]))
+	dataOffset := binary.BigEndian.Uint32(trun[8:])
+	require.Equal(t, []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x00, 0x00, 0x00, 0x01, 0x41}, b[dataOffset:])
+	require.Equal(t, uint32(80), binary.BigEndian.Uint32(trun[12+16+12:]))
+
+	require.Equal(t, b[dataOffset:], findBox(t, b, "mdat"))
+}
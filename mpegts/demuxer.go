@@ -0,0 +1,588 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mpegts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+var ErrContinuity = errors.New("continuity counter is discontinuous")
+
+// Demuxer reads H.264 (Annex B) and AAC (ADTS) streams in MPEG-TS as FLV tags.
+// Sequence headers are generated from SPS/PPS and ADTS headers, and emitted when they are changed.
+// Timestamps are unwrapped from 33bits and rebased so that the first one becomes 0.
+// Broken PESs and sections are dropped, and demuxing continues.
+type Demuxer struct {
+	// OnError is called with an error of a dropped PES or section if set.
+	OnError func(pid uint16, err error)
+
+	r   io.Reader
+	pkt [PacketSize]byte
+	eof bool
+
+	pmtPID  uint16
+	streams map[uint16]StreamType
+	pes     map[uint16]*pesBuffer
+	cc      map[uint16]byte // the last continuity counters of streams
+
+	sps, pps     []byte
+	aacConfig    *aac.AudioSpecificConfig
+	adtsRest     []byte // a partial ADTS frame which continues in the next PES
+	adtsRestTime int64  // 90kHz, unwrapped
+	baseTime     int64  // 90kHz
+	hasBase      bool
+	lastTime     int64 // 90kHz, unwrapped
+	hasLast      bool
+	queue        []*tag.FlvTag
+}
+
+type pesBuffer struct {
+	buf    bytes.Buffer
+	length int // 0 means unbounded
+}
+
+type pesPacket struct {
+	pts, dts int64 // 90kHz, not unwrapped
+	hasPTS   bool
+	payload  []byte
+}
+
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{
+		r:       r,
+		pmtPID:  0xffff,
+		streams: make(map[uint16]StreamType),
+		pes:     make(map[uint16]*pesBuffer),
+		cc:      make(map[uint16]byte),
+	}
+}
+
+// Flags returns FLV header flags for streams declared in the PMT.
+func (d *Demuxer) Flags() flv.Flags {
+	var flags flv.Flags
+	for _, streamType := range d.streams {
+		switch streamType {
+		case StreamTypeH264:
+			flags |= flv.FlagsVideo
+		case StreamTypeADTS:
+			flags |= flv.FlagsAudio
+		}
+	}
+	return flags
+}
+
+// Decode reads a next tag. io.EOF is returned after all packets are read.
+func (d *Demuxer) Decode(flvTag *tag.FlvTag) error {
+	for len(d.queue) == 0 {
+		if d.eof {
+			return io.EOF
+		}
+		if err := d.readPacket(); err != nil {
+			if err != io.EOF {
+				return err
+			}
+			d.eof = true
+			d.flushAll()
+		}
+	}
+
+	*flvTag = *d.queue[0]
+	d.queue = d.queue[1:]
+	return nil
+}
+
+func (d *Demuxer) readPacket() error {
+	pkt := d.pkt[:]
+	if _, err := io.ReadFull(d.r, pkt); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF // ignores a truncated packet at the end
+		}
+		return err
+	}
+
+	// resynchronize
+	for pkt[0] != syncByte {
+		i := bytes.IndexByte(pkt[1:], syncByte)
+		if i < 0 {
+			if _, err := io.ReadFull(d.r, pkt); err != nil {
+				if err == io.ErrUnexpectedEOF {
+					return io.EOF
+				}
+				return err
+			}
+			continue
+		}
+		n := copy(pkt, pkt[i+1:])
+		if _, err := io.ReadFull(d.r, pkt[n:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return io.EOF
+			}
+			return err
+		}
+	}
+
+	unitStart := pkt[1]&0x40 != 0
+	pid := uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+	adaptationFieldControl := (pkt[3] >> 4) & 0x03
+	continuityCounter := pkt[3] & 0x0f
+
+	payload := pkt[4:]
+	discontinuity := false
+	if adaptationFieldControl&0x02 != 0 {
+		afLen := int(payload[0])
+		if afLen+1 > len(payload) {
+			return nil // broken packet
+		}
+		discontinuity = afLen > 0 && payload[1]&0x80 != 0
+		payload = payload[afLen+1:]
+	}
+	if adaptationFieldControl&0x01 == 0 {
+		return nil // no payload
+	}
+
+	switch {
+	case pid == PIDPAT:
+		d.handleSection(pid, payload, unitStart, d.parsePAT)
+		return nil
+	case pid == d.pmtPID:
+		d.handleSection(pid, payload, unitStart, d.parsePMT)
+		return nil
+	}
+
+	if _, ok := d.streams[pid]; !ok {
+		return nil
+	}
+
+	last, ok := d.cc[pid]
+	d.cc[pid] = continuityCounter
+	if ok && !discontinuity {
+		if continuityCounter == last {
+			return nil // duplicated packet
+		}
+		if continuityCounter != (last+1)&0x0f {
+			// packets are lost
+			d.drop(pid, ErrContinuity)
+		}
+	}
+
+	if unitStart {
+		d.flush(pid)
+		if len(payload) < 6 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(payload[4:]))
+		buf := &pesBuffer{}
+		if length != 0 {
+			buf.length = 6 + length
+		}
+		d.pes[pid] = buf
+	}
+
+	buf, ok := d.pes[pid]
+	if !ok {
+		return nil // waits for the start of a PES
+	}
+	buf.buf.Write(payload)
+	if buf.length != 0 && buf.buf.Len() >= buf.length {
+		d.flush(pid)
+	}
+
+	return nil
+}
+
+// handleSection supports sections which fit in a packet (PAT/PMT). A broken section is dropped.
+func (d *Demuxer) handleSection(pid uint16, payload []byte, unitStart bool, parse func(section []byte) error) {
+	if !unitStart || len(payload) < 1 {
+		return
+	}
+	pointer := int(payload[0])
+	if 1+pointer+3 > len(payload) {
+		return
+	}
+	section := payload[1+pointer:]
+	sectionLength := int(binary.BigEndian.Uint16(section[1:]) & 0x0fff)
+	if 3+sectionLength > len(section) || sectionLength < 9 {
+		return
+	}
+	section = section[:3+sectionLength]
+	if crc32MPEG2(section) != 0 {
+		d.reportError(pid, fmt.Errorf("CRC mismatch: TableID = %d", section[0]))
+		return
+	}
+
+	if err := parse(section[8 : len(section)-4]); err != nil {
+		d.reportError(pid, fmt.Errorf("failed to parse section: TableID = %d, %w", section[0], err))
+	}
+}
+
+func (d *Demuxer) parsePAT(b []byte) error {
+	for ; len(b) >= 4; b = b[4:] {
+		programNumber := binary.BigEndian.Uint16(b)
+		if programNumber == 0 {
+			continue // network PID
+		}
+		d.pmtPID = binary.BigEndian.Uint16(b[2:]) & 0x1fff
+		return nil // uses the first program
+	}
+	return nil
+}
+
+func (d *Demuxer) parsePMT(b []byte) error {
+	if len(b) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+	programInfoLength := int(binary.BigEndian.Uint16(b[2:]) & 0x0fff)
+	if 4+programInfoLength > len(b) {
+		return io.ErrUnexpectedEOF
+	}
+	b = b[4+programInfoLength:]
+
+	for len(b) >= 5 {
+		streamType := StreamType(b[0])
+		pid := binary.BigEndian.Uint16(b[1:]) & 0x1fff
+		esInfoLength := int(binary.BigEndian.Uint16(b[3:]) & 0x0fff)
+		if 5+esInfoLength > len(b) {
+			return io.ErrUnexpectedEOF
+		}
+		b = b[5+esInfoLength:]
+
+		switch streamType {
+		case StreamTypeH264, StreamTypeADTS:
+			d.streams[pid] = streamType
+		}
+	}
+
+	return nil
+}
+
+// flushAll flushes pending PESs at the end of the stream in order of their DTS (PTS if it is absent),
+// then their PIDs, so that the order of tags is deterministic.
+func (d *Demuxer) flushAll() {
+	pids := make([]uint16, 0, len(d.pes))
+	times := make(map[uint16]int64, len(d.pes))
+	for pid, buf := range d.pes {
+		pids = append(pids, pid)
+		if pes, err := parsePES(buf.buf.Bytes()); err == nil && pes.hasPTS {
+			times[pid] = unwrapNear(d.lastTime, pes.dts)
+		}
+	}
+	sort.Slice(pids, func(i, j int) bool {
+		if times[pids[i]] != times[pids[j]] {
+			return times[pids[i]] < times[pids[j]]
+		}
+		return pids[i] < pids[j]
+	})
+
+	for _, pid := range pids {
+		d.flush(pid)
+	}
+}
+
+// flush demuxes a pending PES. A broken PES is dropped.
+func (d *Demuxer) flush(pid uint16) {
+	buf, ok := d.pes[pid]
+	if !ok {
+		return
+	}
+	delete(d.pes, pid)
+
+	pes, err := parsePES(buf.buf.Bytes())
+	if err != nil {
+		d.drop(pid, err)
+		return
+	}
+	if !pes.hasPTS {
+		return
+	}
+
+	switch d.streams[pid] {
+	case StreamTypeH264:
+		err = d.handleVideo(pes)
+	case StreamTypeADTS:
+		err = d.handleAudio(pes)
+	}
+	if err != nil {
+		d.drop(pid, err)
+	}
+}
+
+// drop discards a pending PES and a partial frame of the stream.
+func (d *Demuxer) drop(pid uint16, err error) {
+	delete(d.pes, pid)
+	if d.streams[pid] == StreamTypeADTS {
+		d.adtsRest = nil
+	}
+	d.reportError(pid, fmt.Errorf("dropped PES: PID = %d, %w", pid, err))
+}
+
+func (d *Demuxer) reportError(pid uint16, err error) {
+	if d.OnError != nil {
+		d.OnError(pid, err)
+	}
+}
+
+func parsePES(b []byte) (*pesPacket, error) {
+	if len(b) < 9 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if b[0] != 0x00 || b[1] != 0x00 || b[2] != 0x01 {
+		return nil, fmt.Errorf("invalid start code")
+	}
+
+	length := int(binary.BigEndian.Uint16(b[4:]))
+	if length != 0 && 6+length < len(b) {
+		b = b[:6+length]
+	}
+
+	flags := b[7]
+	headerDataLength := int(b[8])
+	if 9+headerDataLength > len(b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	header := b[9 : 9+headerDataLength]
+
+	pes := &pesPacket{payload: b[9+headerDataLength:]}
+	if flags&0x80 != 0 && len(header) >= 5 {
+		pes.pts = decodeTimestamp(header)
+		pes.dts = pes.pts
+		pes.hasPTS = true
+	}
+	if flags&0x40 != 0 && len(header) >= 10 {
+		pes.dts = decodeTimestamp(header[5:])
+	}
+
+	return pes, nil
+}
+
+func decodeTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// unwrap extends a 33bits timestamp to the nearest value from the last one.
+func (d *Demuxer) unwrap(ts int64) int64 {
+	if !d.hasLast {
+		d.lastTime = ts
+		d.hasLast = true
+		return ts
+	}
+
+	d.lastTime = unwrapNear(d.lastTime, ts)
+	return d.lastTime
+}
+
+// unwrapNear extends a 33bits timestamp to the nearest value from last.
+func unwrapNear(last, ts int64) int64 {
+	const period = timestampMask + 1
+	ts += last - last&timestampMask
+	if ts-last > period/2 {
+		ts -= period
+	} else if last-ts > period/2 {
+		ts += period
+	}
+	return ts
+}
+
+// toMilliseconds converts an unwrapped timestamp into FLV timestamp.
+func (d *Demuxer) toMilliseconds(ts int64) uint32 {
+	if !d.hasBase {
+		d.baseTime = ts
+		d.hasBase = true
+	}
+	ms := (ts - d.baseTime) / 90
+	if ms < 0 {
+		return 0
+	}
+	return uint32(ms)
+}
+
+func (d *Demuxer) handleVideo(pes *pesPacket) error {
+	dts := d.unwrap(pes.dts)
+	pts := dts + (pes.pts-pes.dts)&timestampMask // PTS may be wrapped after DTS
+
+	var nalus [][]byte
+	keyframe := false
+	configChanged := false
+	for _, nalu := range avc.SplitAnnexB(pes.payload) {
+		switch avc.NALUnitTypeOf(nalu) {
+		case avc.NALUnitTypeAUD:
+			continue
+		case avc.NALUnitTypeSPS:
+			if !bytes.Equal(d.sps, nalu) {
+				d.sps = append([]byte(nil), nalu...)
+				configChanged = true
+			}
+			continue
+		case avc.NALUnitTypePPS:
+			if !bytes.Equal(d.pps, nalu) {
+				d.pps = append([]byte(nil), nalu...)
+				configChanged = true
+			}
+			continue
+		case avc.NALUnitTypeIDR:
+			keyframe = true
+		}
+		nalus = append(nalus, nalu)
+	}
+
+	timestamp := d.toMilliseconds(dts)
+
+	if configChanged && d.sps != nil && d.pps != nil {
+		record, err := avc.NewDecoderConfigurationRecord([][]byte{d.sps}, [][]byte{d.pps})
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := avc.EncodeDecoderConfigurationRecord(&buf, record); err != nil {
+			return err
+		}
+		d.queue = append(d.queue, &tag.FlvTag{
+			TagType:   tag.TagTypeVideo,
+			Timestamp: timestamp,
+			Data: &tag.VideoData{
+				FrameType:     tag.FrameTypeKeyFrame,
+				CodecID:       tag.CodecIDAVC,
+				AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+				Data:          &buf,
+			},
+		})
+	}
+
+	if len(nalus) == 0 || d.sps == nil || d.pps == nil {
+		return nil // frames before parameter sets cannot be decoded
+	}
+
+	frameType := tag.FrameTypeInterFrame
+	if keyframe {
+		frameType = tag.FrameTypeKeyFrame
+	}
+	d.queue = append(d.queue, &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:       frameType,
+			CodecID:         tag.CodecIDAVC,
+			AVCPacketType:   tag.AVCPacketTypeNALU,
+			CompositionTime: int32((pts - dts) / 90),
+			Data:            bytes.NewReader(avc.AppendAVCC(nil, nalus)),
+		},
+	})
+
+	return nil
+}
+
+func (d *Demuxer) handleAudio(pes *pesPacket) error {
+	pts := d.unwrap(pes.pts)
+
+	// PTS is of the first frame which starts in the PES, thus a frame carried from the previous PES
+	// keeps its own time
+	b := pes.payload
+	carried := d.adtsRest != nil
+	if carried {
+		b = append(d.adtsRest, b...)
+		d.adtsRest = nil
+	}
+	timeOf := func(i int, config *aac.AudioSpecificConfig) int64 {
+		if carried {
+			if i == 0 {
+				return d.adtsRestTime
+			}
+			i--
+		}
+		if i == 0 {
+			return pts
+		}
+		return pts + int64(i)*aac.SamplesPerFrame*ClockRate/int64(config.SamplingFrequency)
+	}
+
+	for i := 0; len(b) > 0; i++ {
+		header, err := aac.ParseADTSHeader(b)
+		if err == io.ErrUnexpectedEOF || (err == nil && header.FrameLength > len(b)) {
+			// continues in the next PES. The config of the previous frame is used for its time
+			d.adtsRest = append([]byte(nil), b...)
+			d.adtsRestTime = timeOf(i, d.aacConfig)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		frame := b[header.HeaderLength:header.FrameLength]
+		b = b[header.FrameLength:]
+
+		config := header.AudioSpecificConfig()
+		if config.SamplingFrequency == 0 {
+			return fmt.Errorf("invalid sampling frequency index: %d", header.SamplingFrequencyIndex)
+		}
+		frameTime := timeOf(i, config)
+		timestamp := d.toMilliseconds(frameTime)
+
+		if d.aacConfig == nil || *d.aacConfig != *config {
+			d.aacConfig = config
+
+			var buf bytes.Buffer
+			if err := aac.EncodeAudioSpecificConfig(&buf, config); err != nil {
+				return err
+			}
+			d.queue = append(d.queue, &tag.FlvTag{
+				TagType:   tag.TagTypeAudio,
+				Timestamp: timestamp,
+				Data:      tag.NewAACAudioData(tag.AACPacketTypeSequenceHeader, buf.Bytes()),
+			})
+		}
+
+		d.queue = append(d.queue, &tag.FlvTag{
+			TagType:   tag.TagTypeAudio,
+			Timestamp: timestamp,
+			Data:      tag.NewAACAudioData(tag.AACPacketTypeRaw, append([]byte(nil), frame...)),
+		})
+	}
+
+	return nil
+}
+
+// RemuxToFLV converts MPEG-TS into FLV.
+func RemuxToFLV(w io.Writer, r io.Reader) error {
+	d := NewDemuxer(r)
+
+	var enc *flv.Encoder
+	for {
+		var flvTag tag.FlvTag
+		if err := d.Decode(&flvTag); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		if enc == nil {
+			// the PMT has been parsed before the first tag
+			var err error
+			if enc, err = flv.NewEncoder(w, d.Flags()); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(&flvTag); err != nil {
+			return err
+		}
+	}
+
+	if enc == nil {
+		_, err := flv.NewEncoder(w, d.Flags())
+		return err
+	}
+	return nil
+}
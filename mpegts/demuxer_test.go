@@ -0,0 +1,313 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mpegts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/codec/aac"
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+type decodedTag struct {
+	TagType         tag.TagType
+	Timestamp       uint32
+	PacketType      uint8
+	Keyframe        bool
+	CompositionTime int32
+	Payload         []byte
+}
+
+func decodeAll(t *testing.T, d *Demuxer) []decodedTag {
+	var tags []decodedTag
+	for {
+		var flvTag tag.FlvTag
+		err := d.Decode(&flvTag)
+		if err == io.EOF {
+			return tags
+		}
+		require.Nil(t, err)
+
+		v := decodedTag{TagType: flvTag.TagType, Timestamp: flvTag.Timestamp}
+		switch data := flvTag.Data.(type) {
+		case *tag.VideoData:
+			v.PacketType = uint8(data.AVCPacketType)
+			v.Keyframe = data.FrameType == tag.FrameTypeKeyFrame
+			v.CompositionTime = data.CompositionTime
+			v.Payload, _ = io.ReadAll(data.Data)
+		case *tag.AudioData:
+			v.PacketType = uint8(data.AACPacketType)
+			v.Payload, _ = io.ReadAll(data.Data)
+		}
+		tags = append(tags, v)
+	}
+}
+
+func writeAACSequenceHeader(t *testing.T, m *Muxer, config *aac.AudioSpecificConfig) {
+	var buf bytes.Buffer
+	require.Nil(t, aac.EncodeAudioSpecificConfig(&buf, config))
+	require.Nil(t, m.WriteTag(&tag.FlvTag{
+		TagType: tag.TagTypeAudio,
+		Data: &tag.AudioData{
+			SoundFormat:   tag.SoundFormatAAC,
+			AACPacketType: tag.AACPacketTypeSequenceHeader,
+			Data:          &buf,
+		},
+	}))
+}
+
+func TestDemuxerRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	for _, flvTag := range testTags(t) {
+		require.Nil(t, m.WriteTag(flvTag))
+	}
+
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var recordBuf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xab}, 400)...)
+
+	d := NewDemuxer(&buf)
+	require.Equal(t, []decodedTag{
+		{tag.TagTypeVideo, 0, uint8(tag.AVCPacketTypeSequenceHeader), true, 0, recordBuf.Bytes()},
+		{tag.TagTypeVideo, 0, uint8(tag.AVCPacketTypeNALU), true, 40, avc.AppendAVCC(nil, [][]byte{idr})},
+		{tag.TagTypeAudio, 0, uint8(tag.AACPacketTypeSequenceHeader), false, 0, []byte{0x12, 0x10}},
+		{tag.TagTypeAudio, 0, uint8(tag.AACPacketTypeRaw), false, 0, []byte{0x21, 0x00, 0x49, 0x90}},
+	}, decodeAll(t, d))
+	require.Equal(t, flv.FlagsAudio|flv.FlagsVideo, d.Flags())
+}
+
+func TestDemuxerTimestampWraparound(t *testing.T) {
+	config := &aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 3,
+		SamplingFrequency:      48000,
+		ChannelConfiguration:   2,
+	}
+	header, err := aac.NewADTSHeader(config, 2)
+	require.Nil(t, err)
+	frame := append(aac.AppendADTSHeader(nil, header), 0x21, 0x00)
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	writeAACSequenceHeader(t, m, config)
+	// two frames in a PES, then the next PES wraps around
+	start := uint64(timestampMask - 90*10)
+	require.Nil(t, m.WriteAudio(start, append(append([]byte{}, frame...), frame...)))
+	require.Nil(t, m.WriteAudio(start+90*50, frame))
+
+	d := NewDemuxer(&buf)
+	var timestamps []uint32
+	for _, v := range decodeAll(t, d) {
+		if v.PacketType == uint8(tag.AACPacketTypeRaw) {
+			timestamps = append(timestamps, v.Timestamp)
+		}
+	}
+	require.Equal(t, []uint32{0, 21, 50}, timestamps)
+}
+
+func TestDemuxerADTSFrameAcrossPES(t *testing.T) {
+	config := &aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 3,
+		SamplingFrequency:      48000,
+		ChannelConfiguration:   2,
+	}
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		header, err := aac.NewADTSHeader(config, 4)
+		require.Nil(t, err)
+		frames = append(frames, append(aac.AppendADTSHeader(nil, header), 0x21, byte(i), 0x49, 0x90))
+	}
+	stream := bytes.Join(frames, nil)
+	split := len(frames[0]) + 3 // in the header of the second frame
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	writeAACSequenceHeader(t, m, config)
+	require.Nil(t, m.WriteAudio(90*1000, stream[:split]))
+	require.Nil(t, m.WriteAudio(90*1100, stream[split:]))
+
+	var raws []decodedTag
+	for _, v := range decodeAll(t, NewDemuxer(&buf)) {
+		if v.PacketType == uint8(tag.AACPacketTypeRaw) {
+			raws = append(raws, v)
+		}
+	}
+	require.Equal(t, []decodedTag{
+		{tag.TagTypeAudio, 0, uint8(tag.AACPacketTypeRaw), false, 0, frames[0][aac.ADTSHeaderLength:]},
+		{tag.TagTypeAudio, 21, uint8(tag.AACPacketTypeRaw), false, 0, frames[1][aac.ADTSHeaderLength:]},
+		{tag.TagTypeAudio, 100, uint8(tag.AACPacketTypeRaw), false, 0, frames[2][aac.ADTSHeaderLength:]},
+	}, raws)
+}
+
+func TestDemuxerFlushOrderAtEOF(t *testing.T) {
+	header, err := aac.NewADTSHeader(&aac.AudioSpecificConfig{
+		ObjectType:             aac.AudioObjectTypeAACLC,
+		SamplingFrequencyIndex: 3,
+		SamplingFrequency:      48000,
+		ChannelConfiguration:   2,
+	}, 2)
+	require.Nil(t, err)
+	audio := append(aac.AppendADTSHeader(nil, header), 0x21, 0x00)
+	video := avc.AppendAnnexB(nil, [][]byte{{0x65, 0xab}})
+
+	pes := func(streamID byte, pts uint64, payload []byte) *pesBuffer {
+		buf := &pesBuffer{}
+		buf.buf.Write(appendTimestamp([]byte{0x00, 0x00, 0x01, streamID, 0x00, 0x00, 0x80, 0x80, 0x05}, 0x02, pts))
+		buf.buf.Write(payload)
+		return buf
+	}
+
+	// the map of pending PESs is iterated in random order
+	for i := 0; i < 20; i++ {
+		d := NewDemuxer(bytes.NewReader(nil))
+		d.streams[PIDVideo] = StreamTypeH264
+		d.streams[PIDAudio] = StreamTypeADTS
+		d.sps, d.pps = testSPS, testPPS
+		d.pes[PIDVideo] = pes(streamIDVideo, 90*20, video)
+		d.pes[PIDAudio] = pes(streamIDAudio, 90*10, audio)
+
+		var order []tag.TagType
+		var timestamps []uint32
+		for _, v := range decodeAll(t, d) {
+			order = append(order, v.TagType)
+			timestamps = append(timestamps, v.Timestamp)
+		}
+		require.Equal(t, []tag.TagType{tag.TagTypeAudio, tag.TagTypeAudio, tag.TagTypeVideo}, order)
+		require.Equal(t, []uint32{0, 0, 10}, timestamps)
+	}
+}
+
+func TestDemuxerCorruptedPacket(t *testing.T) {
+	annexB := func(nalus ...[]byte) []byte {
+		var b []byte
+		for _, nalu := range nalus {
+			b = append(append(b, 0x00, 0x00, 0x00, 0x01), nalu...)
+		}
+		return b
+	}
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xab}, 400)...) // spans 3 packets
+
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	require.Nil(t, m.WriteTag(testTags(t)[0])) // sequence header
+	for i := uint64(0); i < 3; i++ {
+		require.Nil(t, m.WriteVideo(90*40*i, 90*40*i, true, annexB(testSPS, testPPS, idr)))
+	}
+	stream := buf.Bytes()
+
+	// nth returns an index of the n-th packet of the PID which starts a unit
+	nth := func(pid uint16, n int) int {
+		for i := 0; i < len(stream); i += PacketSize {
+			pkt := stream[i:]
+			if pkt[1]&0x40 != 0 && uint16(pkt[1]&0x1f)<<8|uint16(pkt[2]) == pid {
+				if n == 0 {
+					return i
+				}
+				n--
+			}
+		}
+		require.FailNow(t, "not found")
+		return 0
+	}
+	payloadOffset := func(i int) int {
+		if stream[i+3]&0x20 != 0 {
+			return i + 4 + 1 + int(stream[i+4])
+		}
+		return i + 4
+	}
+
+	type testCase struct {
+		Name       string
+		Corrupt    func(b []byte) []byte
+		Timestamps []uint32
+	}
+
+	testCases := []testCase{
+		{
+			Name: "BrokenPES",
+			Corrupt: func(b []byte) []byte {
+				b[payloadOffset(nth(PIDVideo, 1))] = 0xff // start code
+				return b
+			},
+			Timestamps: []uint32{0, 80},
+		},
+		{
+			Name: "LostPacket",
+			Corrupt: func(b []byte) []byte {
+				i := nth(PIDVideo, 1) + PacketSize
+				return append(b[:i:i], b[i+PacketSize:]...)
+			},
+			Timestamps: []uint32{0, 80},
+		},
+		{
+			Name: "BrokenPAT",
+			Corrupt: func(b []byte) []byte {
+				b[payloadOffset(nth(PIDPAT, 1))+5] ^= 0xff
+				return b
+			},
+			Timestamps: []uint32{0, 40, 80},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			b := tc.Corrupt(append([]byte(nil), stream...))
+
+			var errs []error
+			d := NewDemuxer(bytes.NewReader(b))
+			d.OnError = func(pid uint16, err error) {
+				errs = append(errs, err)
+			}
+
+			var timestamps []uint32
+			for _, v := range decodeAll(t, d) {
+				if v.PacketType == uint8(tag.AVCPacketTypeNALU) {
+					timestamps = append(timestamps, v.Timestamp)
+				}
+			}
+			require.Equal(t, tc.Timestamps, timestamps)
+			require.Equal(t, 1, len(errs))
+		})
+	}
+}
+
+func TestRemuxToFLV(t *testing.T) {
+	var ts bytes.Buffer
+	m := NewMuxer(&ts)
+	for _, flvTag := range testTags(t) {
+		require.Nil(t, m.WriteTag(flvTag))
+	}
+
+	var buf bytes.Buffer
+	err := RemuxToFLV(&buf, &ts)
+	require.Nil(t, err)
+
+	dec, err := flv.NewDecoder(&buf)
+	require.Nil(t, err)
+	require.Equal(t, flv.FlagsAudio|flv.FlagsVideo, dec.Header().Flags)
+
+	var flvTag tag.FlvTag
+	err = dec.Decode(&flvTag)
+	require.Nil(t, err)
+	require.Equal(t, tag.AVCPacketTypeSequenceHeader, flvTag.Data.(*tag.VideoData).AVCPacketType)
+}
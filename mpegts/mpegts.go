@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mpegts
+
+const PacketSize = 188
+
+const syncByte = 0x47
+
+// ClockRate is a frequency of PTS/DTS.
+const ClockRate = 90000
+
+// PTS/DTS are 33bits
+const timestampMask = (1 << 33) - 1
+
+const (
+	PIDPAT   uint16 = 0x0000
+	PIDPMT   uint16 = 0x1000
+	PIDVideo uint16 = 0x0100
+	PIDAudio uint16 = 0x0101
+)
+
+type StreamType uint8
+
+const (
+	StreamTypeADTS StreamType = 0x0f
+	StreamTypeH264 StreamType = 0x1b
+)
+
+const (
+	streamIDAudio = 0xc0
+	streamIDVideo = 0xe0
+)
+
+const (
+	tableIDPAT = 0x00
+	tableIDPMT = 0x02
+)
+
+const programNumber = 1
+
+// ========================================
+// CRC32/MPEG-2
+
+var crcTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc32MPEG2(b []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, v := range b {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^v]
+	}
+	return crc
+}
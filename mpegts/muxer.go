@@ -0,0 +1,316 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mpegts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/yutopp/go-flv/es"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// Muxer remuxes FLV tags (H.264/AAC) into MPEG-TS packets.
+type Muxer struct {
+	w io.Writer
+
+	video es.AnnexBConverter
+	audio es.ADTSConverter
+
+	tablesWritten bool
+	pmtVersion    uint8
+	hasVideo      bool // declared in the current PMT
+	hasAudio      bool // declared in the current PMT
+
+	continuityCounters map[uint16]uint8
+
+	pkt [PacketSize]byte
+}
+
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{
+		w:                  w,
+		video:              es.AnnexBConverter{InsertAUD: true},
+		continuityCounters: make(map[uint16]uint8),
+	}
+}
+
+// Reset switches an output. PAT/PMT are written again before the next packet.
+// Codec configurations are kept so that a stream can be split into segments.
+func (m *Muxer) Reset(w io.Writer) {
+	m.w = w
+	m.tablesWritten = false
+}
+
+// HasVideo reports whether an AVC sequence header has been received.
+func (m *Muxer) HasVideo() bool {
+	return m.video.CodecID() == tag.CodecIDAVC
+}
+
+// HasAudio reports whether an AAC sequence header has been received.
+func (m *Muxer) HasAudio() bool {
+	return m.audio.Config() != nil
+}
+
+// WriteTag writes a tag. Sequence headers update configurations and script data is ignored.
+func (m *Muxer) WriteTag(flvTag *tag.FlvTag) error {
+	switch data := flvTag.Data.(type) {
+	case *tag.AudioData:
+		return m.writeAudioData(flvTag.Timestamp, data)
+	case *tag.VideoData:
+		return m.writeVideoData(flvTag.Timestamp, data)
+	case *tag.ScriptData, *tag.UnknownData:
+		return nil
+	default:
+		return fmt.Errorf("unexpected data is set: %T", flvTag.Data)
+	}
+}
+
+func (m *Muxer) writeAudioData(timestamp uint32, audioData *tag.AudioData) error {
+	frame, err := m.audio.Convert(audioData)
+	if err != nil || frame == nil {
+		return err
+	}
+
+	pts := uint64(timestamp) * ClockRate / 1000
+	return m.WriteAudio(pts, frame)
+}
+
+func (m *Muxer) writeVideoData(timestamp uint32, videoData *tag.VideoData) error {
+	if videoData.CodecID != tag.CodecIDAVC {
+		return fmt.Errorf("unsupported video codec: %+v", videoData.CodecID)
+	}
+
+	au, err := m.video.Convert(videoData)
+	if err != nil || au == nil {
+		return err
+	}
+
+	dts := uint64(timestamp) * ClockRate / 1000
+	pts := uint64(int64(timestamp)+int64(videoData.CompositionTime)) * ClockRate / 1000
+	return m.WriteVideo(dts, pts, videoData.FrameType == tag.FrameTypeKeyFrame, au)
+}
+
+// WriteVideo writes an H.264 access unit in Annex B format. Timestamps are in 90kHz.
+func (m *Muxer) WriteVideo(dts, pts uint64, keyframe bool, au []byte) error {
+	if err := m.writeTablesIfNeeded(keyframe); err != nil {
+		return err
+	}
+
+	pcr := dts
+	return m.writePES(PIDVideo, streamIDVideo, pts, &dts, keyframe, &pcr, au)
+}
+
+// WriteAudio writes ADTS frames. A timestamp is in 90kHz.
+func (m *Muxer) WriteAudio(pts uint64, frames []byte) error {
+	if err := m.writeTablesIfNeeded(false); err != nil {
+		return err
+	}
+
+	var pcr *uint64
+	if !m.hasVideo {
+		pcr = &pts
+	}
+	return m.writePES(PIDAudio, streamIDAudio, pts, nil, !m.hasVideo, pcr, frames)
+}
+
+func (m *Muxer) writeTablesIfNeeded(keyframe bool) error {
+	hasVideo, hasAudio := m.HasVideo(), m.HasAudio()
+	changed := hasVideo != m.hasVideo || hasAudio != m.hasAudio
+	if m.tablesWritten && !changed && !keyframe {
+		return nil
+	}
+
+	if changed {
+		if m.tablesWritten {
+			m.pmtVersion = (m.pmtVersion + 1) & 0x1f
+		}
+		m.hasVideo, m.hasAudio = hasVideo, hasAudio
+	}
+
+	if err := m.writePAT(); err != nil {
+		return err
+	}
+	if err := m.writePMT(); err != nil {
+		return err
+	}
+	m.tablesWritten = true
+
+	return nil
+}
+
+func (m *Muxer) writePAT() error {
+	section := []byte{
+		tableIDPAT,
+		0x00, 0x00, // section length (set later)
+		0x00, 0x01, // transport stream id
+		0xc1,       // reserved, version 0, current
+		0x00, 0x00, // section number, last section number
+		byte(programNumber >> 8), byte(programNumber & 0xff),
+		0xe0 | byte(PIDPMT>>8), byte(PIDPMT & 0xff),
+	}
+	return m.writeSection(PIDPAT, section)
+}
+
+func (m *Muxer) writePMT() error {
+	pcrPID := PIDAudio
+	if m.hasVideo {
+		pcrPID = PIDVideo
+	}
+
+	section := []byte{
+		tableIDPMT,
+		0x00, 0x00, // section length (set later)
+		byte(programNumber >> 8), byte(programNumber & 0xff),
+		0xc1 | m.pmtVersion<<1, // reserved, version, current
+		0x00, 0x00,             // section number, last section number
+		0xe0 | byte(pcrPID>>8), byte(pcrPID & 0xff),
+		0xf0, 0x00, // program info length 0
+	}
+	if m.hasVideo {
+		section = append(section, byte(StreamTypeH264), 0xe0|byte(PIDVideo>>8), byte(PIDVideo&0xff), 0xf0, 0x00)
+	}
+	if m.hasAudio {
+		section = append(section, byte(StreamTypeADTS), 0xe0|byte(PIDAudio>>8), byte(PIDAudio&0xff), 0xf0, 0x00)
+	}
+	return m.writeSection(PIDPMT, section)
+}
+
+func (m *Muxer) writeSection(pid uint16, section []byte) error {
+	sectionLength := len(section) - 3 + 4 // excludes the first 3 bytes, includes CRC
+	section[1] = 0xb0 | byte(sectionLength>>8)&0x0f
+	section[2] = byte(sectionLength)
+
+	ui32 := make([]byte, 4)
+	binary.BigEndian.PutUint32(ui32, crc32MPEG2(section))
+	section = append(section, ui32...)
+
+	pkt := m.pkt[:]
+	m.writePacketHeader(pkt, pid, true, false)
+	pkt[4] = 0x00 // pointer field
+	n := copy(pkt[5:], section)
+	for i := 5 + n; i < len(pkt); i++ {
+		pkt[i] = 0xff
+	}
+
+	_, err := m.w.Write(pkt)
+	return err
+}
+
+func (m *Muxer) writePES(pid uint16, streamID byte, pts uint64, dts *uint64, randomAccess bool, pcr *uint64, payload []byte) error {
+	header := make([]byte, 0, 19)
+	header = append(header, 0x00, 0x00, 0x01, streamID)
+
+	headerDataLength := 5
+	flags := byte(0x80) // PTS only
+	if dts != nil && *dts != pts {
+		headerDataLength = 10
+		flags = 0xc0 // PTS and DTS
+	}
+
+	pesLength := 3 + headerDataLength + len(payload)
+	if pesLength > 0xffff {
+		pesLength = 0 // unbounded (allowed for video)
+	}
+	header = append(header, byte(pesLength>>8), byte(pesLength))
+	header = append(header, 0x80, flags, byte(headerDataLength))
+	header = appendTimestamp(header, flags>>4, pts)
+	if headerDataLength == 10 {
+		header = appendTimestamp(header, 0x01, *dts)
+	}
+
+	return m.writePackets(pid, header, payload, randomAccess, pcr)
+}
+
+func appendTimestamp(b []byte, prefix byte, ts uint64) []byte {
+	ts &= timestampMask
+	return append(b,
+		prefix<<4|byte(ts>>29)&0x0e|0x01,
+		byte(ts>>22),
+		byte(ts>>14)|0x01,
+		byte(ts>>7),
+		byte(ts<<1)|0x01,
+	)
+}
+
+func (m *Muxer) writePackets(pid uint16, header, payload []byte, randomAccess bool, pcr *uint64) error {
+	for first := true; len(header)+len(payload) > 0; first = false {
+		pkt := m.pkt[:]
+
+		var af [PacketSize]byte
+		afLen := 0 // includes the length byte
+		if first && (randomAccess || pcr != nil) {
+			afLen = 2
+			if randomAccess {
+				af[1] |= 0x40
+			}
+			if pcr != nil {
+				af[1] |= 0x10
+				base := *pcr & timestampMask
+				af[2] = byte(base >> 25)
+				af[3] = byte(base >> 17)
+				af[4] = byte(base >> 9)
+				af[5] = byte(base >> 1)
+				af[6] = byte(base<<7) | 0x7e // reserved, extension 0
+				af[7] = 0x00
+				afLen += 6
+			}
+		}
+
+		remain := len(header) + len(payload)
+		if space := PacketSize - 4 - afLen; remain < space {
+			stuffing := space - remain
+			if afLen == 0 {
+				afLen = 1 // only the length byte
+				stuffing--
+				if stuffing > 0 {
+					afLen++ // flags
+					stuffing--
+				}
+			}
+			for i := 0; i < stuffing; i++ {
+				af[afLen+i] = 0xff
+			}
+			afLen += stuffing
+		}
+		if afLen > 0 {
+			af[0] = byte(afLen - 1)
+		}
+
+		m.writePacketHeader(pkt, pid, first, afLen > 0)
+		copy(pkt[4:], af[:afLen])
+
+		body := pkt[4+afLen:]
+		n := copy(body, header)
+		header = header[n:]
+		payload = payload[copy(body[n:], payload):]
+
+		if _, err := m.w.Write(pkt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Muxer) writePacketHeader(pkt []byte, pid uint16, unitStart bool, hasAdaptationField bool) {
+	cc := m.continuityCounters[pid]
+	m.continuityCounters[pid] = (cc + 1) & 0x0f
+
+	pkt[0] = syncByte
+	pkt[1] = byte(pid>>8) & 0x1f
+	if unitStart {
+		pkt[1] |= 0x40
+	}
+	pkt[2] = byte(pid)
+	pkt[3] = 0x10 | cc // payload only
+	if hasAdaptationField {
+		pkt[3] |= 0x20
+	}
+}
@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package mpegts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv/codec/avc"
+	"github.com/yutopp/go-flv/tag"
+)
+
+var testSPS = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00,
+	0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+}
+
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+func testTags(t *testing.T) []*tag.FlvTag {
+	record, err := avc.NewDecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+	require.Nil(t, err)
+	var recordBuf bytes.Buffer
+	require.Nil(t, avc.EncodeDecoderConfigurationRecord(&recordBuf, record))
+
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xab}, 400)...)
+
+	return []*tag.FlvTag{
+		{
+			TagType: tag.TagTypeVideo,
+			Data: &tag.VideoData{
+				FrameType:     tag.FrameTypeKeyFrame,
+				CodecID:       tag.CodecIDAVC,
+				AVCPacketType: tag.AVCPacketTypeSequenceHeader,
+				Data:          &recordBuf,
+			},
+		},
+		{
+			TagType: tag.TagTypeAudio,
+			Data: &tag.AudioData{
+				SoundFormat:   tag.SoundFormatAAC,
+				AACPacketType: tag.AACPacketTypeSequenceHeader,
+				Data:          bytes.NewReader([]byte{0x12, 0x10}),
+			},
+		},
+		{
+			TagType:   tag.TagTypeVideo,
+			Timestamp: 1000,
+			Data: &tag.VideoData{
+				FrameType:       tag.FrameTypeKeyFrame,
+				CodecID:         tag.CodecIDAVC,
+				AVCPacketType:   tag.AVCPacketTypeNALU,
+				CompositionTime: 40,
+				Data:            bytes.NewReader(avc.AppendAVCC(nil, [][]byte{idr})),
+			},
+		},
+		{
+			TagType:   tag.TagTypeAudio,
+			Timestamp: 1000,
+			Data: &tag.AudioData{
+				SoundFormat:   tag.SoundFormatAAC,
+				AACPacketType: tag.AACPacketTypeRaw,
+				Data:          bytes.NewReader([]byte{0x21, 0x00, 0x49, 0x90}),
+			},
+		},
+	}
+}
+
+func TestMuxerWriteTag(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	for _, flvTag := range testTags(t) {
+		err := m.WriteTag(flvTag)
+		require.Nil(t, err)
+	}
+
+	b := buf.Bytes()
+	require.Equal(t, 0, len(b)%PacketSize)
+
+	var pids []uint16
+	for i := 0; i < len(b); i += PacketSize {
+		pkt := b[i : i+PacketSize]
+		require.Equal(t, byte(syncByte), pkt[0])
+		pids = append(pids, uint16(pkt[1]&0x1f)<<8|uint16(pkt[2]))
+	}
+	// PAT, PMT, video (3 packets), audio
+	require.Equal(t, []uint16{PIDPAT, PIDPMT, PIDVideo, PIDVideo, PIDVideo, PIDAudio}, pids)
+
+	// CRC of the whole section becomes 0
+	pat := b[5 : 5+3+int(b[7])]
+	require.Equal(t, uint32(0), crc32MPEG2(pat))
+	pmt := b[PacketSize+5 : PacketSize+5+3+int(b[PacketSize+7])]
+	require.Equal(t, uint32(0), crc32MPEG2(pmt))
+	require.Equal(t, byte(StreamTypeH264), pmt[12])
+	require.Equal(t, byte(StreamTypeADTS), pmt[17])
+
+	// video PES has a random access indicator and PCR
+	video := b[2*PacketSize:]
+	require.Equal(t, byte(0x40), video[1]&0x40)
+	require.Equal(t, byte(0x50), video[5]&0x50)
+	pes := video[4+1+int(video[4]):]
+	require.Equal(t, []byte{0x00, 0x00, 0x01, streamIDVideo}, pes[:4])
+	require.Equal(t, byte(0xc0), pes[7]) // PTS and DTS
+	require.Equal(t, int64(1040*90), decodeTimestamp(pes[9:14]))
+	require.Equal(t, int64(1000*90), decodeTimestamp(pes[14:19]))
+	// AUD and parameter sets are inserted before the IDR
+	require.Equal(t, []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x01, 0x67}, pes[19:30])
+
+	// audio PES is bounded and contains an ADTS frame
+	audio := b[5*PacketSize:]
+	pes = audio[4+1+int(audio[4]):]
+	require.Equal(t, []byte{0x00, 0x00, 0x01, streamIDAudio, 0x00, 0x13}, pes[:6])
+	require.Equal(t, byte(0x80), pes[7]) // PTS only
+	require.Equal(t, int64(1000*90), decodeTimestamp(pes[9:14]))
+	require.Equal(t, []byte{0xff, 0xf1}, pes[14:16])
+}
+
+func TestMuxerRejectsFrameWithoutSequenceHeader(t *testing.T) {
+	m := NewMuxer(&bytes.Buffer{})
+
+	tags := testTags(t)
+	err := m.WriteTag(tags[2])
+	require.EqualError(t, err, "AVC sequence header is not received")
+}
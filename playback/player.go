@@ -0,0 +1,299 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package playback releases tags of recorded streams in real time.
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// Clock is a source of time. It is replaced in tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+type Config struct {
+	// Clock defaults to SystemClock.
+	Clock Clock
+	// Speed is a factor of playback speed. Defaults to 1.0.
+	Speed float64
+	// Loop makes the player restart from the beginning at the end. The reader must be an io.Seeker.
+	// Timestamps continue over loops.
+	Loop bool
+	// StartAt skips tags before the offset from the first tag on the first pass. The playback starts
+	// at a video keyframe if the stream has video. Metadata and sequence headers are not skipped.
+	StartAt time.Duration
+}
+
+// videoProbeDuration is a limit of waiting for a video tag when the header declares video, since
+// header flags may be wrong. Audio tags are skipped meanwhile.
+const videoProbeDuration = 1 * time.Second
+
+// Player decodes tags and releases them according to their timestamps relative to the clock.
+// Deadlines are calculated from a fixed origin, so that waits do not accumulate drift.
+type Player struct {
+	r      io.Reader
+	config Config
+
+	dec       *flv.Decoder
+	prev      *tag.FlvTag
+	firstPass bool
+	started   bool
+
+	hasVideo     bool // a video tag is found
+	videoStarted bool // a video keyframe is released
+	probeStart   time.Duration
+	hasProbe     bool
+
+	first      time.Duration // timestamp of the first tag in the pass
+	hasFirst   bool
+	startAt    time.Duration // relative timestamp of the first released tag
+	loopOffset time.Duration
+	lastOut    time.Duration
+	lastDelta  time.Duration
+
+	origin    time.Time
+	hasOrigin bool
+}
+
+func NewPlayer(r io.Reader, config *Config) (*Player, error) {
+	var c Config
+	if config != nil {
+		c = *config
+	}
+	if c.Clock == nil {
+		c.Clock = SystemClock
+	}
+	if c.Speed == 0 {
+		c.Speed = 1.0
+	}
+	if c.Speed < 0 {
+		return nil, fmt.Errorf("speed must be positive: %f", c.Speed)
+	}
+	if _, ok := r.(io.Seeker); c.Loop && !ok {
+		return nil, fmt.Errorf("looping requires io.Seeker")
+	}
+
+	p := &Player{
+		r:         r,
+		config:    c,
+		firstPass: true,
+	}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Next decodes the next tag and waits until its time. Timestamp of the tag is rewritten to the
+// playback timeline, which starts from zero. The payload of the previous tag is drained.
+// It returns io.EOF at the end unless looping.
+func (p *Player) Next(ctx context.Context, flvTag *tag.FlvTag) error {
+	if p.prev != nil {
+		p.prev.Close()
+		p.prev = nil
+	}
+
+	for {
+		if err := p.dec.Decode(flvTag); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			if !p.config.Loop {
+				return io.EOF
+			}
+			if err := p.rewind(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !p.hasFirst {
+			p.first = p.dec.Time()
+			p.hasFirst = true
+		}
+		rel := p.dec.Time() - p.first
+		if flvTag.TagType == tag.TagTypeVideo {
+			p.hasVideo = true
+		}
+
+		if !p.started {
+			if isConfig(flvTag) {
+				// delivered immediately
+				flvTag.Timestamp = uint32(p.loopOffset.Milliseconds())
+				p.prev = flvTag
+				return nil
+			}
+			if !p.isStart(flvTag, rel) {
+				flvTag.Close()
+				continue
+			}
+			p.started = true
+			p.startAt = rel
+		}
+		if videoData, ok := flvTag.Data.(*tag.VideoData); ok && !videoData.IsSequenceHeader() && !p.videoStarted {
+			// video may be found after starting at audio
+			if videoData.FrameType != tag.FrameTypeKeyFrame {
+				flvTag.Close()
+				continue
+			}
+			p.videoStarted = true
+		}
+
+		out := rel - p.startAt + p.loopOffset
+		if out < p.loopOffset {
+			out = p.loopOffset // e.g. audio slightly before the start keyframe
+		}
+		if delta := out - p.lastOut; delta > 0 {
+			p.lastDelta = delta
+		}
+		if out > p.lastOut {
+			p.lastOut = out
+		}
+		flvTag.Timestamp = uint32(out.Milliseconds())
+		p.prev = flvTag
+
+		if err := p.wait(ctx, out); err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// All returns an iterator over tags released in time. An error other than io.EOF is yielded once
+// and stops the iteration. The tag is reused and valid only during the iteration.
+func (p *Player) All(ctx context.Context) iter.Seq2[*tag.FlvTag, error] {
+	return func(yield func(*tag.FlvTag, error) bool) {
+		var flvTag tag.FlvTag
+		for {
+			if err := p.Next(ctx, &flvTag); err != nil {
+				if err != io.EOF {
+					yield(nil, err)
+				}
+				return
+			}
+			if !yield(&flvTag, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (p *Player) open() error {
+	dec, err := flv.NewDecoderWithConfig(p.r, &flv.DecoderConfig{
+		UnwrapTimestamps: true,
+	})
+	if err != nil {
+		return err
+	}
+	p.dec = dec
+	p.hasFirst = false
+
+	return nil
+}
+
+func (p *Player) rewind() error {
+	if !p.started {
+		return fmt.Errorf("no tags to play: StartAt = %s", p.config.StartAt)
+	}
+
+	if _, err := p.r.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := p.open(); err != nil {
+		return err
+	}
+
+	// the next pass starts after the last tag
+	p.loopOffset = p.lastOut + p.lastDelta
+	p.lastOut = p.loopOffset
+	p.startAt = 0
+	p.firstPass = false
+
+	return nil
+}
+
+func (p *Player) isStart(flvTag *tag.FlvTag, rel time.Duration) bool {
+	if p.firstPass && rel < p.config.StartAt {
+		return false
+	}
+
+	if videoData, ok := flvTag.Data.(*tag.VideoData); ok {
+		return videoData.FrameType == tag.FrameTypeKeyFrame
+	}
+	if p.hasVideo {
+		return false
+	}
+	if p.dec.Header().Flags&flv.FlagsVideo == 0 {
+		return true
+	}
+
+	// header flags are not trusted. starts at audio if no video tag is found for a while
+	if !p.hasProbe {
+		p.probeStart = rel
+		p.hasProbe = true
+	}
+	return rel-p.probeStart >= videoProbeDuration
+}
+
+func (p *Player) wait(ctx context.Context, out time.Duration) error {
+	clock := p.config.Clock
+	if !p.hasOrigin {
+		p.origin = clock.Now()
+		p.hasOrigin = true
+	}
+
+	deadline := p.origin.Add(time.Duration(float64(out) / p.config.Speed))
+	d := deadline.Sub(clock.Now())
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isConfig(flvTag *tag.FlvTag) bool {
+	switch data := flvTag.Data.(type) {
+	case *tag.ScriptData:
+		return true
+	case *tag.VideoData:
+		return data.IsSequenceHeader()
+	case *tag.AudioData:
+		return data.IsSequenceHeader()
+	}
+	return false
+}
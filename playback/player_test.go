@@ -0,0 +1,252 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package playback
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-flv"
+	"github.com/yutopp/go-flv/tag"
+)
+
+// fakeClock advances immediately when waited.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func newVideoTag(timestamp uint32, frameType tag.FrameType, packetType tag.AVCPacketType) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeVideo,
+		Timestamp: timestamp,
+		Data: &tag.VideoData{
+			FrameType:     frameType,
+			CodecID:       tag.CodecIDAVC,
+			AVCPacketType: packetType,
+			Data:          bytes.NewReader([]byte{byte(timestamp)}),
+		},
+	}
+}
+
+func newAudioTag(timestamp uint32) *tag.FlvTag {
+	return &tag.FlvTag{
+		TagType:   tag.TagTypeAudio,
+		Timestamp: timestamp,
+		Data: &tag.AudioData{
+			SoundFormat: tag.SoundFormatMP3,
+			Data:        bytes.NewReader([]byte{byte(timestamp)}),
+		},
+	}
+}
+
+// newTestStream returns a stream: sequence header, keyframe(1000), inter(1040), keyframe(1080), inter(1120)
+func newTestStream(t *testing.T) *bytes.Reader {
+	var buf bytes.Buffer
+	enc, err := flv.NewEncoder(&buf, flv.FlagsVideo)
+	require.Nil(t, err)
+
+	for _, flvTag := range []*tag.FlvTag{
+		newVideoTag(1000, tag.FrameTypeKeyFrame, tag.AVCPacketTypeSequenceHeader),
+		newVideoTag(1000, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+		newVideoTag(1040, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+		newVideoTag(1080, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+		newVideoTag(1120, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+	} {
+		err := enc.Encode(flvTag)
+		require.Nil(t, err)
+	}
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestPlayer(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Config     Config
+		Count      int
+		Timestamps []uint32
+		Waits      []time.Duration
+	}
+
+	ms := time.Millisecond
+	testCases := []testCase{
+		{
+			Name:       "RealTime",
+			Count:      5,
+			Timestamps: []uint32{0, 0, 40, 80, 120},
+			Waits:      []time.Duration{40 * ms, 40 * ms, 40 * ms},
+		},
+		{
+			Name:       "Speed",
+			Config:     Config{Speed: 2},
+			Count:      5,
+			Timestamps: []uint32{0, 0, 40, 80, 120},
+			Waits:      []time.Duration{20 * ms, 20 * ms, 20 * ms},
+		},
+		{
+			Name:       "StartAt",
+			Config:     Config{StartAt: 50 * ms},
+			Count:      3,
+			Timestamps: []uint32{0, 0, 40}, // sequence header, keyframe(1080), inter(1120)
+			Waits:      []time.Duration{40 * ms},
+		},
+		{
+			Name:       "Loop",
+			Config:     Config{Loop: true},
+			Count:      8,
+			Timestamps: []uint32{0, 0, 40, 80, 120, 160, 160, 200},
+			Waits:      []time.Duration{40 * ms, 40 * ms, 40 * ms, 40 * ms, 40 * ms},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := &fakeClock{now: time.Unix(0, 0)}
+			config := tc.Config
+			config.Clock = clock
+
+			p, err := NewPlayer(newTestStream(t), &config)
+			require.Nil(t, err)
+
+			var timestamps []uint32
+			for flvTag, err := range p.All(context.Background()) {
+				require.Nil(t, err)
+				timestamps = append(timestamps, flvTag.Timestamp)
+				if len(timestamps) == tc.Count {
+					break
+				}
+			}
+			require.Equal(t, tc.Timestamps, timestamps)
+			require.Equal(t, tc.Waits, clock.waits)
+		})
+	}
+}
+
+func TestPlayerWrongHeaderFlags(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Flags      flv.Flags
+		Tags       []*tag.FlvTag
+		Timestamps []uint32
+		TagTypes   []tag.TagType
+	}
+
+	a, v := tag.TagTypeAudio, tag.TagTypeVideo
+	testCases := []testCase{
+		{
+			Name:  "VideoIsNotFound",
+			Flags: flv.FlagsAudio | flv.FlagsVideo,
+			Tags: []*tag.FlvTag{
+				newAudioTag(0), newAudioTag(500), newAudioTag(1000), newAudioTag(1500),
+			},
+			Timestamps: []uint32{0, 500}, // waits for video for 1s
+			TagTypes:   []tag.TagType{a, a},
+		},
+		{
+			Name:  "VideoIsNotDeclared",
+			Flags: flv.FlagsAudio,
+			Tags: []*tag.FlvTag{
+				newAudioTag(0),
+				newVideoTag(20, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+				newAudioTag(40),
+				newVideoTag(60, tag.FrameTypeKeyFrame, tag.AVCPacketTypeNALU),
+				newVideoTag(80, tag.FrameTypeInterFrame, tag.AVCPacketTypeNALU),
+			},
+			Timestamps: []uint32{0, 40, 60, 80}, // video starts at the keyframe
+			TagTypes:   []tag.TagType{a, a, v, v},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			enc, err := flv.NewEncoder(&buf, tc.Flags)
+			require.Nil(t, err)
+			for _, flvTag := range tc.Tags {
+				require.Nil(t, enc.Encode(flvTag))
+			}
+
+			p, err := NewPlayer(&buf, &Config{
+				Clock: &fakeClock{},
+			})
+			require.Nil(t, err)
+
+			var timestamps []uint32
+			var tagTypes []tag.TagType
+			for flvTag, err := range p.All(context.Background()) {
+				require.Nil(t, err)
+				timestamps = append(timestamps, flvTag.Timestamp)
+				tagTypes = append(tagTypes, flvTag.TagType)
+			}
+			require.Equal(t, tc.Timestamps, timestamps)
+			require.Equal(t, tc.TagTypes, tagTypes)
+		})
+	}
+}
+
+func TestPlayerEOF(t *testing.T) {
+	p, err := NewPlayer(newTestStream(t), &Config{
+		Clock: &fakeClock{},
+	})
+	require.Nil(t, err)
+
+	var flvTag tag.FlvTag
+	for i := 0; i < 5; i++ {
+		err := p.Next(context.Background(), &flvTag)
+		require.Nil(t, err)
+	}
+	err = p.Next(context.Background(), &flvTag)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestPlayerCanceled(t *testing.T) {
+	p, err := NewPlayer(newTestStream(t), nil) // system clock
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var flvTag tag.FlvTag
+	for i := 0; i < 2; i++ {
+		err := p.Next(ctx, &flvTag)
+		require.Nil(t, err)
+	}
+
+	cancel()
+	err = p.Next(ctx, &flvTag) // waits 40ms
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestPlayerLoopRequiresSeeker(t *testing.T) {
+	_, err := NewPlayer(io.MultiReader(newTestStream(t)), &Config{Loop: true})
+	require.EqualError(t, err, "looping requires io.Seeker")
+}
@@ -0,0 +1,275 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package tag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ========================================
+// Owned payloads
+
+// Buffer is a payload which owns its bytes. It can be set to Data of AudioData and VideoData
+// in place of a reader aliasing the underlying stream.
+//
+// Reads consume the buffer like bytes.Reader, but encoders always write the whole payload
+// returned by Bytes without consuming it, so a tag holding Buffers can be encoded any number
+// of times, e.g. to multiple consumers.
+type Buffer struct {
+	b      []byte
+	r      bytes.Reader
+	pooled bool
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &Buffer{}
+	},
+}
+
+// NewBuffer returns a Buffer holding b. The caller must not modify b after that.
+func NewBuffer(b []byte) *Buffer {
+	buf := &Buffer{}
+	buf.reset(b)
+	return buf
+}
+
+// ReadBuffer reads all of r into a Buffer taken from a pool. Call Release to return it when
+// the payload is no longer used.
+func ReadBuffer(r io.Reader) (*Buffer, error) {
+	buf := bufferPool.Get().(*Buffer)
+	buf.pooled = true
+
+	b, err := readAll(r, buf.b[:0])
+	if err != nil {
+		buf.reset(b)
+		buf.Release()
+		return nil, err
+	}
+	buf.reset(b)
+
+	return buf, nil
+}
+
+// Bytes returns the whole payload regardless of reads. It is valid until Release is called.
+func (b *Buffer) Bytes() []byte {
+	return b.b
+}
+
+// Len returns a number of unread bytes.
+func (b *Buffer) Len() int {
+	return b.r.Len()
+}
+
+func (b *Buffer) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *Buffer) WriteTo(w io.Writer) (int64, error) {
+	return b.r.WriteTo(w)
+}
+
+// Rewind resets the read position to the beginning of the payload.
+func (b *Buffer) Rewind() {
+	b.r.Reset(b.b)
+}
+
+// Release returns the buffer to the pool if it was taken from the pool. The buffer must not be
+// used after that.
+func (b *Buffer) Release() {
+	if !b.pooled {
+		return
+	}
+	b.pooled = false
+	b.reset(b.b[:0])
+	bufferPool.Put(b)
+}
+
+func (b *Buffer) reset(p []byte) {
+	b.b = p
+	b.r.Reset(p)
+}
+
+// readAll appends all of r to b.
+func readAll(r io.Reader, b []byte) ([]byte, error) {
+	if n := remainingLen(r); n >= 0 {
+		if cap(b) < n {
+			b = make([]byte, 0, n)
+		}
+		b = b[:n]
+		_, err := io.ReadFull(r, b)
+		return b, wrapEOF(err)
+	}
+
+	for {
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)] // grow
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+}
+
+// remainingLen returns a known number of remaining bytes of r, or -1.
+func remainingLen(r io.Reader) int {
+	switch r := r.(type) {
+	case *io.LimitedReader:
+		return int(r.N)
+	case interface{ Len() int }:
+		return r.Len()
+	}
+	return -1
+}
+
+// writePayload writes whole bytes of Buffers, or copies r.
+func writePayload(w io.Writer, r io.Reader) error {
+	if b, ok := r.(*Buffer); ok {
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// ========================================
+// Tags with owned payloads
+
+// Materialize reads payloads of audio and video data into owned Buffers, so that the tag stays
+// valid after the next tag is decoded and can be stored or shared. Payloads which are already
+// Buffers are left as is. Script data are always decoded into values, so they are owned.
+//
+// Data is copied while materializing, since it may be a part of Scratch.
+func (t *FlvTag) Materialize() error {
+	switch data := t.Data.(type) {
+	case *AudioData:
+		if _, ok := data.Data.(*Buffer); ok {
+			return nil
+		}
+		buf, err := ReadBuffer(data.Data)
+		if err != nil {
+			return err
+		}
+		v := *data
+		v.Data = buf
+		t.Data = &v
+
+	case *VideoData:
+		if _, ok := data.Data.(*Buffer); ok {
+			return nil
+		}
+		buf, err := ReadBuffer(data.Data)
+		if err != nil {
+			return err
+		}
+		v := *data
+		v.Data = buf
+		t.Data = &v
+	}
+	return nil
+}
+
+// Release returns pooled payloads of the tag. The tag must not be used after that.
+func (t *FlvTag) Release() {
+	switch data := t.Data.(type) {
+	case *AudioData:
+		release(data.Data)
+	case *VideoData:
+		release(data.Data)
+	}
+}
+
+func release(r io.Reader) {
+	if b, ok := r.(*Buffer); ok {
+		b.Release()
+	}
+}
+
+// SetPayload sets b as the payload.
+func (d *AudioData) SetPayload(b []byte) {
+	d.Data = NewBuffer(b)
+}
+
+// Payload returns the payload if it is owned by a Buffer.
+func (d *AudioData) Payload() ([]byte, bool) {
+	return payloadOf(d.Data)
+}
+
+// SetPayload sets b as the payload.
+func (d *VideoData) SetPayload(b []byte) {
+	d.Data = NewBuffer(b)
+}
+
+// Payload returns the payload if it is owned by a Buffer.
+func (d *VideoData) Payload() ([]byte, bool) {
+	return payloadOf(d.Data)
+}
+
+func payloadOf(r io.Reader) ([]byte, bool) {
+	if b, ok := r.(*Buffer); ok {
+		return b.Bytes(), true
+	}
+	return nil, false
+}
+
+// ========================================
+// Sized payloads
+
+// SetPayloadReader sets r as the payload of n bytes. Encoders stream it without buffering, and
+// fail with ErrPayloadSizeMismatch unless r ends after exactly n bytes. One more byte is read from r
+// to check it. Use an io.LimitedReader to leave bytes after n in r instead.
+func (d *AudioData) SetPayloadReader(r io.Reader, n int64) {
+	d.Data = newExactReader(r, n)
+}
+
+// SetPayloadReader sets r as the payload of n bytes. Encoders stream it without buffering, and
+// fail with ErrPayloadSizeMismatch unless r ends after exactly n bytes. One more byte is read from r
+// to check it. Use an io.LimitedReader to leave bytes after n in r instead.
+func (d *VideoData) SetPayloadReader(r io.Reader, n int64) {
+	d.Data = newExactReader(r, n)
+}
+
+// exactReader reads n bytes, then fails with ErrPayloadSizeMismatch if r has more bytes.
+type exactReader struct {
+	lr io.LimitedReader
+	n  int64
+}
+
+func newExactReader(r io.Reader, n int64) *exactReader {
+	return &exactReader{
+		lr: io.LimitedReader{R: r, N: n},
+		n:  n,
+	}
+}
+
+func (r *exactReader) Read(p []byte) (int, error) {
+	if r.lr.N > 0 {
+		return r.lr.Read(p)
+	}
+
+	// checks that r ends
+	var b [1]byte
+	if _, err := io.ReadFull(r.lr.R, b[:]); err != nil {
+		return 0, err // io.EOF if r ends
+	}
+	return 0, fmt.Errorf("%w: Expected = %d, Actual > %d", ErrPayloadSizeMismatch, r.n, r.n)
+}
+
+// Len returns a number of remaining bytes.
+func (r *exactReader) Len() int {
+	return int(r.lr.N)
+}
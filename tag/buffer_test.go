@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package tag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBuffer(t *testing.T) {
+	type testCase struct {
+		Name   string
+		Reader io.Reader
+	}
+
+	payload := []byte{0x01, 0x02, 0x03, 0x04}
+	testCases := []testCase{
+		{Name: "Sized", Reader: bytes.NewReader(payload)},
+		{Name: "Limited", Reader: io.LimitReader(bytes.NewReader(payload), 4)},
+		{Name: "Unsized", Reader: io.MultiReader(bytes.NewReader(payload[:1]), bytes.NewReader(payload[1:]))},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			buf, err := ReadBuffer(tc.Reader)
+			require.Nil(t, err)
+			defer buf.Release()
+
+			require.Equal(t, payload, buf.Bytes())
+			require.Equal(t, 4, buf.Len())
+
+			b, err := io.ReadAll(buf)
+			require.Nil(t, err)
+			require.Equal(t, payload, b)
+			require.Equal(t, 0, buf.Len())
+			require.Equal(t, payload, buf.Bytes()) // regardless of reads
+
+			buf.Rewind()
+			require.Equal(t, 4, buf.Len())
+		})
+	}
+}
+
+func TestReadBufferTruncated(t *testing.T) {
+	lr := &io.LimitedReader{R: bytes.NewReader([]byte{0x01}), N: 4}
+	_, err := ReadBuffer(lr)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestFlvTagMaterialize(t *testing.T) {
+	bin := []byte{
+		0x09,             // TagType
+		0x00, 0x00, 0x07, // DataSize
+		0x00, 0x00, 0x0a, 0x00, // Timestamp
+		0x00, 0x00, 0x00, // StreamID
+		0x17, 0x01, 0x00, 0x00, 0x00, // VideoData + AVCVideoPacket
+		0x0a, 0x0b, // Payload
+		0x08, // Next
+	}
+	r := bytes.NewReader(bin)
+
+	var flvTag FlvTag
+	err := DecodeFlvTag(r, &flvTag)
+	require.Nil(t, err)
+
+	err = flvTag.Materialize()
+	require.Nil(t, err)
+	defer flvTag.Release()
+
+	// the payload is owned and the stream proceeds to the next tag
+	payload, ok := flvTag.Data.(*VideoData).Payload()
+	require.True(t, ok)
+	require.Equal(t, []byte{0x0a, 0x0b}, payload)
+	require.Equal(t, 1, r.Len())
+
+	// owned payloads can be encoded multiple times
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		err := EncodeFlvTag(&buf, &flvTag)
+		require.Nil(t, err)
+		require.Equal(t, bin[:len(bin)-1], buf.Bytes())
+	}
+}
+
+func TestSetPayload(t *testing.T) {
+	audioData := &AudioData{
+		SoundFormat:   SoundFormatAAC,
+		AACPacketType: AACPacketTypeRaw,
+	}
+	audioData.SetPayload([]byte{0x0a})
+
+	payload, ok := audioData.Payload()
+	require.True(t, ok)
+	require.Equal(t, []byte{0x0a}, payload)
+
+	var buf bytes.Buffer
+	err := EncodeAudioData(&buf, audioData)
+	require.Nil(t, err)
+	require.Equal(t, []byte{0xa0, 0x01, 0x0a}, buf.Bytes())
+
+	audioData.Data = bytes.NewReader([]byte{0x0a})
+	_, ok = audioData.Payload()
+	require.False(t, ok)
+}
+
+// copyWriter records copies of slices passed to Write, since streamed buffers are reused.
+type copyWriter struct {
+	writes [][]byte
+}
+
+func (w *copyWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func TestSetPayloadReader(t *testing.T) {
+	frames := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+	var s Scratch
+	var offset int64
+	for _, n := range []int64{4, 2} {
+		videoData := &VideoData{
+			FrameType: FrameTypeKeyFrame,
+			CodecID:   CodecIDOn2VP6,
+		}
+		videoData.SetPayloadReader(iotest.OneByteReader(bytes.NewReader(frames[offset:offset+n])), n)
+
+		var w copyWriter
+		err := s.EncodeFlvTag(&w, &FlvTag{
+			TagType: TagTypeVideo,
+			Data:    videoData,
+		})
+		require.Nil(t, err)
+
+		// the header, then the payload streamed without buffering
+		require.Equal(t, 1+int(n), len(w.writes))
+		require.Equal(t, byte(1+n), w.writes[0][3]) // DataSize
+		require.Equal(t, frames[offset:offset+n], bytes.Join(w.writes[1:], nil))
+		offset += n
+	}
+
+	// short and long payloads fail
+	for _, payload := range [][]byte{{0x01}, {0x01, 0x02, 0x03, 0x04, 0x05}} {
+		audioData := &AudioData{
+			SoundFormat: SoundFormatMP3,
+		}
+		audioData.SetPayloadReader(bytes.NewReader(payload), 4)
+
+		var buf bytes.Buffer
+		err := s.EncodeFlvTag(&buf, &FlvTag{
+			TagType: TagTypeAudio,
+			Data:    audioData,
+		})
+		require.True(t, errors.Is(err, ErrPayloadSizeMismatch), "%+v", err)
+	}
+}
+
+func TestLimitedReaderPayloads(t *testing.T) {
+	// payloads of two frames are piped in a stream
+	r := bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
+
+	var s Scratch
+	for _, n := range []int64{4, 2} {
+		var buf bytes.Buffer
+		err := s.EncodeFlvTag(&buf, &FlvTag{
+			TagType: TagTypeAudio,
+			Data: &AudioData{
+				SoundFormat: SoundFormatMP3,
+				Data:        io.LimitReader(r, n),
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, byte(1+n), buf.Bytes()[3]) // DataSize
+	}
+	require.Equal(t, 0, r.Len())
+}
@@ -109,6 +109,36 @@ var flvTagTestCases = []testCase{
 			0x00, 0x00, 0x09,
 		},
 	},
+	{
+		Name: "VideoData Tag (HEVC)",
+		Value: &FlvTag{
+			TagType:   TagTypeVideo,
+			Timestamp: 10,
+			StreamID:  0,
+			Data: &VideoData{
+				FrameType:       FrameTypeInterFrame,
+				CodecID:         CodecIDHEVC,
+				AVCPacketType:   AVCPacketTypeNALU,
+				CompositionTime: 80,
+				Data:            nil,
+			},
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// VideoTag 9
+			0x09,
+			// DataSize 9
+			0x00, 0x00, 0x09,
+			// Timestamp 10
+			0x00, 0x00, 0x0a,
+			// Extended timestamp 0
+			0x00,
+			// StreamID 0
+			0x00, 0x00, 0x00,
+			// Video Data
+			0x2c, 0x01, 0x00, 0x00, 0x50, 0x74, 0x65, 0x73, 0x74,
+		},
+	},
 	{
 		Name: "Extended timestamp (boundary)",
 		Value: &FlvTag{
@@ -169,6 +199,186 @@ var flvTagTestCases = []testCase{
 			0x17, 0x00, 0x00, 0x00, 0x00, 0x74, 0x65, 0x73, 0x74,
 		},
 	},
+	{
+		Name: "Encrypted AudioData Tag",
+		Value: &FlvTag{
+			TagType:   TagTypeAudio,
+			Filter:    true,
+			Timestamp: 10,
+			StreamID:  0,
+			Data: &AudioData{
+				SoundFormat:   SoundFormatAAC,
+				SoundRate:     SoundRate44kHz,
+				SoundSize:     SoundSize16Bit,
+				SoundType:     SoundTypeStereo,
+				AACPacketType: AACPacketTypeRaw,
+				Data:          nil,
+			},
+			Encryption: &EncryptionHeader{
+				NumFilters: 1,
+				FilterName: FilterNameEncryption,
+				FilterParams: FilterParams{
+					IV: testIV,
+				},
+			},
+		},
+		Payload: []byte("test"),
+		Binary: append(append([]byte{
+			// Filter + AudioTag 8
+			0x28,
+			// DataSize 38
+			0x00, 0x00, 0x26,
+			// Timestamp 10
+			0x00, 0x00, 0x0a,
+			// Extended timestamp 0
+			0x00,
+			// StreamID 0
+			0x00, 0x00, 0x00,
+			// Audio Data header
+			0xaf, 0x01,
+			// NumFilters 1
+			0x01,
+			// FilterName "Encryption"
+			0x00, 0x0a, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+			// Length 16
+			0x00, 0x00, 0x10,
+		}, testIV...),
+			// Encrypted payload
+			0x74, 0x65, 0x73, 0x74,
+		),
+	},
+	{
+		Name: "Selectively encrypted VideoData Tag",
+		Value: &FlvTag{
+			TagType:   TagTypeVideo,
+			Filter:    true,
+			Timestamp: 10,
+			StreamID:  0,
+			Data: &VideoData{
+				FrameType:       FrameTypeKeyFrame,
+				CodecID:         CodecIDAVC,
+				AVCPacketType:   AVCPacketTypeNALU,
+				CompositionTime: 0,
+				Data:            nil,
+			},
+			Encryption: &EncryptionHeader{
+				NumFilters: 1,
+				FilterName: FilterNameSE,
+				FilterParams: FilterParams{
+					EncryptedAU: true,
+					SEFlags:     0x81,
+					IV:          testIV,
+				},
+			},
+		},
+		Payload: []byte("test"),
+		Binary: append(append([]byte{
+			// Filter + VideoTag 9
+			0x29,
+			// DataSize 34
+			0x00, 0x00, 0x22,
+			// Timestamp 10
+			0x00, 0x00, 0x0a,
+			// Extended timestamp 0
+			0x00,
+			// StreamID 0
+			0x00, 0x00, 0x00,
+			// Video Data header
+			0x17, 0x01, 0x00, 0x00, 0x00,
+			// NumFilters 1
+			0x01,
+			// FilterName "SE"
+			0x00, 0x02, 0x53, 0x45,
+			// Length 17
+			0x00, 0x00, 0x11,
+			// EncryptedAU + reserved
+			0x81,
+		}, testIV...),
+			// Encrypted payload
+			0x74, 0x65, 0x73, 0x74,
+		),
+	},
+	{
+		Name: "VideoData Tag with unknown filter",
+		Value: &FlvTag{
+			TagType:   TagTypeVideo,
+			Filter:    true,
+			Timestamp: 10,
+			StreamID:  0,
+			Data: &VideoData{
+				FrameType: FrameTypeInterFrame,
+				CodecID:   CodecIDOn2VP6,
+				Data:      nil,
+			},
+			Encryption: &EncryptionHeader{
+				NumFilters: 1,
+				FilterName: "X",
+				FilterParams: FilterParams{
+					Raw: []byte{0x01, 0x02},
+				},
+			},
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// Filter + VideoTag 9
+			0x29,
+			// DataSize 14
+			0x00, 0x00, 0x0e,
+			// Timestamp 10
+			0x00, 0x00, 0x0a,
+			// Extended timestamp 0
+			0x00,
+			// StreamID 0
+			0x00, 0x00, 0x00,
+			// Video Data header
+			0x24,
+			// NumFilters 1
+			0x01,
+			// FilterName "X"
+			0x00, 0x01, 0x58,
+			// Length 2
+			0x00, 0x00, 0x02,
+			// FilterParams
+			0x01, 0x02,
+			// Encrypted payload
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "Reserved bits",
+		Value: &FlvTag{
+			TagType:   TagTypeAudio,
+			Reserved:  0x03,
+			Timestamp: 10,
+			StreamID:  0,
+			Data: &AudioData{
+				SoundFormat: SoundFormatMP3,
+				SoundRate:   SoundRate44kHz,
+				SoundSize:   SoundSize16Bit,
+				SoundType:   SoundTypeStereo,
+				Data:        nil,
+			},
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// Reserved + AudioTag 8
+			0xc8,
+			// DataSize 5
+			0x00, 0x00, 0x05,
+			// Timestamp 10
+			0x00, 0x00, 0x0a,
+			// Extended timestamp 0
+			0x00,
+			// StreamID 0
+			0x00, 0x00, 0x00,
+			// Audio Data
+			0x2f, 0x74, 0x65, 0x73, 0x74,
+		},
+	},
+}
+
+var testIV = []byte{
+	0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
 }
 
 var audioDataTestCases = []testCase{
@@ -241,6 +451,46 @@ var audioDataTestCases = []testCase{
 			0x74, 0x65, 0x73, 0x74,
 		},
 	},
+	{
+		Name: "AudioData(ExHeader, Opus sequence start)",
+		Value: &AudioData{
+			SoundFormat:     SoundFormatExHeader,
+			FourCC:          FourCCOpus,
+			AudioPacketType: AudioPacketTypeSequenceStart,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x90: 0b10010000
+			//         1001     = SoundFormat 9(ExHeader)
+			//             0000 = AudioPacketType 0(SequenceStart)
+			0x90,
+			// "Opus" = FourCC
+			0x4f, 0x70, 0x75, 0x73,
+			// "test" = OpusHead (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "AudioData(ExHeader, Opus coded frames)",
+		Value: &AudioData{
+			SoundFormat:     SoundFormatExHeader,
+			FourCC:          FourCCOpus,
+			AudioPacketType: AudioPacketTypeCodedFrames,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x91: 0b10010001
+			//         1001     = SoundFormat 9(ExHeader)
+			//             0001 = AudioPacketType 1(CodedFrames)
+			0x91,
+			// "Opus" = FourCC
+			0x4f, 0x70, 0x75, 0x73,
+			// "test" = Opus packet (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
 }
 
 var videoDataTestCases = []testCase{
@@ -290,6 +540,140 @@ var videoDataTestCases = []testCase{
 			0x74, 0x65, 0x73, 0x74,
 		},
 	},
+	{
+		Name: "VideoData(HEVC, sequence header)",
+		Value: &VideoData{
+			FrameType:       FrameTypeKeyFrame,
+			CodecID:         CodecIDHEVC,
+			AVCPacketType:   AVCPacketTypeSequenceHeader,
+			CompositionTime: 0,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x1c: 0b00011100
+			//         0001     = FrameType 1(Keyframe)
+			//             1100 = CodecID 12(HEVC)
+			0x1c,
+			// 0x00 = AVCPacketType 0(Sequence Header)
+			0x00,
+			// 0x00 0x00 0x00 = CompositionTime 0(24bit, BigEndian)
+			0x00, 0x00, 0x00,
+			// "test" = HEVCDecoderConfigurationRecord (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "VideoData(HEVC, NALU)",
+		Value: &VideoData{
+			FrameType:       FrameTypeKeyFrame,
+			CodecID:         CodecIDHEVC,
+			AVCPacketType:   AVCPacketTypeNALU,
+			CompositionTime: 40,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x1c: 0b00011100
+			//         0001     = FrameType 1(Keyframe)
+			//             1100 = CodecID 12(HEVC)
+			0x1c,
+			// 0x01 = AVCPacketType 1(NALU)
+			0x01,
+			// 0x00 0x00 0x28 = CompositionTime 40(24bit, BigEndian)
+			0x00, 0x00, 0x28,
+			// "test" = NALUs (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "VideoData(ExHeader, VP9 sequence start)",
+		Value: &VideoData{
+			FrameType:       FrameTypeKeyFrame,
+			ExHeader:        true,
+			FourCC:          FourCCVP9,
+			VideoPacketType: VideoPacketTypeSequenceStart,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x90: 0b10010000
+			//         1        = IsExHeader
+			//          001     = FrameType 1(Keyframe)
+			//             0000 = VideoPacketType 0(SequenceStart)
+			0x90,
+			// "vp09" = FourCC
+			0x76, 0x70, 0x30, 0x39,
+			// "test" = VPCodecConfigurationRecord (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "VideoData(ExHeader, HEVC coded frames)",
+		Value: &VideoData{
+			FrameType:       FrameTypeInterFrame,
+			CompositionTime: -256,
+			ExHeader:        true,
+			FourCC:          FourCCHEVC,
+			VideoPacketType: VideoPacketTypeCodedFrames,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0xa1: 0b10100001
+			//         1        = IsExHeader
+			//          010     = FrameType 2(Interframe)
+			//             0001 = VideoPacketType 1(CodedFrames)
+			0xa1,
+			// "hvc1" = FourCC
+			0x68, 0x76, 0x63, 0x31,
+			// 0xff 0xff 0x00 = CompositionTime -256(24bit, BigEndian)
+			0xff, 0xff, 0x00,
+			// "test" = NALUs (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "VideoData(ExHeader, AV1 coded frames X)",
+		Value: &VideoData{
+			FrameType:       FrameTypeKeyFrame,
+			ExHeader:        true,
+			FourCC:          FourCCAV1,
+			VideoPacketType: VideoPacketTypeCodedFramesX,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x93: 0b10010011
+			//         1        = IsExHeader
+			//          001     = FrameType 1(Keyframe)
+			//             0011 = VideoPacketType 3(CodedFramesX)
+			0x93,
+			// "av01" = FourCC
+			0x61, 0x76, 0x30, 0x31,
+			// "test" = OBUs (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
+	{
+		Name: "VideoData(ExHeader, multitrack)",
+		Value: &VideoData{
+			FrameType:       FrameTypeKeyFrame,
+			ExHeader:        true,
+			VideoPacketType: VideoPacketTypeMultitrack,
+			Data:            nil,
+		},
+		Payload: []byte("test"),
+		Binary: []byte{
+			// 0x96: 0b10010110
+			//         1        = IsExHeader
+			//          001     = FrameType 1(Keyframe)
+			//             0110 = VideoPacketType 6(Multitrack)
+			0x96,
+			// "test" = Multitrack packet (!DUMMY DATA!)
+			0x74, 0x65, 0x73, 0x74,
+		},
+	},
 	{
 		Name: "VideoData(Expect AVC)",
 		Value: &VideoData{
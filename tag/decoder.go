@@ -9,39 +9,69 @@ package tag
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/yutopp/go-amf0"
 )
 
-func DecodeFlvTag(r io.Reader, flvTag *FlvTag) (err error) {
-	ui32 := make([]byte, 4)
-	buf := make([]byte, 11)
-	if _, err := io.ReadAtLeast(r, buf, 1); err != nil {
-		return err
-	}
+var (
+	// ErrUnsupportedTagType is wrapped by errors of tags whose type is unknown.
+	ErrUnsupportedTagType = errors.New("unsupported tag type")
+	// ErrMalformedData is wrapped by errors of data which are inconsistent with the tag, e.g. broken
+	// script data or data shorter than their headers.
+	ErrMalformedData = errors.New("malformed data")
+)
 
-	tagType := TagType(buf[0])
+type DecoderConfig struct {
+	// PassthroughUnknownTags makes tags whose type is not supported decoded as *UnknownData instead
+	// of errors wrapping ErrUnsupportedTagType.
+	PassthroughUnknownTags bool
+}
 
-	copy(ui32[1:], buf[1:4]) // 24bits
-	dataSize := binary.BigEndian.Uint32(ui32)
+// DecodeFlvTag decodes a tag. It returns io.EOF if r ends before the tag, and io.ErrUnexpectedEOF
+// if r ends in the middle of the tag.
+func DecodeFlvTag(r io.Reader, flvTag *FlvTag) error {
+	return DecodeFlvTagWithConfig(r, flvTag, nil)
+}
 
-	copy(ui32[1:], buf[4:7]) // lower 24bits
-	ui32[0] = buf[7]         // upper  8bits
-	timestamp := binary.BigEndian.Uint32(ui32)
+func DecodeFlvTagWithConfig(r io.Reader, flvTag *FlvTag, config *DecoderConfig) error {
+	var s Scratch
+	return s.DecodeFlvTagWithConfig(r, flvTag, config)
+}
 
-	copy(ui32[1:], buf[8:11])
-	ui32[0] = 0 // clear upper 8bits (not used)
-	streamID := binary.BigEndian.Uint32(ui32)
+// DecodeFlvTag decodes a tag reusing buffers of s. Data of the tag points to s, so it is
+// overwritten by the next decoding with s. Call FlvTag.Materialize to keep the tag.
+func (s *Scratch) DecodeFlvTag(r io.Reader, flvTag *FlvTag) error {
+	return s.DecodeFlvTagWithConfig(r, flvTag, nil)
+}
+
+func (s *Scratch) DecodeFlvTagWithConfig(r io.Reader, flvTag *FlvTag, config *DecoderConfig) (err error) {
+	buf := s.buf[:TagHeaderLength]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		*flvTag = FlvTag{}
+		return err
+	}
+
+	reserved := buf[0] & 0xc0 >> 6    // 0b11000000
+	filter := buf[0]&0x20 != 0        // 0b00100000
+	tagType := TagType(buf[0] & 0x1f) // 0b00011111
+
+	dataSize := uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])                       // 24bits
+	timestamp := uint32(buf[7])<<24 | uint32(buf[4])<<16 | uint32(buf[5])<<8 | uint32(buf[6]) // upper 8bits + lower 24bits
+	streamID := uint32(buf[8])<<16 | uint32(buf[9])<<8 | uint32(buf[10])                      // 24bits
 
 	*flvTag = FlvTag{
 		TagType:   tagType,
+		Filter:    filter,
+		Reserved:  reserved,
 		Timestamp: timestamp,
 		StreamID:  streamID,
 	}
 
-	lr := io.LimitReader(r, int64(dataSize))
+	s.lr = io.LimitedReader{R: r, N: int64(dataSize)}
+	lr := &s.lr
 	defer func() {
 		if err != nil {
 			_, _ = io.Copy(io.Discard, lr) // TODO: wrap an error?
@@ -50,36 +80,127 @@ func DecodeFlvTag(r io.Reader, flvTag *FlvTag) (err error) {
 
 	switch tagType {
 	case TagTypeAudio:
-		var v AudioData
-		if err := DecodeAudioData(lr, &v); err != nil {
-			return fmt.Errorf("failed to decode audio data: %w", err)
+		v := &s.audioData
+		if err := decodeAudioData(lr, v, buf); err != nil {
+			return dataError("audio data", err, err, lr)
+		}
+		flvTag.Data = v
+
+		if err := decodeEncryption(lr, flvTag); err != nil {
+			return err
 		}
-		flvTag.Data = &v
 
 	case TagTypeVideo:
-		var v VideoData
-		if err := DecodeVideoData(lr, &v); err != nil {
-			return fmt.Errorf("failed to decode video data: %w", err)
+		v := &s.videoData
+		if err := decodeVideoData(lr, v, buf); err != nil {
+			return dataError("video data", err, err, lr)
+		}
+		flvTag.Data = v
+
+		if err := decodeEncryption(lr, flvTag); err != nil {
+			return err
 		}
-		flvTag.Data = &v
 
 	case TagTypeScriptData:
+		if filter {
+			if err := decodeEncryption(lr, flvTag); err != nil {
+				return err
+			}
+
+			// encrypted values cannot be decoded
+			return decodeUnknownData(lr, flvTag, &DecoderConfig{PassthroughUnknownTags: true})
+		}
+
 		var v ScriptData
-		if err := DecodeScriptData(lr, &v); err != nil {
-			return fmt.Errorf("failed to decode script data: %w", err)
+		rr := recordingReader{r: lr}
+		if err := DecodeScriptData(&rr, &v); err != nil {
+			return dataError("script data", err, rr.err, lr)
 		}
 		flvTag.Data = &v
 
 	default:
-		return fmt.Errorf("unsupported tag type: %+v", tagType)
+		return decodeUnknownData(lr, flvTag, config)
 	}
 
 	return nil
 }
 
+func decodeUnknownData(lr *io.LimitedReader, flvTag *FlvTag, config *DecoderConfig) error {
+	if config == nil || !config.PassthroughUnknownTags {
+		if flvTag.Filter {
+			return fmt.Errorf("%w: %+v (filtered)", ErrUnsupportedTagType, flvTag.TagType)
+		}
+		return fmt.Errorf("%w: %+v", ErrUnsupportedTagType, flvTag.TagType)
+	}
+
+	v := &UnknownData{
+		Type:    flvTag.TagType,
+		Payload: make([]byte, lr.N),
+	}
+	if _, err := io.ReadFull(lr, v.Payload); err != nil {
+		return dataError("unknown data", wrapEOF(err), err, lr)
+	}
+	flvTag.Data = v
+
+	return nil
+}
+
+// decodeEncryption decodes the encryption header if Filter of the tag is set.
+func decodeEncryption(lr *io.LimitedReader, flvTag *FlvTag) error {
+	if !flvTag.Filter {
+		return nil
+	}
+
+	rr := recordingReader{r: lr}
+	var h EncryptionHeader
+	if err := DecodeEncryptionHeader(&rr, &h); err != nil {
+		return dataError("encryption header", err, rr.err, lr)
+	}
+	flvTag.Encryption = &h
+
+	return nil
+}
+
+// dataError classifies err of decoding data of a tag by readErr, which is the last error from lr.
+func dataError(name string, err, readErr error, lr *io.LimitedReader) error {
+	switch {
+	case readErr == io.EOF || readErr == io.ErrUnexpectedEOF:
+		if lr.N > 0 {
+			// the stream ended in the middle of the data
+			return fmt.Errorf("failed to decode %s: %w", name, io.ErrUnexpectedEOF)
+		}
+		return fmt.Errorf("failed to decode %s: %w: data is shorter than expected", name, ErrMalformedData)
+
+	case readErr != nil:
+		// e.g. an error of the underlying reader
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+
+	default:
+		return fmt.Errorf("failed to decode %s: %w: %w", name, ErrMalformedData, err)
+	}
+}
+
+// recordingReader records the last error from r.
+type recordingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
 func DecodeAudioData(r io.Reader, audioData *AudioData) error {
-	buf := make([]byte, 1)
-	if _, err := io.ReadAtLeast(r, buf, 1); err != nil {
+	return decodeAudioData(r, audioData, make([]byte, 4))
+}
+
+func decodeAudioData(r io.Reader, audioData *AudioData, buf []byte) error {
+	buf = buf[:1]
+	if _, err := io.ReadFull(r, buf); err != nil {
 		return err
 	}
 
@@ -88,6 +209,10 @@ func DecodeAudioData(r io.Reader, audioData *AudioData) error {
 	soundSize := SoundSize(buf[0] & 0x02 >> 1)     // 0b00000010
 	soundType := SoundType(buf[0] & 0x01)          // 0b00000001
 
+	if soundFormat == SoundFormatExHeader {
+		return decodeExAudioData(r, audioData, buf)
+	}
+
 	*audioData = AudioData{
 		SoundFormat: soundFormat,
 		SoundRate:   soundRate,
@@ -97,7 +222,7 @@ func DecodeAudioData(r io.Reader, audioData *AudioData) error {
 
 	if soundFormat == SoundFormatAAC {
 		var aacAudioData AACAudioData
-		if err := DecodeAACAudioData(r, &aacAudioData); err != nil {
+		if err := decodeAACAudioData(r, &aacAudioData, buf); err != nil {
 			return wrapEOF(err)
 		}
 
@@ -110,9 +235,33 @@ func DecodeAudioData(r io.Reader, audioData *AudioData) error {
 	return nil
 }
 
+// decodeExAudioData decodes the rest of ExAudioTagHeader of Enhanced RTMP. buf[0] is the first byte.
+func decodeExAudioData(r io.Reader, audioData *AudioData, buf []byte) error {
+	*audioData = AudioData{
+		SoundFormat:     SoundFormatExHeader,
+		AudioPacketType: AudioPacketType(buf[0] & 0x0f), // 0b00001111
+		Data:            r,
+	}
+	if !audioData.hasFourCC() {
+		return nil
+	}
+
+	buf = buf[:4]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return wrapEOF(err)
+	}
+	audioData.FourCC = FourCC(binary.BigEndian.Uint32(buf))
+
+	return nil
+}
+
 func DecodeAACAudioData(r io.Reader, aacAudioData *AACAudioData) error {
-	buf := make([]byte, 1)
-	if _, err := io.ReadAtLeast(r, buf, 1); err != nil {
+	return decodeAACAudioData(r, aacAudioData, make([]byte, 1))
+}
+
+func decodeAACAudioData(r io.Reader, aacAudioData *AACAudioData, buf []byte) error {
+	buf = buf[:1]
+	if _, err := io.ReadFull(r, buf); err != nil {
 		return err
 	}
 
@@ -127,11 +276,19 @@ func DecodeAACAudioData(r io.Reader, aacAudioData *AACAudioData) error {
 }
 
 func DecodeVideoData(r io.Reader, videoData *VideoData) error {
-	buf := make([]byte, 1)
-	if _, err := io.ReadAtLeast(r, buf, 1); err != nil {
+	return decodeVideoData(r, videoData, make([]byte, 4))
+}
+
+func decodeVideoData(r io.Reader, videoData *VideoData, buf []byte) error {
+	buf = buf[:1]
+	if _, err := io.ReadFull(r, buf); err != nil {
 		return err
 	}
 
+	if buf[0]&0x80 != 0 { // 0b10000000
+		return decodeExVideoData(r, videoData, buf)
+	}
+
 	frameType := FrameType(buf[0] & 0xf0 >> 4) // 0b11110000
 	codecID := CodecID(buf[0] & 0x0f)          // 0b00001111
 
@@ -140,9 +297,9 @@ func DecodeVideoData(r io.Reader, videoData *VideoData) error {
 		CodecID:   codecID,
 	}
 
-	if codecID == CodecIDAVC {
+	if codecID == CodecIDAVC || codecID == CodecIDHEVC {
 		var avcVideoPacket AVCVideoPacket
-		if err := DecodeAVCVideoPacket(r, &avcVideoPacket); err != nil {
+		if err := decodeAVCVideoPacket(r, &avcVideoPacket, buf); err != nil {
 			return wrapEOF(err)
 		}
 		videoData.AVCPacketType = avcVideoPacket.AVCPacketType
@@ -155,16 +312,47 @@ func DecodeVideoData(r io.Reader, videoData *VideoData) error {
 	return nil
 }
 
+// decodeExVideoData decodes the rest of ExVideoTagHeader of Enhanced RTMP. buf[0] is the first byte.
+func decodeExVideoData(r io.Reader, videoData *VideoData, buf []byte) error {
+	*videoData = VideoData{
+		FrameType:       FrameType(buf[0] & 0x70 >> 4),  // 0b01110000
+		ExHeader:        true,                           // 0b10000000
+		VideoPacketType: VideoPacketType(buf[0] & 0x0f), // 0b00001111
+		Data:            r,
+	}
+	if !videoData.hasFourCC() {
+		return nil
+	}
+
+	buf = buf[:4]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return wrapEOF(err)
+	}
+	videoData.FourCC = FourCC(binary.BigEndian.Uint32(buf))
+
+	if videoData.hasCompositionTime() {
+		buf = buf[:3]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return wrapEOF(err)
+		}
+		videoData.CompositionTime = int32(uint32(buf[0])<<24|uint32(buf[1])<<16|uint32(buf[2])<<8) >> 8 // Signed Interger 24 bits
+	}
+
+	return nil
+}
+
 func DecodeAVCVideoPacket(r io.Reader, avcVideoPacket *AVCVideoPacket) error {
-	buf := make([]byte, 4)
-	if _, err := io.ReadAtLeast(r, buf, 4); err != nil {
+	return decodeAVCVideoPacket(r, avcVideoPacket, make([]byte, 4))
+}
+
+func decodeAVCVideoPacket(r io.Reader, avcVideoPacket *AVCVideoPacket, buf []byte) error {
+	buf = buf[:4]
+	if _, err := io.ReadFull(r, buf); err != nil {
 		return err
 	}
 
 	avcPacketType := AVCPacketType(buf[0])
-	ctBin := make([]byte, 4)
-	copy(ctBin[0:3], buf[1:4])
-	compositionTime := int32(binary.BigEndian.Uint32(ctBin)) >> 8 // Signed Interger 24 bits. TODO: check
+	compositionTime := int32(uint32(buf[1])<<24|uint32(buf[2])<<16|uint32(buf[3])<<8) >> 8 // Signed Interger 24 bits
 
 	*avcVideoPacket = AVCVideoPacket{
 		AVCPacketType:   avcPacketType,
@@ -175,6 +363,72 @@ func DecodeAVCVideoPacket(r io.Reader, avcVideoPacket *AVCVideoPacket) error {
 	return nil
 }
 
+// DecodeEncryptionHeader decodes EncryptionTagHeader and FilterParams.
+func DecodeEncryptionHeader(r io.Reader, h *EncryptionHeader) error {
+	var buf [3]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return err
+	}
+	numFilters := buf[0]
+
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return wrapEOF(err)
+	}
+	name := make([]byte, binary.BigEndian.Uint16(buf[:2])) // SCRIPTDATASTRING
+	if _, err := io.ReadFull(r, name); err != nil {
+		return wrapEOF(err)
+	}
+
+	if _, err := io.ReadFull(r, buf[:3]); err != nil {
+		return wrapEOF(err)
+	}
+	length := uint32(buf[0])<<16 | uint32(buf[1])<<8 | uint32(buf[2]) // 24bits
+	params := make([]byte, length)
+	if _, err := io.ReadFull(r, params); err != nil {
+		return wrapEOF(err)
+	}
+
+	*h = EncryptionHeader{
+		NumFilters: numFilters,
+		FilterName: string(name),
+	}
+
+	return decodeFilterParams(h.FilterName, params, &h.FilterParams)
+}
+
+func decodeFilterParams(filterName string, b []byte, params *FilterParams) error {
+	switch filterName {
+	case FilterNameEncryption:
+		if len(b) != IVLength {
+			return fmt.Errorf("invalid length of filter params: Name = %s, Length = %d", filterName, len(b))
+		}
+		params.IV = b
+
+	case FilterNameSE:
+		if len(b) == 0 {
+			return fmt.Errorf("invalid length of filter params: Name = %s, Length = %d", filterName, len(b))
+		}
+		params.SEFlags = b[0]
+		params.EncryptedAU = b[0]&0x80 != 0 // 0b10000000
+
+		expected := 1
+		if params.EncryptedAU {
+			expected += IVLength
+		}
+		if len(b) != expected {
+			return fmt.Errorf("invalid length of filter params: Name = %s, Length = %d", filterName, len(b))
+		}
+		if params.EncryptedAU {
+			params.IV = b[1:]
+		}
+
+	default:
+		params.Raw = b
+	}
+
+	return nil
+}
+
 func DecodeScriptData(r io.Reader, data *ScriptData) error {
 	dec := amf0.NewDecoder(r)
 
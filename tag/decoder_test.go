@@ -9,6 +9,7 @@ package tag
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"testing"
 
@@ -21,6 +22,8 @@ func assertEqualAudioData(t *testing.T, expected *AudioData, payload []byte, act
 	require.Equal(t, expected.SoundSize, actual.SoundSize)
 	require.Equal(t, expected.SoundType, actual.SoundType)
 	require.Equal(t, expected.AACPacketType, actual.AACPacketType)
+	require.Equal(t, expected.FourCC, actual.FourCC)
+	require.Equal(t, expected.AudioPacketType, actual.AudioPacketType)
 
 	actualPayload, err := io.ReadAll(actual.Data)
 	require.Nil(t, err)
@@ -32,6 +35,9 @@ func assertEqualVideoData(t *testing.T, expected *VideoData, payload []byte, act
 	require.Equal(t, expected.CodecID, actual.CodecID)
 	require.Equal(t, expected.AVCPacketType, actual.AVCPacketType)
 	require.Equal(t, expected.CompositionTime, actual.CompositionTime)
+	require.Equal(t, expected.ExHeader, actual.ExHeader)
+	require.Equal(t, expected.FourCC, actual.FourCC)
+	require.Equal(t, expected.VideoPacketType, actual.VideoPacketType)
 
 	actualPayload, err := io.ReadAll(actual.Data)
 	require.Nil(t, err)
@@ -52,8 +58,11 @@ func TestDecodeFlvTagCommon(t *testing.T) {
 			require.Nil(t, err)
 
 			require.Equal(t, tc.Value.(*FlvTag).TagType, flvTag.TagType)
+			require.Equal(t, tc.Value.(*FlvTag).Filter, flvTag.Filter)
+			require.Equal(t, tc.Value.(*FlvTag).Reserved, flvTag.Reserved)
 			require.Equal(t, tc.Value.(*FlvTag).Timestamp, flvTag.Timestamp)
 			require.Equal(t, tc.Value.(*FlvTag).StreamID, flvTag.StreamID)
+			require.Equal(t, tc.Value.(*FlvTag).Encryption, flvTag.Encryption)
 
 			switch data := flvTag.Data.(type) {
 			case *AudioData:
@@ -141,6 +150,41 @@ func TestDecodeBrokenVideo(t *testing.T) {
 	require.Equal(t, io.ErrUnexpectedEOF, err)
 }
 
+func TestDecodeBrokenHEVCVideo(t *testing.T) {
+	r := bytes.NewReader([]byte{0x1c, 0x01, 0x00}) // HEVC has the same packet header as AVC
+
+	var videoData VideoData
+	err := DecodeVideoData(r, &videoData)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestDecodeBrokenExHeader(t *testing.T) {
+	var videoData VideoData
+	err := DecodeVideoData(bytes.NewReader([]byte{0x91, 0x68, 0x76, 0x63, 0x31, 0x00}), &videoData) // CompositionTime is truncated
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	var audioData AudioData
+	err = DecodeAudioData(bytes.NewReader([]byte{0x91, 0x4f, 0x70}), &audioData) // FourCC is truncated
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestFourCCString(t *testing.T) {
+	require.Equal(t, "vp09", FourCCVP9.String())
+	require.Equal(t, "Opus", FourCCOpus.String())
+}
+
+func TestIsSequenceHeader(t *testing.T) {
+	require.True(t, (&VideoData{CodecID: CodecIDAVC, AVCPacketType: AVCPacketTypeSequenceHeader}).IsSequenceHeader())
+	require.True(t, (&VideoData{CodecID: CodecIDHEVC, AVCPacketType: AVCPacketTypeSequenceHeader}).IsSequenceHeader())
+	require.False(t, (&VideoData{CodecID: CodecIDOn2VP6, AVCPacketType: AVCPacketTypeSequenceHeader}).IsSequenceHeader())
+	require.True(t, (&VideoData{ExHeader: true, VideoPacketType: VideoPacketTypeSequenceStart}).IsSequenceHeader())
+	require.False(t, (&VideoData{ExHeader: true, VideoPacketType: VideoPacketTypeCodedFrames}).IsSequenceHeader())
+
+	require.True(t, (&AudioData{SoundFormat: SoundFormatAAC, AACPacketType: AACPacketTypeSequenceHeader}).IsSequenceHeader())
+	require.False(t, (&AudioData{SoundFormat: SoundFormatMP3, AACPacketType: AACPacketTypeSequenceHeader}).IsSequenceHeader())
+	require.True(t, (&AudioData{SoundFormat: SoundFormatExHeader, AudioPacketType: AudioPacketTypeSequenceStart}).IsSequenceHeader())
+}
+
 func TestDecodeScriptDataCommon(t *testing.T) {
 	for _, tc := range scriptDataTestCases {
 		tc := tc // capture
@@ -222,6 +266,140 @@ func TestDecodeSequentialTag(t *testing.T) {
 	})
 }
 
+func TestDecodeFlvTagErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		binary []byte
+		err    error
+	}{
+		{
+			name: "unsupported tag type",
+			binary: []byte{
+				0x07, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 1Byte
+				0x00,
+			},
+			err: ErrUnsupportedTagType,
+		},
+		{
+			name: "audio data shorter than its header",
+			binary: []byte{
+				0x08, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 1Byte
+				0xaf, // AAC requires at least 2Bytes
+				0x00, 0x00, 0x00, 0x0c,
+			},
+			err: ErrMalformedData,
+		},
+		{
+			name: "truncated video data",
+			binary: []byte{
+				0x09, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 5Bytes
+				0x17, 0x00, // ends in the middle of the AVC header
+			},
+			err: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "invalid encryption filter params",
+			binary: []byte{
+				0x28, 0x00, 0x00, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 18Bytes
+				0x2f,
+				0x01, 0x00, 0x0a, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+				0x00, 0x00, 0x01, 0x00, // IV must be 16Bytes
+			},
+			err: ErrMalformedData,
+		},
+		{
+			name: "filtered script data without encryption header",
+			binary: []byte{
+				0x32, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 1Byte
+				0x01, // NumFilters only
+			},
+			err: ErrMalformedData,
+		},
+		{
+			name: "broken script data",
+			binary: []byte{
+				0x12, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 2Bytes
+				0xff, 0xff, // invalid marker
+			},
+			err: ErrMalformedData,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var flvTag FlvTag
+			err := DecodeFlvTag(bytes.NewReader(tc.binary), &flvTag)
+			require.NotNil(t, err)
+			require.True(t, errors.Is(err, tc.err), "%+v", err)
+
+			for _, other := range []error{ErrUnsupportedTagType, ErrMalformedData, io.ErrUnexpectedEOF} {
+				if other != tc.err {
+					require.False(t, errors.Is(err, other), "%+v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeFlvTagPassthroughUnknown(t *testing.T) {
+	bin := []byte{
+		0x0f, 0x00, 0x00, 0x03, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x00, // vendor specific, 3Bytes
+		0x01, 0x02, 0x03,
+	}
+	config := &DecoderConfig{PassthroughUnknownTags: true}
+
+	var flvTag FlvTag
+	err := DecodeFlvTagWithConfig(bytes.NewReader(bin), &flvTag, config)
+	require.Nil(t, err)
+	require.Equal(t, TagType(0x0f), flvTag.TagType)
+	require.Equal(t, uint32(10), flvTag.Timestamp)
+	require.Equal(t, &UnknownData{Type: 0x0f, Payload: []byte{0x01, 0x02, 0x03}}, flvTag.Data)
+
+	// written back unchanged
+	var buf bytes.Buffer
+	err = EncodeFlvTag(&buf, &flvTag)
+	require.Nil(t, err)
+	require.Equal(t, bin, buf.Bytes())
+
+	// truncated
+	err = DecodeFlvTagWithConfig(bytes.NewReader(bin[:len(bin)-1]), &flvTag, config)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%+v", err)
+
+	// disabled
+	err = DecodeFlvTag(bytes.NewReader(bin), &flvTag)
+	require.True(t, errors.Is(err, ErrUnsupportedTagType), "%+v", err)
+}
+
+func TestDecodeFilteredScriptData(t *testing.T) {
+	bin := []byte{
+		0x32, 0x00, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // filtered script data, 11Bytes
+		0x01, 0x00, 0x02, 0x53, 0x45, 0x00, 0x00, 0x01, 0x01, // SE, not encrypted, a reserved bit
+		0x01, 0x02, // encrypted values
+	}
+
+	// encrypted values cannot be decoded, thus passed through regardless of the config
+	var flvTag FlvTag
+	err := DecodeFlvTag(bytes.NewReader(bin), &flvTag)
+	require.Nil(t, err)
+	require.True(t, flvTag.Filter)
+	require.Equal(t, &EncryptionHeader{
+		NumFilters:   1,
+		FilterName:   FilterNameSE,
+		FilterParams: FilterParams{SEFlags: 0x01},
+	}, flvTag.Encryption)
+	require.Equal(t, &UnknownData{Type: TagTypeScriptData, Payload: []byte{0x01, 0x02}}, flvTag.Data)
+
+	// written back unchanged
+	var buf bytes.Buffer
+	err = EncodeFlvTag(&buf, &flvTag)
+	require.Nil(t, err)
+	require.Equal(t, bin, buf.Bytes())
+}
+
 func BenchmarkDecodeFlvTagCommon(b *testing.B) {
 	bin := []byte{
 		0x08, 0x00, 0x00, 0x06, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x00, 0xaf, 0x00, 0x74, 0x65, 0x73, 0x74,
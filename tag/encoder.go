@@ -8,155 +8,406 @@
 package tag
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/yutopp/go-amf0"
 )
 
+// ErrPayloadSizeMismatch is wrapped by errors of sized payloads which do not match their length.
+// The tag is broken in the output since its header is already written.
+var ErrPayloadSizeMismatch = errors.New("payload size mismatch")
+
 func EncodeFlvTag(w io.Writer, flvTag *FlvTag) error {
-	var dataBuf bytes.Buffer // TODO: check performance
-	switch flvTag.TagType {
-	case TagTypeAudio:
+	var s Scratch
+	return s.EncodeFlvTag(w, flvTag)
+}
+
+// EncodeFlvTag encodes a tag reusing buffers of s.
+//
+// When a length of the payload is known, i.e. it is a Buffer or a reader which has Len() (see
+// AudioData.SetPayloadReader) or is an io.LimitedReader, the header and the payload are written
+// directly: Buffers with vectored writes (net.Buffers), and readers streamed through. Otherwise
+// the payload is buffered once to calculate DataSize. An io.LimitedReader is read up to N bytes,
+// and extra bytes of the underlying reader are left unread without an error.
+func (s *Scratch) EncodeFlvTag(w io.Writer, flvTag *FlvTag) error {
+	return s.encodeFlvTag(w, flvTag, false)
+}
+
+// EncodeFlvTagWithSize encodes a tag followed by its 4 bytes size, which is PreviousTagSize of
+// the next tag in FLV bodies.
+func (s *Scratch) EncodeFlvTagWithSize(w io.Writer, flvTag *FlvTag) error {
+	return s.encodeFlvTag(w, flvTag, true)
+}
+
+func (s *Scratch) encodeFlvTag(w io.Writer, flvTag *FlvTag, withSize bool) error {
+	if flvTag.TagType > 0x1f {
+		return fmt.Errorf("tag type is out of 5bits: %+v", flvTag.TagType)
+	}
+
+	header := s.header[:TagHeaderLength]
+	var payload io.Reader
+
+	var err error
+	switch ud, ok := flvTag.Data.(*UnknownData); {
+	case ok:
+		// written back as is, including the encryption header if filtered except for script data
+		if ud.Type != flvTag.TagType {
+			return fmt.Errorf("unexpected data is set: UnknownData of type %+v", ud.Type)
+		}
+		if flvTag.TagType == TagTypeScriptData {
+			if header, err = appendEncryption(header, flvTag); err != nil {
+				return err
+			}
+		}
+		s.body.Reset()
+		_, _ = s.body.Write(ud.Payload)
+		payload = &s.body
+
+	case flvTag.TagType == TagTypeAudio:
 		ad, ok := flvTag.Data.(*AudioData)
 		if !ok {
 			return fmt.Errorf("unexpected data is set: not *AudioData")
 		}
-		if err := EncodeAudioData(&dataBuf, ad); err != nil {
+		header = appendAudioDataHeader(header, ad)
+		if header, err = appendEncryption(header, flvTag); err != nil {
 			return err
 		}
+		payload = ad.Data
 
-	case TagTypeVideo:
+	case flvTag.TagType == TagTypeVideo:
 		vd, ok := flvTag.Data.(*VideoData)
 		if !ok {
 			return fmt.Errorf("unexpected data is set: not *VideoData")
 		}
-		if err := EncodeVideoData(&dataBuf, vd); err != nil {
+		header = appendVideoDataHeader(header, vd)
+		if header, err = appendEncryption(header, flvTag); err != nil {
 			return err
 		}
+		payload = vd.Data
 
-	case TagTypeScriptData:
+	case flvTag.TagType == TagTypeScriptData:
 		sd, ok := flvTag.Data.(*ScriptData)
 		if !ok {
 			return fmt.Errorf("unexpected data is set: not *ScriptData")
 		}
-		if err := EncodeScriptData(&dataBuf, sd); err != nil {
+		if flvTag.Filter {
+			return fmt.Errorf("filtered script data must be UnknownData")
+		}
+		s.body.Reset()
+		if err := EncodeScriptData(&s.body, sd); err != nil {
 			return err
 		}
+		payload = &s.body
 
 	default:
-		return fmt.Errorf("unsupported tag type: %+v", flvTag.TagType)
+		return fmt.Errorf("%w: %+v", ErrUnsupportedTagType, flvTag.TagType)
 	}
 
-	ui32 := make([]byte, 4)
-	buf := make([]byte, 11)
-
-	buf[0] = byte(flvTag.TagType)
+	var payloadBytes []byte
+	payloadSize := payloadLen(payload)
+	switch {
+	case payloadSize < 0:
+		// unknown length
+		s.body.Reset()
+		if err := writePayload(&s.body, payload); err != nil {
+			return err
+		}
+		payloadBytes = s.body.Bytes()
+	case payload == &s.body:
+		payloadBytes = s.body.Bytes()
+	default:
+		if b, ok := payload.(*Buffer); ok {
+			payloadBytes = b.Bytes()
+		}
+	}
+	if payloadBytes != nil {
+		payloadSize = len(payloadBytes)
+	}
 
-	binary.BigEndian.PutUint32(ui32, uint32(dataBuf.Len()))
-	copy(buf[1:4], ui32[1:]) // 24bits
+	dataSize := len(header) - TagHeaderLength + payloadSize
+	if dataSize > 0xffffff {
+		return fmt.Errorf("data is too large: %d", dataSize)
+	}
+	putFlvTagHeader(header, flvTag, uint32(dataSize))
 
-	binary.BigEndian.PutUint32(ui32, flvTag.Timestamp)
-	copy(buf[4:7], ui32[1:]) // lower 24bits
-	buf[7] = ui32[0]         // upper  8bits
+	var size []byte
+	if withSize {
+		size = s.size[:]
+		binary.BigEndian.PutUint32(size, uint32(TagHeaderLength+dataSize))
+	}
 
-	binary.BigEndian.PutUint32(ui32, flvTag.StreamID)
-	copy(buf[8:11], ui32[1:])
+	if payloadBytes != nil {
+		return s.writev(w, header, payloadBytes, size)
+	}
 
-	if _, err := w.Write(buf); err != nil {
+	// sized readers
+	if _, err := w.Write(header); err != nil {
 		return err
 	}
-	if _, err := io.CopyN(w, &dataBuf, int64(dataBuf.Len())); err != nil {
+	n, err := io.Copy(w, payload)
+	if err != nil {
 		return err
 	}
+	if n != int64(payloadSize) {
+		return fmt.Errorf("%w: Expected = %d, Actual = %d", ErrPayloadSizeMismatch, payloadSize, n)
+	}
+	if size != nil {
+		if _, err := w.Write(size); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func EncodeAudioData(w io.Writer, audioData *AudioData) error {
-	buf := make([]byte, 1)
-	buf[0] |= byte(audioData.SoundFormat<<4) & 0xf0 // 0b11110000
-	buf[0] |= byte(audioData.SoundRate<<2) & 0x0c   // 0b00001100
-	buf[0] |= byte(audioData.SoundSize<<1) & 0x02   // 0b00000010
-	buf[0] |= byte(audioData.SoundType) & 0x01      // 0b00000001
+func (s *Scratch) writev(w io.Writer, header, payload, size []byte) error {
+	// WriteTo consumes bufs, thus it is rebuilt on the array every time
+	s.bufs = append(s.bufsArray[:0], header, payload)
+	if size != nil {
+		s.bufs = append(s.bufs, size)
+	}
+	_, err := s.bufs.WriteTo(w)
+	return err
+}
 
-	if _, err := w.Write(buf); err != nil {
+// payloadLen returns a length of bytes written by writePayload, or -1 if it is unknown.
+func payloadLen(r io.Reader) int {
+	if b, ok := r.(*Buffer); ok {
+		return len(b.Bytes())
+	}
+	return remainingLen(r)
+}
+
+func putFlvTagHeader(buf []byte, flvTag *FlvTag, dataSize uint32) {
+	var b byte
+	b |= flvTag.Reserved << 6 & 0xc0 // 0b11000000
+	if flvTag.Filter {
+		b |= 0x20 // 0b00100000
+	}
+	b |= byte(flvTag.TagType) & 0x1f // 0b00011111
+	buf[0] = b
+
+	buf[1] = byte(dataSize >> 16) // 24bits
+	buf[2] = byte(dataSize >> 8)
+	buf[3] = byte(dataSize)
+
+	buf[4] = byte(flvTag.Timestamp >> 16) // lower 24bits
+	buf[5] = byte(flvTag.Timestamp >> 8)
+	buf[6] = byte(flvTag.Timestamp)
+	buf[7] = byte(flvTag.Timestamp >> 24) // upper  8bits
+
+	buf[8] = byte(flvTag.StreamID >> 16) // 24bits
+	buf[9] = byte(flvTag.StreamID >> 8)
+	buf[10] = byte(flvTag.StreamID)
+}
+
+// appendEncryption appends the encryption header if Filter of the tag is set.
+func appendEncryption(buf []byte, flvTag *FlvTag) ([]byte, error) {
+	if !flvTag.Filter {
+		return buf, nil
+	}
+	if flvTag.Encryption == nil {
+		return nil, fmt.Errorf("encryption header is not set to the filtered tag")
+	}
+
+	return appendEncryptionHeader(buf, flvTag.Encryption)
+}
+
+// EncodeEncryptionHeader encodes EncryptionTagHeader and FilterParams.
+func EncodeEncryptionHeader(w io.Writer, h *EncryptionHeader) error {
+	buf, err := appendEncryptionHeader(nil, h)
+	if err != nil {
 		return err
 	}
 
-	if audioData.SoundFormat == SoundFormatAAC {
-		return EncodeAACAudioData(w, &AACAudioData{
-			AACPacketType: audioData.AACPacketType,
-			Data:          audioData.Data,
-		})
+	_, err = w.Write(buf)
+	return err
+}
+
+func appendEncryptionHeader(buf []byte, h *EncryptionHeader) ([]byte, error) {
+	if len(h.FilterName) > 0xffff {
+		return nil, fmt.Errorf("filter name is too long: %d", len(h.FilterName))
 	}
 
-	if _, err := io.Copy(w, audioData.Data); err != nil {
+	params := &h.FilterParams
+	var length int
+	switch h.FilterName {
+	case FilterNameEncryption:
+		if len(params.IV) != IVLength {
+			return nil, fmt.Errorf("invalid length of IV: %d", len(params.IV))
+		}
+		length = IVLength
+
+	case FilterNameSE:
+		length = 1
+		if params.EncryptedAU {
+			if len(params.IV) != IVLength {
+				return nil, fmt.Errorf("invalid length of IV: %d", len(params.IV))
+			}
+			length += IVLength
+		}
+
+	default:
+		length = len(params.Raw)
+		if length > 0xffffff {
+			return nil, fmt.Errorf("filter params are too large: %d", length)
+		}
+	}
+
+	buf = append(buf, h.NumFilters)
+	buf = append(buf, byte(len(h.FilterName)>>8), byte(len(h.FilterName))) // SCRIPTDATASTRING
+	buf = append(buf, h.FilterName...)
+	buf = append(buf, byte(length>>16), byte(length>>8), byte(length)) // 24bits
+
+	switch h.FilterName {
+	case FilterNameEncryption:
+		buf = append(buf, params.IV...)
+
+	case FilterNameSE:
+		b := params.SEFlags &^ 0x80
+		if params.EncryptedAU {
+			b |= 0x80 // 0b10000000
+		}
+		buf = append(buf, b)
+		if params.EncryptedAU {
+			buf = append(buf, params.IV...)
+		}
+
+	default:
+		buf = append(buf, params.Raw...)
+	}
+
+	return buf, nil
+}
+
+func EncodeAudioData(w io.Writer, audioData *AudioData) error {
+	if _, err := w.Write(appendAudioDataHeader(nil, audioData)); err != nil {
+		return err
+	}
+
+	if err := writePayload(w, audioData.Data); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func appendAudioDataHeader(buf []byte, audioData *AudioData) []byte {
+	if audioData.SoundFormat == SoundFormatExHeader {
+		return appendExAudioDataHeader(buf, audioData)
+	}
+
+	var b byte
+	b |= byte(audioData.SoundFormat<<4) & 0xf0 // 0b11110000
+	b |= byte(audioData.SoundRate<<2) & 0x0c   // 0b00001100
+	b |= byte(audioData.SoundSize<<1) & 0x02   // 0b00000010
+	b |= byte(audioData.SoundType) & 0x01      // 0b00000001
+	buf = append(buf, b)
+
+	if audioData.SoundFormat == SoundFormatAAC {
+		buf = appendAACAudioDataHeader(buf, audioData.AACPacketType)
+	}
+
+	return buf
+}
+
+func appendExAudioDataHeader(buf []byte, audioData *AudioData) []byte {
+	var b byte
+	b |= byte(SoundFormatExHeader<<4) & 0xf0    // 0b11110000
+	b |= byte(audioData.AudioPacketType) & 0x0f // 0b00001111
+	buf = append(buf, b)
+
+	if audioData.hasFourCC() {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(audioData.FourCC))
+	}
+
+	return buf
+}
+
 func EncodeAACAudioData(w io.Writer, aacAudioData *AACAudioData) error {
-	buf := make([]byte, 1)
-	buf[0] = byte(aacAudioData.AACPacketType)
-	if _, err := w.Write(buf); err != nil {
+	if _, err := w.Write(appendAACAudioDataHeader(nil, aacAudioData.AACPacketType)); err != nil {
 		return err
 	}
 
-	if _, err := io.Copy(w, aacAudioData.Data); err != nil {
+	if err := writePayload(w, aacAudioData.Data); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func appendAACAudioDataHeader(buf []byte, aacPacketType AACPacketType) []byte {
+	return append(buf, byte(aacPacketType))
+}
+
 func EncodeVideoData(w io.Writer, videoData *VideoData) error {
-	buf := make([]byte, 1)
-	buf[0] |= byte(videoData.FrameType<<4) & 0xf0 // 0b11110000
-	buf[0] |= byte(videoData.CodecID) & 0x0f      // 0b00001111
+	if _, err := w.Write(appendVideoDataHeader(nil, videoData)); err != nil {
+		return err
+	}
 
-	if _, err := w.Write(buf); err != nil {
+	if err := writePayload(w, videoData.Data); err != nil {
 		return err
 	}
 
-	if videoData.CodecID == CodecIDAVC {
-		return EncodeAVCVideoPacket(w, &AVCVideoPacket{
-			AVCPacketType:   videoData.AVCPacketType,
-			CompositionTime: videoData.CompositionTime,
-			Data:            videoData.Data,
-		})
+	return nil
+}
+
+func appendVideoDataHeader(buf []byte, videoData *VideoData) []byte {
+	if videoData.ExHeader {
+		return appendExVideoDataHeader(buf, videoData)
 	}
 
-	if _, err := io.Copy(w, videoData.Data); err != nil {
-		return err
+	var b byte
+	b |= byte(videoData.FrameType<<4) & 0xf0 // 0b11110000
+	b |= byte(videoData.CodecID) & 0x0f      // 0b00001111
+	buf = append(buf, b)
+
+	if videoData.CodecID == CodecIDAVC || videoData.CodecID == CodecIDHEVC {
+		buf = appendAVCVideoPacketHeader(buf, videoData.AVCPacketType, videoData.CompositionTime)
 	}
 
-	return nil
+	return buf
 }
 
-func EncodeAVCVideoPacket(w io.Writer, avcVideoPacket *AVCVideoPacket) error {
-	buf := make([]byte, 4)
-	buf[0] = byte(avcVideoPacket.AVCPacketType)
+func appendExVideoDataHeader(buf []byte, videoData *VideoData) []byte {
+	var b byte
+	b |= 0x80                                   // 0b10000000
+	b |= byte(videoData.FrameType<<4) & 0x70    // 0b01110000
+	b |= byte(videoData.VideoPacketType) & 0x0f // 0b00001111
+	buf = append(buf, b)
 
-	ctBin := make([]byte, 4)
-	binary.BigEndian.PutUint32(ctBin, uint32(avcVideoPacket.CompositionTime))
-	copy(buf[1:4], ctBin[1:])
+	if videoData.hasFourCC() {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(videoData.FourCC))
+	}
+	if videoData.hasCompositionTime() {
+		ct := uint32(videoData.CompositionTime) // Signed Interger 24 bits
+		buf = append(buf, byte(ct>>16), byte(ct>>8), byte(ct))
+	}
+
+	return buf
+}
 
+func EncodeAVCVideoPacket(w io.Writer, avcVideoPacket *AVCVideoPacket) error {
+	buf := appendAVCVideoPacketHeader(nil, avcVideoPacket.AVCPacketType, avcVideoPacket.CompositionTime)
 	if _, err := w.Write(buf); err != nil {
 		return err
 	}
 
-	if _, err := io.Copy(w, avcVideoPacket.Data); err != nil {
+	if err := writePayload(w, avcVideoPacket.Data); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func appendAVCVideoPacketHeader(buf []byte, avcPacketType AVCPacketType, compositionTime int32) []byte {
+	ct := uint32(compositionTime) // Signed Interger 24 bits
+	return append(buf, byte(avcPacketType), byte(ct>>16), byte(ct>>8), byte(ct))
+}
+
 func EncodeScriptData(w io.Writer, data *ScriptData) error {
 	enc := amf0.NewEncoder(w)
 
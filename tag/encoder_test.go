@@ -55,6 +55,13 @@ func TestEncodeAudioDataCommon(t *testing.T) {
 	}
 }
 
+func TestEncodeNewAACAudioData(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeAudioData(&buf, NewAACAudioData(AACPacketTypeRaw, []byte("test")))
+	require.Nil(t, err)
+	require.Equal(t, []byte{0xaf, 0x01, 0x74, 0x65, 0x73, 0x74}, buf.Bytes())
+}
+
 func TestEncodeVideoDataCommon(t *testing.T) {
 	for _, tc := range videoDataTestCases {
 		tc := tc // capture
@@ -0,0 +1,34 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package tag
+
+import (
+	"bytes"
+	"io"
+	"net"
+)
+
+const (
+	TagHeaderLength  = 11 // TagType + DataSize + Timestamp + TimestampExtended + StreamID
+	dataHeaderLength = 8  // at most, ExVideoTagHeader with FourCC and CompositionTime
+)
+
+// Scratch holds buffers which are reused to decode and encode tags without allocations.
+// The zero value is ready to use. It must not be used concurrently.
+type Scratch struct {
+	buf       [TagHeaderLength]byte
+	lr        io.LimitedReader
+	audioData AudioData
+	videoData VideoData
+
+	header    [TagHeaderLength + dataHeaderLength]byte
+	size      [4]byte
+	body      bytes.Buffer
+	bufs      net.Buffers
+	bufsArray [3][]byte
+}
@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package tag
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScratchDecodeFlvTag(t *testing.T) {
+	bin := []byte{
+		// keyframe
+		0x09,
+		0x00, 0x00, 0x06, // DataSize
+		0x00, 0x00, 0x00, 0x00, // Timestamp
+		0x00, 0x00, 0x00, // StreamID
+		0x17, 0x01, 0x00, 0x00, 0x00, // VideoData + AVCVideoPacket
+		0x0a, // Payload
+		// inter frame
+		0x09,
+		0x00, 0x00, 0x06, // DataSize
+		0x00, 0x00, 0x0a, 0x00, // Timestamp
+		0x00, 0x00, 0x00, // StreamID
+		0x27, 0x01, 0x00, 0x00, 0x00, // VideoData + AVCVideoPacket
+		0x0b, // Payload
+	}
+	r := bytes.NewReader(bin)
+
+	var s Scratch
+
+	var first FlvTag
+	err := s.DecodeFlvTag(r, &first)
+	require.Nil(t, err)
+	err = first.Materialize()
+	require.Nil(t, err)
+
+	var second FlvTag
+	err = s.DecodeFlvTag(r, &second)
+	require.Nil(t, err)
+
+	// the materialized tag is detached from the scratch
+	videoData := first.Data.(*VideoData)
+	require.Equal(t, FrameTypeKeyFrame, videoData.FrameType)
+	payload, ok := videoData.Payload()
+	require.True(t, ok)
+	require.Equal(t, []byte{0x0a}, payload)
+
+	videoData = second.Data.(*VideoData)
+	require.Equal(t, FrameTypeInterFrame, videoData.FrameType)
+	payload, err = io.ReadAll(videoData.Data)
+	require.Nil(t, err)
+	require.Equal(t, []byte{0x0b}, payload)
+	require.Equal(t, 0, r.Len())
+
+	// encode them back with the same scratch
+	var buf bytes.Buffer
+	err = s.EncodeFlvTag(&buf, &first)
+	require.Nil(t, err)
+	require.Equal(t, bin[:17], buf.Bytes())
+}
+
+func TestScratchDecodeTruncatedHeader(t *testing.T) {
+	r := bytes.NewReader([]byte{0x09, 0x00, 0x00})
+
+	var s Scratch
+	var flvTag FlvTag
+	err := s.DecodeFlvTag(r, &flvTag)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+// recordWriter records slices passed to Write.
+type recordWriter struct {
+	writes [][]byte
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, p)
+	return len(p), nil
+}
+
+func (w *recordWriter) Bytes() []byte {
+	return bytes.Join(w.writes, nil)
+}
+
+func TestScratchEncodeFlvTagSized(t *testing.T) {
+	type testCase struct {
+		Name    string
+		Payload func(b []byte) io.Reader
+	}
+
+	testCases := []testCase{
+		{
+			Name:    "Buffer",
+			Payload: func(b []byte) io.Reader { return NewBuffer(b) },
+		},
+		{
+			Name:    "Len",
+			Payload: func(b []byte) io.Reader { return bytes.NewReader(b) },
+		},
+		{
+			Name:    "LimitedReader",
+			Payload: func(b []byte) io.Reader { return io.LimitReader(bytes.NewReader(b), int64(len(b))) },
+		},
+		{
+			Name:    "Unsized",
+			Payload: func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) },
+		},
+	}
+
+	expected := []byte{
+		0x09,             // TagType
+		0x00, 0x00, 0x07, // DataSize
+		0x00, 0x00, 0x0a, 0x00, // Timestamp
+		0x00, 0x00, 0x00, // StreamID
+		0x17, 0x01, 0x00, 0x00, 0x00, // VideoData + AVCVideoPacket
+		0x0a, 0x0b, // Payload
+		0x00, 0x00, 0x00, 0x12, // Tag size
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := []byte{0x0a, 0x0b}
+			flvTag := &FlvTag{
+				TagType:   TagTypeVideo,
+				Timestamp: 10,
+				Data: &VideoData{
+					FrameType:     FrameTypeKeyFrame,
+					CodecID:       CodecIDAVC,
+					AVCPacketType: AVCPacketTypeNALU,
+					Data:          tc.Payload(payload),
+				},
+			}
+
+			var s Scratch
+			var w recordWriter
+			err := s.EncodeFlvTagWithSize(&w, flvTag)
+			require.Nil(t, err)
+			require.Equal(t, expected, w.Bytes())
+
+			if tc.Name == "Buffer" {
+				// the payload is written as is without copies
+				require.Equal(t, 3, len(w.writes))
+				require.True(t, &payload[0] == &w.writes[1][0])
+			}
+		})
+	}
+}
+
+func TestScratchEncodeFlvTagSizeMismatch(t *testing.T) {
+	flvTag := &FlvTag{
+		TagType: TagTypeAudio,
+		Data: &AudioData{
+			SoundFormat: SoundFormatMP3,
+			Data:        &io.LimitedReader{R: bytes.NewReader([]byte{0x01}), N: 4},
+		},
+	}
+
+	var s Scratch
+	var buf bytes.Buffer
+	err := s.EncodeFlvTag(&buf, flvTag)
+	require.EqualError(t, err, "payload size mismatch: Expected = 4, Actual = 1")
+}
@@ -8,6 +8,7 @@
 package tag
 
 import (
+	"bytes"
 	"io"
 
 	"github.com/yutopp/go-amf0"
@@ -25,10 +26,15 @@ const (
 )
 
 type FlvTag struct {
-	TagType
+	TagType         // 5bits
+	Filter    bool  // the payload is encrypted. Encryption must be set
+	Reserved  uint8 // 2bits, reserved for FMS
 	Timestamp uint32
 	StreamID  uint32      // 24bit
-	Data      interface{} // *AudioData | *VideoData | *ScriptData
+	Data      interface{} // *AudioData | *VideoData | *ScriptData | *UnknownData
+	// Encryption is EncryptionTagHeader and FilterParams of tags whose Filter is set. It is placed
+	// between the header of the data and the encrypted payload.
+	Encryption *EncryptionHeader
 }
 
 // Close
@@ -58,6 +64,7 @@ const (
 	SoundFormatG711ALawLogarithmicPCM  SoundFormat = 7
 	SoundFormatG711muLawLogarithmicPCM SoundFormat = 8
 	SoundFormatReserved                SoundFormat = 9
+	SoundFormatExHeader                SoundFormat = 9 // Enhanced RTMP. The reserved value is used.
 	SoundFormatAAC                     SoundFormat = 10
 	SoundFormatSpeex                   SoundFormat = 11
 	SoundFormatMP3_8kHz                SoundFormat = 14
@@ -93,7 +100,13 @@ type AudioData struct {
 	SoundSize     SoundSize
 	SoundType     SoundType
 	AACPacketType AACPacketType
-	Data          io.Reader
+
+	// FourCC and AudioPacketType are of the ExAudioTagHeader when SoundFormat is SoundFormatExHeader.
+	// SoundRate, SoundSize and SoundType are not used then.
+	FourCC          FourCC
+	AudioPacketType AudioPacketType
+
+	Data io.Reader
 }
 
 func (d *AudioData) Read(buf []byte) (int, error) {
@@ -111,11 +124,54 @@ const (
 	AACPacketTypeRaw            AACPacketType = 1
 )
 
+// IsSequenceHeader reports whether the data is an AAC sequence header or an Enhanced RTMP
+// sequence start.
+func (d *AudioData) IsSequenceHeader() bool {
+	switch d.SoundFormat {
+	case SoundFormatAAC:
+		return d.AACPacketType == AACPacketTypeSequenceHeader
+	case SoundFormatExHeader:
+		return d.AudioPacketType == AudioPacketTypeSequenceStart
+	default:
+		return false
+	}
+}
+
+// AudioPacketType is a type of Enhanced RTMP audio packets.
+type AudioPacketType uint8
+
+const (
+	AudioPacketTypeSequenceStart      AudioPacketType = 0
+	AudioPacketTypeCodedFrames        AudioPacketType = 1
+	AudioPacketTypeSequenceEnd        AudioPacketType = 2
+	AudioPacketTypeMultichannelConfig AudioPacketType = 4
+	AudioPacketTypeMultitrack         AudioPacketType = 5 // not decoded further
+	AudioPacketTypeModEx              AudioPacketType = 7 // not decoded further
+)
+
+// hasFourCC reports whether the ExAudioTagHeader has a FourCC.
+func (d *AudioData) hasFourCC() bool {
+	return d.AudioPacketType != AudioPacketTypeMultitrack && d.AudioPacketType != AudioPacketTypeModEx
+}
+
 type AACAudioData struct {
 	AACPacketType AACPacketType
 	Data          io.Reader
 }
 
+// NewAACAudioData returns AudioData of AAC with data as the payload. SoundRate, SoundSize and
+// SoundType are set to the fixed values for AAC, as actual ones are in the AudioSpecificConfig.
+func NewAACAudioData(packetType AACPacketType, data []byte) *AudioData {
+	return &AudioData{
+		SoundFormat:   SoundFormatAAC,
+		SoundRate:     SoundRate44kHz,
+		SoundSize:     SoundSize16Bit,
+		SoundType:     SoundTypeStereo,
+		AACPacketType: packetType,
+		Data:          bytes.NewReader(data),
+	}
+}
+
 // ========================================
 // Video Tags
 
@@ -139,6 +195,7 @@ const (
 	CodecIDOn2VP6WithAlphaChannel CodecID = 5
 	CodecIDScreenVideoVersion2    CodecID = 6
 	CodecIDAVC                    CodecID = 7
+	CodecIDHEVC                   CodecID = 12 // Not in the spec, but widely used. Packets have the same layout as AVC.
 )
 
 type VideoData struct {
@@ -146,7 +203,15 @@ type VideoData struct {
 	CodecID         CodecID
 	AVCPacketType   AVCPacketType
 	CompositionTime int32
-	Data            io.Reader
+
+	// ExHeader is set if the tag has an ExVideoTagHeader of Enhanced RTMP. Then FourCC and
+	// VideoPacketType are used instead of CodecID and AVCPacketType, and CompositionTime is only
+	// for VideoPacketTypeCodedFrames of AVC and HEVC.
+	ExHeader        bool
+	FourCC          FourCC
+	VideoPacketType VideoPacketType
+
+	Data io.Reader
 }
 
 func (d *VideoData) Read(buf []byte) (int, error) {
@@ -165,12 +230,78 @@ const (
 	AVCPacketTypeEOS            AVCPacketType = 2
 )
 
+// IsSequenceHeader reports whether the data is an AVC/HEVC sequence header or an Enhanced RTMP
+// sequence start.
+func (d *VideoData) IsSequenceHeader() bool {
+	if d.ExHeader {
+		return d.VideoPacketType == VideoPacketTypeSequenceStart
+	}
+	isAVC := d.CodecID == CodecIDAVC || d.CodecID == CodecIDHEVC
+	return isAVC && d.AVCPacketType == AVCPacketTypeSequenceHeader
+}
+
+// VideoPacketType is a type of Enhanced RTMP video packets.
+type VideoPacketType uint8
+
+const (
+	VideoPacketTypeSequenceStart        VideoPacketType = 0
+	VideoPacketTypeCodedFrames          VideoPacketType = 1
+	VideoPacketTypeSequenceEnd          VideoPacketType = 2
+	VideoPacketTypeCodedFramesX         VideoPacketType = 3 // CompositionTime is 0
+	VideoPacketTypeMetadata             VideoPacketType = 4
+	VideoPacketTypeMPEG2TSSequenceStart VideoPacketType = 5
+	VideoPacketTypeMultitrack           VideoPacketType = 6 // not decoded further
+	VideoPacketTypeModEx                VideoPacketType = 7 // not decoded further
+)
+
+// hasFourCC reports whether the ExVideoTagHeader has a FourCC. Command frames have a command
+// instead of it.
+func (d *VideoData) hasFourCC() bool {
+	switch {
+	case d.VideoPacketType == VideoPacketTypeMultitrack, d.VideoPacketType == VideoPacketTypeModEx:
+		return false
+	case d.FrameType == FrameTypeVideoInfoCommandFrame && d.VideoPacketType != VideoPacketTypeMetadata:
+		return false
+	}
+	return true
+}
+
+// hasCompositionTime reports whether the ExVideoTagHeader has a CompositionTime.
+func (d *VideoData) hasCompositionTime() bool {
+	return d.VideoPacketType == VideoPacketTypeCodedFrames && (d.FourCC == FourCCAVC || d.FourCC == FourCCHEVC)
+}
+
 type AVCVideoPacket struct {
 	AVCPacketType   AVCPacketType
 	CompositionTime int32
 	Data            io.Reader
 }
 
+// ========================================
+// Enhanced RTMP
+
+// FourCC identifies a codec in Enhanced RTMP headers.
+type FourCC uint32
+
+const (
+	FourCCVP8  FourCC = 'v'<<24 | 'p'<<16 | '0'<<8 | '8'
+	FourCCVP9  FourCC = 'v'<<24 | 'p'<<16 | '0'<<8 | '9'
+	FourCCAV1  FourCC = 'a'<<24 | 'v'<<16 | '0'<<8 | '1'
+	FourCCAVC  FourCC = 'a'<<24 | 'v'<<16 | 'c'<<8 | '1'
+	FourCCHEVC FourCC = 'h'<<24 | 'v'<<16 | 'c'<<8 | '1'
+
+	FourCCOpus FourCC = 'O'<<24 | 'p'<<16 | 'u'<<8 | 's'
+	FourCCFLAC FourCC = 'f'<<24 | 'L'<<16 | 'a'<<8 | 'C'
+	FourCCAC3  FourCC = 'a'<<24 | 'c'<<16 | '-'<<8 | '3'
+	FourCCEAC3 FourCC = 'e'<<24 | 'c'<<16 | '-'<<8 | '3'
+	FourCCMP3  FourCC = '.'<<24 | 'm'<<16 | 'p'<<8 | '3'
+	FourCCAAC  FourCC = 'm'<<24 | 'p'<<16 | '4'<<8 | 'a'
+)
+
+func (c FourCC) String() string {
+	return string([]byte{byte(c >> 24), byte(c >> 16), byte(c >> 8), byte(c)})
+}
+
 // ========================================
 // Data tags
 
@@ -178,3 +309,48 @@ type ScriptData struct {
 	// all values are represented as subset of AMF0
 	Objects map[string]amf0.ECMAArray
 }
+
+// ========================================
+// Unknown tags
+
+// UnknownData is raw data of a tag whose type is not supported, e.g. vendor specific tags. It is
+// decoded only if DecoderConfig.PassthroughUnknownTags is set, and encoded back as is regardless
+// of the type.
+//
+// Encrypted script data is also decoded as UnknownData regardless of the config, since its values
+// cannot be decoded. Then Payload is the encrypted payload after the encryption header, which is
+// decoded into Encryption of the tag.
+type UnknownData struct {
+	Type    TagType // same as TagType of the tag
+	Payload []byte
+}
+
+// ========================================
+// Encrypted tags
+
+const (
+	FilterNameEncryption = "Encryption"
+	FilterNameSE         = "SE" // selective encryption
+)
+
+// IVLength is a length of initialization vectors in FilterParams.
+const IVLength = 16
+
+type EncryptionHeader struct {
+	NumFilters   uint8 // must be 1
+	FilterName   string
+	FilterParams FilterParams
+}
+
+type FilterParams struct {
+	// EncryptedAU reports whether the access unit is encrypted. It is only for FilterNameSE, and
+	// IV is present only if it is set.
+	EncryptedAU bool
+	// SEFlags is the raw flags byte of FilterNameSE including the reserved 7 bits, which are
+	// written back as is. Its top bit is replaced by EncryptedAU on encoding.
+	SEFlags uint8
+	// IV is an initialization vector of IVLength bytes.
+	IV []byte
+	// Raw is FilterParams of filters other than FilterNameEncryption and FilterNameSE.
+	Raw []byte
+}
@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"time"
+)
+
+const (
+	timestampWrap32 int64 = 1 << 32 // ~49.7 days
+	timestampWrap24 int64 = 1 << 24 // ~4.6 hours
+)
+
+// TimestampUnwrapper converts wrapping 32bits millisecond timestamps into monotonically increasing
+// durations. Small backward jumps (e.g. jitter of interleaved audio and video) are kept as is.
+type TimestampUnwrapper struct {
+	// Detect24BitWrap enables detection of wraps at 24bits, which broken encoders emit because
+	// they ignore TimestampExtended.
+	Detect24BitWrap bool
+
+	base     int64 // milliseconds
+	last     uint32
+	lastWrap int64
+	started  bool
+}
+
+// Unwrap returns an unwrapped timestamp.
+func (u *TimestampUnwrapper) Unwrap(timestamp uint32) time.Duration {
+	if !u.started {
+		u.started = true
+		u.last = timestamp
+		return toDuration(int64(timestamp))
+	}
+
+	switch {
+	case timestamp < u.last:
+		diff := u.last - timestamp
+		if u.Detect24BitWrap && int64(u.last) < timestampWrap24 && int64(diff) > timestampWrap24/2 {
+			u.wrap(timestampWrap24)
+		} else if int64(diff) > timestampWrap32/2 {
+			u.wrap(timestampWrap32)
+		}
+
+	case u.lastWrap > 0 && int64(timestamp-u.last) > u.lastWrap/2:
+		// a late tag from before the last wrap
+		return toDuration(u.base - u.lastWrap + int64(timestamp))
+	}
+
+	u.last = timestamp
+	return toDuration(u.base + int64(timestamp))
+}
+
+func (u *TimestampUnwrapper) wrap(size int64) {
+	u.base += size
+	u.lastWrap = size
+}
+
+// WrapTimestamp converts a duration into a millisecond timestamp. If wrap24Bit is true, it wraps
+// at 24bits for players which ignore TimestampExtended.
+func WrapTimestamp(d time.Duration, wrap24Bit bool) uint32 {
+	ms := d.Milliseconds()
+	if wrap24Bit {
+		return uint32(ms % timestampWrap24)
+	}
+	return uint32(ms) // wraps at 32bits
+}
+
+func toDuration(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package flv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampUnwrapper(t *testing.T) {
+	type testCase struct {
+		Name            string
+		Detect24BitWrap bool
+		Timestamps      []uint32
+		Expected        []int64 // milliseconds
+	}
+
+	testCases := []testCase{
+		{
+			Name:       "NoWrap",
+			Timestamps: []uint32{1000, 1033, 1020, 1066},
+			Expected:   []int64{1000, 1033, 1020, 1066}, // jitter is kept
+		},
+		{
+			Name:       "Wrap32Bit",
+			Timestamps: []uint32{0xffffffe0, 0xfffffff0, 0x10, 0x20},
+			Expected:   []int64{0xffffffe0, 0xfffffff0, 1<<32 + 0x10, 1<<32 + 0x20},
+		},
+		{
+			Name:       "Wrap32BitTwice",
+			Timestamps: []uint32{0xfffffff0, 0x10, 0x80000000, 0xfffffff0, 0x10},
+			Expected:   []int64{0xfffffff0, 1<<32 + 0x10, 1<<32 + 0x80000000, 1<<32 + 0xfffffff0, 2<<32 + 0x10},
+		},
+		{
+			Name:       "LateTagAfterWrap",
+			Timestamps: []uint32{0xfffffff0, 0x10, 0xfffffff8, 0x20},
+			Expected:   []int64{0xfffffff0, 1<<32 + 0x10, 0xfffffff8, 1<<32 + 0x20},
+		},
+		{
+			Name:       "24BitWrapNotDetected",
+			Timestamps: []uint32{0xfffff0, 0x10},
+			Expected:   []int64{0xfffff0, 0x10},
+		},
+		{
+			Name:            "24BitWrap",
+			Detect24BitWrap: true,
+			Timestamps:      []uint32{0xfffff0, 0x10, 0xfffff8, 0x20, 0x7fffff, 0xfffff0, 0x10},
+			Expected:        []int64{0xfffff0, 1<<24 + 0x10, 0xfffff8, 1<<24 + 0x20, 1<<24 + 0x7fffff, 1<<24 + 0xfffff0, 2<<24 + 0x10},
+		},
+		{
+			Name:            "32BitWrapWith24BitDetection",
+			Detect24BitWrap: true,
+			Timestamps:      []uint32{0xfffffff0, 0x10},
+			Expected:        []int64{0xfffffff0, 1<<32 + 0x10},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			u := TimestampUnwrapper{Detect24BitWrap: tc.Detect24BitWrap}
+
+			actual := make([]int64, len(tc.Timestamps))
+			for i, ts := range tc.Timestamps {
+				actual[i] = u.Unwrap(ts).Milliseconds()
+			}
+			require.Equal(t, tc.Expected, actual)
+		})
+	}
+}
+
+func TestWrapTimestamp(t *testing.T) {
+	d := time.Duration(1<<32+0x01000010) * time.Millisecond
+
+	require.Equal(t, uint32(0x01000010), WrapTimestamp(d, false))
+	require.Equal(t, uint32(0x10), WrapTimestamp(d, true))
+}
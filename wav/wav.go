@@ -0,0 +1,293 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package wav reads and writes RIFF WAVE files.
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type FormatTag uint16
+
+const (
+	FormatTagPCM        FormatTag = 0x0001
+	FormatTagALaw       FormatTag = 0x0006
+	FormatTagMuLaw      FormatTag = 0x0007
+	FormatTagExtensible FormatTag = 0xfffe
+)
+
+type Format struct {
+	FormatTag     FormatTag
+	Channels      uint16
+	SampleRate    uint32
+	BitsPerSample uint16
+}
+
+// BlockAlign returns a size of a sample frame (samples of all channels) in bytes.
+func (f *Format) BlockAlign() int {
+	return int(f.Channels) * int(f.BitsPerSample) / 8
+}
+
+// unknownSize is set to size fields when the size cannot be determined.
+const unknownSize = 0xffffffff
+
+// ========================================
+// Writer
+
+// Writer writes samples as a WAVE file. Sizes in headers are fixed up by Close
+// when the underlying writer is an io.WriteSeeker.
+type Writer struct {
+	w      io.Writer
+	format Format
+
+	headerOffset   int64
+	factOffset     int64 // 0 when no fact chunk
+	dataSizeOffset int64
+	dataSize       int64
+}
+
+func NewWriter(w io.Writer, format *Format) (*Writer, error) {
+	if format.Channels == 0 || format.SampleRate == 0 || format.BitsPerSample == 0 || format.BitsPerSample%8 != 0 {
+		return nil, fmt.Errorf("invalid format: %+v", format)
+	}
+
+	ww := &Writer{
+		w:      w,
+		format: *format,
+	}
+
+	if s, ok := w.(io.Seeker); ok {
+		offset, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		ww.headerOffset = offset
+	}
+
+	if err := ww.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return ww, nil
+}
+
+func (w *Writer) writeHeader() error {
+	fmtSize := 16
+	if w.format.FormatTag != FormatTagPCM {
+		fmtSize = 18 // cbSize is required by non-PCM formats
+	}
+
+	buf := make([]byte, 0, 58)
+	buf = append(buf, "RIFF"...)
+	buf = appendUint32(buf, unknownSize)
+	buf = append(buf, "WAVE"...)
+
+	buf = append(buf, "fmt "...)
+	buf = appendUint32(buf, uint32(fmtSize))
+	buf = appendUint16(buf, uint16(w.format.FormatTag))
+	buf = appendUint16(buf, w.format.Channels)
+	buf = appendUint32(buf, w.format.SampleRate)
+	buf = appendUint32(buf, w.format.SampleRate*uint32(w.format.BlockAlign()))
+	buf = appendUint16(buf, uint16(w.format.BlockAlign()))
+	buf = appendUint16(buf, w.format.BitsPerSample)
+	if fmtSize == 18 {
+		buf = appendUint16(buf, 0)
+
+		buf = append(buf, "fact"...)
+		buf = appendUint32(buf, 4)
+		w.factOffset = int64(len(buf))
+		buf = appendUint32(buf, unknownSize)
+	}
+
+	buf = append(buf, "data"...)
+	w.dataSizeOffset = int64(len(buf))
+	buf = appendUint32(buf, unknownSize)
+
+	_, err := w.w.Write(buf)
+	return err
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// Write writes interleaved samples.
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.dataSize += int64(n)
+	return n, err
+}
+
+// Close pads the data chunk and fixes up sizes in headers if possible. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.dataSize%2 == 1 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+
+	s, ok := w.w.(io.WriteSeeker)
+	if !ok || w.dataSize > unknownSize-int64(w.dataSizeOffset) {
+		return nil
+	}
+
+	end, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	riffSize := uint32(end - w.headerOffset - 8)
+	if err := w.putUint32At(s, 4, riffSize); err != nil {
+		return err
+	}
+	if w.factOffset != 0 {
+		blockAlign := int64(w.format.BlockAlign())
+		if err := w.putUint32At(s, w.factOffset, uint32(w.dataSize/blockAlign)); err != nil {
+			return err
+		}
+	}
+	if err := w.putUint32At(s, w.dataSizeOffset, uint32(w.dataSize)); err != nil {
+		return err
+	}
+
+	_, err = s.Seek(end, io.SeekStart)
+	return err
+}
+
+func (w *Writer) putUint32At(s io.WriteSeeker, offset int64, v uint32) error {
+	if _, err := s.Seek(w.headerOffset+offset, io.SeekStart); err != nil {
+		return err
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	_, err := s.Write(b)
+	return err
+}
+
+// ========================================
+// Reader
+
+// Reader reads samples from a WAVE file.
+type Reader struct {
+	r      io.Reader
+	format Format
+	remain int64 // -1 when the size is unknown
+}
+
+// NewReader reads headers until the data chunk.
+func NewReader(r io.Reader) (*Reader, error) {
+	le := binary.LittleEndian
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read RIFF header: %w", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAVE file")
+	}
+
+	var format *Format
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("data chunk is not found")
+			}
+			return nil, err
+		}
+		id := string(chunkHeader[0:4])
+		size := int64(le.Uint32(chunkHeader[4:8]))
+
+		switch id {
+		case "fmt ":
+			f, err := decodeFormat(r, size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode fmt chunk: %w", err)
+			}
+			format = f
+
+		case "data":
+			if format == nil {
+				return nil, fmt.Errorf("fmt chunk is not found before data chunk")
+			}
+			if size == unknownSize {
+				size = -1
+			}
+			return &Reader{
+				r:      r,
+				format: *format,
+				remain: size,
+			}, nil
+
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("failed to skip %q chunk: %w", id, err)
+			}
+		}
+	}
+}
+
+func decodeFormat(r io.Reader, size int64) (*Format, error) {
+	if size < 16 || size > 0xffff {
+		return nil, fmt.Errorf("invalid size: %d", size)
+	}
+
+	b := make([]byte, size+size%2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	format := &Format{
+		FormatTag:     FormatTag(le.Uint16(b[0:2])),
+		Channels:      le.Uint16(b[2:4]),
+		SampleRate:    le.Uint32(b[4:8]),
+		BitsPerSample: le.Uint16(b[14:16]),
+	}
+	if format.FormatTag == FormatTagExtensible {
+		// WAVEFORMATEXTENSIBLE: the first 2 bytes of SubFormat GUID are the actual format tag
+		if size < 40 {
+			return nil, fmt.Errorf("WAVEFORMATEXTENSIBLE is truncated: %d", size)
+		}
+		format.FormatTag = FormatTag(le.Uint16(b[24:26]))
+	}
+	if format.Channels == 0 || format.SampleRate == 0 || format.BitsPerSample == 0 || format.BitsPerSample%8 != 0 {
+		return nil, fmt.Errorf("invalid format: %+v", format)
+	}
+
+	return format, nil
+}
+
+func (r *Reader) Format() *Format {
+	return &r.format
+}
+
+// Read reads interleaved samples. It returns io.EOF at the end of the data chunk.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.remain == 0 {
+		return 0, io.EOF
+	}
+	if r.remain > 0 && int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+
+	n, err := r.r.Read(p)
+	if r.remain > 0 {
+		r.remain -= int64(n)
+		if err == io.EOF && r.remain > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,123 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterAndReader(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Format     *Format
+		Samples    []byte
+		HeaderSize int
+	}
+
+	testCases := []testCase{
+		{
+			Name: "PCM 16bit stereo",
+			Format: &Format{
+				FormatTag:     FormatTagPCM,
+				Channels:      2,
+				SampleRate:    44100,
+				BitsPerSample: 16,
+			},
+			Samples:    []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			HeaderSize: 44,
+		},
+		{
+			Name: "A-law mono",
+			Format: &Format{
+				FormatTag:     FormatTagALaw,
+				Channels:      1,
+				SampleRate:    8000,
+				BitsPerSample: 8,
+			},
+			Samples:    []byte{0xd5, 0x55, 0xd5}, // odd size
+			HeaderSize: 58,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := os.Create(filepath.Join(t.TempDir(), "test.wav"))
+			require.Nil(t, err)
+			defer f.Close()
+
+			w, err := NewWriter(f, tc.Format)
+			require.Nil(t, err)
+			_, err = w.Write(tc.Samples)
+			require.Nil(t, err)
+			require.Nil(t, w.Close())
+
+			_, err = f.Seek(0, io.SeekStart)
+			require.Nil(t, err)
+			b, err := io.ReadAll(f)
+			require.Nil(t, err)
+
+			dataSize := len(tc.Samples)
+			require.Equal(t, tc.HeaderSize+dataSize+dataSize%2, len(b))
+			require.Equal(t, uint32(len(b)-8), binary.LittleEndian.Uint32(b[4:8]))
+			require.Equal(t, uint32(dataSize), binary.LittleEndian.Uint32(b[tc.HeaderSize-4:tc.HeaderSize]))
+
+			r, err := NewReader(bytes.NewReader(b))
+			require.Nil(t, err)
+			require.Equal(t, tc.Format, r.Format())
+			actual, err := io.ReadAll(r)
+			require.Nil(t, err)
+			require.Equal(t, tc.Samples, actual)
+		})
+	}
+}
+
+func TestWriterWithoutSeeker(t *testing.T) {
+	format := &Format{
+		FormatTag:     FormatTagMuLaw,
+		Channels:      1,
+		SampleRate:    8000,
+		BitsPerSample: 8,
+	}
+	samples := []byte{0xff, 0x7f}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	require.Nil(t, err)
+	_, err = w.Write(samples)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	// size is unknown, thus reads until EOF
+	r, err := NewReader(&buf)
+	require.Nil(t, err)
+	require.Equal(t, format, r.Format())
+	actual, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, samples, actual)
+}
+
+func TestReaderErrors(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00AVI ")))
+	require.NotNil(t, err)
+
+	_, err = NewReader(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00WAVEdata\x00\x00\x00\x00")))
+	require.NotNil(t, err)
+
+	_, err = NewWriter(io.Discard, &Format{FormatTag: FormatTagPCM, Channels: 1, SampleRate: 8000, BitsPerSample: 12})
+	require.NotNil(t, err)
+}